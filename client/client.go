@@ -0,0 +1,161 @@
+// Package client talks to a running noc-watch monitor over its control
+// socket, so other tools (info screens, chat bots) can query and steer the
+// monitor without speaking the line protocol by hand.
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a request. The monitor answers between tests, which
+// can take a while during a DHCP renewal.
+const DefaultTimeout = 60 * time.Second
+
+// ErrUnreachable is returned when no monitor listens on the control socket
+var ErrUnreachable = errors.New("monitor not reachable")
+
+// Client sends commands to one monitor's control socket
+type Client struct {
+	Path    string        // Control socket path (CONTROL_SOCKET of the monitor)
+	Timeout time.Duration // Request timeout (DefaultTimeout when zero)
+}
+
+// New returns a client for the control socket at path
+func New(path string) *Client {
+	return &Client{Path: path}
+}
+
+// Do sends a raw command line and returns the response text. Responses
+// starting with "error: " are returned as errors.
+func (c *Client) Do(command string) (string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.DialTimeout("unix", c.Path, 5*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("%w on %s: %v", ErrUnreachable, c.Path, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte(command + "\n")); err != nil {
+		return "", err
+	}
+
+	var response strings.Builder
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		response.WriteString(scanner.Text() + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if text := response.String(); strings.HasPrefix(text, "error: ") {
+		return "", errors.New(strings.TrimSpace(strings.TrimPrefix(text, "error: ")))
+	}
+	return response.String(), nil
+}
+
+// Status returns the status summary as ordered name/value pairs
+// (interface state, p95, fail, DHCP, IPv6, score, ...)
+func (c *Client) Status() ([][2]string, error) {
+	text, err := c.Do("status")
+	if err != nil {
+		return nil, err
+	}
+
+	var fields [][2]string
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if name, value, ok := strings.Cut(line, ": "); ok {
+			fields = append(fields, [2]string{name, value})
+		}
+	}
+	return fields, nil
+}
+
+// StatusLine returns the one-line status, e.g.
+// "wlan0 UP | p95 38ms | loss 0.4% | DHCP 1.2s | IPv6 OK | score 92"
+func (c *Client) StatusLine() (string, error) {
+	text, err := c.Do("status --oneline")
+	return strings.TrimSpace(text), err
+}
+
+// Annotate adds a note to the timeline of the ongoing outage
+func (c *Client) Annotate(text string) error {
+	_, err := c.Do("annotate " + strings.Join(strings.Fields(text), " "))
+	return err
+}
+
+// Pause stops active probing for duration, or until Resume when duration is zero
+func (c *Client) Pause(duration time.Duration) error {
+	command := "pause"
+	if duration > 0 {
+		command += " " + duration.String()
+	}
+	_, err := c.Do(command)
+	return err
+}
+
+// Resume restarts active probing after a pause
+func (c *Client) Resume() error {
+	_, err := c.Do("resume")
+	return err
+}
+
+// Buffer runs a remote-write buffer action: status, flush or drop
+func (c *Client) Buffer(action string) (string, error) {
+	return c.Do("buffer " + action)
+}
+
+// Version returns the version and config hash of the running monitor,
+// e.g. "version=1.4.0 config_hash=643163571397"
+func (c *Client) Version() (string, error) {
+	text, err := c.Do("version")
+	return strings.TrimSpace(text), err
+}
+
+// Debug returns the recent raw probe outputs of source (all sources when empty)
+func (c *Client) Debug(source string) (string, error) {
+	return c.Do(strings.TrimSpace("debug " + source))
+}
+
+// Silences returns the active silences
+func (c *Client) Silences() ([]Silence, error) {
+	text, err := c.Do("silence list")
+	if err != nil {
+		return nil, err
+	}
+	var silences []Silence
+	err = json.Unmarshal([]byte(text), &silences)
+	return silences, err
+}
+
+// AddSilence creates a silence and returns it with its ID
+func (c *Client) AddSilence(req SilenceRequest) (Silence, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return Silence{}, err
+	}
+	text, err := c.Do("silence add " + string(data))
+	if err != nil {
+		return Silence{}, err
+	}
+	var silence Silence
+	err = json.Unmarshal([]byte(text), &silence)
+	return silence, err
+}
+
+// ExpireSilence ends a silence immediately
+func (c *Client) ExpireSilence(id string) error {
+	_, err := c.Do("silence expire " + id)
+	return err
+}
@@ -0,0 +1,310 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// REST queries a monitor's HTTP API (API_LISTEN of the monitor) as
+// described by schemas/openapi.yaml, from another host if the API listens
+// beyond localhost
+type REST struct {
+	BaseURL    string       // Base URL of the API, e.g. https://probe01:9102
+	Token      string       // API_TOKEN of the monitor ("" when unset)
+	HTTPClient *http.Client // Client with the TLS configuration for API_TLS_* (http.DefaultClient when nil)
+}
+
+// NewREST returns a REST client for the API at baseURL
+func NewREST(baseURL, token string) *REST {
+	return &REST{BaseURL: strings.TrimSuffix(baseURL, "/"), Token: token}
+}
+
+// Rate is a success rate with its 95% Wilson interval
+type Rate struct {
+	Successes  int     `json:"successes"`        // Successful samples
+	Total      int     `json:"total"`            // Total samples
+	Percent    float64 `json:"percent"`          // Observed success rate
+	Lower      float64 `json:"ci_lower_percent"` // Lower bound of the 95% Wilson interval
+	Upper      float64 `json:"ci_upper_percent"` // Upper bound of the 95% Wilson interval
+	Sufficient bool    `json:"sufficient"`       // At least MIN_RATE_SAMPLES samples
+}
+
+// Target is the result of one ping target in a test
+type Target struct {
+	Name     string        `json:"name"`               // Target name
+	IPv6     bool          `json:"ipv6,omitempty"`     // Target was pinged over IPv6
+	Success  bool          `json:"success"`            // At least one reply arrived
+	Latency  time.Duration `json:"latency_ns"`         // Average round trip time
+	Min      time.Duration `json:"latency_min_ns"`     // Minimum round trip time
+	Max      time.Duration `json:"latency_max_ns"`     // Maximum round trip time
+	Jitter   time.Duration `json:"jitter_ns"`          // RFC 3550 interarrival jitter
+	Loss     float64       `json:"loss"`               // Packet loss in percent
+	Sent     int           `json:"sent,omitempty"`     // Echo requests sent
+	Received int           `json:"received,omitempty"` // Echo replies received
+	Error    string        `json:"error,omitempty"`    // Failure reason
+}
+
+// Test is one DHCP or connectivity test. Station, lease and gateway
+// details are kept as raw JSON (see schemas/result.schema.json).
+type Test struct {
+	Probe           string          `json:"probe,omitempty"`            // dhcp or ping (only in /api/tests)
+	DHCPRenewTime   time.Duration   `json:"dhcp_renew_time_ns"`         // Time taken for DHCP renewal
+	IPv4            bool            `json:"ipv4"`                       // IPv4 connectivity status
+	IPv6            bool            `json:"ipv6"`                       // IPv6 connectivity status
+	Latency         time.Duration   `json:"latency_ns"`                 // Measured latency
+	MinLatency      time.Duration   `json:"latency_min_ns,omitempty"`   // Minimum round trip time of the burst
+	MaxLatency      time.Duration   `json:"latency_max_ns,omitempty"`   // Maximum round trip time of the burst
+	Jitter          time.Duration   `json:"jitter_ns,omitempty"`        // RFC 3550 interarrival jitter of the burst
+	Loss            float64         `json:"loss,omitempty"`             // Packet loss of the burst in percent
+	Sent            int             `json:"sent,omitempty"`             // Echo requests sent in the burst
+	Received        int             `json:"received,omitempty"`         // Echo replies received in the burst
+	Success         bool            `json:"success"`                    // Overall test success status
+	Timestamp       time.Time       `json:"timestamp"`                  // Test execution timestamp
+	UpstreamFailure bool            `json:"upstream_failure,omitempty"` // Wired reference failed too
+	Disrupted       bool            `json:"disrupted,omitempty"`        // Taken right after the monitor's own DHCP renewal
+	Targets         []Target        `json:"targets,omitempty"`          // Result per ping target
+	Station         json.RawMessage `json:"station,omitempty"`          // WiFi signal, bitrates and retries of the cycle
+	Lease           json.RawMessage `json:"lease,omitempty"`            // Renewed DHCP lease
+	Gateways        json.RawMessage `json:"gateways,omitempty"`         // ARP/NDP reachability of the default gateways
+}
+
+// Status is the response of /api/status
+type Status struct {
+	Agent      string            `json:"agent"`                 // Host name of the agent
+	Workspace  string            `json:"workspace,omitempty"`   // WORKSPACE (event or venue) the agent reports to
+	Location   map[string]string `json:"location,omitempty"`    // AGENT_LOCATION placement (floor, room, x, y, ...)
+	Interface  string            `json:"interface"`             // Monitored WiFi interface
+	Link       string            `json:"link"`                  // UP, DOWN or UNKNOWN
+	State      string            `json:"connectivity"`          // healthy, degraded or down ("" before the first test)
+	Health     float64           `json:"health_score"`          // Success percentage of the last hour
+	Dominant   string            `json:"dominant_failure"`      // Most frequent failure class of the last hour
+	Paused     bool              `json:"paused"`                // Probing paused by an operator
+	Profile    string            `json:"profile"`               // Active probing profile
+	Alerts     []string          `json:"alerts"`                // Firing alerts by name
+	LatestDHCP *Test             `json:"latest_dhcp,omitempty"` // Newest DHCP test
+	LatestPing *Test             `json:"latest_ping,omitempty"` // Newest connectivity test
+	Version    string            `json:"version"`               // noc-watch release
+	ConfigHash string            `json:"config_hash"`           // Hash of the effective configuration
+	Timestamp  time.Time         `json:"timestamp"`             // Time of the response
+}
+
+// Summary is the response of /api/summary
+type Summary struct {
+	Availability float64         `json:"availability_percent"`   // Time-weighted availability
+	Downtime     time.Duration   `json:"downtime_ns"`            // Total outage duration
+	Outages      int             `json:"outages"`                // Number of outages
+	Since        time.Time       `json:"since"`                  // Start of the observation period
+	SuccessRate  *float64        `json:"success_rate_percent"`   // Blended rate, nil with insufficient data
+	Probes       map[string]Rate `json:"probes"`                 // Success rate per probe type
+	Targets      map[string]Rate `json:"targets"`                // Success rate per ping target
+	DHCPRenewP95 float64         `json:"dhcp_renew_p95_seconds"` // p95 of the DHCP renewal histogram
+	DHCPTests    int             `json:"dhcp_tests"`             // DHCP tests in memory
+	PingTests    int             `json:"ping_tests"`             // Connectivity tests in memory
+	Throughput   json.RawMessage `json:"throughput,omitempty"`   // Newest successful throughput test
+	NAT          json.RawMessage `json:"nat,omitempty"`          // Newest NAT behavior discovery
+}
+
+// RawOutput is the unparsed output of one probe command or request, as
+// returned by /api/debug
+type RawOutput struct {
+	Time    time.Time `json:"time"`             // When the command finished
+	Source  string    `json:"source"`           // Producer (ping, dhclient, traceroute, iw, http, ...)
+	Command string    `json:"command"`          // Command line or request URL
+	Stdout  string    `json:"stdout,omitempty"` // Raw standard output, or the HTTP status line and headers
+	Stderr  string    `json:"stderr,omitempty"` // Raw standard error
+	Error   string    `json:"error,omitempty"`  // Exit status or request error ("" on success)
+}
+
+// Silence mutes notifications for alerts matching a label set until it ends
+type Silence struct {
+	ID       string            `json:"id"`       // Short random identifier
+	Matchers map[string]string `json:"matchers"` // Labels that must be equal for the silence to apply
+	Start    time.Time         `json:"start"`    // Creation time
+	End      time.Time         `json:"end"`      // Expiry time
+	Reason   string            `json:"reason"`   // Why the alerts are muted (e.g., incident reference)
+	Author   string            `json:"author"`   // Who created the silence
+}
+
+// SilenceRequest creates a silence
+type SilenceRequest struct {
+	Matchers map[string]string `json:"matchers"`         // Labels that must be equal for the silence to apply
+	For      string            `json:"for"`              // How long the silence lasts (e.g. 2h)
+	Reason   string            `json:"reason"`           // Why the alerts are muted
+	Author   string            `json:"author,omitempty"` // Who creates the silence
+}
+
+// Event is one server-sent event of /api/stream
+type Event struct {
+	Type string          // result or alert
+	Data json.RawMessage // Result line (as in JSON Lines output) or alert payload (as in webhooks)
+}
+
+// request sends an authorized request for the API path, with a JSON body
+// unless body is nil
+func (c *REST) request(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, content)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return nil, fmt.Errorf("%s: %s", path, body.Error)
+		}
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+// get decodes the JSON response of an API path
+func (c *REST) get(ctx context.Context, path string, query url.Values, v any) error {
+	return c.send(ctx, http.MethodGet, path, query, nil, v)
+}
+
+// send sends a request with a JSON body (unless nil) and decodes the JSON
+// response into v (unless nil)
+func (c *REST) send(ctx context.Context, method, path string, query url.Values, body, v any) error {
+	resp, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Status returns the current state of the monitor
+func (c *REST) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.get(ctx, "/api/status", nil, &status)
+	return status, err
+}
+
+// Summary returns the availability and success rates of the monitor
+func (c *REST) Summary(ctx context.Context) (Summary, error) {
+	var summary Summary
+	err := c.get(ctx, "/api/summary", nil, &summary)
+	return summary, err
+}
+
+// Tests returns the tests taken since a duration before now (e.g. 2h) or
+// an RFC 3339 time, limited to one probe (dhcp or ping) unless probe is ""
+func (c *REST) Tests(ctx context.Context, since, probe string) ([]Test, error) {
+	query := url.Values{}
+	if since != "" {
+		query.Set("since", since)
+	}
+	if probe != "" {
+		query.Set("probe", probe)
+	}
+	var tests []Test
+	err := c.get(ctx, "/api/tests", query, &tests)
+	return tests, err
+}
+
+// Debug returns the recent raw probe outputs of the monitor, newest first,
+// limited to one source (ping, dhclient, http, ...) unless source is ""
+func (c *REST) Debug(ctx context.Context, source string) ([]RawOutput, error) {
+	query := url.Values{}
+	if source != "" {
+		query.Set("source", source)
+	}
+	var outputs []RawOutput
+	err := c.get(ctx, "/api/debug", query, &outputs)
+	return outputs, err
+}
+
+// Silences returns the active silences of the monitor
+func (c *REST) Silences(ctx context.Context) ([]Silence, error) {
+	var silences []Silence
+	err := c.get(ctx, "/api/silences", nil, &silences)
+	return silences, err
+}
+
+// AddSilence creates a silence and returns it with its ID
+func (c *REST) AddSilence(ctx context.Context, req SilenceRequest) (Silence, error) {
+	var silence Silence
+	err := c.send(ctx, http.MethodPost, "/api/silences", nil, req, &silence)
+	return silence, err
+}
+
+// ExpireSilence ends a silence immediately
+func (c *REST) ExpireSilence(ctx context.Context, id string) error {
+	return c.send(ctx, http.MethodDelete, "/api/silences/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Stream follows /api/stream and calls handle for every event until the
+// context ends or the monitor closes the stream. probes limits the results
+// to some probe types (all when empty); alerts are always delivered.
+func (c *REST) Stream(ctx context.Context, probes []string, handle func(Event)) error {
+	query := url.Values{}
+	if len(probes) > 0 {
+		query.Set("probe", strings.Join(probes, ","))
+	}
+	resp, err := c.request(ctx, http.MethodGet, "/api/stream", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var event Event
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.Type != "" {
+				handle(event)
+			}
+			event = Event{}
+		case strings.HasPrefix(line, "event: "):
+			event.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/marokiki/noc-watch/schemas"
+	"gopkg.in/yaml.v3"
+)
+
+// dynamicConfigPrefixes are settings whose names are chosen by the user
+// (PROFILE_<NAME>) and therefore not listed in the config schema
+var dynamicConfigPrefixes = []string{"PROFILE_"}
+
+// LoadFile reads the settings of a YAML or TOML config file, named like
+// their environment variables. The environment and explicit values
+// override them.
+func (s *Settings) LoadFile(path string) error {
+	file, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	return nil
+}
+
+// readFile reads and flattens the settings of a config file, refusing
+// settings that are not in the config schema
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	settings := make(map[string]string)
+	if err := flattenConfig("", tree, settings); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known, err := SchemaKeys()
+	if err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for key := range settings {
+		if !known[key] && !IsDynamic(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%s: unknown settings %s (see noc-watch schema config)", path, strings.Join(unknown, ", "))
+	}
+
+	return settings, nil
+}
+
+// flattenConfig turns nested sections into environment variable names:
+// {remote_write: {url: ...}} sets REMOTE_WRITE_URL. Lists become comma
+// separated values.
+func flattenConfig(prefix string, value any, settings map[string]string) error {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			if err := flattenConfig(name, child, settings); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return nil
+	case []any:
+		var items []string
+		for _, item := range v {
+			text, err := configScalar(prefix, item)
+			if err != nil {
+				return err
+			}
+			items = append(items, text)
+		}
+		settings[prefix] = strings.Join(items, ",")
+		return nil
+	default:
+		text, err := configScalar(prefix, v)
+		if err != nil {
+			return err
+		}
+		settings[prefix] = text
+		return nil
+	}
+}
+
+// configScalar formats a single config value the way the environment variable expects it
+func configScalar(key string, value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%s: unsupported value %v (%T)", key, value, value)
+	}
+}
+
+// SchemaKeys returns the setting names of the published config schema
+func SchemaKeys() (map[string]bool, error) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	data, _ := schemas.Files.ReadFile("config.schema.json")
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("embedded config schema is invalid: %v", err)
+	}
+	keys := make(map[string]bool, len(schema.Properties))
+	for key := range schema.Properties {
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// IsDynamic reports whether a setting name is user chosen, like PROFILE_NIGHT
+func IsDynamic(key string) bool {
+	for _, prefix := range dynamicConfigPrefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
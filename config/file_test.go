@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlattenConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		tree    map[string]any
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "top level scalars",
+			tree: map[string]any{"log_file": "/var/log/noc-watch.log", "headless": true, "ping_count": 5, "loss_threshold": 2.5},
+			want: map[string]string{"LOG_FILE": "/var/log/noc-watch.log", "HEADLESS": "true", "PING_COUNT": "5", "LOSS_THRESHOLD": "2.5"},
+		},
+		{
+			name: "nested sections",
+			tree: map[string]any{"remote_write": map[string]any{"url": "https://mimir/api/v1/push", "tls": map[string]any{"ca": "ca.pem"}}},
+			want: map[string]string{"REMOTE_WRITE_URL": "https://mimir/api/v1/push", "REMOTE_WRITE_TLS_CA": "ca.pem"},
+		},
+		{
+			name: "hyphens and case",
+			tree: map[string]any{"Wifi": map[string]any{"Interface-Name": "wlan0"}},
+			want: map[string]string{"WIFI_INTERFACE_NAME": "wlan0"},
+		},
+		{
+			name: "lists become comma separated",
+			tree: map[string]any{"ping_targets": []any{"gateway={{gateway}}", "1.1.1.1"}, "ports": []any{53, int64(443)}},
+			want: map[string]string{"PING_TARGETS": "gateway={{gateway}},1.1.1.1", "PORTS": "53,443"},
+		},
+		{
+			name: "empty list and null",
+			tree: map[string]any{"isp_targets": []any{}, "upstream_target": nil},
+			want: map[string]string{"ISP_TARGETS": ""},
+		},
+		{
+			name:    "section inside a list",
+			tree:    map[string]any{"ping_targets": []any{map[string]any{"name": "gw"}}},
+			wantErr: "PING_TARGETS: unsupported value",
+		},
+		{
+			name:    "nested list",
+			tree:    map[string]any{"profile": map[string]any{"night": []any{[]any{"ping=5m"}}}},
+			wantErr: "PROFILE_NIGHT: unsupported value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := make(map[string]string)
+			err := flattenConfig("", tt.tree, settings)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("flattenConfig: %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.want) {
+				t.Errorf("settings %v, want %v", settings, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "yaml",
+			file:    "noc-watch.yaml",
+			content: "wifi:\n  interface: wlan9\nupstream_target: 192.0.2.1\nprofile:\n  night: [ping=5m, dhcp=30m]\n",
+			want:    map[string]string{"WIFI_INTERFACE": "wlan9", "UPSTREAM_TARGET": "192.0.2.1", "PROFILE_NIGHT": "ping=5m,dhcp=30m"},
+		},
+		{
+			name:    "toml",
+			file:    "noc-watch.toml",
+			content: "upstream_target = \"192.0.2.2\"\n[wifi]\ninterface = \"wlan8\"\n",
+			want:    map[string]string{"WIFI_INTERFACE": "wlan8", "UPSTREAM_TARGET": "192.0.2.2"},
+		},
+		{
+			name:    "unknown key",
+			file:    "noc-watch.yml",
+			content: "wifi:\n  interfase: wlan0\nupstream_targets: 192.0.2.1\n",
+			wantErr: "unknown settings UPSTREAM_TARGETS, WIFI_INTERFASE",
+		},
+		{
+			name:    "bare dynamic prefix",
+			file:    "noc-watch.yaml",
+			content: "profile: night\n",
+			wantErr: "unknown settings PROFILE",
+		},
+		{
+			name:    "unsupported file type",
+			file:    "noc-watch.json",
+			content: "{}",
+			wantErr: "unsupported config file type",
+		},
+		{
+			name:    "invalid yaml",
+			file:    "noc-watch.yaml",
+			content: "wifi: [interface\n",
+			wantErr: "parsing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readFile: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "noc-watch.yaml")
+	content := "upstream_target: 192.0.2.1\nping_interval: 45s\nlog_file: /var/log/file.log\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readFile(path)
+	if err != nil {
+		t.Fatalf("readFile: %v", err)
+	}
+	t.Setenv("UPSTREAM_TARGET", "198.51.100.1")
+	t.Setenv("LOG_FILE", "/var/log/env.log")
+	for _, key := range []string{"PING_INTERVAL", "DHCP_INTERVAL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	s := &Settings{file: file}
+	s.Set("LOG_FILE", "/var/log/flag.log")
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "PING_INTERVAL", want: "45s"},            // Only in the file
+		{key: "UPSTREAM_TARGET", want: "198.51.100.1"}, // The environment overrides the file
+		{key: "LOG_FILE", want: "/var/log/flag.log"},   // Explicit values override both
+		{key: "DHCP_INTERVAL", want: ""},               // Not set anywhere
+	}
+	for _, tt := range tests {
+		if got := s.Get(tt.key); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if os.Getenv("LOG_FILE") != "/var/log/env.log" || os.Getenv("PING_INTERVAL") != "" {
+		t.Error("settings changed the process environment")
+	}
+}
@@ -0,0 +1,119 @@
+// Package config holds the settings of a monitor, named by the environment
+// variables of the config schema (schemas/config.schema.json).
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings is the configuration of one monitor, keyed by the environment
+// variable names of the config schema. Explicit values (command line flags,
+// monitor.Config.Settings) override the process environment, which
+// overrides the config file. Nothing is written back to the environment, so
+// monitors embedded in the same process keep their own settings.
+type Settings struct {
+	values map[string]string // Explicit values
+	file   map[string]string // Values from the config file
+}
+
+// New returns settings with explicit values over the environment
+func New(values map[string]string) *Settings {
+	return &Settings{values: values}
+}
+
+// Lookup returns a setting and whether it is set at all
+func (s *Settings) Lookup(key string) (string, bool) {
+	if v, ok := s.values[key]; ok {
+		return v, true
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := s.file[key]
+	return v, ok
+}
+
+// Get returns a setting, or "" when it is not set
+func (s *Settings) Get(key string) string {
+	v, _ := s.Lookup(key)
+	return v
+}
+
+// Set sets an explicit value, overriding the environment and the config file
+func (s *Settings) Set(key, value string) {
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[key] = value
+}
+
+// Keys returns the names of the explicit and file settings and of every
+// environment variable
+func (s *Settings) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for key := range s.values {
+		add(key)
+	}
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		add(key)
+	}
+	for key := range s.file {
+		add(key)
+	}
+	return keys
+}
+
+// String returns a setting or a default
+func (s *Settings) String(key, def string) string {
+	if v := s.Get(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Duration parses a duration setting (e.g. "30s"), falling back to a default
+func (s *Settings) Duration(key string, def time.Duration) time.Duration {
+	if v := s.Get(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+// Int parses an integer setting, falling back to a default
+func (s *Settings) Int(key string, def int) int {
+	if v := s.Get(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+// List splits a comma separated setting into trimmed, non-empty items
+func (s *Settings) List(key string) []string {
+	return SplitList(s.Get(key))
+}
+
+// SplitList splits a comma separated value, trimming and skipping empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// AlertRule raises an alert when test results match a condition for a
+// number of consecutive tests, e.g. latency above 100ms five times in a row
+type AlertRule struct {
+	Name        string `json:"name"`        // Rule name; the alert is rule_<name>
+	When        string `json:"when"`        // Conditions in the tail filter syntax, e.g. type=ping,latency>100ms
+	Consecutive int    `json:"consecutive"` // Matching tests in a row before firing (default 1)
+	Severity    string `json:"severity"`    // Severity label of the alert (default warning)
+	Message     string `json:"message"`     // Optional text used instead of the conditions
+	Cooldown    string `json:"cooldown"`    // Minimum time between notifications of the alert (default ALERT_COOLDOWN)
+
+	conditions []tailCondition // Parsed When
+	cooldown   time.Duration   // Parsed Cooldown
+	streak     int             // Consecutive matching tests so far
+}
+
+// loadAlertRules reads the result rules from the JSON file in ALERT_RULES
+func loadAlertRules(s *config.Settings) []*AlertRule {
+	path := s.Get("ALERT_RULES")
+	if path == "" {
+		return nil
+	}
+
+	var rules []*AlertRule
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading alert rules: %v\n", err)
+		return nil
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		fmt.Printf("Error parsing alert rules: %v\n", err)
+		return nil
+	}
+
+	valid := rules[:0]
+	for _, rule := range rules {
+		conditions, err := parseTailFilter(rule.When)
+		if err != nil {
+			fmt.Printf("Error parsing alert rule %s: %v\n", rule.Name, err)
+			continue
+		}
+		if rule.Name == "" || len(conditions) == 0 {
+			fmt.Printf("Error parsing alert rule %q: name and when are required\n", rule.Name)
+			continue
+		}
+		if rule.Cooldown != "" {
+			d, err := time.ParseDuration(rule.Cooldown)
+			if err != nil {
+				fmt.Printf("Error parsing alert rule %s: invalid cooldown %q\n", rule.Name, rule.Cooldown)
+				continue
+			}
+			rule.cooldown = d
+		}
+		rule.conditions = conditions
+		rule.Consecutive = max(rule.Consecutive, 1)
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		valid = append(valid, rule)
+	}
+	return valid
+}
+
+// applies reports whether the rule looks at tests of the given kind. Tests
+// excluded by a type condition neither extend nor break the streak.
+func (r *AlertRule) applies(kind string) bool {
+	for _, condition := range r.conditions {
+		if condition.Field == "type" && !condition.matches(kind, WiFiTest{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// alertRuleSeverity returns the severity configured for a rule_ alert, or ""
+// for other alerts
+func (w *WiFiMonitor) alertRuleSeverity(name string) string {
+	for _, rule := range w.alertRules {
+		if "rule_"+rule.Name == name {
+			return rule.Severity
+		}
+	}
+	return ""
+}
+
+// checkAlertRules evaluates every rule against a finished test. A rule fires
+// once its conditions held for the configured number of tests in a row and
+// resolves with the first test they do not hold for. Samples disrupted by
+// the monitor's own DHCP renewal are left out.
+func (w *WiFiMonitor) checkAlertRules(kind string, test WiFiTest) {
+	if !countsTowardsStats(w.settings, test) {
+		return
+	}
+
+	for _, rule := range w.alertRules {
+		if !rule.applies(kind) {
+			continue
+		}
+		matched := true
+		for _, condition := range rule.conditions {
+			matched = matched && condition.matches(kind, test)
+		}
+		if !matched {
+			rule.streak = 0
+			w.setAlert("rule_"+rule.Name, false, fmt.Sprintf("%s no longer holds on %s", rule.When, w.wifiInterface))
+			continue
+		}
+
+		rule.streak++
+		if rule.streak < rule.Consecutive {
+			continue
+		}
+		message := rule.Message
+		if message == "" {
+			message = fmt.Sprintf("%s on %s", rule.When, w.wifiInterface)
+		}
+		if rule.Consecutive > 1 {
+			message += fmt.Sprintf(" (%d consecutive tests)", rule.streak)
+		}
+		w.setAlert("rule_"+rule.Name, true, message)
+	}
+}
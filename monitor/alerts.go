@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxRecentAlerts limits the alert history kept for the UI
+const maxRecentAlerts = 20
+
+// Alert represents a firing or resolved condition detected by a probe
+type Alert struct {
+	Name       string            // Alert identifier (e.g., dns_tcp_blocked)
+	Message    string            // Human readable description
+	Resolved   bool              // True when this record marks recovery
+	Event      bool              // True for one-off events without a firing/resolved state
+	Labels     map[string]string // Routing labels (alertname, severity, component, room, ...)
+	Silenced   string            // ID of the silence that muted the notification, if any
+	Suppressed string            // Why flood control held back the notification (cooldown, maintenance window), if any
+	Runbook    string            // Runbook URL from ALERT_RUNBOOKS
+	Action     string            // Suggested action from ALERT_RUNBOOKS
+	Timeline   []TimelineEntry   // Incident timeline attached to outage_resolved
+	State      string            // Connectivity state entered (connectivity_* events only)
+	Previous   string            // Connectivity state left (connectivity_* events only)
+	Summary    string            // Status line with the recent metrics when the alert was raised
+	Timestamp  time.Time         // Time of the state transition
+}
+
+// setAlert records an alert state transition. Repeated calls with the same
+// state are ignored so only changes are reported.
+func (w *WiFiMonitor) setAlert(name string, firing bool, message string) {
+	if w.activeAlerts[name] == firing {
+		return
+	}
+
+	if firing {
+		w.activeAlerts[name] = true
+	} else {
+		delete(w.activeAlerts, name)
+	}
+
+	w.recordAlert(Alert{
+		Name:      name,
+		Message:   message,
+		Resolved:  !firing,
+		Timestamp: time.Now(),
+	})
+}
+
+// notifyEvent records a one-off event (e.g., a configuration change) that has
+// no resolved state
+func (w *WiFiMonitor) notifyEvent(name, message string) {
+	w.recordAlert(Alert{
+		Name:      name,
+		Message:   message,
+		Event:     true,
+		Timestamp: time.Now(),
+	})
+}
+
+// recordAlert queues an alert record for the log file and the UI and
+// routes it to the configured notifiers
+func (w *WiFiMonitor) recordAlert(alert Alert) {
+	alert.Labels = w.alertLabels(alert.Name)
+	alert.Summary = w.statusLine()
+	if silence := w.silences.match(alert.Labels, alert.Timestamp); silence != nil {
+		alert.Silenced = silence.ID
+	} else {
+		alert.Suppressed = w.suppression(alert, alert.Timestamp)
+	}
+	if runbook := w.runbookFor(alert.Labels); runbook != nil && !alert.Resolved {
+		alert.Runbook, alert.Action = runbook.Runbook, runbook.Action
+	}
+	if w.incident != nil {
+		kind := "alert"
+		if alert.Event {
+			kind = "event"
+		} else if alert.Resolved {
+			kind = "resolved"
+		}
+		w.incident.add(alert.Timestamp, kind, alert.Name+": "+alert.Message)
+	}
+	w.pendingAlerts = append(w.pendingAlerts, alert)
+	w.recentAlerts = append(w.recentAlerts, alert)
+	if len(w.recentAlerts) > maxRecentAlerts {
+		w.recentAlerts = w.recentAlerts[len(w.recentAlerts)-maxRecentAlerts:]
+	}
+
+	if w.headless {
+		fmt.Println(alert.String())
+	}
+	w.publishAlert(alert)
+
+	// Firings held back by flood control are notified later if they last
+	switch {
+	case alert.Silenced != "":
+	case alert.Suppressed != "":
+		if !alert.Event && !alert.Resolved {
+			w.heldAlerts[alert.Name] = alert
+		}
+	default:
+		w.deliver(alert)
+	}
+}
+
+// String formats the alert for logs
+func (a Alert) String() string {
+	state := "ALERT"
+	if a.Event {
+		state = "EVENT"
+	} else if a.Resolved {
+		state = "RESOLVED"
+	}
+	text := fmt.Sprintf("[%s] %s %s: %s", a.Timestamp.Format("2006-01-02 15:04:05"), state, a.Name, a.Message)
+	if a.Silenced != "" {
+		text += " (silenced by " + a.Silenced + ")"
+	}
+	if a.Suppressed != "" {
+		text += " (not notified: " + a.Suppressed + ")"
+	}
+	return text
+}
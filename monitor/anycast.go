@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// AnycastPOP records which point of presence answered for an anycast target
+type AnycastPOP struct {
+	Target    string    // Anycast address (e.g., 8.8.8.8)
+	Hop       string    // Last responding hop before the target
+	Name      string    // Reverse DNS name of that hop, identifying the POP
+	Timestamp time.Time // Time of the traceroute
+}
+
+// POP returns the POP identity: the hop's reverse DNS name, or its address
+func (p AnycastPOP) POP() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Hop
+}
+
+// tracePOP traces to an anycast target and identifies the POP from the
+// traceroute tail, i.e. the last router that answered before the target
+func (w *WiFiMonitor) tracePOP(target string) (AnycastPOP, bool) {
+	pop := AnycastPOP{Target: target, Timestamp: time.Now()}
+
+	hops := w.traceHops(target, 30)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i] != "" && hops[i] != target {
+			pop.Hop = hops[i]
+			break
+		}
+	}
+	if pop.Hop == "" {
+		return pop, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if names, err := net.DefaultResolver.LookupAddr(ctx, pop.Hop); err == nil && len(names) > 0 {
+		pop.Name = strings.TrimSuffix(names[0], ".")
+	}
+	return pop, true
+}
+
+// runAnycastCheck records the answering POP of every ANYCAST_TARGETS entry and
+// flags POP changes, so anycast re-routing is not mistaken for a venue problem.
+// Each target takes a traceroute of up to 30 hops, so the check runs off the
+// monitoring loop.
+func (w *WiFiMonitor) runAnycastCheck() {
+	targets := w.settings.List("ANYCAST_TARGETS")
+	w.runInBackground("anycast", func() func() {
+		var pops []AnycastPOP
+		for _, target := range targets {
+			if pop, ok := w.tracePOP(target); ok {
+				pops = append(pops, pop)
+			}
+		}
+		return func() { w.recordAnycastPOPs(pops) }
+	})
+}
+
+// recordAnycastPOPs keeps the answering POPs and notifies POP changes
+func (w *WiFiMonitor) recordAnycastPOPs(pops []AnycastPOP) {
+	for _, pop := range pops {
+		if prev, seen := w.anycastPOPs[pop.Target]; seen && prev.POP() != pop.POP() {
+			w.notifyEvent("anycast_pop_changed", fmt.Sprintf("%s is now served via %s (was %s); latency shifts may come from anycast re-routing",
+				pop.Target, pop.POP(), prev.POP()))
+		}
+		w.anycastPOPs[pop.Target] = &pop
+	}
+}
+
+// String formats the POP for the log file
+func (p AnycastPOP) String() string {
+	return fmt.Sprintf("%s via %s (%s)", p.Target, p.POP(), p.Hop)
+}
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// Config selects the monitored interface and log file of an embedded
+// monitor. Every other setting is named by its environment variable, as
+// listed by `noc-watch schema config`; settings missing here are read from
+// the process environment.
+type Config struct {
+	Interface string            // WiFi interface under test (default wlan0)
+	LogFile   string            // Log file path (default noc-watch.log)
+	Settings  map[string]string // Further settings by environment variable name
+}
+
+// Monitor is a headless noc-watch monitor embedded in another program
+type Monitor struct {
+	w *WiFiMonitor // Monitor state, owned by the monitoring loop while Run is active
+}
+
+// New creates a headless monitor. Its settings stay with the monitor and
+// leave the process environment alone, so a process can embed several
+// monitors, each with its own interface and log file.
+func New(cfg Config) *Monitor {
+	s := config.New(map[string]string{"HEADLESS": "true"})
+	if cfg.Interface != "" {
+		s.Set("WIFI_INTERFACE", cfg.Interface)
+	}
+	if cfg.LogFile != "" {
+		s.Set("LOG_FILE", cfg.LogFile)
+	}
+	for key, value := range cfg.Settings {
+		s.Set(key, value)
+	}
+	return &Monitor{w: NewWiFiMonitor(s)}
+}
+
+// AddProbe schedules a custom probe every interval. Its results appear in
+// the UI, the log, alerts (probe_failed_NAME) and the exported metrics. Call
+// it before Run.
+func (m *Monitor) AddProbe(p probe.Probe, interval time.Duration) {
+	m.w.addCustomProbe(p, interval)
+}
+
+// Run tests, logs and exports until ctx is canceled, and closes the control
+// socket and the metrics and API listeners before it returns. Unlike the
+// noc-watch command it leaves signal handling to the embedding program.
+func (m *Monitor) Run(ctx context.Context) error {
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.w.stop("context canceled")
+		case <-m.w.stopped:
+		}
+	}()
+	m.w.startMonitoring()
+	return ctx.Err()
+}
+
+// Command runs a control command (status, pause, resume, annotate TEXT, ...)
+// on the running monitor and returns the response, as the control socket does
+func (m *Monitor) Command(command string) string {
+	req := controlRequest{command: command, reply: make(chan string, 1)}
+	select {
+	case m.w.controlRequests <- req:
+		return <-req.reply
+	case <-m.w.stopped:
+		return "error: monitor is not running\n"
+	}
+}
@@ -0,0 +1,272 @@
+package monitor
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// ArchiveHour aggregates the results of one hour for long-term trends
+type ArchiveHour struct {
+	Start        time.Time // Beginning of the hour
+	Tests        int       // DHCP and ping tests run
+	Successes    int       // Successful tests
+	IPv4Up       int       // Tests with IPv4 connectivity
+	LatencyAvgMs float64   // Mean latency of successful ping tests
+	LatencyP95Ms float64   // 95th percentile latency of successful ping tests
+	DHCPTests    int       // DHCP renewal tests run
+	DHCPAvgMs    float64   // Mean renewal time of successful DHCP tests
+	Roams        int       // BSSID changes, to correlate with the latency columns
+	LinkFlaps    int       // Interface up/down and association losses
+}
+
+// Archive summarizes a period of results that is about to expire
+type Archive struct {
+	Interface  string        // Monitored interface
+	Version    string        // noc-watch version that wrote the archive
+	ConfigHash string        // Config hash of the agent
+	From       time.Time     // First expiring result
+	To         time.Time     // Last expiring result
+	Hours      []ArchiveHour // Hourly aggregates in time order
+	Tests      int           // Tests in the period
+	Successes  int           // Successful tests in the period
+}
+
+// archiveDir returns ARCHIVE_DIR, defaulting to an archive directory next to the log
+func archiveDir(s *config.Settings, logFile string) string {
+	return s.String("ARCHIVE_DIR", filepath.Join(filepath.Dir(logFile), "archive"))
+}
+
+// expiredCount returns how many leading tests are older than cutoff; tests are in time order
+func expiredCount(tests []WiFiTest, cutoff time.Time) int {
+	return sort.Search(len(tests), func(i int) bool { return !tests[i].Timestamp.Before(cutoff) })
+}
+
+// runRetention archives results older than RETENTION and drops them from
+// memory and the history database. Nothing is dropped unless both archive
+// files were written.
+func (w *WiFiMonitor) runRetention() {
+	cutoff := time.Now().Add(-w.settings.Duration("RETENTION", 0))
+	dhcp := expiredCount(w.dhcpTests, cutoff)
+	ping := expiredCount(w.pingTests, cutoff)
+	if dhcp == 0 && ping == 0 {
+		return
+	}
+
+	markers := expiredMarkers(w.linkMarkers, cutoff)
+	archive := buildArchive(w.wifiInterface, w.dhcpTests[:dhcp], w.pingTests[:ping], w.linkMarkers[:markers])
+	archive.Version, archive.ConfigHash = version, w.configHash
+	paths, err := archive.write(archiveDir(w.settings, w.logFile))
+	if err != nil {
+		fmt.Printf("Error archiving expired results: %v\n", err)
+		return
+	}
+	fmt.Printf("Archived %d expired results to %s\n", archive.Tests, strings.Join(paths, ", "))
+
+	w.dhcpTests = append([]WiFiTest(nil), w.dhcpTests[dhcp:]...)
+	w.pingTests = append([]WiFiTest(nil), w.pingTests[ping:]...)
+	w.linkMarkers = append([]ChartMarker(nil), w.linkMarkers[markers:]...)
+	if w.history != nil {
+		if _, err := w.history.Prune(cutoff); err != nil {
+			fmt.Printf("Error pruning history database: %v\n", err)
+		}
+	}
+}
+
+// expiredMarkers returns how many leading markers are older than cutoff; markers are in time order
+func expiredMarkers(markers []ChartMarker, cutoff time.Time) int {
+	return sort.Search(len(markers), func(i int) bool { return !markers[i].Time.Before(cutoff) })
+}
+
+// buildArchive aggregates the expiring tests and link event markers per hour
+func buildArchive(iface string, dhcpTests, pingTests []WiFiTest, markers []ChartMarker) Archive {
+	archive := Archive{Interface: iface}
+	hours := make(map[time.Time]*ArchiveHour)
+	latencies := make(map[time.Time][]float64)
+	dhcpTimes := make(map[time.Time][]float64)
+
+	for _, tests := range [][]WiFiTest{dhcpTests, pingTests} {
+		for _, test := range tests {
+			start := test.Timestamp.Truncate(time.Hour)
+			hour, ok := hours[start]
+			if !ok {
+				hour = &ArchiveHour{Start: start}
+				hours[start] = hour
+			}
+
+			hour.Tests++
+			archive.Tests++
+			if test.Success {
+				hour.Successes++
+				archive.Successes++
+			}
+			if test.IPv4Connectivity {
+				hour.IPv4Up++
+			}
+			if archive.From.IsZero() || test.Timestamp.Before(archive.From) {
+				archive.From = test.Timestamp
+			}
+			if test.Timestamp.After(archive.To) {
+				archive.To = test.Timestamp
+			}
+		}
+	}
+
+	// Latency comes from ping tests, renewal time from DHCP tests
+	for _, test := range pingTests {
+		if test.Success && test.Latency > 0 {
+			start := test.Timestamp.Truncate(time.Hour)
+			latencies[start] = append(latencies[start], float64(test.Latency)/float64(time.Millisecond))
+		}
+	}
+	for _, test := range dhcpTests {
+		start := test.Timestamp.Truncate(time.Hour)
+		hours[start].DHCPTests++
+		if test.Success {
+			dhcpTimes[start] = append(dhcpTimes[start], float64(test.DHCPRenewTime)/float64(time.Millisecond))
+		}
+	}
+
+	// Events only count towards hours that have tests to correlate them with
+	for _, marker := range markers {
+		hour, ok := hours[marker.Time.Truncate(time.Hour)]
+		if !ok {
+			continue
+		}
+		switch marker.Kind {
+		case "roam":
+			hour.Roams++
+		case "flap":
+			hour.LinkFlaps++
+		}
+	}
+
+	for start, hour := range hours {
+		if values := latencies[start]; len(values) > 0 {
+			sort.Float64s(values)
+			hour.LatencyAvgMs = mean(values)
+			hour.LatencyP95Ms = values[(len(values)*95-1)/100]
+		}
+		if values := dhcpTimes[start]; len(values) > 0 {
+			hour.DHCPAvgMs = mean(values)
+		}
+		archive.Hours = append(archive.Hours, *hour)
+	}
+	sort.Slice(archive.Hours, func(i, j int) bool { return archive.Hours[i].Start.Before(archive.Hours[j].Start) })
+
+	return archive
+}
+
+// mean returns the average of values
+func mean(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// SuccessRate returns the percentage of successful tests in the period
+func (a Archive) SuccessRate() float64 {
+	if a.Tests == 0 {
+		return 0
+	}
+	return float64(a.Successes) / float64(a.Tests) * 100
+}
+
+// write stores the archive as an HTML report and a Parquet table of the
+// hourly aggregates, named after the archived period
+func (a Archive) write(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(dir, fmt.Sprintf("noc-watch-%s-%s-%s", a.Interface,
+		a.From.Format("20060102T1504"), a.To.Format("20060102T1504")))
+
+	var report strings.Builder
+	if err := archiveTemplate.Execute(&report, a); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(base+".html", []byte(report.String()), 0644); err != nil {
+		return nil, err
+	}
+
+	table, err := storage.EncodeParquet(a.columns())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(base+".parquet", table, 0644); err != nil {
+		return nil, err
+	}
+
+	return []string{base + ".html", base + ".parquet"}, nil
+}
+
+// columns lays out the hourly aggregates as Parquet columns
+func (a Archive) columns() []storage.ParquetColumn {
+	columns := []storage.ParquetColumn{
+		{Name: "hour", Times: []time.Time{}},
+		{Name: "interface", Strings: []string{}},
+		{Name: "tests", Int64s: []int64{}},
+		{Name: "successes", Int64s: []int64{}},
+		{Name: "ipv4_up", Int64s: []int64{}},
+		{Name: "latency_avg_ms", Doubles: []float64{}},
+		{Name: "latency_p95_ms", Doubles: []float64{}},
+		{Name: "dhcp_tests", Int64s: []int64{}},
+		{Name: "dhcp_avg_ms", Doubles: []float64{}},
+		{Name: "roams", Int64s: []int64{}},
+		{Name: "link_flaps", Int64s: []int64{}},
+		{Name: "version", Strings: []string{}},
+		{Name: "config_hash", Strings: []string{}},
+	}
+	for _, hour := range a.Hours {
+		columns[0].Times = append(columns[0].Times, hour.Start)
+		columns[1].Strings = append(columns[1].Strings, a.Interface)
+		columns[2].Int64s = append(columns[2].Int64s, int64(hour.Tests))
+		columns[3].Int64s = append(columns[3].Int64s, int64(hour.Successes))
+		columns[4].Int64s = append(columns[4].Int64s, int64(hour.IPv4Up))
+		columns[5].Doubles = append(columns[5].Doubles, hour.LatencyAvgMs)
+		columns[6].Doubles = append(columns[6].Doubles, hour.LatencyP95Ms)
+		columns[7].Int64s = append(columns[7].Int64s, int64(hour.DHCPTests))
+		columns[8].Doubles = append(columns[8].Doubles, hour.DHCPAvgMs)
+		columns[9].Int64s = append(columns[9].Int64s, int64(hour.Roams))
+		columns[10].Int64s = append(columns[10].Int64s, int64(hour.LinkFlaps))
+		columns[11].Strings = append(columns[11].Strings, a.Version)
+		columns[12].Strings = append(columns[12].Strings, a.ConfigHash)
+	}
+	return columns
+}
+
+// archiveTemplate renders the human readable archive report
+var archiveTemplate = template.Must(template.New("archive").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>noc-watch {{.Interface}} {{.From.Format "2006-01-02 15:04"}} - {{.To.Format "2006-01-02 15:04"}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: right; }
+</style>
+</head>
+<body>
+<h1>noc-watch archive: {{.Interface}}</h1>
+<p>{{.From.Format "2006-01-02 15:04:05"}} - {{.To.Format "2006-01-02 15:04:05"}}</p>
+<p>Tests: {{.Tests}}, Success Rate: {{printf "%.2f" .SuccessRate}}%</p>
+<p>noc-watch {{.Version}}, config {{.ConfigHash}}</p>
+<table>
+<tr><th>Hour</th><th>Tests</th><th>Success</th><th>IPv4 Up</th><th>Latency avg (ms)</th><th>Latency p95 (ms)</th><th>DHCP tests</th><th>DHCP avg (ms)</th><th>Roams</th><th>Link flaps</th></tr>
+{{- range .Hours}}
+<tr><td>{{.Start.Format "2006-01-02 15:00"}}</td><td>{{.Tests}}</td><td>{{.Successes}}</td><td>{{.IPv4Up}}</td><td>{{printf "%.1f" .LatencyAvgMs}}</td><td>{{printf "%.1f" .LatencyP95Ms}}</td><td>{{.DHCPTests}}</td><td>{{printf "%.0f" .DHCPAvgMs}}</td><td>{{.Roams}}</td><td>{{.LinkFlaps}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Outage is a period during which connectivity tests failed
+type Outage struct {
+	Start    time.Time       // Time of the first failing test
+	End      time.Time       // Time of the first successful test afterwards (zero while ongoing)
+	Timeline []TimelineEntry // Assembled incident timeline, set when the outage resolves
+}
+
+// Duration returns the outage length, counting ongoing outages up to now
+func (o Outage) Duration(now time.Time) time.Duration {
+	if o.End.IsZero() {
+		return now.Sub(o.Start)
+	}
+	return o.End.Sub(o.Start)
+}
+
+// availabilityTracker derives time-weighted availability from connectivity observations
+type availabilityTracker struct {
+	start   time.Time // Start of the observation period
+	outages []Outage  // Outages in chronological order
+}
+
+// newAvailabilityTracker starts tracking availability now
+func newAvailabilityTracker() availabilityTracker {
+	return availabilityTracker{start: time.Now()}
+}
+
+// mark records a connectivity observation and opens or closes outages
+func (a *availabilityTracker) mark(timestamp time.Time, up bool) {
+	ongoing := len(a.outages) > 0 && a.outages[len(a.outages)-1].End.IsZero()
+
+	switch {
+	case !up && !ongoing:
+		a.outages = append(a.outages, Outage{Start: timestamp})
+	case up && ongoing:
+		a.outages[len(a.outages)-1].End = timestamp
+	}
+}
+
+// percent returns the time-weighted availability in percent and the total downtime
+func (a *availabilityTracker) percent(now time.Time) (float64, time.Duration) {
+	observed := now.Sub(a.start)
+	if observed <= 0 {
+		return 100, 0
+	}
+
+	var downtime time.Duration
+	for _, o := range a.outages {
+		downtime += o.Duration(now)
+	}
+
+	return (1 - float64(downtime)/float64(observed)) * 100, downtime
+}
+
+// String formats the headline availability
+func (a *availabilityTracker) String() string {
+	percent, downtime := a.percent(time.Now())
+	return fmt.Sprintf("%.3f%% (%d outages, %v down)", percent, len(a.outages), downtime.Round(time.Second))
+}
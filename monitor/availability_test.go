@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityPercent(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	type mark struct {
+		minute int
+		up     bool
+	}
+	tests := []struct {
+		name         string
+		marks        []mark
+		now          int
+		want         float64
+		wantDowntime time.Duration
+		wantOutages  int
+	}{
+		{name: "nothing observed yet", now: 0, want: 100},
+		{name: "always up", marks: []mark{{1, true}, {2, true}}, now: 100, want: 100},
+		{name: "one outage", marks: []mark{{10, false}, {20, true}}, now: 100, want: 90, wantDowntime: 10 * time.Minute, wantOutages: 1},
+		{
+			name:         "failures within an outage do not restart it",
+			marks:        []mark{{10, false}, {12, false}, {15, false}, {20, true}, {21, true}},
+			now:          100,
+			want:         90,
+			wantDowntime: 10 * time.Minute,
+			wantOutages:  1,
+		},
+		{
+			name:         "two outages",
+			marks:        []mark{{10, false}, {15, true}, {50, false}, {70, true}},
+			now:          100,
+			want:         75,
+			wantDowntime: 25 * time.Minute,
+			wantOutages:  2,
+		},
+		{name: "ongoing outage counts up to now", marks: []mark{{60, false}}, now: 80, want: 75, wantDowntime: 20 * time.Minute, wantOutages: 1},
+		{name: "down from the start", marks: []mark{{0, false}}, now: 30, want: 0, wantDowntime: 30 * time.Minute, wantOutages: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := availabilityTracker{start: start}
+			for _, m := range tt.marks {
+				a.mark(at(m.minute), m.up)
+			}
+			got, downtime := a.percent(at(tt.now))
+			if math.Abs(got-tt.want) > 1e-9 || downtime != tt.wantDowntime {
+				t.Errorf("percent() = %.3f%%, %v, want %.3f%%, %v", got, downtime, tt.want, tt.wantDowntime)
+			}
+			if len(a.outages) != tt.wantOutages {
+				t.Errorf("%d outages, want %d", len(a.outages), tt.wantOutages)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxBudgetHistory limits the number of budget cycles kept in memory
+const maxBudgetHistory = 60
+
+// SegmentShare is the latency/loss consumed by one network segment
+type SegmentShare struct {
+	Name    string        // Segment name (access, distribution, upstream)
+	Target  string        // Probe target at the far end of the segment
+	Latency time.Duration // Latency added by this segment
+	Loss    float64       // Loss added by this segment in percent
+}
+
+// SegmentBudget attributes the end-to-end latency and loss of one cycle to segments
+type SegmentBudget struct {
+	Segments  []SegmentShare // Per-segment shares, nearest first
+	Total     time.Duration  // End-to-end latency
+	TotalLoss float64        // End-to-end loss in percent
+	Timestamp time.Time      // Cycle time
+}
+
+// hopSegmentNames names the segments ending at the discovered hops
+var hopSegmentNames = []string{"access", "distribution", "core"}
+
+// budgetTargets returns the segment boundaries: the gateway (or first hop),
+// the configured distribution target or discovered intermediate hops, and the upstream target
+func (w *WiFiMonitor) budgetTargets() [][2]string {
+	var targets [][2]string
+
+	if distribution := w.probeTarget("DISTRIBUTION_TARGET", ""); distribution != "" || len(w.pathHops) == 0 {
+		if gateway := probe.DefaultGateway(w.wifiInterface); gateway != "" {
+			targets = append(targets, [2]string{"access", gateway})
+		}
+		if distribution != "" {
+			targets = append(targets, [2]string{"distribution", distribution})
+		}
+	} else {
+		for i, hop := range w.pathHops {
+			if hop != "" && i < len(hopSegmentNames) {
+				targets = append(targets, [2]string{hopSegmentNames[i], hop})
+			}
+		}
+	}
+
+	if upstream := w.probeTarget("UPSTREAM_TARGET", "8.8.8.8"); upstream != "" {
+		targets = append(targets, [2]string{"upstream", upstream})
+	}
+	return targets
+}
+
+// runBudgetAttribution probes each segment boundary and attributes the
+// incremental latency and loss to the segment in front of it
+func (w *WiFiMonitor) runBudgetAttribution() {
+	budget := SegmentBudget{Timestamp: time.Now()}
+
+	var prevLatency time.Duration
+	var prevLoss float64
+	for _, target := range w.budgetTargets() {
+		stats := w.pingTarget(target[1], 5)
+
+		share := SegmentShare{Name: target[0], Target: target[1]}
+		if stats.Avg > prevLatency {
+			share.Latency = stats.Avg - prevLatency
+		}
+		if stats.Loss > prevLoss {
+			share.Loss = stats.Loss - prevLoss
+		}
+		budget.Segments = append(budget.Segments, share)
+
+		// Cumulative values only grow along the path
+		if stats.Avg > prevLatency {
+			prevLatency = stats.Avg
+		}
+		prevLoss = math.Max(prevLoss, stats.Loss)
+	}
+	budget.Total = prevLatency
+	budget.TotalLoss = prevLoss
+
+	w.budgets = append(w.budgets, budget)
+	if len(w.budgets) > maxBudgetHistory {
+		w.budgets = w.budgets[len(w.budgets)-maxBudgetHistory:]
+	}
+}
+
+// segmentColors are the tview colors used for stacked bar segments
+var segmentColors = map[string]string{
+	"access":       "green",
+	"distribution": "blue",
+	"core":         "aqua",
+	"upstream":     "fuchsia",
+}
+
+// budgetChartText renders the latest cycles as stacked latency bars
+func (w *WiFiMonitor) budgetChartText(width int) string {
+	if len(w.budgets) == 0 {
+		return ""
+	}
+
+	recent := w.budgets
+	if len(recent) > 10 {
+		recent = recent[len(recent)-10:]
+	}
+
+	var max time.Duration
+	for _, b := range recent {
+		if b.Total > max {
+			max = b.Total
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	text := "\n[yellow]Latency Budget ([green]access[yellow]/[blue]distribution[yellow]/[aqua]core[yellow]/[fuchsia]upstream[yellow]):[white]\n"
+	for _, b := range recent {
+		bar := ""
+		for _, s := range b.Segments {
+			n := int(float64(width) * float64(s.Latency) / float64(max))
+			bar += fmt.Sprintf("[%s]%s", segmentColors[s.Name], strings.Repeat("█", n))
+		}
+		text += fmt.Sprintf("  %s %s[white] %v loss %.0f%%\n",
+			b.Timestamp.Format("15:04"), bar, b.Total.Round(100*time.Microsecond), b.TotalLoss)
+	}
+	return text
+}
+
+// budgetSummary averages the per-segment shares over the kept history for reports
+func (w *WiFiMonitor) budgetSummary() string {
+	if len(w.budgets) == 0 {
+		return ""
+	}
+
+	type acc struct {
+		latency time.Duration
+		loss    float64
+		n       int
+	}
+	var order []string
+	sums := make(map[string]*acc)
+	var total time.Duration
+	for _, b := range w.budgets {
+		total += b.Total
+		for _, s := range b.Segments {
+			a, ok := sums[s.Name]
+			if !ok {
+				a = &acc{}
+				sums[s.Name] = a
+				order = append(order, s.Name)
+			}
+			a.latency += s.Latency
+			a.loss += s.Loss
+			a.n++
+		}
+	}
+
+	var parts []string
+	for _, name := range order {
+		a := sums[name]
+		share := 0.0
+		if total > 0 {
+			share = float64(a.latency) / float64(total) * 100
+		}
+		parts = append(parts, fmt.Sprintf("%s %v (%.0f%%) loss %.1f%%",
+			name, (a.latency/time.Duration(a.n)).Round(100*time.Microsecond), share, a.loss/float64(a.n)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// bufferStatus describes the series waiting for the remote-write endpoint
+func (r *RemoteWriter) bufferStatus() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Endpoint: %s\n", r.url)
+	fmt.Fprintf(&text, "Buffered: %d series (limit %d)\n", len(r.buffer), r.maxBuffered)
+	if r.expired > 0 {
+		fmt.Fprintf(&text, "Expired: %d series older than %v dropped\n", r.expired, r.maxAge)
+	}
+
+	if len(r.buffer) > 0 {
+		oldest, newest := r.buffer[0].timestamp, r.buffer[0].timestamp
+		for _, s := range r.buffer {
+			if s.timestamp.Before(oldest) {
+				oldest = s.timestamp
+			}
+			if s.timestamp.After(newest) {
+				newest = s.timestamp
+			}
+		}
+		fmt.Fprintf(&text, "Oldest: %s (%v ago)\n", oldest.Format("2006-01-02 15:04:05"), time.Since(oldest).Round(time.Second))
+		fmt.Fprintf(&text, "Newest: %s\n", newest.Format("2006-01-02 15:04:05"))
+	}
+
+	if r.lastFlush.IsZero() {
+		text.WriteString("Last Flush: never\n")
+	} else {
+		fmt.Fprintf(&text, "Last Flush: %s (%d series, %d bytes, %v)\n", r.lastFlush.Format("2006-01-02 15:04:05"),
+			r.lastBatch, r.lastBytes, r.lastLatency.Round(time.Millisecond))
+	}
+	if r.lastError != "" {
+		fmt.Fprintf(&text, "Last Error: %s\n", r.lastError)
+	}
+	return text.String()
+}
+
+// handleBufferCommand inspects, flushes or discards the remote-write buffer
+// on behalf of `noc-watch buffer`
+func (w *WiFiMonitor) handleBufferCommand(action string) string {
+	r := w.remoteWriter
+	if r == nil {
+		return "error: remote write is not configured\n"
+	}
+
+	switch action {
+	case "status":
+		return r.bufferStatus()
+	case "flush":
+		buffered := len(r.buffer)
+		if err := r.flush(); err != nil {
+			return fmt.Sprintf("error: flush failed with %d of %d series still buffered: %v\n", len(r.buffer), buffered, err)
+		}
+		return fmt.Sprintf("flushed %d series\n", buffered)
+	case "drop":
+		dropped := len(r.buffer)
+		r.buffer = nil
+		fmt.Printf("Remote write: %d buffered series dropped by operator\n", dropped)
+		return fmt.Sprintf("dropped %d series\n", dropped)
+	default:
+		return fmt.Sprintf("error: unknown buffer action %q (status, flush, drop)\n", action)
+	}
+}
+
+// runBufferCommand implements `noc-watch buffer status|flush|drop` against the
+// running monitor, for when a remote sink misbehaves mid-event
+func runBufferCommand(s *config.Settings, args []string) int {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "flush" && args[0] != "drop") {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch buffer status|flush|drop")
+		return exitUsage
+	}
+
+	response, err := sendControl(s, "buffer "+args[0])
+	if err != nil {
+		fmt.Printf("Error running buffer %s: %v\n", args[0], err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// coreLabels identify a series' source (or, for le, a histogram bucket, and
+// for version and config_hash, the build info) and are never dropped by guardrails
+var coreLabels = map[string]bool{"__name__": true, "instance": true, "job": true, "le": true, "version": true, "config_hash": true}
+
+// cardinalityLimits keeps exported series counts bounded on large fleets
+type cardinalityLimits struct {
+	allow        map[string]bool // Extra labels allowed besides the core labels (nil allows all)
+	maxPerMetric int             // Series per metric name before it is aggregated (0 disables)
+}
+
+// cardinalityLimitsFromEnv reads REMOTE_WRITE_LABEL_ALLOWLIST and REMOTE_WRITE_MAX_SERIES_PER_METRIC
+func cardinalityLimitsFromEnv(s *config.Settings) cardinalityLimits {
+	limits := cardinalityLimits{maxPerMetric: s.Int("REMOTE_WRITE_MAX_SERIES_PER_METRIC", 100)}
+	if allow := s.List("REMOTE_WRITE_LABEL_ALLOWLIST"); len(allow) > 0 {
+		limits.allow = make(map[string]bool)
+		for _, label := range allow {
+			limits.allow[label] = true
+		}
+	}
+	return limits
+}
+
+// apply drops labels outside the allow-list and aggregates metrics with too
+// many series into one series per metric. Series that collide after dropping
+// labels are averaged. It returns the names of aggregated metrics.
+func (l cardinalityLimits) apply(series []remoteSeries) ([]remoteSeries, []string) {
+	// Drop labels that are not allowed
+	if l.allow != nil {
+		for i := range series {
+			labels := make(map[string]string)
+			for name, value := range series[i].labels {
+				if coreLabels[name] || l.allow[name] {
+					labels[name] = value
+				}
+			}
+			series[i].labels = labels
+		}
+	}
+
+	// Aggregation fallback: keep only the core labels of oversized metrics
+	var aggregated []string
+	if l.maxPerMetric > 0 {
+		counts := make(map[string]int)
+		for _, s := range series {
+			counts[s.labels["__name__"]]++
+		}
+		for name, count := range counts {
+			if count > l.maxPerMetric {
+				aggregated = append(aggregated, name)
+			}
+		}
+		sort.Strings(aggregated)
+
+		for i := range series {
+			name := series[i].labels["__name__"]
+			if counts[name] <= l.maxPerMetric {
+				continue
+			}
+			labels := make(map[string]string)
+			for label := range coreLabels {
+				if value, ok := series[i].labels[label]; ok {
+					labels[label] = value
+				}
+			}
+			series[i].labels = labels
+		}
+	}
+
+	return mergeSeries(series), aggregated
+}
+
+// mergeSeries averages series with identical label sets, keeping the latest timestamp
+func mergeSeries(series []remoteSeries) []remoteSeries {
+	index := make(map[string]int)
+	counts := make(map[string]int)
+	var merged []remoteSeries
+
+	for _, s := range series {
+		key := seriesKey(s.labels)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			counts[key] = 1
+			merged = append(merged, s)
+			continue
+		}
+
+		counts[key]++
+		m := &merged[i]
+		m.value += (s.value - m.value) / float64(counts[key])
+		if s.timestamp.After(m.timestamp) {
+			m.timestamp = s.timestamp
+		}
+	}
+	return merged
+}
+
+// seriesKey returns a canonical string for a label set
+func seriesKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name)
+		key.WriteByte(0)
+		key.WriteString(labels[name])
+		key.WriteByte(0)
+	}
+	return key.String()
+}
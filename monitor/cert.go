@@ -0,0 +1,196 @@
+package monitor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// runCertCommand implements `noc-watch cert issue` and `noc-watch cert signing-key`
+func runCertCommand(args []string) int {
+	if len(args) > 0 && args[0] == "signing-key" {
+		return runSigningKeyCommand(args[1:])
+	}
+	if len(args) == 0 || args[0] != "issue" {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch cert issue [--dir DIR] [--name NAME] [--server] [--hosts h1,h2] [--days N]")
+		fmt.Fprintln(os.Stderr, "       noc-watch cert signing-key [--out FILE]")
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet("cert issue", flag.ContinueOnError)
+	dir := fs.String("dir", "certs", "directory holding ca.pem and issued certificates")
+	hostname, _ := os.Hostname()
+	name := fs.String("name", hostname, "certificate common name and file prefix")
+	server := fs.Bool("server", false, "issue a server certificate (collector) instead of a client certificate (agent)")
+	hosts := fs.String("hosts", "", "comma separated DNS names or IPs for server certificates")
+	days := fs.Int("days", 825, "certificate validity in days")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		fmt.Printf("Error creating certificate directory: %v\n", err)
+		return exitError
+	}
+
+	ca, caKey, err := loadOrCreateCA(*dir)
+	if err != nil {
+		fmt.Printf("Error loading CA: %v\n", err)
+		return exitError
+	}
+
+	cert, err := issueCertificate(*dir, *name, *server, config.SplitList(*hosts), *days, ca, caKey)
+	if err != nil {
+		fmt.Printf("Error issuing certificate: %v\n", err)
+		return exitError
+	}
+
+	fmt.Printf("certificate: %s\n", filepath.Join(*dir, *name+".pem"))
+	fmt.Printf("key:         %s\n", filepath.Join(*dir, *name+"-key.pem"))
+	fmt.Printf("ca:          %s\n", filepath.Join(*dir, "ca.pem"))
+	fmt.Printf("pin:         %s\n", certificatePin(cert))
+	fmt.Printf("ca pin:      %s\n", certificatePin(ca))
+	return exitOK
+}
+
+// runSigningKeyCommand creates the Ed25519 key used to sign log blocks
+func runSigningKeyCommand(args []string) int {
+	fs := flag.NewFlagSet("cert signing-key", flag.ContinueOnError)
+	out := fs.String("out", "signing-key.pem", "private key file (the public key is written to FILE.pub)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	// Never overwrite an existing key: earlier signatures depend on it
+	if _, err := os.Stat(*out); err == nil {
+		fmt.Printf("%s already exists\n", *out)
+		return exitOK
+	}
+	if err := storage.GenerateSigningKey(*out); err != nil {
+		fmt.Printf("Error generating signing key: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("private key: %s\npublic key:  %s.pub\n", *out, *out)
+	return exitOK
+}
+
+// loadOrCreateCA loads ca.pem/ca-key.pem from dir, creating a new CA on first use
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca-key.pem")
+
+	if certPEM, err := os.ReadFile(certPath); err == nil {
+		keyPEM, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		certBlock, _ := pem.Decode(certPEM)
+		keyBlock, _ := pem.Decode(keyPEM)
+		if certBlock == nil || keyBlock == nil {
+			return nil, nil, errors.New("invalid CA PEM files")
+		}
+		cert, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "noc-watch CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// issueCertificate creates a key pair signed by the CA and writes NAME.pem/NAME-key.pem
+func issueCertificate(dir, name string, server bool, hosts []string, days int, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, days),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		if len(hosts) == 0 {
+			hosts = []string{name}
+		}
+		for _, host := range hosts {
+			if ip := net.ParseIP(host); ip != nil {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			} else {
+				template.DNSNames = append(template.DNSNames, host)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeKeyPair(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"), der, key); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// writeKeyPair writes a certificate and its private key as PEM files
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// discordMaxContent is the message length limit of Discord webhooks
+const discordMaxContent = 2000
+
+// chatTargets returns the chat notifiers that receive every alert:
+// SLACK_WEBHOOK_URL, DISCORD_WEBHOOK_URL and the Telegram bot selected by
+// TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID
+func chatTargets(s *config.Settings) []string {
+	var targets []string
+	for _, key := range []string{"SLACK_WEBHOOK_URL", "DISCORD_WEBHOOK_URL"} {
+		if target := s.Get(key); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	token, chat := s.Get("TELEGRAM_BOT_TOKEN"), s.Get("TELEGRAM_CHAT_ID")
+	if token != "" && chat != "" {
+		targets = append(targets, "https://api.telegram.org/bot"+token+"/sendMessage?chat_id="+url.QueryEscape(chat))
+	} else if token != "" || chat != "" {
+		fmt.Println("Error configuring Telegram notifications: TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID are both required")
+	}
+	return targets
+}
+
+// chatKind recognizes Slack, Discord and Telegram targets by their URL, so
+// routes in ALERT_ROUTES can point at chats too. Other URLs get the JSON
+// alert payload.
+func chatKind(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case u.Host == "hooks.slack.com":
+		return "slack"
+	case (u.Host == "discord.com" || u.Host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return "discord"
+	case u.Host == "api.telegram.org" && strings.HasSuffix(u.Path, "/sendMessage"):
+		return "telegram"
+	}
+	return ""
+}
+
+// targetName identifies a notification target in error messages without
+// revealing the secret parts of its URL
+func targetName(target string) string {
+	if kind := chatKind(target); kind != "" {
+		return kind
+	}
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "webhook"
+}
+
+// chatText formats an alert as a short chat message: state, name and
+// severity, the message, the recent metrics and the runbook
+func chatText(p alertPayload, bold func(string) string) string {
+	state := map[string]string{"firing": "ALERT", "resolved": "RESOLVED", "event": "EVENT"}[p.Status]
+	if p.State != "" {
+		state = strings.ToUpper(p.State)
+	}
+	lines := []string{
+		bold(fmt.Sprintf("[%s] %s", state, p.Name)) + fmt.Sprintf(" (%s, %s)", p.Labels["severity"], p.Labels["interface"]),
+		p.Message,
+	}
+	if p.Summary != "" {
+		lines = append(lines, p.Summary)
+	}
+	if p.Action != "" {
+		lines = append(lines, "Action: "+p.Action)
+	}
+	if p.Runbook != "" {
+		lines = append(lines, "Runbook: "+p.Runbook)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// chatBody encodes an alert in the request format of a chat service
+func chatBody(kind, target string, p alertPayload) ([]byte, error) {
+	switch kind {
+	case "slack":
+		return json.Marshal(map[string]string{"text": chatText(p, func(s string) string { return "*" + s + "*" })})
+	case "discord":
+		text := chatText(p, func(s string) string { return "**" + s + "**" })
+		if len(text) > discordMaxContent {
+			text = strings.ToValidUTF8(text[:discordMaxContent-3], "") + "..."
+		}
+		return json.Marshal(map[string]string{"content": text})
+	default:
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]any{
+			"chat_id":                  u.Query().Get("chat_id"),
+			"text":                     chatText(p, func(s string) string { return s }),
+			"disable_web_page_preview": true,
+		})
+	}
+}
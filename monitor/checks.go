@@ -0,0 +1,70 @@
+package monitor
+
+import "time"
+
+// periodicCheck is an auxiliary probe run on its own interval by the monitoring loop
+type periodicCheck struct {
+	name     string        // Check name for diagnostics
+	interval time.Duration // Time between runs
+	next     time.Time     // Next scheduled run
+	run      func()        // Check implementation
+	active   bool          // Sends probe traffic, so it is skipped while probing is paused
+}
+
+// addCheck registers an auxiliary check. The first run happens after one interval,
+// matching the behaviour of the built-in DHCP and ping tickers.
+func (w *WiFiMonitor) addCheck(name string, interval time.Duration, run func()) {
+	w.checks = append(w.checks, &periodicCheck{
+		name:     name,
+		interval: interval,
+		next:     time.Now().Add(interval),
+		run:      run,
+	})
+}
+
+// addProbe registers an auxiliary check that sends probe traffic. Unlike
+// passive checks it does not run while probing is paused.
+func (w *WiFiMonitor) addProbe(name string, interval time.Duration, run func()) {
+	w.addCheck(name, interval, run)
+	w.checks[len(w.checks)-1].active = true
+}
+
+// runDueChecks executes every check whose schedule has elapsed. Probes that
+// fall due during a pause run as soon as probing resumes; in low-power mode
+// they wait for the next batch.
+func (w *WiFiMonitor) runDueChecks(now time.Time) bool {
+	ran := false
+	for _, c := range w.checks {
+		if now.Before(c.next) || (c.active && w.pause != nil) || w.deferred(c) {
+			continue
+		}
+		c.run()
+		c.next = time.Now().Add(w.stretched(time.Duration(float64(c.interval) * w.profile.CheckScale)))
+		ran = true
+	}
+	return ran
+}
+
+// runInBackground runs a measurement that takes long enough to hold up
+// scrapes, API queries and control commands (an iperf3 run, a traceroute)
+// on its own goroutine. The function the measurement returns records its
+// result back on the monitoring loop. A measurement is not started again
+// while the last one of the same name is still running.
+func (w *WiFiMonitor) runInBackground(name string, measure func() func()) {
+	if w.backgroundRuns[name] {
+		return
+	}
+	w.backgroundRuns[name] = true
+
+	go func() {
+		record := measure()
+		done := func() {
+			delete(w.backgroundRuns, name)
+			record()
+		}
+		select {
+		case w.backgroundResults <- done:
+		case <-w.stopped:
+		}
+	}()
+}
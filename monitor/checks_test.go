@@ -0,0 +1,44 @@
+package monitor
+
+import "testing"
+
+func TestRunInBackground(t *testing.T) {
+	w := &WiFiMonitor{
+		stopped:           make(chan struct{}),
+		backgroundResults: make(chan func()),
+		backgroundRuns:    make(map[string]bool),
+	}
+
+	release := make(chan struct{})
+	var recorded []string
+	measure := func(result string) func() func() {
+		return func() func() {
+			<-release
+			return func() { recorded = append(recorded, result) }
+		}
+	}
+
+	w.runInBackground("throughput", measure("first"))
+	// Still running: the second start is skipped
+	w.runInBackground("throughput", measure("skipped"))
+	w.runInBackground("anycast", measure("anycast"))
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		(<-w.backgroundResults)()
+	}
+	if len(recorded) != 2 || len(w.backgroundRuns) != 0 {
+		t.Fatalf("recorded %v with %v running, want first and anycast with none running", recorded, w.backgroundRuns)
+	}
+
+	// Once recorded, the measurement can run again
+	w.runInBackground("throughput", measure("second"))
+	(<-w.backgroundResults)()
+	if recorded[len(recorded)-1] != "second" {
+		t.Errorf("recorded %v, want second last", recorded)
+	}
+
+	// Results arriving after the loop has returned are dropped
+	w.runInBackground("throughput", measure("late"))
+	close(w.stopped)
+}
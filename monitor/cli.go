@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// runFlags are the command line flags shared by the monitor and the one-shot
+// test. Each flag overrides its environment variable and the config file.
+type runFlags struct {
+	config       string        // --config: YAML/TOML config file
+	iface        string        // --interface: WIFI_INTERFACE
+	pingInterval time.Duration // --ping-interval: PING_INTERVAL
+	dhcpInterval time.Duration // --dhcp-interval: DHCP_INTERVAL
+	logFile      string        // --log-file: LOG_FILE
+	headless     bool          // --headless: HEADLESS
+	metrics      string        // --metrics-listen: METRICS_LISTEN
+	api          string        // --api-listen: API_LISTEN
+	jsonl        string        // --jsonl: RESULTS_JSONL
+}
+
+// newRunFlagSet defines the shared flags on a flag set named after the command
+func newRunFlagSet(name string) (*flag.FlagSet, *runFlags) {
+	f := &runFlags{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&f.config, "config", "", "YAML or TOML config file (.yaml, .yml, .toml)")
+	fs.StringVar(&f.iface, "interface", "", "WiFi interface under test (WIFI_INTERFACE)")
+	fs.DurationVar(&f.pingInterval, "ping-interval", 0, "connectivity test interval (PING_INTERVAL)")
+	fs.DurationVar(&f.dhcpInterval, "dhcp-interval", 0, "DHCP renewal test interval (DHCP_INTERVAL)")
+	fs.StringVar(&f.logFile, "log-file", "", "log file path (LOG_FILE)")
+	fs.BoolVar(&f.headless, "headless", false, "run without the TUI (HEADLESS)")
+	fs.StringVar(&f.jsonl, "jsonl", "", "append every result as a JSON line to this file, - for stdout when headless (RESULTS_JSONL)")
+	fs.StringVar(&f.metrics, "metrics-listen", "", "serve Prometheus metrics on this address, e.g. :9101 (METRICS_LISTEN)")
+	fs.StringVar(&f.api, "api-listen", "", "serve the REST API on this address, e.g. 127.0.0.1:9102 (API_LISTEN)")
+	return fs, f
+}
+
+// parseRunFlags parses the command line, loads the config file and sets the
+// shared flags given on the command line in the settings. It returns the
+// arguments after the flags.
+func parseRunFlags(s *config.Settings, fs *flag.FlagSet, f *runFlags, args []string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if f.config != "" {
+		if err := s.LoadFile(f.config); err != nil {
+			fmt.Printf("Error loading config file: %v\n", err)
+			return nil, err
+		}
+	}
+
+	// Only flags that were given override; defaults leave the settings alone
+	values := map[string]string{
+		"interface":      f.iface,
+		"ping-interval":  f.pingInterval.String(),
+		"dhcp-interval":  f.dhcpInterval.String(),
+		"log-file":       f.logFile,
+		"headless":       fmt.Sprint(f.headless),
+		"metrics-listen": f.metrics,
+		"api-listen":     f.api,
+		"jsonl":          f.jsonl,
+	}
+	keys := map[string]string{
+		"interface":      "WIFI_INTERFACE",
+		"ping-interval":  "PING_INTERVAL",
+		"dhcp-interval":  "DHCP_INTERVAL",
+		"log-file":       "LOG_FILE",
+		"headless":       "HEADLESS",
+		"metrics-listen": "METRICS_LISTEN",
+		"api-listen":     "API_LISTEN",
+		"jsonl":          "RESULTS_JSONL",
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if key, ok := keys[fl.Name]; ok {
+			s.Set(key, values[fl.Name])
+		}
+	})
+	return fs.Args(), nil
+}
+
+// runRunCommand implements `noc-watch run [FLAGS]`, starting the monitor
+func runRunCommand(s *config.Settings, args []string) int {
+	fs, f := newRunFlagSet("run")
+	rest, err := parseRunFlags(s, fs, f, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", rest[0])
+		return exitUsage
+	}
+	runMonitor(s)
+	return exitOK
+}
+
+// runTestCommand implements `noc-watch test [FLAGS] [--skip-dhcp] [--json]`,
+// running one test, printing the result and exiting 0 when it succeeded
+func runTestCommand(s *config.Settings, args []string) int {
+	fs, f := newRunFlagSet("test")
+	skipDHCP := fs.Bool("skip-dhcp", false, "only test connectivity and latency, without renewing the DHCP lease")
+	asJSON := fs.Bool("json", false, "print the result record as JSON (see noc-watch schema result)")
+	rest, err := parseRunFlags(s, fs, f, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", rest[0])
+		return exitUsage
+	}
+
+	w := NewWiFiMonitor(s)
+	kind, test := "dhcp", WiFiTest{}
+	if *skipDHCP {
+		kind, test = "ping", w.runConnectivityTest()
+	} else {
+		test = w.runTest()
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(test)
+	} else {
+		fmt.Print(formatTailLine(kind, test))
+	}
+	if !test.Success {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/schemas"
+)
+
+// schemaFiles are the published JSON Schemas
+var schemaFiles = schemas.Files
+
+// runSubcommand executes a CLI subcommand and returns the process exit code
+func runSubcommand(s *config.Settings, args []string) int {
+	switch args[0] {
+	case "schema":
+		return runSchemaCommand(args[1:])
+	case "check-config":
+		return runCheckConfigCommand(s, args[1:])
+	case "init":
+		return runInitCommand(s, args[1:])
+	case "cert":
+		return runCertCommand(args[1:])
+	case "silence":
+		return runSilenceCommand(s, args[1:])
+	case "status":
+		return runStatusCommand(s, args[1:])
+	case "annotate":
+		return runAnnotateCommand(s, args[1:])
+	case "tail":
+		return runTailCommand(s, args[1:])
+	case "pause":
+		return runPauseCommand(s, args[1:])
+	case "resume":
+		return runResumeCommand(s, args[1:])
+	case "reflector":
+		return runReflectorCommand(args[1:])
+	case "debug":
+		return runDebugCommand(s, args[1:])
+	case "buffer":
+		return runBufferCommand(s, args[1:])
+	case "version":
+		return runVersionCommand(s, args[1:])
+	case "run":
+		return runRunCommand(s, args[1:])
+	case "test":
+		return runTestCommand(s, args[1:])
+	case "simulate":
+		return runSimulateCommand(args[1:])
+	case "selftest":
+		return runSelfTestCommand(s, args[1:])
+	case "verify-log":
+		return runVerifyLogCommand(s, args[1:])
+	case "export":
+		return runExportCommand(s, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "usage: noc-watch [--config FILE] [--interface IFACE] [--ping-interval DUR] [--dhcp-interval DUR] [--log-file PATH] [--headless] [--jsonl PATH] [--metrics-listen ADDR] [--api-listen ADDR] [run | test [--skip-dhcp] [--json] | export [--format csv] [--since DUR] | schema [config|result|alert-routes|alert-runbooks|metric-rules|alert-rules] | check-config [--json] | init [--check] [--json] | cert issue|signing-key | verify-log [--pub KEY] [LOGFILE] | silence add|list|expire | selftest | simulate | status [--oneline] | tail [--filter EXPR] | annotate TEXT | pause [DURATION] | resume | buffer status|flush|drop | debug [SOURCE] | version | reflector [--udp ADDR] [--tcp ADDR] [--http ADDR]]")
+		return exitUsage
+	}
+}
+
+// runSchemaCommand prints the JSON Schema for the config or result format
+func runSchemaCommand(args []string) int {
+	name := "config"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	data, err := schemaFiles.ReadFile(name + ".schema.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unknown schema %q (available: config, result, alert-routes, alert-runbooks, metric-rules, alert-rules)\n", name)
+		return exitUsage
+	}
+
+	os.Stdout.Write(data)
+	return exitOK
+}
@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Connectivity states reported on transitions
+const (
+	stateHealthy  = "healthy"
+	stateDegraded = "degraded"
+	stateDown     = "down"
+)
+
+// connectivityState follows the overall connectivity of the interface
+type connectivityState struct {
+	state      string        // healthy, degraded or down ("" before the first test)
+	since      time.Time     // When the current state was entered
+	pingFailed int           // Consecutive failed connectivity tests
+	dhcpFailed bool          // The latest DHCP renewal failed
+	latency    time.Duration // Latency of the latest successful connectivity test (0 after a failure)
+}
+
+// connectivityDownAfter returns the number of consecutive failed
+// connectivity tests after which the interface counts as down
+func connectivityDownAfter(s *config.Settings) int {
+	return max(s.Int("CONNECTIVITY_DOWN_AFTER", 3), 1)
+}
+
+// observeConnectivity updates the connectivity state with a finished test
+// and announces transitions between healthy, degraded and down as
+// connectivity_<state> events, which reach every configured webhook.
+// Samples disrupted by the monitor's own DHCP renewal are left out.
+func (w *WiFiMonitor) observeConnectivity(kind string, test WiFiTest) {
+	if !countsTowardsStats(w.settings, test) {
+		return
+	}
+
+	c := &w.connectivity
+	threshold := w.settings.Duration("CONNECTIVITY_DEGRADED_LATENCY", 200*time.Millisecond)
+	if kind == "dhcp" {
+		c.dhcpFailed = !test.Success
+	} else {
+		c.pingFailed++
+		if test.Success {
+			c.pingFailed = 0
+		}
+		c.latency = 0
+		if test.Success {
+			c.latency = test.Latency
+		}
+	}
+
+	// The worst condition decides the state and the reason given for it
+	state, reasons := stateHealthy, []string{}
+	if c.pingFailed >= connectivityDownAfter(w.settings) {
+		state = stateDown
+		reasons = append(reasons, fmt.Sprintf("%d consecutive connectivity tests failed", c.pingFailed))
+	} else {
+		if c.pingFailed > 0 {
+			state = stateDegraded
+			reasons = append(reasons, fmt.Sprintf("%d connectivity test(s) failed", c.pingFailed))
+		}
+		if threshold > 0 && c.latency > threshold {
+			state = stateDegraded
+			reasons = append(reasons, fmt.Sprintf("latency %v above %v", c.latency.Round(time.Millisecond), threshold))
+		}
+	}
+	if c.dhcpFailed {
+		if state == stateHealthy {
+			state = stateDegraded
+		}
+		reasons = append(reasons, "DHCP renewal failed")
+	}
+
+	if state == c.state {
+		return
+	}
+	previous := c.state
+	c.state, c.since = state, test.Timestamp
+	// The first test only establishes the state; starting healthy is not news
+	if previous == "" && state == stateHealthy {
+		return
+	}
+	if previous == "" {
+		previous = stateHealthy
+	}
+
+	message := fmt.Sprintf("Connectivity %s on %s (was %s)", state, w.wifiInterface, previous)
+	if len(reasons) > 0 {
+		message += ": " + strings.Join(reasons, ", ")
+	}
+	w.recordAlert(Alert{
+		Name:      "connectivity_" + state,
+		Message:   message,
+		Event:     true,
+		State:     state,
+		Previous:  previous,
+		Timestamp: test.Timestamp,
+	})
+}
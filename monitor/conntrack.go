@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConntrackSample is a snapshot of the connection tracking table occupancy
+type ConntrackSample struct {
+	Count     int       // Current number of tracked connections
+	Max       int       // Table size limit
+	Timestamp time.Time // Sample time
+}
+
+// Usage returns the table occupancy in percent
+func (c ConntrackSample) Usage() float64 {
+	if c.Max == 0 {
+		return 0
+	}
+	return float64(c.Count) / float64(c.Max) * 100
+}
+
+// readProcInt reads a single integer value from a /proc file
+func readProcInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// runConntrackCheck samples the conntrack table and alerts near exhaustion
+func (w *WiFiMonitor) runConntrackCheck() {
+	count, err := readProcInt("/proc/sys/net/netfilter/nf_conntrack_count")
+	if err != nil {
+		return // conntrack module not loaded
+	}
+	max, err := readProcInt("/proc/sys/net/netfilter/nf_conntrack_max")
+	if err != nil {
+		return
+	}
+
+	sample := ConntrackSample{Count: count, Max: max, Timestamp: time.Now()}
+	w.conntrack = &sample
+
+	threshold := float64(w.settings.Int("CONNTRACK_ALERT_PERCENT", 80))
+	w.setAlert("conntrack_pressure", sample.Usage() >= threshold,
+		fmt.Sprintf("Conntrack table at %.1f%% (%d/%d)", sample.Usage(), sample.Count, sample.Max))
+}
+
+// String formats the sample for logs
+func (c ConntrackSample) String() string {
+	return fmt.Sprintf("%d/%d (%.1f%%)", c.Count, c.Max, c.Usage())
+}
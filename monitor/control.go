@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/client"
+	"github.com/marokiki/noc-watch/config"
+)
+
+// controlRequest is a command received on the control socket. Requests are
+// answered by the monitoring loop so they see consistent state.
+type controlRequest struct {
+	command string      // Command line sent by the client
+	reply   chan string // Response text
+}
+
+// controlSocketPath returns the control socket path from CONTROL_SOCKET,
+// defaulting to a socket next to the log file
+func controlSocketPath(s *config.Settings) string {
+	logFile := s.String("LOG_FILE", "noc-watch.log")
+	return s.String("CONTROL_SOCKET", filepath.Join(filepath.Dir(logFile), "noc-watch.sock"))
+}
+
+// startControlServer listens on the control socket and forwards each command
+// to the monitoring loop. It returns a function closing the socket; closing
+// the listener also removes the socket file, so the next run can listen again.
+func (w *WiFiMonitor) startControlServer() func() {
+	path := controlSocketPath(w.settings)
+
+	// A socket left behind by a previous run blocks Listen
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		fmt.Printf("Error starting control socket: another instance is listening on %s\n", path)
+		return func() {}
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		fmt.Printf("Error starting control socket: %v\n", err)
+		return func() {}
+	}
+	os.Chmod(path, 0660)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go w.serveControl(conn)
+		}
+	}()
+	return func() { listener.Close() }
+}
+
+// serveControl answers a single command on a control connection, or keeps
+// it open to stream results for tail
+func (w *WiFiMonitor) serveControl(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+
+	command := strings.TrimSpace(line)
+	if command == "tail" || strings.HasPrefix(command, "tail ") {
+		w.serveTail(conn, strings.TrimPrefix(command, "tail"))
+		return
+	}
+
+	req := controlRequest{command: command, reply: make(chan string, 1)}
+	w.controlRequests <- req
+	conn.Write([]byte(<-req.reply))
+}
+
+// command runs a control command on the monitoring loop. It returns false
+// instead of blocking once the loop has returned.
+func (w *WiFiMonitor) command(command string) (string, bool) {
+	req := controlRequest{command: command, reply: make(chan string, 1)}
+	select {
+	case w.controlRequests <- req:
+		return <-req.reply, true
+	case <-w.stopped:
+		return "", false
+	}
+}
+
+// handleControl executes a control command on the monitoring goroutine
+func (w *WiFiMonitor) handleControl(command string) string {
+	switch {
+	case command == "status":
+		var text string
+		for _, field := range w.statusFields() {
+			text += fmt.Sprintf("%s: %s\n", field[0], field[1])
+		}
+		return text
+	case command == "status --oneline":
+		return w.statusLine() + "\n"
+	case strings.HasPrefix(command, "annotate "):
+		if err := w.annotate(strings.TrimPrefix(command, "annotate ")); err != nil {
+			return fmt.Sprintf("error: %v\n", err)
+		}
+		return "annotation added\n"
+	case command == "pause" || strings.HasPrefix(command, "pause "):
+		var duration time.Duration
+		if arg := strings.TrimSpace(strings.TrimPrefix(command, "pause")); arg != "" {
+			var err error
+			if duration, err = time.ParseDuration(arg); err != nil || duration <= 0 {
+				return fmt.Sprintf("error: invalid duration %q\n", arg)
+			}
+		}
+		return w.pauseProbing(duration)
+	case command == "resume":
+		return w.resumeProbing("resumed by operator")
+	case command == "debug" || strings.HasPrefix(command, "debug "):
+		return formatRawOutputs(w.rawOutputs.Recent(strings.TrimSpace(strings.TrimPrefix(command, "debug"))))
+	case strings.HasPrefix(command, "silence "):
+		return w.silences.handleCommand(strings.TrimPrefix(command, "silence "))
+	case strings.HasPrefix(command, "buffer "):
+		return w.handleBufferCommand(strings.TrimPrefix(command, "buffer "))
+	case command == "version":
+		return w.stamp() + "\n"
+	case command == metricsCommand:
+		return w.metricsText()
+	case strings.HasPrefix(command, apiCommand):
+		return w.handleAPICommand(strings.TrimPrefix(command, apiCommand))
+	case strings.HasPrefix(command, "export "):
+		return w.handleExportCommand(strings.TrimPrefix(command, "export "))
+	default:
+		return fmt.Sprintf("error: unknown command %q\n", command)
+	}
+}
+
+// sendControl sends a command to the running monitor and returns its response
+func sendControl(s *config.Settings, command string) (string, error) {
+	return client.New(controlSocketPath(s)).Do(command)
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// freeAddr returns a loopback TCP address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestListenersCloseWhenStopped(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "noc-watch.sock")
+	metricsAddr, apiAddr := freeAddr(t), freeAddr(t)
+	w := &WiFiMonitor{
+		settings: config.New(map[string]string{"CONTROL_SOCKET": socket, "METRICS_LISTEN": metricsAddr, "API_LISTEN": apiAddr}),
+		stopped:  make(chan struct{}),
+	}
+
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		start   func() func()
+	}{
+		{name: "control socket", network: "unix", addr: socket, start: w.startControlServer},
+		{name: "metrics", network: "tcp", addr: metricsAddr, start: w.startMetricsServer},
+		{name: "API", network: "tcp", addr: apiAddr, start: w.startAPIServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stop := tt.start()
+
+			// HTTP servers start listening in the background
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				conn, err := net.Dial(tt.network, tt.addr)
+				if err == nil {
+					conn.Close()
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("%s is not listening: %v", tt.addr, err)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			stop()
+			if conn, err := net.Dial(tt.network, tt.addr); err == nil {
+				conn.Close()
+				t.Errorf("%s still accepts connections after stopping", tt.addr)
+			}
+			if tt.network == "unix" {
+				if _, err := os.Stat(tt.addr); !os.IsNotExist(err) {
+					t.Errorf("socket %s left behind: %v", tt.addr, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// excludeDisrupted reports whether samples taken during the monitor's own
+// disruptive actions are left out of the headline statistics
+// (DISRUPTION_STATS=exclude). By default they are counted and only labeled.
+func excludeDisrupted(s *config.Settings) bool {
+	return s.Get("DISRUPTION_STATS") == "exclude"
+}
+
+// startDisruption opens a window after a disruptive action of the monitor
+// itself (the DHCP release/renew), during which samples are labeled disrupted
+func (w *WiFiMonitor) startDisruption() {
+	w.disruptedUntil = time.Now().Add(w.settings.Duration("DISRUPTION_WINDOW", 30*time.Second))
+}
+
+// markDisruption labels a sample taken inside the current disruption window
+func (w *WiFiMonitor) markDisruption(test *WiFiTest) {
+	if test.Timestamp.Before(w.disruptedUntil) {
+		test.Disrupted = true
+	}
+}
+
+// countsTowardsStats reports whether a sample enters the headline success,
+// availability and latency statistics
+func countsTowardsStats(s *config.Settings, test WiFiTest) bool {
+	return !test.Disrupted || !excludeDisrupted(s)
+}
+
+// headlineTests returns the tests that enter the headline statistics
+func headlineTests(s *config.Settings, tests []WiFiTest) []WiFiTest {
+	if !excludeDisrupted(s) {
+		return tests
+	}
+	counted := make([]WiFiTest, 0, len(tests))
+	for _, test := range tests {
+		if countsTowardsStats(s, test) {
+			counted = append(counted, test)
+		}
+	}
+	return counted
+}
+
+// disruptionNote describes the disrupted samples of a test history for the stats lines
+func disruptionNote(s *config.Settings, tests []WiFiTest) string {
+	disrupted := 0
+	for _, test := range tests {
+		if test.Disrupted {
+			disrupted++
+		}
+	}
+	if disrupted == 0 {
+		return ""
+	}
+	if excludeDisrupted(s) {
+		return fmt.Sprintf(" (%d samples after DHCP renewals excluded)", disrupted)
+	}
+	return fmt.Sprintf(" (incl. %d samples after DHCP renewals)", disrupted)
+}
@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNS types and classes not predefined by dnsmessage
+const (
+	dnsTypeDNSKEY dnsmessage.Type  = 48
+	dnsClassCHAOS dnsmessage.Class = 3
+)
+
+// dnsQuery describes a raw DNS query sent by the DNS probes
+type dnsQuery struct {
+	name    string              // Query name (fully qualified or not)
+	qtype   dnsmessage.Type     // Query type
+	class   dnsmessage.Class    // Query class (IN or CHAOS)
+	udpSize uint16              // EDNS UDP payload size; 0 disables EDNS
+	dnssec  bool                // Set the DNSSEC OK bit
+	options []dnsmessage.Option // Additional EDNS options (e.g., client subnet)
+}
+
+// pack builds the wire format message for the query
+func (q dnsQuery) pack() ([]byte, error) {
+	name := q.name
+	if name == "" || name[len(name)-1] != '.' {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	class := q.class
+	if class == 0 {
+		class = dnsmessage.ClassINET
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               uint16(rand.Intn(1 << 16)),
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{Name: qname, Type: q.qtype, Class: class}},
+	}
+
+	if q.udpSize > 0 {
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(int(q.udpSize), dnsmessage.RCodeSuccess, q.dnssec); err != nil {
+			return nil, err
+		}
+		msg.Additionals = append(msg.Additionals, dnsmessage.Resource{
+			Header: opt,
+			Body:   &dnsmessage.OPTResource{Options: q.options},
+		})
+	}
+
+	return msg.Pack()
+}
+
+// dnsCheckServer returns the resolver probed by the DNS checks: DNS_CHECK_SERVER
+// if set, otherwise the first nameserver from resolv.conf
+func dnsCheckServer(s *config.Settings) string {
+	if server := s.Get("DNS_CHECK_SERVER"); server != "" {
+		return server
+	}
+	if resolvers := probe.SystemResolvers(); len(resolvers) > 0 {
+		return resolvers[0]
+	}
+	return ""
+}
+
+// exchangeDNS sends a query over "udp" or "tcp" to server (host or host:port)
+// and returns the parsed response together with its wire size and round-trip time
+func (w *WiFiMonitor) exchangeDNS(network, server string, q dnsQuery, timeout time.Duration) (*dnsmessage.Message, int, time.Duration, error) {
+	query, err := q.pack()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	start := time.Now()
+	conn, err := w.interfaceDialer(timeout).Dial(network, server)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var resp []byte
+	if network == "tcp" {
+		// TCP messages carry a two-byte length prefix
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(framed, query...)); err != nil {
+			return nil, 0, 0, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, 0, 0, err
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, 0, 0, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, 0, 0, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		resp = buf[:n]
+	}
+	rtt := time.Since(start)
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, len(resp), rtt, err
+	}
+	if msg.Header.ID != binary.BigEndian.Uint16(query) {
+		return nil, len(resp), rtt, errors.New("dns response ID mismatch")
+	}
+
+	return &msg, len(resp), rtt, nil
+}
@@ -0,0 +1,251 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// minResolverSamples is the number of queries needed before a resolver is ranked
+const minResolverSamples = 5
+
+// resolverWindow is the number of most recent queries a resolver is judged
+// on, so failures age out once it has recovered
+const resolverWindow = 30
+
+// resolvedStubs are the local addresses of the systemd-resolved stub resolver
+var resolvedStubs = []string{"127.0.0.53", "127.0.0.54"}
+
+// resolverHealth tracks query health of one resolver
+type resolverHealth struct {
+	Server  string        // Resolver address
+	Results []bool        // Outcome of the most recent queries, oldest first (at most resolverWindow)
+	Latency time.Duration // Exponentially weighted moving average of successful RTTs
+}
+
+// record adds the outcome of a query, dropping the oldest beyond resolverWindow
+func (r *resolverHealth) record(ok bool) {
+	r.Results = append(r.Results, ok)
+	if len(r.Results) > resolverWindow {
+		r.Results = r.Results[len(r.Results)-resolverWindow:]
+	}
+}
+
+// successRate returns the percentage of answered queries in the window
+func (r *resolverHealth) successRate() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	answered := 0
+	for _, ok := range r.Results {
+		if ok {
+			answered++
+		}
+	}
+	return float64(answered) / float64(len(r.Results)) * 100
+}
+
+// isResolvedStub reports whether a nameserver is the systemd-resolved stub
+func isResolvedStub(server string) bool {
+	for _, stub := range resolvedStubs {
+		if server == stub {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvedUpstreams returns the DNS servers systemd-resolved forwards to for
+// an interface: the link servers from `resolvectl dns`, else the global list
+// resolved writes to /run/systemd/resolve/resolv.conf
+func resolvedUpstreams(iface string) []string {
+	var servers []string
+	if out, err := exec.Command("resolvectl", "dns", iface).Output(); err == nil {
+		// "Link 3 (wlan0): 192.168.1.1 1.1.1.1#cloudflare-dns.com"
+		if _, list, ok := strings.Cut(string(out), ":"); ok {
+			for _, server := range strings.Fields(list) {
+				server, _, _ = strings.Cut(server, "#")
+				if host, _, _ := strings.Cut(server, "%"); net.ParseIP(host) != nil {
+					servers = append(servers, server)
+				}
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = probe.ResolvConfFileValues("/run/systemd/resolve/resolv.conf", "nameserver")
+	}
+	return servers
+}
+
+// upstreamResolvers returns the resolvers actually answering the host's
+// queries. Behind the systemd-resolved stub these are resolved's upstreams;
+// the stub itself only forwards and is never a failover candidate.
+func upstreamResolvers(iface string) []string {
+	var servers []string
+	stub := false
+	for _, server := range probe.SystemResolvers() {
+		if isResolvedStub(server) {
+			stub = true
+			continue
+		}
+		servers = append(servers, server)
+	}
+	if stub {
+		servers = append(resolvedUpstreams(iface), servers...)
+	}
+	return servers
+}
+
+// candidateResolvers returns the upstream resolvers of the interface followed
+// by extra candidates from DNS_CANDIDATE_RESOLVERS, without duplicates
+func candidateResolvers(s *config.Settings, iface string) []string {
+	seen := make(map[string]bool)
+	var servers []string
+	for _, server := range append(upstreamResolvers(iface), s.List("DNS_CANDIDATE_RESOLVERS")...) {
+		if !seen[server] && !isResolvedStub(server) {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// runResolverRanking queries every candidate resolver, updates its health and
+// recommends (or optionally applies) a better primary resolver
+func (w *WiFiMonitor) runResolverRanking() {
+	servers := candidateResolvers(w.settings, w.wifiInterface)
+	if len(servers) < 2 {
+		return
+	}
+
+	query := dnsQuery{name: w.settings.String("DNS_CHECK_NAME", "example.com"), qtype: dnsmessage.TypeA}
+	for _, server := range servers {
+		health, ok := w.resolverHealth[server]
+		if !ok {
+			health = &resolverHealth{Server: server}
+			w.resolverHealth[server] = health
+		}
+
+		msg, _, rtt, err := w.exchangeDNS("udp", server, query, 3*time.Second)
+		if err != nil || msg.Header.RCode != dnsmessage.RCodeSuccess {
+			health.record(false)
+			continue
+		}
+		health.record(true)
+		if health.Latency == 0 {
+			health.Latency = rtt
+		} else {
+			health.Latency = (health.Latency*4 + rtt) / 5
+		}
+	}
+
+	ranking := w.rankResolvers(servers)
+	w.dnsRecommendation = ""
+	if len(ranking) == 0 {
+		return
+	}
+
+	best := ranking[0]
+	primary := w.resolverHealth[servers[0]]
+	if best.Server == primary.Server || len(primary.Results) < minResolverSamples {
+		return
+	}
+
+	// Only recommend a switch for a clear improvement
+	if best.successRate()-primary.successRate() < 5 &&
+		(primary.Latency < 2*best.Latency || primary.Latency-best.Latency < 20*time.Millisecond) {
+		return
+	}
+
+	w.dnsRecommendation = fmt.Sprintf("use %s instead of %s (%.0f%% / %v vs %.0f%% / %v)",
+		best.Server, primary.Server, best.successRate(), best.Latency.Round(time.Millisecond),
+		primary.successRate(), primary.Latency.Round(time.Millisecond))
+
+	if w.settings.Get("DNS_FAILOVER_APPLY") == "true" {
+		order := []string{best.Server}
+		for _, server := range servers {
+			if server != best.Server {
+				order = append(order, server)
+			}
+		}
+		if err := w.applyResolverOrder(order); err != nil {
+			fmt.Printf("Error applying resolver order: %v\n", err)
+		}
+	}
+}
+
+// rankResolvers orders resolvers with enough samples by success rate, then latency
+func (w *WiFiMonitor) rankResolvers(servers []string) []*resolverHealth {
+	var ranking []*resolverHealth
+	for _, server := range servers {
+		if health := w.resolverHealth[server]; health != nil && len(health.Results) >= minResolverSamples {
+			ranking = append(ranking, health)
+		}
+	}
+
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].successRate() != ranking[j].successRate() {
+			return ranking[i].successRate() > ranking[j].successRate()
+		}
+		return ranking[i].Latency < ranking[j].Latency
+	})
+
+	return ranking
+}
+
+// applyResolverOrder moves the recommended resolver to the front, either via
+// systemd-resolved or by rewriting the nameserver lines of /etc/resolv.conf
+func (w *WiFiMonitor) applyResolverOrder(servers []string) error {
+	content, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return err
+	}
+
+	// systemd-resolved stub: configure the link's upstreams instead of the
+	// generated file; the candidates never include the stub itself
+	stub := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "nameserver" && isResolvedStub(fields[1]) {
+			stub = true
+		}
+	}
+	if stub {
+		args := append([]string{"dns", w.wifiInterface}, servers...)
+		return exec.Command("resolvectl", args...).Run()
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "nameserver") {
+			lines = append(lines, line)
+		}
+	}
+	for _, server := range servers {
+		lines = append(lines, "nameserver "+server)
+	}
+
+	return os.WriteFile("/etc/resolv.conf", []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// resolverRankingText formats the current ranking for the log file
+func (w *WiFiMonitor) resolverRankingText() string {
+	ranking := w.rankResolvers(candidateResolvers(w.settings, w.wifiInterface))
+	if len(ranking) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for i, health := range ranking {
+		parts = append(parts, fmt.Sprintf("%d. %s %.0f%% %v", i+1, health.Server,
+			health.successRate(), health.Latency.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ResolverFingerprint describes how the venue resolver behaves
+type ResolverFingerprint struct {
+	Server        string    // Resolver address that was queried
+	ServerID      string    // CHAOS id.server answer (instance that served the query)
+	Hostname      string    // CHAOS hostname.bind answer
+	Version       string    // CHAOS version.bind answer
+	EgressIP      string    // Address the resolver uses towards authoritative servers
+	ClientSubnet  string    // EDNS client subnet seen by the authoritative server ("" if none)
+	TTLFirst      uint32    // TTL of the first answer for the TTL test name
+	TTLSecond     uint32    // TTL of the repeated answer
+	TTLCountsDown bool      // Cached TTL decreased between queries as expected
+	Timestamp     time.Time // Probe execution timestamp
+}
+
+// chaosTXT queries a CHAOS class TXT record (id.server, version.bind, ...)
+func (w *WiFiMonitor) chaosTXT(server, name string) string {
+	msg, _, _, err := w.exchangeDNS("udp", server, dnsQuery{name: name, qtype: dnsmessage.TypeTXT, class: dnsClassCHAOS}, 5*time.Second)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(txtAnswers(msg), " ")
+}
+
+// txtAnswers returns all TXT strings found in the answer section
+func txtAnswers(msg *dnsmessage.Message) []string {
+	var txt []string
+	for _, answer := range msg.Answers {
+		if body, ok := answer.Body.(*dnsmessage.TXTResource); ok {
+			txt = append(txt, strings.Join(body.TXT, ""))
+		}
+	}
+	return txt
+}
+
+// firstTTL returns the TTL of the first answer record
+func firstTTL(msg *dnsmessage.Message) (uint32, bool) {
+	if len(msg.Answers) == 0 {
+		return 0, false
+	}
+	return msg.Answers[0].Header.TTL, true
+}
+
+// runResolverFingerprint records which resolver served answers, whether ECS is
+// appended upstream, and whether cached TTLs are rewritten
+func (w *WiFiMonitor) runResolverFingerprint() {
+	server := dnsCheckServer(w.settings)
+	if server == "" {
+		return
+	}
+
+	fp := ResolverFingerprint{Server: server, Timestamp: time.Now()}
+
+	// CHAOS class identification queries
+	fp.ServerID = w.chaosTXT(server, "id.server")
+	fp.Hostname = w.chaosTXT(server, "hostname.bind")
+	fp.Version = w.chaosTXT(server, "version.bind")
+
+	// Google's o-o.myaddr echoes the resolver egress address and any client subnet it received
+	echoName := w.settings.String("DNS_ECHO_NAME", "o-o.myaddr.l.google.com")
+	if msg, _, _, err := w.exchangeDNS("udp", server, dnsQuery{name: echoName, qtype: dnsmessage.TypeTXT, udpSize: 1232}, 5*time.Second); err == nil {
+		for _, txt := range txtAnswers(msg) {
+			if strings.HasPrefix(txt, "edns0-client-subnet ") {
+				fp.ClientSubnet = strings.TrimPrefix(txt, "edns0-client-subnet ")
+			} else if fp.EgressIP == "" {
+				fp.EgressIP = txt
+			}
+		}
+	}
+
+	// A cached record should count its TTL down between two queries
+	ttlName := w.settings.String("DNS_TTL_CHECK_NAME", "example.com")
+	query := dnsQuery{name: ttlName, qtype: dnsmessage.TypeA}
+	if msg, _, _, err := w.exchangeDNS("udp", server, query, 5*time.Second); err == nil {
+		fp.TTLFirst, _ = firstTTL(msg)
+		time.Sleep(2 * time.Second)
+		if msg, _, _, err := w.exchangeDNS("udp", server, query, 5*time.Second); err == nil {
+			fp.TTLSecond, _ = firstTTL(msg)
+			fp.TTLCountsDown = fp.TTLSecond < fp.TTLFirst
+		}
+	}
+
+	w.resolverFingerprint = &fp
+}
+
+// String formats the fingerprint as the resolver behavior report section
+func (fp ResolverFingerprint) String() string {
+	orNone := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	ecs := "not forwarded"
+	if fp.ClientSubnet != "" {
+		ecs = "forwarded (" + fp.ClientSubnet + ")"
+	}
+
+	ttl := "counts down"
+	if fp.TTLFirst == 0 {
+		ttl = "unknown"
+	} else if !fp.TTLCountsDown {
+		ttl = "rewritten/frozen"
+	}
+
+	return fmt.Sprintf("Server=%s, ID=%s, Hostname=%s, Version=%s\n"+
+		"  Egress=%s, ClientSubnet=%s, TTL=%s (%d -> %d)",
+		fp.Server, orNone(fp.ServerID), orNone(fp.Hostname), orNone(fp.Version),
+		orNone(fp.EgressIP), ecs, ttl, fp.TTLFirst, fp.TTLSecond)
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSTransportResult holds the outcome of a UDP vs TCP DNS transport probe
+type DNSTransportResult struct {
+	Server       string        // Resolver that was probed
+	UDP          bool          // Small query answered over UDP
+	TCP          bool          // Query answered over TCP/53
+	LargeUDP     bool          // Large EDNS response received over UDP (fragmented path)
+	LargeSize    int           // Size of the large response in bytes (measured over TCP when possible)
+	LargeCapped  bool          // The resolver truncated the EDNS response at its own buffer size (e.g. 1232)
+	LargeTimeout bool          // The large EDNS query over UDP went unanswered
+	PathLimit    int           // Largest UDP DNS payload that fits the interface MTU without fragmentation
+	Truncated    bool          // Non-EDNS query for the large record came back truncated
+	TruncatedTCP bool          // The truncated answer was retrieved over TCP
+	UDPLatency   time.Duration // Round-trip time of the small UDP query
+	TCPLatency   time.Duration // Round-trip time of the TCP query
+	Timestamp    time.Time     // Probe execution timestamp
+}
+
+// dnsLargeType returns the record type of the large query from
+// DNS_CHECK_LARGE_TYPE (TXT, default, or DNSKEY)
+func dnsLargeType(s *config.Settings) dnsmessage.Type {
+	if strings.EqualFold(s.Get("DNS_CHECK_LARGE_TYPE"), "DNSKEY") {
+		return dnsTypeDNSKEY
+	}
+	return dnsmessage.TypeTXT
+}
+
+// dnsPathLimit returns the largest DNS payload a UDP datagram to server can
+// carry over the interface without IP fragmentation
+func dnsPathLimit(iface, server string) int {
+	mtu := 1500
+	if ifi, err := net.InterfaceByName(iface); err == nil && ifi.MTU > 0 {
+		mtu = ifi.MTU
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return mtu - 48 // IPv6 and UDP headers
+	}
+	return mtu - 28 // IPv4 and UDP headers
+}
+
+// isTimeout reports whether err is a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// runDNSTransportCheck probes the resolver over UDP, TCP and with a large EDNS
+// response and raises alerts when TCP/53 or fragmented responses are blocked.
+// A resolver that truncates the large answer at its EDNS buffer size (the
+// 1232 byte flag-day default) is capped, not blocked; fragments only count
+// as blocked when an answer known to exceed the MTU never arrives.
+func (w *WiFiMonitor) runDNSTransportCheck() {
+	server := dnsCheckServer(w.settings)
+	if server == "" {
+		return
+	}
+
+	timeout := 5 * time.Second
+	name := w.settings.String("DNS_CHECK_NAME", "example.com")
+	largeName := w.settings.String("DNS_CHECK_LARGE_NAME", "microsoft.com")
+	largeType := dnsLargeType(w.settings)
+
+	result := DNSTransportResult{Server: server, PathLimit: dnsPathLimit(w.wifiInterface, server), Timestamp: time.Now()}
+
+	// Small query over UDP and TCP
+	small := dnsQuery{name: name, qtype: dnsmessage.TypeA}
+	if _, _, rtt, err := w.exchangeDNS("udp", server, small, timeout); err == nil {
+		result.UDP = true
+		result.UDPLatency = rtt
+	}
+	if _, _, rtt, err := w.exchangeDNS("tcp", server, small, timeout); err == nil {
+		result.TCP = true
+		result.TCPLatency = rtt
+	}
+
+	// Large DNSSEC response forcing IP fragmentation over UDP; TCP tells
+	// how large the full answer is
+	large := dnsQuery{name: largeName, qtype: largeType, udpSize: 4096, dnssec: true}
+	if msg, size, _, err := w.exchangeDNS("tcp", server, large, timeout); err == nil && !msg.Header.Truncated {
+		result.LargeSize = size
+	}
+	msg, size, _, err := w.exchangeDNS("udp", server, large, timeout)
+	switch {
+	case err == nil && msg.Header.Truncated:
+		result.LargeCapped = true
+	case err == nil:
+		result.LargeUDP = true
+		result.LargeSize = max(result.LargeSize, size)
+	case isTimeout(err):
+		result.LargeTimeout = true
+	}
+
+	// Same record without EDNS must be truncated and then fetched over TCP
+	legacy := dnsQuery{name: largeName, qtype: largeType}
+	if msg, _, _, err := w.exchangeDNS("udp", server, legacy, timeout); err == nil && msg.Header.Truncated {
+		result.Truncated = true
+		if _, _, _, err := w.exchangeDNS("tcp", server, legacy, timeout); err == nil {
+			result.TruncatedTCP = true
+		}
+	}
+
+	w.dnsTransport = &result
+
+	w.setAlert("dns_tcp_blocked", result.UDP && !result.TCP,
+		fmt.Sprintf("DNS over UDP works but TCP/53 to %s is blocked", server))
+	w.setAlert("dns_fragments_blocked", result.UDP && result.LargeTimeout && result.LargeSize > result.PathLimit,
+		fmt.Sprintf("Fragmented UDP DNS responses from %s are not delivered (%d byte answer, %d bytes fit unfragmented)",
+			server, result.LargeSize, result.PathLimit))
+}
+
+// String summarizes the transport probe result for logs
+func (r DNSTransportResult) String() string {
+	return fmt.Sprintf("Server=%s, UDP=%v (%v), TCP=%v (%v), LargeUDP=%v (%d bytes, %d fit unfragmented), Capped=%v, Truncated=%v, TruncatedViaTCP=%v",
+		r.Server, r.UDP, r.UDPLatency, r.TCP, r.TCPLatency, r.LargeUDP, r.LargeSize, r.PathLimit, r.LargeCapped, r.Truncated, r.TruncatedTCP)
+}
@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsLookupHistoryLimit is the number of lookups kept per name and server
+const dnsLookupHistoryLimit = 500
+
+// systemResolverName labels lookups through the system resolver configuration
+const systemResolverName = "system"
+
+// DNSLookup is one resolution of a hostname
+type DNSLookup struct {
+	Name      string        `json:"name"`            // Hostname looked up
+	Server    string        `json:"server"`          // Resolver ("system" for resolv.conf through the stub resolver)
+	Latency   time.Duration `json:"latency_ns"`      // Lookup time
+	Addresses int           `json:"addresses"`       // Addresses in the answer
+	Error     string        `json:"error,omitempty"` // Failure reason ("" on success)
+	Timestamp time.Time     `json:"timestamp"`       // Lookup time
+}
+
+// key identifies the name and resolver of a lookup in the history
+func (l DNSLookup) key() string {
+	return l.Name + "@" + l.Server
+}
+
+// String formats a lookup for the log file and the TUI
+func (l DNSLookup) String() string {
+	if l.Error != "" {
+		return fmt.Sprintf("%s via %s: FAIL after %v (%s)", l.Name, l.Server, l.Latency.Round(time.Millisecond), l.Error)
+	}
+	return fmt.Sprintf("%s via %s: %v, %d addresses", l.Name, l.Server, l.Latency.Round(100*time.Microsecond), l.Addresses)
+}
+
+// dnsLookupNames returns the hostnames resolved every cycle from DNS_LOOKUP_NAMES
+func dnsLookupNames(s *config.Settings) []string {
+	if names := s.List("DNS_LOOKUP_NAMES"); len(names) > 0 {
+		return names
+	}
+	return []string{s.String("DNS_CHECK_NAME", "example.com")}
+}
+
+// dnsLookupServers returns the system resolver followed by the servers from
+// DNS_LOOKUP_SERVERS, each queried directly
+func dnsLookupServers(s *config.Settings) []string {
+	return append([]string{systemResolverName}, s.List("DNS_LOOKUP_SERVERS")...)
+}
+
+// lookupSystem resolves a name like applications do: through resolv.conf
+// with its search domains, over the monitored interface
+func (w *WiFiMonitor) lookupSystem(name string, timeout time.Duration) DNSLookup {
+	lookup := DNSLookup{Name: name, Server: systemResolverName, Timestamp: time.Now()}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return w.interfaceDialer(timeout).DialContext(ctx, network, address)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, name)
+	lookup.Latency = time.Since(start)
+	if err != nil {
+		lookup.Error = err.Error()
+		return lookup
+	}
+	lookup.Addresses = len(addrs)
+	return lookup
+}
+
+// lookupServer sends an A query for a name straight to one resolver. Error
+// responses such as SERVFAIL and NXDOMAIN count as failures.
+func (w *WiFiMonitor) lookupServer(server, name string, timeout time.Duration) DNSLookup {
+	lookup := DNSLookup{Name: name, Server: server, Timestamp: time.Now()}
+	msg, _, rtt, err := w.exchangeDNS("udp", server, dnsQuery{name: name, qtype: dnsmessage.TypeA}, timeout)
+	lookup.Latency = rtt
+	if err != nil {
+		lookup.Error = err.Error()
+		return lookup
+	}
+	if msg.Header.RCode != dnsmessage.RCodeSuccess {
+		lookup.Error = rcodeName(msg.Header.RCode)
+		return lookup
+	}
+	lookup.Addresses = len(msg.Answers)
+	return lookup
+}
+
+// rcodeName returns the usual mnemonic of a DNS response code (e.g., NXDOMAIN)
+func rcodeName(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	}
+	return strings.TrimPrefix(rcode.String(), "RCode")
+}
+
+// runDNSLookups resolves every name against every resolver, keeps the
+// results for the stats table and alerts per resolver when no name resolves
+func (w *WiFiMonitor) runDNSLookups() {
+	timeout := w.settings.Duration("DNS_LOOKUP_TIMEOUT", 5*time.Second)
+	names := dnsLookupNames(w.settings)
+
+	for _, server := range dnsLookupServers(w.settings) {
+		var failed []string
+		for _, name := range names {
+			var lookup DNSLookup
+			if server == systemResolverName {
+				lookup = w.lookupSystem(name, timeout)
+			} else {
+				lookup = w.lookupServer(server, name, timeout)
+			}
+			w.recordDNSLookup(lookup)
+			w.countProbeFailure("dns", lookup.Error != "")
+			w.writeJSONL("dns", lookup)
+			if lookup.Error != "" {
+				failed = append(failed, name)
+			}
+		}
+
+		w.setAlert("dns_lookup_failed_"+server, len(failed) == len(names),
+			fmt.Sprintf("DNS lookups via %s fail for every name (%s)", server, strings.Join(failed, ", ")))
+	}
+}
+
+// recordDNSLookup keeps the latest lookups per name and resolver
+func (w *WiFiMonitor) recordDNSLookup(lookup DNSLookup) {
+	key := lookup.key()
+	if _, ok := w.dnsLookups[key]; !ok {
+		w.dnsLookupKeys = append(w.dnsLookupKeys, key)
+	}
+	history := append(w.dnsLookups[key], lookup)
+	if len(history) > dnsLookupHistoryLimit {
+		history = history[len(history)-dnsLookupHistoryLimit:]
+	}
+	w.dnsLookups[key] = history
+}
+
+// latestDNSLookups returns the newest lookup of every name and resolver in first-seen order
+func (w *WiFiMonitor) latestDNSLookups() []DNSLookup {
+	var latest []DNSLookup
+	for _, key := range w.dnsLookupKeys {
+		if history := w.dnsLookups[key]; len(history) > 0 {
+			latest = append(latest, history[len(history)-1])
+		}
+	}
+	return latest
+}
+
+// dnsLookupStats builds a stats table row per name and resolver
+func (w *WiFiMonitor) dnsLookupStats() []TargetStats {
+	var rows []TargetStats
+	for _, key := range w.dnsLookupKeys {
+		history := w.dnsLookups[key]
+		stats := TargetStats{Target: "dns:" + key, Success: rateEstimate{total: len(history)}}
+		for _, lookup := range history {
+			if lookup.Error == "" {
+				stats.Success.successes++
+				stats.Latencies = append(stats.Latencies, lookup.Latency)
+			}
+		}
+		if stats.Success.total > 0 {
+			stats.Loss = 100 - stats.Success.rate()
+		}
+		rows = append(rows, stats)
+	}
+	return rows
+}
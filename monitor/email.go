@@ -0,0 +1,251 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Mailer sends alerts and the daily summary through an SMTP relay
+type Mailer struct {
+	addr     string   // Relay host:port (SMTP_HOST)
+	username string   // Login for SMTP AUTH ("" for none)
+	password string   // Password for SMTP AUTH
+	from     string   // Sender address
+	to       []string // Recipient addresses
+	critical bool     // Only critical alerts are mailed (SMTP_ALERT_SEVERITY=critical)
+}
+
+// NewMailer configures the SMTP notifier from SMTP_HOST, SMTP_USERNAME,
+// SMTP_PASSWORD, SMTP_FROM and SMTP_TO. It returns nil when no relay or
+// no recipient is configured.
+func NewMailer(s *config.Settings) *Mailer {
+	host := s.Get("SMTP_HOST")
+	to := s.List("SMTP_TO")
+	if host == "" || len(to) == 0 {
+		if host != "" {
+			fmt.Println("Error configuring email alerts: SMTP_TO is required")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "587")
+	}
+
+	hostname, _ := os.Hostname()
+	return &Mailer{
+		addr:     host,
+		username: s.Get("SMTP_USERNAME"),
+		password: s.Get("SMTP_PASSWORD"),
+		from:     s.String("SMTP_FROM", "noc-watch@"+hostname),
+		to:       to,
+		critical: s.Get("SMTP_ALERT_SEVERITY") == "critical",
+	}
+}
+
+// message builds a plain text RFC 5322 message
+func (m *Mailer) message(subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
+
+// send delivers a message. Port 465 uses implicit TLS; other ports upgrade
+// with STARTTLS when the relay offers it, as venue relays often do not.
+func (m *Mailer) send(subject, body string) error {
+	host, port, _ := net.SplitHostPort(m.addr)
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, host)
+	}
+	if port != "465" {
+		return smtp.SendMail(m.addr, auth, m.from, m.to, m.message(subject, body))
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", m.addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	for _, rcpt := range m.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(m.message(subject, body)); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// notify mails an alert without blocking the monitoring loop
+func (m *Mailer) notify(alert Alert, configHash string) {
+	if m.critical && alert.Labels["severity"] != "critical" {
+		return
+	}
+	payload := alert.payload(configHash)
+	body := chatText(payload, func(s string) string { return s })
+	body += "\n\nTime: " + alert.Timestamp.Format("2006-01-02 15:04:05")
+	labels := make([]string, 0, len(payload.Labels))
+	for key, value := range payload.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	body += "\nLabels: " + strings.Join(labels, ", ")
+	if len(payload.Timeline) > 0 {
+		body += "\n\nTimeline:\n  " + strings.Join(payload.Timeline, "\n  ")
+	}
+	subject := fmt.Sprintf("[noc-watch] %s", strings.SplitN(body, "\n", 2)[0])
+
+	go func() {
+		if err := m.send(subject, body); err != nil {
+			fmt.Printf("Error sending alert %s by email: %v\n", alert.Name, err)
+		}
+	}()
+}
+
+// nextSummaryTime returns the next occurrence of SMTP_SUMMARY_AT (HH:MM,
+// default 08:00) after now in local time
+func nextSummaryTime(s *config.Settings, now time.Time) time.Time {
+	at, err := time.Parse("15:04", s.String("SMTP_SUMMARY_AT", "08:00"))
+	if err != nil {
+		fmt.Printf("Error parsing SMTP_SUMMARY_AT: expected HH:MM\n")
+		at, _ = time.Parse("15:04", "08:00")
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// runDailySummary mails the summary of the last 24 hours once the summary
+// time has passed
+func (w *WiFiMonitor) runDailySummary() {
+	now := time.Now()
+	if now.Before(w.nextSummary) {
+		return
+	}
+	w.nextSummary = nextSummaryTime(w.settings, now)
+
+	subject := fmt.Sprintf("[noc-watch] Daily summary for %s (%s)", w.wifiInterface, now.Format("2006-01-02"))
+	body := w.dailySummary(now)
+	go func() {
+		if err := w.mailer.send(subject, body); err != nil {
+			fmt.Printf("Error sending daily summary by email: %v\n", err)
+		}
+	}()
+}
+
+// dailySummary formats the last 24 hours: success rates, latency, DHCP
+// renewal times, outages and alerts
+func (w *WiFiMonitor) dailySummary(now time.Time) string {
+	cutoff := now.Add(-24 * time.Hour)
+	var lines []string
+	lines = append(lines, fmt.Sprintf("noc-watch summary for %s, %s to %s", w.wifiInterface,
+		cutoff.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04")), w.stamp(), "")
+
+	var pings, dhcps []WiFiTest
+	var latencies, renewals []time.Duration
+	for _, test := range w.historySince(cutoff) {
+		if !countsTowardsStats(w.settings, test.WiFiTest) {
+			continue
+		}
+		if test.Probe == "dhcp" {
+			dhcps = append(dhcps, test.WiFiTest)
+			if test.Success {
+				renewals = append(renewals, test.DHCPRenewTime)
+			}
+			continue
+		}
+		pings = append(pings, test.WiFiTest)
+		if test.Success {
+			latencies = append(latencies, test.Latency)
+		}
+	}
+	lines = append(lines,
+		"Connectivity tests: "+successEstimate(pings).format(w.minRateSamples()),
+		"DHCP renewals: "+successEstimate(dhcps).format(w.minRateSamples()),
+		"Latency: "+percentileSummary(latencies),
+		"DHCP renewal time: "+percentileSummary(renewals),
+		"Availability since start: "+w.availability.String())
+	if summary := w.throughputSummary(); summary != "" {
+		lines = append(lines, "Throughput: "+summary)
+	}
+	if w.natType != nil {
+		lines = append(lines, "NAT type: "+w.natType.String())
+	}
+
+	lines = append(lines, "", "Outages:")
+	outages := 0
+	for _, outage := range w.availability.outages {
+		if outage.End.IsZero() || outage.End.After(cutoff) {
+			outages++
+			lines = append(lines, fmt.Sprintf("  %s for %v", outage.Start.Format("2006-01-02 15:04:05"),
+				outage.Duration(now).Round(time.Second)))
+		}
+	}
+	if outages == 0 {
+		lines = append(lines, "  none")
+	}
+
+	lines = append(lines, "", "Recent alerts:")
+	alerts := 0
+	for _, alert := range w.recentAlerts {
+		if alert.Timestamp.After(cutoff) {
+			alerts++
+			lines = append(lines, "  "+alert.String())
+		}
+	}
+	if alerts == 0 {
+		lines = append(lines, "  none")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// percentileSummary formats the median and p95 of durations
+func percentileSummary(values []time.Duration) string {
+	if len(values) == 0 {
+		return "n/a"
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p50 := sorted[(len(sorted)*50-1)/100]
+	p95 := sorted[(len(sorted)*95-1)/100]
+	return fmt.Sprintf("p50 %v, p95 %v (n=%d)", p50.Round(time.Millisecond), p95.Round(time.Millisecond), len(sorted))
+}
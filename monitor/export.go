@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// exportedTest is a DHCP or ping test with its kind, as exported
+type exportedTest struct {
+	Probe string `json:"probe"` // dhcp or ping
+	WiFiTest
+}
+
+// exportColumns are the fixed CSV columns; per-target columns follow them
+var exportColumns = []string{
+	"timestamp", "probe", "success", "ipv4", "ipv6",
+	"latency_ms", "latency_min_ms", "latency_max_ms", "jitter_ms", "loss_percent",
+	"dhcp_renew_ms", "upstream_failure", "disrupted", "failed_targets",
+}
+
+// historySince returns the DHCP and ping tests taken after the cutoff in time order
+func (w *WiFiMonitor) historySince(cutoff time.Time) []exportedTest {
+	var tests []exportedTest
+	for _, test := range w.dhcpTests {
+		if !test.Timestamp.Before(cutoff) {
+			tests = append(tests, exportedTest{"dhcp", test})
+		}
+	}
+	for _, test := range w.pingTests {
+		if !test.Timestamp.Before(cutoff) {
+			tests = append(tests, exportedTest{"ping", test})
+		}
+	}
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].Timestamp.Before(tests[j].Timestamp) })
+	return tests
+}
+
+// millis formats a duration in milliseconds for spreadsheets
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// formatCSV writes the tests with one column per metric. Every ping target
+// seen in the tests gets a latency and a loss column.
+func formatCSV(tests []exportedTest) string {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, test := range tests {
+		for _, result := range test.Targets {
+			if !seen[result.Name] {
+				seen[result.Name] = true
+				targets = append(targets, result.Name)
+			}
+		}
+	}
+
+	header := append([]string{}, exportColumns...)
+	for _, target := range targets {
+		header = append(header, "target_"+target+"_latency_ms", "target_"+target+"_loss_percent")
+	}
+
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	out.Write(header)
+	for _, test := range tests {
+		row := []string{
+			test.Timestamp.Format(time.RFC3339),
+			test.Probe,
+			strconv.FormatBool(test.Success),
+			strconv.FormatBool(test.IPv4Connectivity),
+			strconv.FormatBool(test.IPv6Connectivity),
+			millis(test.Latency),
+			millis(test.MinLatency),
+			millis(test.MaxLatency),
+			millis(test.Jitter),
+			strconv.FormatFloat(test.Loss, 'f', 1, 64),
+			millis(test.DHCPRenewTime),
+			strconv.FormatBool(test.UpstreamFailure),
+			strconv.FormatBool(test.Disrupted),
+			strings.Join(failedTargets(test.WiFiTest), " "),
+		}
+
+		// Targets missing from a test leave their cells empty
+		results := make(map[string]TargetResult)
+		for _, result := range test.Targets {
+			results[result.Name] = result
+		}
+		for _, target := range targets {
+			result, ok := results[target]
+			switch {
+			case !ok:
+				row = append(row, "", "")
+			case !result.Success:
+				row = append(row, "", strconv.FormatFloat(result.Loss, 'f', 1, 64))
+			default:
+				row = append(row, millis(result.Latency), strconv.FormatFloat(result.Loss, 'f', 1, 64))
+			}
+		}
+		out.Write(row)
+	}
+	out.Flush()
+	return buf.String()
+}
+
+// handleExportCommand answers `export SINCE` on the control socket with the
+// in-memory history as CSV
+func (w *WiFiMonitor) handleExportCommand(arg string) string {
+	since, err := time.ParseDuration(strings.TrimSpace(arg))
+	if err != nil || since <= 0 {
+		return fmt.Sprintf("error: invalid duration %q\n", arg)
+	}
+	return formatCSV(w.historySince(time.Now().Add(-since)))
+}
+
+// readJSONLHistory reads the DHCP and ping tests taken after the cutoff from
+// the JSON Lines output, for exports while the monitor is not running
+func readJSONLHistory(path string, cutoff time.Time) ([]exportedTest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tests []exportedTest
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var test exportedTest
+		if json.Unmarshal(scanner.Bytes(), &test) != nil {
+			continue // Not a record, e.g. a message on a shared stdout capture
+		}
+		if (test.Probe == "dhcp" || test.Probe == "ping") && !test.Timestamp.Before(cutoff) {
+			tests = append(tests, test)
+		}
+	}
+	return tests, scanner.Err()
+}
+
+// readStoredHistory reads the DHCP and ping tests taken after the cutoff
+// from the history database, or from the JSON Lines output (RESULTS_JSONL)
+// when there is no database
+func readStoredHistory(s *config.Settings, cutoff time.Time) ([]exportedTest, error) {
+	path := storage.HistoryPath(s, s.String("LOG_FILE", "noc-watch.log"))
+	if _, err := os.Stat(path); path == "" || err != nil {
+		jsonl := s.Get("RESULTS_JSONL")
+		if jsonl == "" || jsonl == storage.JSONLStdout {
+			return nil, fmt.Errorf("no history database or JSON Lines output found")
+		}
+		return readJSONLHistory(jsonl, cutoff)
+	}
+
+	store, err := storage.OpenHistory(path, historyKinds...)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	w := &WiFiMonitor{}
+	if err := store.Load("dhcp", cutoff, &w.dhcpTests); err != nil {
+		return nil, err
+	}
+	if err := store.Load("ping", cutoff, &w.pingTests); err != nil {
+		return nil, err
+	}
+	return w.historySince(cutoff), nil
+}
+
+// runExportCommand implements `noc-watch export [--format csv] [--since DUR]`.
+// The running monitor answers with its in-memory history; without one the
+// history is read from the history database or the JSON Lines output.
+func runExportCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "output format (csv)")
+	since := fs.Duration("since", 24*time.Hour, "export tests taken within this period")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *format != "csv" {
+		fmt.Fprintf(os.Stderr, "unsupported format %q (available: csv)\n", *format)
+		return exitUsage
+	}
+
+	response, err := sendControl(s, fmt.Sprintf("export %v", *since))
+	if err != nil {
+		tests, readErr := readStoredHistory(s, time.Now().Add(-*since))
+		if readErr != nil {
+			fmt.Printf("Error exporting history: %v (%v)\n", readErr, err)
+			return exitError
+		}
+		response = formatCSV(tests)
+	}
+	if strings.HasPrefix(response, "error: ") {
+		fmt.Fprint(os.Stderr, response)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
+
+// exportFromTUI writes the history of the last EXPORT_SINCE (default 24h) to
+// a CSV file next to the log. The history is read by the monitoring loop, so
+// the export runs off the UI goroutine.
+func (w *WiFiMonitor) exportFromTUI() {
+	since := w.settings.Duration("EXPORT_SINCE", 24*time.Hour)
+	path := filepath.Join(filepath.Dir(w.logFile), "noc-watch-"+time.Now().Format("20060102-150405")+".csv")
+
+	go func() {
+		req := controlRequest{command: fmt.Sprintf("export %v", since), reply: make(chan string, 1)}
+		w.controlRequests <- req
+		message := fmt.Sprintf("Exported the last %v to\n\n%s", since, path)
+		if err := os.WriteFile(path, []byte(<-req.reply), 0644); err != nil {
+			message = fmt.Sprintf("Error writing export: %v", err)
+		}
+
+		w.tui.Queue(func() { w.tui.ShowMessage("export", message) })
+	}()
+}
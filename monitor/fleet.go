@@ -0,0 +1,310 @@
+package monitor
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marokiki/noc-watch/client"
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// fleetTimeout bounds the status query of each agent of the fleet
+const fleetTimeout = 5 * time.Second
+
+// fleetAgent is the placement and health of one agent of the fleet
+type fleetAgent struct {
+	Name      string            `json:"name"`                       // Host name of the agent (the URL host when unreachable)
+	Workspace string            `json:"workspace,omitempty"`        // WORKSPACE the agent reports to ("" when unknown or unset)
+	URL       string            `json:"url,omitempty"`              // API of the agent ("" for this agent)
+	Location  map[string]string `json:"location,omitempty"`         // AGENT_LOCATION of the agent; x and y are pixels on the floor plan
+	State     string            `json:"connectivity"`               // healthy, degraded or down ("" when unknown)
+	Health    float64           `json:"health_score"`               // Success percentage of the last hour
+	Dominant  string            `json:"dominant_failure,omitempty"` // Most frequent failure class of the last hour
+	Alerts    []string          `json:"alerts"`                     // Firing alerts by name
+	Error     string            `json:"error,omitempty"`            // Why the agent could not be queried
+}
+
+// fleetRanking is the response of /api/fleet
+type fleetRanking struct {
+	Workspace  string       `json:"workspace,omitempty"` // Workspace the agents were filtered by
+	Workspaces []string     `json:"workspaces"`          // Every workspace reported by the fleet
+	Worst      int          `json:"worst"`               // Number of agents at the top to highlight
+	Agents     []fleetAgent `json:"agents"`              // Agents from the worst to the healthiest
+}
+
+// newFleetAgent converts the /api/status response of an agent
+func newFleetAgent(status client.Status) fleetAgent {
+	alerts := status.Alerts
+	if alerts == nil {
+		alerts = []string{}
+	}
+	return fleetAgent{
+		Name:      status.Agent,
+		Workspace: status.Workspace,
+		Location:  status.Location,
+		State:     status.State,
+		Health:    status.Health,
+		Dominant:  status.Dominant,
+		Alerts:    alerts,
+	}
+}
+
+// where names the place of the agent from the floor and room of its
+// AGENT_LOCATION (e.g. "floor 2, Hall A")
+func (a fleetAgent) where() string {
+	var parts []string
+	if floor := a.Location["floor"]; floor != "" {
+		parts = append(parts, "floor "+floor)
+	}
+	if room := a.Location["room"]; room != "" {
+		parts = append(parts, room)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// queryFleetAgents queries the status of the other agents of FLEET_AGENTS
+// (base URLs of their APIs) in parallel, with FLEET_AGENTS_TOKEN (API_TOKEN
+// by default) and the client TLS configuration of FLEET_AGENTS_TLS_*
+func queryFleetAgents(ctx context.Context, s *config.Settings) []fleetAgent {
+	urls := s.List("FLEET_AGENTS")
+	agents := make([]fleetAgent, len(urls))
+	if len(urls) == 0 {
+		return agents
+	}
+
+	for i, base := range urls {
+		agents[i] = fleetAgent{Name: base, URL: base, Alerts: []string{}}
+		if u, err := url.Parse(base); err == nil && u.Hostname() != "" {
+			agents[i].Name = u.Hostname()
+		}
+	}
+
+	httpClient := &http.Client{Timeout: fleetTimeout}
+	tlsConfig, err := clientTLSConfig(s, "FLEET_AGENTS_TLS")
+	if err != nil {
+		for i := range agents {
+			agents[i].Error = fmt.Sprintf("TLS configuration: %v", err)
+		}
+		return agents
+	}
+	if tlsConfig != nil {
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	token := s.String("FLEET_AGENTS_TOKEN", s.Get("API_TOKEN"))
+
+	var wg sync.WaitGroup
+	for i := range agents {
+		wg.Add(1)
+		go func(agent *fleetAgent) {
+			defer wg.Done()
+			api := client.NewREST(agent.URL, token)
+			api.HTTPClient = httpClient
+			status, err := api.Status(ctx)
+			if err != nil {
+				agent.Error = err.Error()
+				return
+			}
+			*agent = newFleetAgent(status)
+			agent.URL = api.BaseURL
+		}(&agents[i])
+	}
+	wg.Wait()
+	return agents
+}
+
+// fleetOf returns this agent, given its /api/status response, followed by
+// the agents of FLEET_AGENTS
+func fleetOf(ctx context.Context, s *config.Settings, self string) ([]fleetAgent, error) {
+	var status client.Status
+	if err := json.Unmarshal([]byte(self), &status); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, fleetTimeout)
+	defer cancel()
+	return append([]fleetAgent{newFleetAgent(status)}, queryFleetAgents(ctx, s)...), nil
+}
+
+// rankFleet sorts agents from the worst to the healthiest: unreachable
+// agents first, then by health score and by the number of firing alerts
+func rankFleet(agents []fleetAgent) {
+	sort.SliceStable(agents, func(i, j int) bool {
+		a, b := agents[i], agents[j]
+		if (a.Error != "") != (b.Error != "") {
+			return a.Error != ""
+		}
+		if a.Health != b.Health {
+			return a.Health < b.Health
+		}
+		if len(a.Alerts) != len(b.Alerts) {
+			return len(a.Alerts) > len(b.Alerts)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// fleetWorst returns how many of the worst agents to highlight: ?worst= of
+// the request, or FLEET_WORST (default 5)
+func fleetWorst(s *config.Settings, value string) (int, error) {
+	if value == "" {
+		return s.Int("FLEET_WORST", 5), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid worst %q: expected a count", value)
+	}
+	return n, nil
+}
+
+// fleetWorkspaces returns the workspaces reported by the reachable agents,
+// sorted, with "" for agents without WORKSPACE
+func fleetWorkspaces(agents []fleetAgent) []string {
+	seen := make(map[string]bool)
+	workspaces := []string{}
+	for _, agent := range agents {
+		if agent.Error == "" && !seen[agent.Workspace] {
+			seen[agent.Workspace] = true
+			workspaces = append(workspaces, agent.Workspace)
+		}
+	}
+	sort.Strings(workspaces)
+	return workspaces
+}
+
+// inWorkspace keeps the agents reporting a workspace. Unreachable agents
+// are kept too, as their workspace is unknown.
+func inWorkspace(agents []fleetAgent, workspace string) []fleetAgent {
+	kept := []fleetAgent{}
+	for _, agent := range agents {
+		if agent.Error != "" || agent.Workspace == workspace {
+			kept = append(kept, agent)
+		}
+	}
+	return kept
+}
+
+// writeFleetCSV writes the fleet ranking as a CSV report, one agent per row
+func writeFleetCSV(out io.Writer, ranking fleetRanking) error {
+	records := [][]string{{"rank", "worst", "workspace", "agent", "location", "connectivity", "health_score", "dominant_failure", "alerts", "error"}}
+	for i, agent := range ranking.Agents {
+		records = append(records, []string{
+			strconv.Itoa(i + 1),
+			strconv.FormatBool(i < ranking.Worst),
+			agent.Workspace,
+			agent.Name,
+			agent.where(),
+			agent.State,
+			strconv.FormatFloat(agent.Health, 'f', 1, 64),
+			agent.Dominant,
+			strings.Join(agent.Alerts, " "),
+			agent.Error,
+		})
+	}
+	return csv.NewWriter(out).WriteAll(records)
+}
+
+// serveFleet implements /api/fleet?worst=N&workspace=NAME&format=csv: this
+// agent and the agents of FLEET_AGENTS ranked from the worst to the
+// healthiest, so the NOC sees which room needs a volunteer first. With
+// workspace, or a token of WORKSPACE_TOKENS, only the agents of that event
+// or venue are ranked.
+func (w *WiFiMonitor) serveFleet(rw http.ResponseWriter, r *http.Request) {
+	scope, ok := apiReadScope(w.settings, rw, r)
+	if !ok {
+		return
+	}
+	workspace, filtered, ok := scopedWorkspace(rw, r, scope)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	worst, err := fleetWorst(w.settings, query.Get("worst"))
+	if err != nil {
+		writeAPIError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	response, ok := w.queryMonitor(rw, r, apiCommand+"status")
+	if !ok {
+		return
+	}
+	agents, err := fleetOf(r.Context(), w.settings, response)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ranking := fleetRanking{Workspaces: fleetWorkspaces(agents), Worst: worst}
+	if filtered {
+		ranking.Workspace = workspace
+		agents = inWorkspace(agents, workspace)
+	}
+	if scope != "" {
+		// A workspace token does not learn which other events share the collector
+		ranking.Workspaces = []string{scope}
+	}
+	rankFleet(agents)
+	ranking.Agents = agents
+
+	if query.Get("format") == "csv" {
+		rw.Header().Set("Content-Type", "text/csv")
+		writeFleetCSV(rw, ranking)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(ranking)
+}
+
+// fleetColumns are the headers of the fleet ranking in the TUI
+var fleetColumns = []string{"Workspace", "#", "Agent", "Location", "State", "Health", "Dominant failure", "Alerts"}
+
+// showFleet opens the fleet ranking of each workspace with its worst
+// FLEET_WORST agents in red. The status of this agent is read by the
+// monitoring loop and the other agents are queried over the network, so it
+// is built off the UI goroutine.
+func (w *WiFiMonitor) showFleet() {
+	worst := w.settings.Int("FLEET_WORST", 5)
+
+	go func() {
+		status, ok := w.command(apiCommand + "status")
+		if !ok {
+			return
+		}
+		agents, err := fleetOf(context.Background(), w.settings, status)
+		rankFleet(agents)
+		sort.SliceStable(agents, func(i, j int) bool {
+			return agents[i].Workspace < agents[j].Workspace
+		})
+
+		w.tui.Queue(func() {
+			if err != nil {
+				w.tui.ShowMessage("fleet", fmt.Sprintf("Error reading fleet: %v", err))
+				return
+			}
+
+			table := ui.Table{Title: fmt.Sprintf(" Fleet ranking, worst %d in red (Esc to close) ", worst), Headers: fleetColumns}
+			rank := 0
+			for i, agent := range agents {
+				if rank++; i > 0 && agent.Workspace != agents[i-1].Workspace {
+					rank = 1
+				}
+				state, health, alerts := agent.State, fmt.Sprintf("%.1f", agent.Health), strings.Join(agent.Alerts, ", ")
+				if agent.Error != "" {
+					state, health, alerts = "unreachable", "-", agent.Error
+				}
+				table.Rows = append(table.Rows, []string{agent.Workspace, strconv.Itoa(rank), agent.Name, agent.where(), state, health, agent.Dominant, alerts})
+				table.Red = append(table.Red, rank <= worst)
+			}
+			w.tui.ShowTable("fleet", table, nil)
+		})
+	}()
+}
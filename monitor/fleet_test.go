@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+func TestRankFleet(t *testing.T) {
+	agents := []fleetAgent{
+		{Name: "hall-a", Health: 99.5, Alerts: []string{}},
+		{Name: "probe05", Error: "connection refused", Alerts: []string{}},
+		{Name: "room-201", Health: 62, Dominant: "dhcp_timeout", Alerts: []string{"dhcp_failed"}},
+		{Name: "room-202", Health: 62, Dominant: "dns", Alerts: []string{"dns_failed", "ping_loss"}},
+		{Name: "foyer", Health: 99.5, Alerts: []string{}},
+		{Name: "probe04", Error: "timeout", Alerts: []string{}},
+	}
+	rankFleet(agents)
+
+	var got []string
+	for _, agent := range agents {
+		got = append(got, agent.Name)
+	}
+	want := []string{"probe04", "probe05", "room-202", "room-201", "foyer", "hall-a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankFleet() = %v, want %v", got, want)
+	}
+}
+
+func TestFleetWorst(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", want: 5},
+		{name: "FLEET_WORST", setting: "3", want: 3},
+		{name: "query overrides the setting", setting: "3", value: "10", want: 10},
+		{name: "zero", value: "0", want: 0},
+		{name: "negative", value: "-1", wantErr: true},
+		{name: "not a number", value: "all", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"FLEET_WORST": tt.setting})
+			got, err := fleetWorst(s, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fleetWorst() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("fleetWorst() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFleetWorkspaces(t *testing.T) {
+	agents := []fleetAgent{
+		{Name: "collector"},
+		{Name: "hall-a", Workspace: "conf-2026-spring"},
+		{Name: "probe05", Error: "timeout"},
+		{Name: "room-201", Workspace: "conf-2026-autumn"},
+		{Name: "foyer", Workspace: "conf-2026-spring"},
+	}
+	if got, want := fleetWorkspaces(agents), []string{"", "conf-2026-autumn", "conf-2026-spring"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fleetWorkspaces() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		workspace string
+		want      []string
+	}{
+		{workspace: "conf-2026-spring", want: []string{"hall-a", "probe05", "foyer"}},
+		{workspace: "", want: []string{"collector", "probe05"}},
+		{workspace: "unknown", want: []string{"probe05"}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.workspace), func(t *testing.T) {
+			got := []string{}
+			for _, agent := range inWorkspace(agents, tt.workspace) {
+				got = append(got, agent.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inWorkspace(%q) = %v, want %v", tt.workspace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFloorPlanPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		floorPlan string
+		workspace string
+		want      string
+		wantErr   bool
+	}{
+		{name: "default", want: "/var/log/noc-watch/floorplan"},
+		{name: "default of a workspace", workspace: "conf-2026", want: "/var/log/noc-watch/floorplan-conf-2026"},
+		{name: "FLOOR_PLAN", floorPlan: "/srv/hall.png", want: "/srv/hall.png"},
+		{name: "FLOOR_PLAN of a workspace", floorPlan: "/srv/hall.png", workspace: "conf_2026.b", want: "/srv/hall-conf_2026.b.png"},
+		{name: "path in the workspace", workspace: "../etc/passwd", wantErr: true},
+		{name: "hidden workspace", workspace: ".conf", wantErr: true},
+		{name: "separator in the workspace", workspace: "conf/2026", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"FLOOR_PLAN": tt.floorPlan})
+			got, err := floorPlanPath(s, "/var/log/noc-watch/noc-watch.log", tt.workspace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("floorPlanPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("floorPlanPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
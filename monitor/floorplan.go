@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// floorPlanMaxSize bounds an uploaded floor plan image
+const floorPlanMaxSize = 10 << 20
+
+// floorPlanTypes are the image types accepted as floor plan. SVG is refused
+// as it could run script in the origin of the dashboard.
+var floorPlanTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+// floorPlan is the response of /api/floorplan
+type floorPlan struct {
+	Image  bool         `json:"image"`  // A floor plan image is available at /api/floorplan/image
+	Agents []fleetAgent `json:"agents"` // This agent followed by the FLEET_AGENTS (of the workspace)
+}
+
+// workspaceName matches the workspaces whose floor plan images are kept, as
+// the workspace becomes part of the file name
+var workspaceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// floorPlanPath returns FLOOR_PLAN, defaulting to a file next to the log.
+// The image of a workspace sits next to it with the workspace appended to
+// the name (hall-conf-2026.png for hall.png).
+func floorPlanPath(s *config.Settings, logFile, workspace string) (string, error) {
+	path := s.String("FLOOR_PLAN", filepath.Join(filepath.Dir(logFile), "floorplan"))
+	if workspace == "" {
+		return path, nil
+	}
+	if !workspaceName.MatchString(workspace) {
+		return "", fmt.Errorf("invalid workspace %q: expected letters, digits, '.', '_' or '-'", workspace)
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + workspace + ext, nil
+}
+
+// serveFloorPlan implements /api/floorplan?workspace=NAME: the placement
+// and health of this agent and of the agents in FLEET_AGENTS, which the
+// dashboard draws as colored markers on the floor plan image. With
+// workspace, or a token of WORKSPACE_TOKENS, only the agents of that
+// workspace are placed on its image.
+func (w *WiFiMonitor) serveFloorPlan(rw http.ResponseWriter, r *http.Request) {
+	scope, ok := apiReadScope(w.settings, rw, r)
+	if !ok {
+		return
+	}
+	workspace, filtered, ok := scopedWorkspace(rw, r, scope)
+	if !ok {
+		return
+	}
+	path, err := floorPlanPath(w.settings, w.logFile, workspace)
+	if err != nil {
+		writeAPIError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	response, ok := w.queryMonitor(rw, r, apiCommand+"status")
+	if !ok {
+		return
+	}
+	agents, err := fleetOf(r.Context(), w.settings, response)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filtered {
+		agents = inWorkspace(agents, workspace)
+	}
+
+	plan := floorPlan{Agents: agents}
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		plan.Image = true
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(plan)
+}
+
+// serveFloorPlanImage serves the floor plan image (of ?workspace=) on GET
+// and replaces it with the PNG, JPEG, GIF or WebP image in the body of a PUT.
+// A token of WORKSPACE_TOKENS only reads and replaces its own workspace's.
+func (w *WiFiMonitor) serveFloorPlanImage(rw http.ResponseWriter, r *http.Request) {
+	var scope string
+	var ok bool
+	if r.Method == http.MethodPut {
+		if scope, ok = apiWriteScope(w.settings, r); !ok {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else if scope, ok = apiReadScope(w.settings, rw, r); !ok {
+		return
+	}
+	workspace, _, ok := scopedWorkspace(rw, r, scope)
+	if !ok {
+		return
+	}
+	path, err := floorPlanPath(w.settings, w.logFile, workspace)
+	if err != nil {
+		writeAPIError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.Method != http.MethodPut {
+		rw.Header().Set("X-Content-Type-Options", "nosniff")
+		rw.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(rw, r, path)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, floorPlanMaxSize))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("floor plan larger than %d MB", floorPlanMaxSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if kind := http.DetectContentType(data); !floorPlanTypes[kind] {
+		http.Error(rw, fmt.Sprintf("unsupported floor plan type %s (PNG, JPEG, GIF or WebP)", strings.Split(kind, ";")[0]), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Replace the image atomically so a concurrent GET never sees half of it
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,246 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+	"golang.org/x/net/ipv6"
+)
+
+// gatewayProbeAttempts is the number of ARP requests or neighbor
+// solicitations sent before the gateway counts as unreachable
+const gatewayProbeAttempts = 3
+
+// gatewayProbeWait is the time to wait for the reply to one request
+const gatewayProbeWait = 1 * time.Second
+
+// errNoReply means the gateway was asked but did not answer, as opposed to
+// the probe not being possible at all
+var errNoReply = errors.New("no reply")
+
+// GatewayProbe is the link-layer reachability of a default gateway: an ARP
+// request for the IPv4 gateway or a neighbor solicitation for the IPv6 one
+type GatewayProbe struct {
+	Gateway   string        `json:"gateway"`          // Gateway address from the routing table
+	Family    string        `json:"family"`           // ipv4 (ARP) or ipv6 (NDP)
+	MAC       string        `json:"mac,omitempty"`    // Hardware address the gateway answered with
+	RTT       time.Duration `json:"rtt_ns,omitempty"` // Request until the reply
+	Reachable bool          `json:"reachable"`        // The gateway answered
+	Error     string        `json:"error,omitempty"`  // Why the gateway is not reachable
+}
+
+// String formats the probe for the log and the UI
+func (p GatewayProbe) String() string {
+	method := "ARP"
+	if p.Family == "ipv6" {
+		method = "NDP"
+	}
+	if !p.Reachable {
+		return fmt.Sprintf("%s %s FAIL (%s)", p.Gateway, method, p.Error)
+	}
+	return fmt.Sprintf("%s %s %v (%s)", p.Gateway, method, p.RTT.Round(10*time.Microsecond), p.MAC)
+}
+
+// arpProbe resolves the IPv4 gateway with ARP requests on a packet socket,
+// bypassing the kernel's neighbor cache. It needs CAP_NET_RAW.
+func arpProbe(iface string, gateway net.IP) (net.HardwareAddr, time.Duration, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, 0, fmt.Errorf("%s has no Ethernet address", iface)
+	}
+	source := probe.InterfaceIPv4(iface)
+	if source == nil {
+		return nil, 0, fmt.Errorf("no IPv4 address on %s", iface)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, int(probe.Htons(syscall.ETH_P_ARP)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("packet socket (needs CAP_NET_RAW): %v", err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: probe.Htons(syscall.ETH_P_ARP), Ifindex: ifi.Index}); err != nil {
+		return nil, 0, err
+	}
+	timeout := syscall.NsecToTimeval(int64(100 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return nil, 0, err
+	}
+
+	// Ethernet/IPv4 request: who has the gateway, tell our address
+	request := make([]byte, 28)
+	binary.BigEndian.PutUint16(request[0:2], 1)
+	binary.BigEndian.PutUint16(request[2:4], syscall.ETH_P_IP)
+	request[4], request[5] = 6, 4
+	binary.BigEndian.PutUint16(request[6:8], 1)
+	copy(request[8:14], ifi.HardwareAddr)
+	copy(request[14:18], source.To4())
+	copy(request[24:28], gateway.To4())
+	broadcast := &syscall.SockaddrLinklayer{
+		Protocol: probe.Htons(syscall.ETH_P_ARP),
+		Ifindex:  ifi.Index,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < gatewayProbeAttempts; attempt++ {
+		start := time.Now()
+		if err := syscall.Sendto(fd, request, 0, broadcast); err != nil {
+			return nil, 0, err
+		}
+		for time.Since(start) < gatewayProbeWait {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// A reply from the gateway's address, whatever else is said on the link
+			reply := buf[:n]
+			if len(reply) < 28 || binary.BigEndian.Uint16(reply[6:8]) != 2 || !net.IP(reply[14:18]).Equal(gateway) {
+				continue
+			}
+			return net.HardwareAddr(append([]byte(nil), reply[8:14]...)), time.Since(start), nil
+		}
+	}
+	return nil, 0, errNoReply
+}
+
+// solicitedNodeAddr returns the solicited-node multicast address of an IPv6 address
+func solicitedNodeAddr(ip net.IP) net.IP {
+	addr := net.ParseIP("ff02::1:ff00:0")
+	copy(addr[13:], ip.To16()[13:])
+	return addr
+}
+
+// ndpProbe resolves the IPv6 gateway with neighbor solicitations and times
+// the neighbor advertisement. It needs CAP_NET_RAW.
+func ndpProbe(iface string, gateway net.IP) (net.HardwareAddr, time.Duration, error) {
+	conn, err := probe.ListenNeighborDiscovery(iface, ipv6.ICMPTypeNeighborAdvertisement)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	// Solicitation for the gateway with our link-layer address
+	msg := make([]byte, 24)
+	msg[0] = byte(ipv6.ICMPTypeNeighborSolicitation)
+	copy(msg[8:24], gateway.To16())
+	if ifi, err := net.InterfaceByName(iface); err == nil && len(ifi.HardwareAddr) == 6 {
+		msg = append(msg, probe.NDOptSourceLinkAddr, 1)
+		msg = append(msg, ifi.HardwareAddr...)
+	}
+	dst := &net.IPAddr{IP: solicitedNodeAddr(gateway), Zone: iface}
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < gatewayProbeAttempts; attempt++ {
+		start := time.Now()
+		if _, err := conn.WriteTo(msg, nil, dst); err != nil {
+			return nil, 0, err
+		}
+		conn.SetReadDeadline(start.Add(gatewayProbeWait))
+		for {
+			n, cm, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			reply := buf[:n]
+			if (cm != nil && cm.HopLimit != 255) || len(reply) < 24 || !net.IP(reply[8:24]).Equal(gateway) {
+				continue
+			}
+
+			// The target link-layer address option carries the gateway's MAC
+			var mac net.HardwareAddr
+			for opts := reply[24:]; len(opts) >= 8 && opts[1] > 0 && int(opts[1])*8 <= len(opts); opts = opts[int(opts[1])*8:] {
+				if opts[0] == probe.NDOptTargetLinkAddr {
+					mac = net.HardwareAddr(append([]byte(nil), opts[2:8]...))
+				}
+			}
+			return mac, time.Since(start), nil
+		}
+	}
+	return nil, 0, errNoReply
+}
+
+// probeGateways checks the ARP/NDP reachability of the interface's default
+// gateways, so a dead first hop can be told apart from a dead upstream
+func probeGateways(iface string) []GatewayProbe {
+	var probes []GatewayProbe
+	for _, gateway := range []struct {
+		family  string
+		address string
+		probe   func(string, net.IP) (net.HardwareAddr, time.Duration, error)
+	}{
+		{"ipv4", probe.DefaultGateway(iface), arpProbe},
+		{"ipv6", probe.DefaultGatewayIPv6(iface), ndpProbe},
+	} {
+		ip := net.ParseIP(gateway.address)
+		if ip == nil {
+			continue
+		}
+		probe := GatewayProbe{Gateway: gateway.address, Family: gateway.family}
+		mac, rtt, err := gateway.probe(iface, ip)
+		if err != nil {
+			probe.Error = err.Error()
+		} else {
+			probe.Reachable, probe.RTT = true, rtt
+			if mac != nil {
+				probe.MAC = mac.String()
+			}
+		}
+		probes = append(probes, probe)
+	}
+	return probes
+}
+
+// gatewayUnreachable reports whether gateways were asked and none answered
+func gatewayUnreachable(probes []GatewayProbe) bool {
+	unanswered := false
+	for _, probe := range probes {
+		if probe.Reachable {
+			return false
+		}
+		if probe.Error == errNoReply.Error() {
+			unanswered = true
+		}
+	}
+	return unanswered
+}
+
+// gatewaySummary joins the gateway probes for the UI and the log
+func gatewaySummary(probes []GatewayProbe) string {
+	var parts []string
+	for _, probe := range probes {
+		parts = append(parts, probe.String())
+	}
+	return strings.Join(parts, " | ")
+}
+
+// attachGatewayProbes probes the default gateways in every test cycle
+// unless GATEWAY_PROBE=false, and raises gateway_unreachable when none of
+// them answers
+func (w *WiFiMonitor) attachGatewayProbes(test *WiFiTest) {
+	if w.settings.Get("GATEWAY_PROBE") == "false" {
+		return
+	}
+	test.Gateways = probeGateways(w.wifiInterface)
+	w.gateways = test.Gateways
+
+	var gateways []string
+	for _, probe := range test.Gateways {
+		gateways = append(gateways, probe.Gateway)
+	}
+	w.setAlert("gateway_unreachable", gatewayUnreachable(test.Gateways),
+		fmt.Sprintf("Default gateway %s does not answer ARP/NDP on %s", strings.Join(gateways, ", "), w.wifiInterface))
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// healthWindow is the period of test history used for the health score
+const healthWindow = time.Hour
+
+// Health summarizes recent test results as a single score for fleet ranking
+type Health struct {
+	Score    float64        // Percentage of successful tests in the window (100 without data)
+	Dominant string         // Most frequent failure class ("" when nothing failed)
+	Failures map[string]int // Failed tests per failure class
+}
+
+// failureClass returns why a failed test failed: a WiFi authentication
+// failure, no IPv4 connectivity, no latency measurement, or (with both
+// present) the DHCP renewal
+func failureClass(test WiFiTest) string {
+	switch {
+	case test.AuthFailure != "":
+		return "auth"
+	case gatewayUnreachable(test.Gateways):
+		return "gateway"
+	case !test.IPv4Connectivity:
+		return "ipv4"
+	case test.Latency <= 0:
+		return "latency"
+	default:
+		return "dhcp"
+	}
+}
+
+// health computes the health score and dominant failure class of the last hour
+func (w *WiFiMonitor) health(now time.Time) Health {
+	health := Health{Score: 100, Failures: make(map[string]int)}
+
+	var total, successes int
+	for _, tests := range [][]WiFiTest{w.dhcpTests, headlineTests(w.settings, w.pingTests)} {
+		for _, test := range tests {
+			if now.Sub(test.Timestamp) > healthWindow {
+				continue
+			}
+			total++
+			if test.Success {
+				successes++
+			} else {
+				health.Failures[failureClass(test)]++
+			}
+		}
+	}
+	if total > 0 {
+		health.Score = float64(successes) / float64(total) * 100
+	}
+
+	for class, count := range health.Failures {
+		if count > health.Failures[health.Dominant] || (count == health.Failures[health.Dominant] && class < health.Dominant) {
+			health.Dominant = class
+		}
+	}
+	return health
+}
+
+// String formats the health for the UI and log file
+func (h Health) String() string {
+	if h.Dominant == "" {
+		return fmt.Sprintf("%.1f", h.Score)
+	}
+	return fmt.Sprintf("%.1f (mostly %s failures)", h.Score, h.Dominant)
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// dhcpRenewBuckets are exponential upper bounds in seconds (50ms doubling up to ~100s)
+var dhcpRenewBuckets = exponentialBuckets(0.05, 2, 12)
+
+// minHistogramSamples is the number of renewals needed before the p95 is alerted on
+const minHistogramSamples = 5
+
+// exponentialBuckets returns count upper bounds starting at start, each factor times the previous
+func exponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// histogram counts observations in fixed buckets, like a Prometheus histogram
+type histogram struct {
+	bounds []float64 // Bucket upper bounds in ascending order
+	counts []uint64  // Observations per bucket; the last entry is the +Inf bucket
+	sum    float64   // Sum of all observations
+	count  uint64    // Number of observations
+}
+
+// newHistogram creates an empty histogram with the given bucket bounds
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe adds one observation
+func (h *histogram) observe(value float64) {
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+// quantile estimates the q-quantile by linear interpolation inside the bucket
+// that contains it, as histogram_quantile does. Values in the +Inf bucket are
+// reported as the highest bound.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+	var cumulative uint64
+	for i, n := range h.counts {
+		if float64(cumulative+n) < rank || n == 0 {
+			cumulative += n
+			continue
+		}
+		if i == len(h.bounds) {
+			return h.bounds[len(h.bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		return lower + (h.bounds[i]-lower)*(rank-float64(cumulative))/float64(n)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// cumulative returns the Prometheus style le label and cumulative count of every bucket
+func (h *histogram) cumulative() ([]string, []uint64) {
+	var les []string
+	var counts []uint64
+	var total uint64
+	for i, n := range h.counts {
+		total += n
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		les = append(les, le)
+		counts = append(counts, total)
+	}
+	return les, counts
+}
+
+// recentDHCPRenewals returns a histogram of the successful renewals within window
+func (w *WiFiMonitor) recentDHCPRenewals(now time.Time, window time.Duration) *histogram {
+	h := newHistogram(dhcpRenewBuckets)
+	for _, test := range w.dhcpTests {
+		if test.Success && now.Sub(test.Timestamp) <= window {
+			h.observe(test.DHCPRenewTime.Seconds())
+		}
+	}
+	return h
+}
+
+// checkDHCPTailAlert alerts when the p95 renewal time of the recent window
+// crosses DHCP_P95_THRESHOLD, catching a slowly drowning DHCP server while
+// every renewal still succeeds
+func (w *WiFiMonitor) checkDHCPTailAlert() {
+	threshold := w.settings.Duration("DHCP_P95_THRESHOLD", 3*time.Second)
+	recent := w.recentDHCPRenewals(time.Now(), w.settings.Duration("DHCP_P95_WINDOW", 1*time.Hour))
+	if recent.count < minHistogramSamples {
+		return
+	}
+
+	p95 := time.Duration(recent.quantile(0.95) * float64(time.Second))
+	w.setAlert("dhcp_renew_slow", p95 > threshold,
+		fmt.Sprintf("DHCP renewal p95 is %v over %d renewals (threshold %v)", p95.Round(time.Millisecond), recent.count, threshold))
+}
+
+// String formats the p95 and sample count for the log file
+func (h *histogram) String() string {
+	if h.count < minHistogramSamples {
+		return fmt.Sprintf("insufficient data (n=%d)", h.count)
+	}
+	p95 := time.Duration(h.quantile(0.95) * float64(time.Second))
+	return fmt.Sprintf("p95 %v (n=%d)", p95.Round(time.Millisecond), h.count)
+}
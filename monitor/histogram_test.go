@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	repeat := func(value float64, n int) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = value
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "no observations", want: 0},
+		{name: "first bucket", values: repeat(0.5, 10), want: 0.95},
+		{name: "value on a bound belongs to that bucket", values: repeat(2, 10), want: 1.95},
+		{name: "interpolated in the second bucket", values: append(repeat(0.5, 5), repeat(1.5, 5)...), want: 1.9},
+		{name: "one slow renewal in 20 stays out of the p95", values: append(repeat(0.5, 19), 3), want: 1},
+		{name: "two slow renewals in 20 move the p95", values: append(repeat(0.5, 18), 3, 3), want: 3},
+		{name: "overflow reports the highest bound", values: repeat(10, 10), want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistogram([]float64{1, 2, 4})
+			for _, v := range tt.values {
+				h.observe(v)
+			}
+			if got := h.quantile(0.95); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("quantile(0.95) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramCumulative(t *testing.T) {
+	h := newHistogram(exponentialBuckets(0.5, 2, 3))
+	for _, v := range []float64{0.1, 0.5, 0.7, 1.5, 30} {
+		h.observe(v)
+	}
+	les, counts := h.cumulative()
+	if want := []string{"0.5", "1", "2", "+Inf"}; !reflect.DeepEqual(les, want) {
+		t.Errorf("cumulative() le = %v, want %v", les, want)
+	}
+	if want := []uint64{2, 3, 4, 5}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("cumulative() counts = %v, want %v", counts, want)
+	}
+	if h.count != 5 || h.sum != 32.8 {
+		t.Errorf("count = %d, sum = %v, want 5, 32.8", h.count, h.sum)
+	}
+}
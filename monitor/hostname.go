@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// HostnameCheck holds the result of the hostname / reverse DNS sanity checks
+type HostnameCheck struct {
+	Hostname      string    // Fully qualified hostname that was looked up
+	Resolves      bool      // Hostname resolves via the resolver
+	Address       string    // Address assigned to the monitored interface
+	ReverseName   string    // PTR name of the assigned address ("" if none)
+	ReverseOK     bool      // PTR matches EXPECTED_RDNS_SUFFIX (true when not configured)
+	SearchDomains []string  // Search domains handed out by DHCP
+	SearchOK      bool      // Search list contains EXPECTED_SEARCH_DOMAIN (true when not configured)
+	Timestamp     time.Time // Check execution timestamp
+}
+
+// reverseName returns the in-addr.arpa name for an IPv4 address
+func reverseName(ip []byte) string {
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip[3], ip[2], ip[1], ip[0])
+}
+
+// runHostnameCheck verifies that the probe hostname resolves, the assigned address
+// has the expected reverse DNS and the DHCP search domain is correct
+func (w *WiFiMonitor) runHostnameCheck() {
+	server := dnsCheckServer(w.settings)
+	if server == "" {
+		return
+	}
+
+	check := HostnameCheck{Timestamp: time.Now(), ReverseOK: true, SearchOK: true}
+	check.SearchDomains = probe.SystemSearchDomains()
+
+	// Qualify a short hostname with the first search domain
+	hostname, _ := os.Hostname()
+	if !strings.Contains(hostname, ".") && len(check.SearchDomains) > 0 {
+		hostname += "." + check.SearchDomains[0]
+	}
+	check.Hostname = hostname
+
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		msg, _, _, err := w.exchangeDNS("udp", server, dnsQuery{name: hostname, qtype: qtype}, 5*time.Second)
+		if err == nil && len(msg.Answers) > 0 {
+			check.Resolves = true
+			break
+		}
+	}
+
+	// Reverse DNS of the address assigned to the monitored interface
+	if ip := probe.InterfaceIPv4(w.wifiInterface); ip != nil {
+		check.Address = ip.String()
+		msg, _, _, err := w.exchangeDNS("udp", server, dnsQuery{name: reverseName(ip.To4()), qtype: dnsmessage.TypePTR}, 5*time.Second)
+		if err == nil {
+			for _, answer := range msg.Answers {
+				if ptr, ok := answer.Body.(*dnsmessage.PTRResource); ok {
+					check.ReverseName = ptr.PTR.String()
+					break
+				}
+			}
+		}
+		if suffix := w.settings.Get("EXPECTED_RDNS_SUFFIX"); suffix != "" {
+			check.ReverseOK = strings.HasSuffix(strings.TrimSuffix(check.ReverseName, "."), strings.TrimSuffix(suffix, "."))
+		}
+	}
+
+	if expected := w.settings.Get("EXPECTED_SEARCH_DOMAIN"); expected != "" {
+		check.SearchOK = false
+		for _, domain := range check.SearchDomains {
+			if strings.TrimSuffix(domain, ".") == strings.TrimSuffix(expected, ".") {
+				check.SearchOK = true
+			}
+		}
+	}
+
+	w.hostnameCheck = &check
+
+	w.setAlert("hostname_unresolvable", !check.Resolves,
+		fmt.Sprintf("Probe hostname %s does not resolve via %s", check.Hostname, server))
+	w.setAlert("rdns_mismatch", !check.ReverseOK,
+		fmt.Sprintf("Reverse DNS of %s is %q, expected suffix %q", check.Address, check.ReverseName, w.settings.Get("EXPECTED_RDNS_SUFFIX")))
+	w.setAlert("search_domain_mismatch", !check.SearchOK,
+		fmt.Sprintf("DHCP search domains %v do not include %q", check.SearchDomains, w.settings.Get("EXPECTED_SEARCH_DOMAIN")))
+}
+
+// String formats the check for logs
+func (c HostnameCheck) String() string {
+	return fmt.Sprintf("Hostname=%s, Resolves=%v, Address=%s, PTR=%s, PTROK=%v, Search=%s, SearchOK=%v",
+		c.Hostname, c.Resolves, c.Address, c.ReverseName, c.ReverseOK, strings.Join(c.SearchDomains, " "), c.SearchOK)
+}
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// httpCheckHistoryLimit is the number of results kept per HTTP check
+const httpCheckHistoryLimit = 500
+
+// HTTPCheckTarget is a URL fetched by the HTTP check
+type HTTPCheckTarget struct {
+	Name string // Display name (defaults to the URL)
+	URL  string // URL fetched over the monitored interface
+}
+
+// HTTPCheck is one fetch of an HTTP check URL split into its phases. TTFB
+// and Total are measured from the start of the request, like curl's
+// time_starttransfer and time_total.
+type HTTPCheck struct {
+	Name      string        `json:"name"`            // Check name
+	URL       string        `json:"url"`             // Fetched URL
+	Status    int           `json:"status"`          // HTTP status code (0 if no response)
+	DNS       time.Duration `json:"dns_ns"`          // Name resolution
+	Connect   time.Duration `json:"connect_ns"`      // TCP connect
+	TLS       time.Duration `json:"tls_ns"`          // TLS handshake (0 for plain HTTP)
+	TTFB      time.Duration `json:"ttfb_ns"`         // Time to the first response byte
+	Total     time.Duration `json:"total_ns"`        // Time until the body was read
+	Error     string        `json:"error,omitempty"` // Failure reason ("" on success)
+	Timestamp time.Time     `json:"timestamp"`       // Fetch time
+}
+
+// String formats a fetch for the log file and the TUI
+func (c HTTPCheck) String() string {
+	phases := fmt.Sprintf("dns %v, connect %v, tls %v, ttfb %v, total %v",
+		c.DNS.Round(100*time.Microsecond), c.Connect.Round(100*time.Microsecond), c.TLS.Round(100*time.Microsecond),
+		c.TTFB.Round(100*time.Microsecond), c.Total.Round(100*time.Microsecond))
+	if c.Error != "" {
+		return fmt.Sprintf("%s: FAIL %s (%s)", c.Name, c.Error, phases)
+	}
+	return fmt.Sprintf("%s: %d (%s)", c.Name, c.Status, phases)
+}
+
+// parseHTTPCheckTargets parses HTTP_CHECK_URLS entries of the form name=url or url
+func parseHTTPCheckTargets(s *config.Settings) []HTTPCheckTarget {
+	var targets []HTTPCheckTarget
+	for _, entry := range s.List("HTTP_CHECK_URLS") {
+		name, target, ok := strings.Cut(entry, "=")
+		if !ok || strings.Contains(name, "/") {
+			name, target = entry, entry
+		}
+		targets = append(targets, HTTPCheckTarget{Name: strings.TrimSpace(name), URL: strings.TrimSpace(target)})
+	}
+	return targets
+}
+
+// fetchHTTPCheck fetches a URL over the monitored interface with a fresh
+// connection and records the timing of every phase. Redirects are not
+// followed, so a captive portal shows up as a failed check.
+func (w *WiFiMonitor) fetchHTTPCheck(target HTTPCheckTarget, timeout time.Duration) HTTPCheck {
+	check := HTTPCheck{Name: target.Name, URL: target.URL, Timestamp: time.Now()}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { check.DNS = time.Since(dnsStart) },
+		ConnectStart: func(string, string) {
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil && check.Connect == 0 {
+				check.Connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			check.TLS = time.Since(tlsStart)
+		},
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       w.interfaceDialer(timeout).DialContext,
+			DisableKeepAlives: true,
+		},
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	trace.GotFirstResponseByte = func() { check.TTFB = time.Since(start) }
+	resp, err := client.Do(req)
+	w.rawOutputs.AddResponse(target.URL, resp, err)
+	if err != nil {
+		check.Total = time.Since(start)
+		check.Error = err.Error()
+		return check
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	check.Total = time.Since(start)
+	check.Status = resp.StatusCode
+
+	// A redirect or error status means the page is not what was asked for
+	switch {
+	case err != nil:
+		check.Error = "reading body: " + err.Error()
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		check.Error = fmt.Sprintf("%s to %s", resp.Status, resp.Header.Get("Location"))
+	case resp.StatusCode >= 400:
+		check.Error = resp.Status
+	}
+	return check
+}
+
+// runHTTPChecks fetches every HTTP check URL and alerts on failed fetches
+func (w *WiFiMonitor) runHTTPChecks() {
+	timeout := w.settings.Duration("HTTP_CHECK_TIMEOUT", 10*time.Second)
+
+	// Point out when ping still works, i.e. the fault is above layer 3
+	// (proxy, captive portal, MTU)
+	layer3 := ""
+	if n := len(w.pingTests); n > 0 && w.pingTests[n-1].IPv4Connectivity {
+		layer3 = " while ping succeeds"
+	}
+
+	for _, target := range w.httpCheckTargets {
+		check := w.fetchHTTPCheck(target, timeout)
+
+		history := append(w.httpChecks[target.Name], check)
+		if len(history) > httpCheckHistoryLimit {
+			history = history[len(history)-httpCheckHistoryLimit:]
+		}
+		w.httpChecks[target.Name] = history
+		w.countProbeFailure("http", check.Error != "")
+		w.writeJSONL("http", check)
+
+		w.setAlert("http_failed_"+target.Name, check.Error != "",
+			fmt.Sprintf("HTTP check %s (%s) failed%s: %s", target.Name, target.URL, layer3, check.Error))
+	}
+}
+
+// latestHTTPChecks returns the newest result of every HTTP check
+func (w *WiFiMonitor) latestHTTPChecks() []HTTPCheck {
+	var latest []HTTPCheck
+	for _, target := range w.httpCheckTargets {
+		if history := w.httpChecks[target.Name]; len(history) > 0 {
+			latest = append(latest, history[len(history)-1])
+		}
+	}
+	return latest
+}
+
+// httpCheckStats builds a stats table row per HTTP check from its total times
+func (w *WiFiMonitor) httpCheckStats() []TargetStats {
+	var rows []TargetStats
+	for _, target := range w.httpCheckTargets {
+		history := w.httpChecks[target.Name]
+		stats := TargetStats{Target: "http:" + target.Name, Success: rateEstimate{total: len(history)}}
+		for _, check := range history {
+			if check.Error == "" {
+				stats.Success.successes++
+				stats.Latencies = append(stats.Latencies, check.Total)
+			}
+		}
+		if stats.Success.total > 0 {
+			stats.Loss = 100 - stats.Success.rate()
+		}
+		rows = append(rows, stats)
+	}
+	return rows
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// TimelineEntry is one step in the history of an outage
+type TimelineEntry struct {
+	Time time.Time // When it happened
+	Kind string    // first_failure, classification, link, alert, event, annotation or recovery
+	Text string    // Description
+}
+
+// Incident collects the timeline of an ongoing outage
+type Incident struct {
+	Start    time.Time       // First failing test
+	End      time.Time       // First successful test afterwards (zero while ongoing)
+	Class    string          // Current outage classification
+	Timeline []TimelineEntry // Entries in chronological order
+}
+
+// add appends a timeline entry
+func (i *Incident) add(timestamp time.Time, kind, text string) {
+	i.Timeline = append(i.Timeline, TimelineEntry{Time: timestamp, Kind: kind, Text: text})
+}
+
+// outageClass narrows down where connectivity is lost from the latest link facts
+func (w *WiFiMonitor) outageClass() string {
+	info := w.linkInfo
+	switch {
+	case info == nil:
+		return "unknown"
+	case !info.Up:
+		return "link down"
+	case w.authFailure != nil:
+		return "authentication failing"
+	case info.WiFi == nil:
+		return "not associated"
+	case !probe.HasIPv4(info.Addrs):
+		return "no IPv4 address"
+	case info.Gateway == "":
+		return "no default route"
+	case gatewayUnreachable(w.gateways):
+		return "gateway unreachable"
+	default:
+		return "upstream unreachable"
+	}
+}
+
+// trackIncident follows a test result through the outage lifecycle. The
+// first failing test opens an incident, classification changes are added
+// while it lasts and the first success closes it and publishes the timeline.
+func (w *WiFiMonitor) trackIncident(kind string, test WiFiTest) {
+	if !test.IPv4Connectivity {
+		class := w.outageClass()
+		if w.incident == nil {
+			w.incident = &Incident{Start: test.Timestamp, Class: class}
+			w.incident.add(test.Timestamp, "first_failure", fmt.Sprintf("%s test failed: %s", kind, class))
+		} else if class != w.incident.Class {
+			w.incident.add(test.Timestamp, "classification", fmt.Sprintf("%s -> %s", w.incident.Class, class))
+			w.incident.Class = class
+		}
+		return
+	}
+
+	if w.incident == nil {
+		return
+	}
+
+	incident := w.incident
+	w.incident = nil
+	incident.End = test.Timestamp
+	incident.add(test.Timestamp, "recovery", fmt.Sprintf("%s test succeeded after %v", kind,
+		incident.End.Sub(incident.Start).Round(time.Second)))
+
+	// The timeline goes with the outage record, the log file and the notification
+	if n := len(w.availability.outages); n > 0 && w.availability.outages[n-1].Start.Equal(incident.Start) {
+		w.availability.outages[n-1].Timeline = incident.Timeline
+	}
+	w.pendingIncidents = append(w.pendingIncidents, *incident)
+	w.recordAlert(Alert{
+		Name:      "outage_resolved",
+		Message:   fmt.Sprintf("Outage of %v resolved (%s)", incident.End.Sub(incident.Start).Round(time.Second), incident.Class),
+		Event:     true,
+		Timeline:  incident.Timeline,
+		Timestamp: test.Timestamp,
+	})
+}
+
+// noteLinkChange adds link state changes seen during an outage (interface
+// up/down, association and roams, address changes) to the timeline
+func (w *WiFiMonitor) noteLinkChange(prev, info *LinkInfo) {
+	if w.incident == nil || prev == nil {
+		return
+	}
+
+	var changes []string
+	if prev.Up != info.Up {
+		changes = append(changes, fmt.Sprintf("interface %s", map[bool]string{true: "up", false: "down"}[info.Up]))
+	}
+	switch {
+	case prev.WiFi != nil && info.WiFi == nil:
+		changes = append(changes, "disassociated from "+prev.WiFi.BSSID)
+	case prev.WiFi == nil && info.WiFi != nil:
+		changes = append(changes, fmt.Sprintf("associated to %s (%s)", info.WiFi.BSSID, info.WiFi.SSID))
+	case prev.WiFi != nil && info.WiFi != nil && prev.WiFi.BSSID != info.WiFi.BSSID:
+		changes = append(changes, fmt.Sprintf("roamed %s -> %s", prev.WiFi.BSSID, info.WiFi.BSSID))
+	}
+	if before, after := strings.Join(prev.Addrs, ","), strings.Join(info.Addrs, ","); before != after {
+		changes = append(changes, fmt.Sprintf("addresses %s -> %s", orDash(before), orDash(after)))
+	}
+
+	if len(changes) > 0 {
+		w.incident.add(info.Timestamp, "link", strings.Join(changes, ", "))
+	}
+}
+
+// annotate adds an operator note to the ongoing outage
+func (w *WiFiMonitor) annotate(text string) error {
+	if w.incident == nil {
+		return fmt.Errorf("no ongoing outage")
+	}
+	w.incident.add(time.Now(), "annotation", text)
+	return nil
+}
+
+// String formats the timeline entry for logs and notifications
+func (e TimelineEntry) String() string {
+	return fmt.Sprintf("%s %-14s %s", e.Time.Format("15:04:05"), e.Kind, e.Text)
+}
+
+// runAnnotateCommand implements `noc-watch annotate TEXT`, adding an operator
+// note to the timeline of the ongoing outage of the running monitor
+func runAnnotateCommand(s *config.Settings, args []string) int {
+	text := strings.Join(args, " ")
+	if strings.TrimSpace(text) == "" {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch annotate TEXT")
+		return exitUsage
+	}
+	if user := os.Getenv("USER"); user != "" {
+		text = user + ": " + text
+	}
+
+	// The control protocol is line based
+	text = strings.Join(strings.Fields(text), " ")
+	response, err := sendControl(s, "annotate "+text)
+	if err != nil {
+		fmt.Printf("Error adding annotation: %v\n", err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
@@ -0,0 +1,293 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxIPv6ProvisionHistory limits the number of IPv6 provisioning tests kept in memory
+const maxIPv6ProvisionHistory = 50
+
+// IPv6 address flags from /proc/net/if_inet6
+const (
+	ifaFlagDADFailed = 0x08
+	ifaFlagTentative = 0x40
+)
+
+// DHCPv6 message types and options used by the Information-Request
+const (
+	dhcpv6InformationRequest = 11
+	dhcpv6Reply              = 7
+	dhcpv6OptClientID        = 1
+	dhcpv6OptORO             = 6
+	dhcpv6OptElapsedTime     = 8
+	dhcpv6OptDNSServers      = 23
+	dhcpv6OptDomainList      = 24
+)
+
+// IPv6ProvisionTest is one run of the IPv6 provisioning test: the global
+// addresses are flushed and the time until SLAAC or DHCPv6 configures a
+// usable one again is measured, together with the DNS options received
+type IPv6ProvisionTest struct {
+	RouterAdvert  time.Duration              `json:"ra_ns,omitempty"`          // Router solicitation until the first advertisement
+	TimeToAddress time.Duration              `json:"address_ns,omitempty"`     // Flush until a global address passed duplicate address detection
+	Address       string                     `json:"address,omitempty"`        // Global address configured after the flush
+	Method        string                     `json:"method,omitempty"`         // slaac (from an advertised prefix) or dhcpv6
+	RA            *probe.RouterAdvertisement `json:"ra,omitempty"`             // Advertisement answering the solicitation
+	DHCPv6DNS     []string                   `json:"dhcpv6_dns,omitempty"`     // DNS servers from a DHCPv6 Information-Request (M or O flag set)
+	DHCPv6Domains []string                   `json:"dhcpv6_domains,omitempty"` // Domain search list from DHCPv6
+	DHCPv6Error   string                     `json:"dhcpv6_error,omitempty"`   // Why the DHCPv6 options could not be read
+	Success       bool                       `json:"success"`                  // A global address was configured within the timeout
+	Error         string                     `json:"error,omitempty"`          // Failure reason
+	Timestamp     time.Time                  `json:"timestamp"`                // Test start
+}
+
+// String formats the provisioning test for the log and the UI
+func (t IPv6ProvisionTest) String() string {
+	if !t.Success {
+		return fmt.Sprintf("FAIL (%s)", t.Error)
+	}
+	text := fmt.Sprintf("OK %s via %s in %v (RA %v)", t.Address, t.Method,
+		t.TimeToAddress.Round(time.Millisecond), t.RouterAdvert.Round(time.Millisecond))
+	if t.RA != nil {
+		text += " rdnss=" + orDash(strings.Join(t.RA.RDNSS, ","))
+	}
+	if len(t.DHCPv6DNS) > 0 {
+		text += " dhcpv6_dns=" + strings.Join(t.DHCPv6DNS, ",")
+	}
+	return text
+}
+
+// inet6Addr is an IPv6 address of an interface as the kernel lists it
+type inet6Addr struct {
+	IP        net.IP // Address
+	PrefixLen int    // Prefix length
+	Global    bool   // Global scope
+	Flags     int    // IFA_F_* flags
+}
+
+// interfaceIPv6Addrs reads the IPv6 addresses of an interface with their
+// scope and flags from /proc/net/if_inet6
+func interfaceIPv6Addrs(iface string) []inet6Addr {
+	file, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var addrs []inet6Addr
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[5] != iface {
+			continue
+		}
+		ip, err := hex.DecodeString(fields[0])
+		if err != nil || len(ip) != 16 {
+			continue
+		}
+		prefixLen, _ := strconv.ParseInt(fields[2], 16, 32)
+		scope, _ := strconv.ParseInt(fields[3], 16, 32)
+		flags, _ := strconv.ParseInt(fields[4], 16, 32)
+		addrs = append(addrs, inet6Addr{IP: net.IP(ip), PrefixLen: int(prefixLen), Global: scope == 0, Flags: int(flags)})
+	}
+	return addrs
+}
+
+// usableGlobalIPv6 returns the first global address that passed duplicate
+// address detection
+func usableGlobalIPv6(iface string) (inet6Addr, bool) {
+	for _, addr := range interfaceIPv6Addrs(iface) {
+		if addr.Global && addr.Flags&(ifaFlagTentative|ifaFlagDADFailed) == 0 {
+			return addr, true
+		}
+	}
+	return inet6Addr{}, false
+}
+
+// provisionMethod tells SLAAC and DHCPv6 addresses apart: SLAAC addresses
+// lie in an autonomous prefix of the advertisement, DHCPv6 ones are /128
+func provisionMethod(addr inet6Addr, ra *probe.RouterAdvertisement) string {
+	if ra != nil {
+		for _, p := range ra.Prefixes {
+			if _, prefix, err := net.ParseCIDR(p.Prefix); err == nil && p.Autonomous && prefix.Contains(addr.IP) && addr.PrefixLen != 128 {
+				return "slaac"
+			}
+		}
+	}
+	if addr.PrefixLen == 128 {
+		return "dhcpv6"
+	}
+	return "slaac"
+}
+
+// dhcpv6Information sends a stateless DHCPv6 Information-Request and returns
+// the DNS servers and domain search list of the reply. It shares the client
+// port with the system's DHCPv6 client, so it is best effort.
+func dhcpv6Information(ctx context.Context, iface string) ([]string, []string, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, nil, err
+	}
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); sockErr != nil {
+				return
+			}
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}}
+	conn, err := lc.ListenPacket(ctx, "udp6", "[::]:546")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	// Information-Request with a link-layer DUID asking for DNS servers and domains
+	xid := make([]byte, 3)
+	rand.Read(xid)
+	msg := append([]byte{dhcpv6InformationRequest}, xid...)
+	option := func(code uint16, data []byte) {
+		msg = binary.BigEndian.AppendUint16(msg, code)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(data)))
+		msg = append(msg, data...)
+	}
+	option(dhcpv6OptClientID, append([]byte{0, 3, 0, 1}, ifi.HardwareAddr...))
+	option(dhcpv6OptORO, []byte{0, dhcpv6OptDNSServers, 0, dhcpv6OptDomainList})
+	option(dhcpv6OptElapsedTime, []byte{0, 0})
+	servers := &net.UDPAddr{IP: net.ParseIP("ff02::1:2"), Port: 547, Zone: iface}
+	if _, err := conn.WriteTo(msg, servers); err != nil {
+		return nil, nil, err
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("no DHCPv6 reply: %v", err)
+		}
+		reply := buf[:n]
+		if len(reply) < 4 || reply[0] != dhcpv6Reply || string(reply[1:4]) != string(xid) {
+			continue
+		}
+
+		var dns, domains []string
+		for opts := reply[4:]; len(opts) >= 4; {
+			code, length := binary.BigEndian.Uint16(opts), int(binary.BigEndian.Uint16(opts[2:]))
+			if 4+length > len(opts) {
+				return nil, nil, errors.New("truncated DHCPv6 option")
+			}
+			data := opts[4 : 4+length]
+			opts = opts[4+length:]
+			switch code {
+			case dhcpv6OptDNSServers:
+				for ; len(data) >= 16; data = data[16:] {
+					dns = append(dns, net.IP(data[:16]).String())
+				}
+			case dhcpv6OptDomainList:
+				domains = append(domains, probe.ParseDNSLabels(data)...)
+			}
+		}
+		return dns, domains, nil
+	}
+}
+
+// provisionIPv6 flushes the global IPv6 addresses of the interface, solicits
+// a router advertisement and waits until a global address is usable again
+func provisionIPv6(ctx context.Context, iface string) IPv6ProvisionTest {
+	test := IPv6ProvisionTest{Timestamp: time.Now()}
+
+	// Listen before flushing so the answer to the solicitation is not missed
+	conn, err := probe.ListenRouterAdvertisements(iface)
+	if err != nil {
+		test.Error = err.Error()
+		return test
+	}
+	defer conn.Close()
+
+	if _, err := probe.Privileged(ctx, "ip", "-6", "addr", "flush", "dev", iface, "scope", "global"); err != nil {
+		test.Error = fmt.Sprintf("flush: %v", err)
+		return test
+	}
+	start := time.Now()
+	if err := probe.SendRouterSolicitation(conn, iface); err != nil {
+		test.Error = fmt.Sprintf("router solicitation: %v", err)
+		return test
+	}
+
+	// The first advertisement, then the address it leads to
+	deadline, _ := ctx.Deadline()
+	ra, err := probe.ReadRouterAdvertisement(conn, deadline)
+	if err != nil {
+		test.Error = "no router advertisement"
+		return test
+	}
+	test.RouterAdvert = ra.Received.Sub(start)
+	test.RA = &ra
+	for {
+		if addr, ok := usableGlobalIPv6(iface); ok {
+			test.TimeToAddress = time.Since(start)
+			test.Address = addr.IP.String()
+			test.Method = provisionMethod(addr, &ra)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			test.Error = "no global IPv6 address"
+			return test
+		case <-time.After(probe.DHCPAddressPollInterval):
+		}
+	}
+	test.Success = true
+
+	// DNS options the advertisement points to DHCPv6 for
+	if ra.Managed || ra.OtherConfig {
+		test.DHCPv6DNS, test.DHCPv6Domains, err = dhcpv6Information(ctx, iface)
+		if err != nil {
+			test.DHCPv6Error = err.Error()
+		}
+	}
+	return test
+}
+
+// runIPv6ProvisionTest runs an IPv6 provisioning test on the
+// IPV6_PROVISION_INTERVAL schedule. Pings right after it measure the
+// monitor's own disruption.
+func (w *WiFiMonitor) runIPv6ProvisionTest() {
+	ctx, cancel := context.WithTimeout(w.probeContext(), w.settings.Duration("IPV6_PROVISION_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	test := provisionIPv6(ctx, w.wifiInterface)
+	w.startDisruption()
+	w.ipv6Provisions = append(w.ipv6Provisions, test)
+	if len(w.ipv6Provisions) > maxIPv6ProvisionHistory {
+		w.ipv6Provisions = w.ipv6Provisions[len(w.ipv6Provisions)-maxIPv6ProvisionHistory:]
+	}
+	w.writeJSONL("ipv6_provision", test)
+	w.countProbeFailure("ipv6-provision", !test.Success)
+	w.setAlert("ipv6_provision_failed", !test.Success,
+		fmt.Sprintf("IPv6 provisioning test failed on %s: %s", w.wifiInterface, test.Error))
+}
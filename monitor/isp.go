@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// ISPTarget is a measurement endpoint on the ISP's own network (looking-glass
+// host, speedtest server). Its results are kept apart from the venue targets
+// so they can be handed to the ISP as like-for-like evidence.
+type ISPTarget struct {
+	Name    string      // Display name (e.g., isp-lg-tokyo)
+	Host    string      // Address or hostname probed
+	Samples []ISPSample // Results within ISP_SLA_WINDOW in time order
+}
+
+// ISPSample is one probe of an ISP target
+type ISPSample struct {
+	Time    time.Time     // Probe time
+	Latency time.Duration // Average RTT (0 when nothing answered)
+	Jitter  time.Duration // Spread between the fastest and slowest reply
+	Loss    float64       // Packet loss in percent
+}
+
+// ISPSummary aggregates the samples of an ISP target for SLA reporting
+type ISPSummary struct {
+	Samples    int           // Probes in the window
+	LatencyAvg time.Duration // Mean latency of answered probes
+	LatencyP95 time.Duration // 95th percentile latency of answered probes
+	JitterAvg  time.Duration // Mean jitter of answered probes
+	Loss       float64       // Mean packet loss in percent
+	Reachable  float64       // Percentage of probes with at least one reply
+}
+
+// parseISPTargets parses ISP_TARGETS entries of the form name=host or host
+func parseISPTargets(s *config.Settings) []*ISPTarget {
+	var targets []*ISPTarget
+	for _, entry := range s.List("ISP_TARGETS") {
+		name, host, ok := strings.Cut(entry, "=")
+		if !ok {
+			host = name
+		}
+		targets = append(targets, &ISPTarget{Name: strings.TrimSpace(name), Host: strings.TrimSpace(host)})
+	}
+	return targets
+}
+
+// runISPChecks probes every ISP target and drops samples older than the SLA window
+func (w *WiFiMonitor) runISPChecks() {
+	count := w.settings.Int("ISP_PING_COUNT", 10)
+	cutoff := time.Now().Add(-w.settings.Duration("ISP_SLA_WINDOW", 24*time.Hour))
+
+	for _, target := range w.ispTargets {
+		stats := w.pingTarget(target.Host, count)
+		sample := ISPSample{Time: time.Now(), Loss: stats.Loss}
+		if stats.Loss < 100 {
+			sample.Latency, sample.Jitter = stats.Avg, stats.Max-stats.Min
+		}
+		target.Samples = append(target.Samples, sample)
+
+		expired := sort.Search(len(target.Samples), func(i int) bool { return !target.Samples[i].Time.Before(cutoff) })
+		target.Samples = target.Samples[expired:]
+	}
+}
+
+// summary aggregates the samples in the SLA window
+func (t *ISPTarget) summary() ISPSummary {
+	summary := ISPSummary{Samples: len(t.Samples)}
+	if summary.Samples == 0 {
+		return summary
+	}
+
+	var latencies []time.Duration
+	var jitter time.Duration
+	var loss float64
+	for _, s := range t.Samples {
+		loss += s.Loss
+		if s.Loss < 100 {
+			latencies = append(latencies, s.Latency)
+			jitter += s.Jitter
+		}
+	}
+	summary.Loss = loss / float64(summary.Samples)
+	summary.Reachable = float64(len(latencies)) / float64(summary.Samples) * 100
+
+	if len(latencies) > 0 {
+		summary.LatencyAvg = meanDuration(latencies)
+		summary.JitterAvg = jitter / time.Duration(len(latencies))
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		summary.LatencyP95 = latencies[(len(latencies)*95-1)/100]
+	}
+	return summary
+}
+
+// String formats the SLA summary for the log file and the TUI
+func (t *ISPTarget) String() string {
+	s := t.summary()
+	if s.Samples == 0 {
+		return fmt.Sprintf("%s (%s): no samples yet", t.Name, t.Host)
+	}
+	return fmt.Sprintf("%s (%s): latency avg %v p95 %v, jitter %v, loss %.2f%%, reachable %.2f%% (n=%d since %s)",
+		t.Name, t.Host, s.LatencyAvg.Round(100*time.Microsecond), s.LatencyP95.Round(100*time.Microsecond),
+		s.JitterAvg.Round(100*time.Microsecond), s.Loss, s.Reachable, s.Samples, t.Samples[0].Time.Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"fmt"
+
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// jsonlPath returns the JSON Lines output from RESULTS_JSONL: a file path,
+// "-" for standard output in headless mode, or "" when the output is off
+func (w *WiFiMonitor) jsonlPath() string {
+	path := w.settings.Get("RESULTS_JSONL")
+	if path == storage.JSONLStdout && !w.headless {
+		return "" // The TUI owns the terminal
+	}
+	return path
+}
+
+// writeJSONL appends one result as a JSON object on its own line and
+// streams the same object to /api/stream clients
+func (w *WiFiMonitor) writeJSONL(probe string, result any) {
+	path := w.jsonlPath()
+	if path == "" && len(w.streamSubscribers) == 0 {
+		return
+	}
+
+	line, err := storage.JSONLRecord(result, map[string]any{"probe": probe, "interface": w.wifiInterface})
+	if err != nil {
+		fmt.Printf("Error encoding JSON Lines record: %v\n", err)
+		return
+	}
+	w.publishStream("result", probe, line)
+	if path == "" {
+		return
+	}
+	if err := storage.AppendJSONL(path, line); err != nil {
+		fmt.Printf("Error writing JSON Lines output: %v\n", err)
+	}
+}
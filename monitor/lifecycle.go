@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// configFileKeys are settings naming files whose content is configuration
+// too, so a changed file changes the config hash
+var configFileKeys = []string{"ALERT_ROUTES", "ALERT_RUNBOOKS", "METRIC_RULES", "ALERT_RULES"}
+
+// configHash identifies the active configuration: every setting of the config
+// schema (and every profile definition) that is set and the content of the
+// referenced config files
+func configHash(s *config.Settings) string {
+	known, _ := config.SchemaKeys()
+	keys := make([]string, 0, len(known))
+	for key := range known {
+		keys = append(keys, key)
+	}
+	for _, key := range s.Keys() {
+		if config.IsDynamic(key) && !known[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		if value := s.Get(key); value != "" {
+			fmt.Fprintf(h, "%s=%s\n", key, value)
+		}
+	}
+	for _, key := range configFileKeys {
+		if path := s.Get(key); path != "" {
+			content, _ := os.ReadFile(path)
+			fmt.Fprintf(h, "file:%s %d\n", key, len(content))
+			h.Write(content)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// recordLifecycle writes a lifecycle record (started, stopped, config_reloaded)
+// to the log file and the tail stream, so gaps in the data can be told apart
+// from outages when the history is analyzed. Like alerts, it is only printed
+// in headless mode, where it would not draw over the TUI.
+func (w *WiFiMonitor) recordLifecycle(event, detail string) {
+	now := time.Now()
+	line := fmt.Sprintf("Lifecycle: event=%s %s", event, w.stamp())
+	if detail != "" {
+		line += fmt.Sprintf(" detail=%q", detail)
+	}
+	if w.headless {
+		fmt.Println(line)
+	}
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "\n=== Monitor Lifecycle - %s ===\n%s\n", now.Format("2006-01-02 15:04:05"), line)
+	if err := w.appendLogBlock(&block); err != nil {
+		fmt.Printf("Error writing lifecycle record: %v\n", err)
+	}
+
+	// Lifecycle records reach every tail client regardless of its result filter
+	for sub := range w.tailSubscribers {
+		w.sendTail(sub, fmt.Sprintf("[%s] %s\n", now.Format("2006-01-02 15:04:05"), line))
+	}
+}
+
+// reloadConfig re-reads the file based configuration (alert routes, runbooks,
+// metric rules and alert rules) on SIGHUP. Environment variables only change on restart.
+func (w *WiFiMonitor) reloadConfig() {
+	previous := w.configHash
+	w.runbooks = loadRunbooks(w.settings)
+	w.metricRules = loadMetricRules(w.settings)
+	w.alertRules = loadAlertRules(w.settings)
+	w.notifier = NewNotifier(w.settings, metricRuleRoutes(w.metricRules))
+	w.configHash = configHash(w.settings)
+
+	w.recordLifecycle("config_reloaded", "previous config hash "+previous)
+}
+
+// watchSignals forwards termination and reload signals to the monitoring loop
+func (w *WiFiMonitor) watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				select {
+				case w.reloadRequests <- struct{}{}:
+				default: // A reload is already pending
+				}
+				continue
+			}
+			w.stop("signal " + sig.String())
+			return
+		}
+	}()
+}
+
+// stop asks the monitoring loop to record the shutdown and return. It waits
+// until the loop is done so the stopped record is written before the process exits.
+func (w *WiFiMonitor) stop(reason string) {
+	select {
+	case w.stopRequests <- reason:
+		<-w.stopped
+	case <-w.stopped:
+	}
+}
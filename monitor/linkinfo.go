@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// LinkInfo collects the link facts an operator would otherwise look up with ip and iw
+type LinkInfo struct {
+	Interface string          // Interface name
+	MAC       string          // Hardware address
+	Up        bool            // Interface is administratively and operationally up
+	Addrs     []string        // Assigned addresses in CIDR notation
+	Gateway   string          // IPv4 default gateway
+	DNS       []string        // Resolvers from /etc/resolv.conf
+	WiFi      *probe.WiFiLink // Association details (nil when not associated or not WiFi)
+	Timestamp time.Time       // Collection time
+}
+
+// readLinkInfo gathers the current link facts of an interface
+func readLinkInfo(ctx context.Context, iface string) LinkInfo {
+	info := LinkInfo{Interface: iface, DNS: probe.SystemResolvers(), Timestamp: time.Now()}
+
+	if ifi, err := net.InterfaceByName(iface); err == nil {
+		info.MAC = ifi.HardwareAddr.String()
+		info.Up = ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagRunning != 0
+		if addrs, err := ifi.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addrs = append(info.Addrs, addr.String())
+			}
+		}
+	}
+
+	info.Gateway = probe.DefaultGateway(iface)
+	if link, ok := probe.ReadWiFiLink(ctx, iface); ok {
+		info.WiFi = link
+	}
+	return info
+}
+
+// runLinkInfoCheck refreshes the link summary
+func (w *WiFiMonitor) runLinkInfoCheck() {
+	info := readLinkInfo(w.probeContext(), w.wifiInterface)
+	w.noteLinkChange(w.linkInfo, &info)
+	w.noteLinkMarkers(w.linkInfo, &info)
+	w.linkInfo = &info
+}
+
+// paneText formats the link facts for the TUI summary pane
+func (i LinkInfo) paneText() string {
+	state := "[red]DOWN[white]"
+	if i.Up {
+		state = "[green]UP[white]"
+	}
+
+	text := fmt.Sprintf("[yellow]Link:[white] %s %s  MAC %s\n", i.Interface, state, orDash(i.MAC))
+	text += fmt.Sprintf("IP: %s\n", orDash(strings.Join(i.Addrs, ", ")))
+	text += fmt.Sprintf("Gateway: %s  DNS: %s\n", orDash(i.Gateway), orDash(strings.Join(i.DNS, ", ")))
+	if i.WiFi != nil {
+		text += fmt.Sprintf("SSID: %s  BSSID: %s\n", ui.Escape(i.WiFi.SSID), i.WiFi.BSSID)
+		text += fmt.Sprintf("Channel: %d (%d MHz)  PHY rate: %.1f Mbit/s\n", i.WiFi.Channel(), i.WiFi.FreqMHz, i.WiFi.TxMbps)
+	} else {
+		text += "[yellow]Not associated[white]\n"
+	}
+	return text
+}
+
+// String formats the link facts for the log file
+func (i LinkInfo) String() string {
+	text := fmt.Sprintf("%s up=%v mac=%s addrs=%s gw=%s dns=%s", i.Interface, i.Up, orDash(i.MAC),
+		orDash(strings.Join(i.Addrs, ",")), orDash(i.Gateway), orDash(strings.Join(i.DNS, ",")))
+	if i.WiFi != nil {
+		text += fmt.Sprintf(" ssid=%q bssid=%s ch=%d rate=%.1fMbps", i.WiFi.SSID, i.WiFi.BSSID, i.WiFi.Channel(), i.WiFi.TxMbps)
+	}
+	return text
+}
+
+// orDash returns "-" for empty values
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// legacyRateMbps is the highest 802.11a/g rate; anything at or below is a legacy rate
+const legacyRateMbps = 54
+
+// LinkRate tracks the negotiated rate of a monitored interface
+type LinkRate struct {
+	Interface string    // Interface name
+	Kind      string    // "wifi" (PHY tx bitrate) or "wired" (Ethernet speed)
+	Mbps      float64   // Current negotiated rate
+	Peak      float64   // Highest rate seen since start
+	Timestamp time.Time // Sample time
+}
+
+// readWiFiTxBitrate returns the current tx bitrate of a WiFi interface from `iw dev <if> link`
+func readWiFiTxBitrate(ctx context.Context, iface string) (float64, bool) {
+	link, ok := probe.ReadWiFiLink(ctx, iface)
+	if !ok || link.TxMbps == 0 {
+		return 0, false
+	}
+	return link.TxMbps, true
+}
+
+// updateLinkRate records a new rate sample and returns the tracked state
+func (w *WiFiMonitor) updateLinkRate(iface, kind string, mbps float64) *LinkRate {
+	rate, ok := w.linkRates[iface]
+	if !ok {
+		rate = &LinkRate{Interface: iface, Kind: kind}
+		w.linkRates[iface] = rate
+	}
+	rate.Mbps = mbps
+	rate.Timestamp = time.Now()
+	if mbps > rate.Peak {
+		rate.Peak = mbps
+	}
+	return rate
+}
+
+// runLinkRateCheck samples negotiated link rates and alerts on regressions
+func (w *WiFiMonitor) runLinkRateCheck() {
+	if mbps, ok := readWiFiTxBitrate(w.probeContext(), w.wifiInterface); ok {
+		rate := w.updateLinkRate(w.wifiInterface, "wifi", mbps)
+		minRate := float64(w.settings.Int("WIFI_MIN_RATE_MBPS", 0))
+		w.setAlert("wifi_rate_degraded",
+			(rate.Peak > legacyRateMbps && mbps <= legacyRateMbps) || mbps < minRate,
+			fmt.Sprintf("%s tx bitrate dropped to %.1f Mbit/s (peak %.1f)", rate.Interface, mbps, rate.Peak))
+	}
+
+	if w.wiredInterface != "" {
+		if linkUp, speed, _ := readEthtool(w.wiredInterface); linkUp && speed > 0 {
+			rate := w.updateLinkRate(w.wiredInterface, "wired", float64(speed))
+			minSpeed := float64(w.settings.Int("WIRED_MIN_SPEED_MBPS", 0))
+			w.setAlert("wired_speed_degraded", rate.Mbps < rate.Peak || rate.Mbps < minSpeed,
+				fmt.Sprintf("%s renegotiated at %.0fMb/s (peak %.0fMb/s)", rate.Interface, rate.Mbps, rate.Peak))
+		}
+	}
+}
+
+// String formats the link rate for logs
+func (r LinkRate) String() string {
+	return fmt.Sprintf("%s (%s) %.1fMbps peak=%.1fMbps", r.Interface, r.Kind, r.Mbps, r.Peak)
+}
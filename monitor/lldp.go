@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// LLDPNeighbor identifies the switch port the probe host is plugged into
+type LLDPNeighbor struct {
+	Protocol  string    // Discovery protocol (LLDP, CDPv2, ...)
+	Chassis   string    // Neighbor system name
+	ChassisID string    // Neighbor chassis ID (usually a MAC address)
+	Port      string    // Neighbor port name
+	PortDescr string    // Neighbor port description
+	VLAN      string    // Advertised VLAN ID
+	Timestamp time.Time // Discovery time
+}
+
+// Key identifies the physical attachment point
+func (n LLDPNeighbor) Key() string {
+	chassis := n.Chassis
+	if chassis == "" {
+		chassis = n.ChassisID
+	}
+	return chassis + "/" + n.Port
+}
+
+// readLLDPNeighbor queries lldpd (which also decodes CDP) for the neighbor of an interface
+func readLLDPNeighbor(iface string) (*LLDPNeighbor, error) {
+	output, err := exec.Command("lldpctl", "-f", "keyvalue", iface).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	neighbor := &LLDPNeighbor{Timestamp: time.Now()}
+	prefix := "lldp." + iface + "."
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, prefix), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "via":
+			neighbor.Protocol = value
+		case "chassis.name":
+			neighbor.Chassis = value
+		case "chassis.mac", "chassis.local":
+			neighbor.ChassisID = value
+		case "port.ifname", "port.local":
+			neighbor.Port = value
+		case "port.descr":
+			neighbor.PortDescr = value
+		case "vlan.vlan-id":
+			neighbor.VLAN = value
+		}
+	}
+
+	if neighbor.Protocol == "" {
+		return nil, fmt.Errorf("no LLDP/CDP neighbor on %s", iface)
+	}
+	return neighbor, nil
+}
+
+// runLLDPCheck records the wired neighbor and alerts when it changes from the expected one
+func (w *WiFiMonitor) runLLDPCheck() {
+	iface := w.settings.String("LLDP_INTERFACE", w.wiredInterface)
+
+	neighbor, err := readLLDPNeighbor(iface)
+	if err != nil {
+		return
+	}
+	w.lldpNeighbor = neighbor
+
+	// The first neighbor seen becomes the baseline unless one is configured
+	expected := w.settings.Get("LLDP_EXPECTED")
+	if expected == "" {
+		if w.lldpBaseline == "" {
+			w.lldpBaseline = neighbor.Key()
+		}
+		expected = w.lldpBaseline
+	}
+
+	w.setAlert("lldp_neighbor_changed", neighbor.Key() != expected,
+		fmt.Sprintf("%s is now attached to %s (expected %s)", iface, neighbor.Key(), expected))
+}
+
+// String formats the neighbor for logs
+func (n LLDPNeighbor) String() string {
+	return fmt.Sprintf("%s %s port=%s (%s) vlan=%s", n.Protocol, n.Key(), n.Port, n.PortDescr, n.VLAN)
+}
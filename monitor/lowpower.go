@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// lowPowerPoll is how often the monitoring loop wakes for auxiliary checks in low-power mode
+const lowPowerPoll = 5 * time.Second
+
+// LowPower stretches the probe intervals of a battery or solar powered node
+// while results are stable and tracks how much of the time it is busy
+type LowPower struct {
+	stretch    float64       // Current multiplier of every probe interval
+	maxStretch float64       // Upper bound of the multiplier
+	stableRuns int           // Stable tests needed before the intervals are doubled
+	stable     int           // Consecutive stable tests since the last change
+	batching   bool          // Active checks may run (set while a batch follows a ping test)
+	busy       time.Duration // Time spent running probes
+	since      time.Time     // Start of the duty cycle measurement
+}
+
+// NewLowPower reads LOW_POWER and friends. It returns nil when low-power mode is off.
+func NewLowPower(s *config.Settings) *LowPower {
+	if s.Get("LOW_POWER") != "true" {
+		return nil
+	}
+	maxStretch := float64(s.Int("LOW_POWER_MAX_STRETCH", 4))
+	if maxStretch < 1 {
+		maxStretch = 1
+	}
+	return &LowPower{
+		stretch:    1,
+		maxStretch: maxStretch,
+		stableRuns: max(s.Int("LOW_POWER_STABLE_RUNS", 5), 1),
+		since:      time.Now(),
+	}
+}
+
+// factor returns the interval multiplier; 1 when low-power mode is off
+func (l *LowPower) factor() float64 {
+	if l == nil {
+		return 1
+	}
+	return l.stretch
+}
+
+// stretched scales a probe interval by the current multiplier
+func (w *WiFiMonitor) stretched(interval time.Duration) time.Duration {
+	return time.Duration(float64(interval) * w.lowPower.factor())
+}
+
+// dhcpInterval returns the DHCP renewal test interval for the current profile
+func (w *WiFiMonitor) dhcpInterval() time.Duration {
+	return w.stretched(w.profile.DHCPInterval)
+}
+
+// observe doubles the intervals after a run of stable tests and drops back to
+// the configured intervals on the first failure. It reports whether the
+// multiplier changed so the tickers can be reset.
+func (l *LowPower) observe(test WiFiTest) bool {
+	if l == nil || test.Disrupted {
+		return false
+	}
+
+	previous := l.stretch
+	if !test.Success {
+		l.stable = 0
+		l.stretch = 1
+		return l.stretch != previous
+	}
+
+	l.stable++
+	if l.stable >= l.stableRuns && l.stretch < l.maxStretch {
+		l.stable = 0
+		l.stretch = min(l.stretch*2, l.maxStretch)
+	}
+	return l.stretch != previous
+}
+
+// track adds the time a probe took since start to the busy time
+func (l *LowPower) track(start time.Time) {
+	if l != nil {
+		l.busy += time.Since(start)
+	}
+}
+
+// deferred reports whether an active check has to wait for the next batch.
+// In low-power mode probes only run right after a ping test so the radio and
+// CPU wake up once per interval instead of for every check.
+func (w *WiFiMonitor) deferred(c *periodicCheck) bool {
+	return c.active && w.lowPower != nil && !w.lowPower.batching
+}
+
+// runProbeBatch runs the active checks that fell due since the last ping test
+func (w *WiFiMonitor) runProbeBatch() bool {
+	start := time.Now()
+	w.lowPower.batching = true
+	ran := w.runDueChecks(start)
+	w.lowPower.batching = false
+	w.lowPower.track(start)
+	return ran
+}
+
+// dutyCycle estimates the percentage of time spent probing
+func (l *LowPower) dutyCycle() float64 {
+	elapsed := time.Since(l.since)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(l.busy) / float64(elapsed) * 100
+}
+
+// String formats the low-power state for the log file and the TUI
+func (l *LowPower) String() string {
+	return fmt.Sprintf("intervals x%g (max x%g), estimated duty cycle %.2f%%", l.stretch, l.maxStretch, l.dutyCycle())
+}
@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxChartMarkers bounds the kept roam and link flap markers
+const maxChartMarkers = 1000
+
+// ChartMarker is a network event drawn on the latency timeline
+type ChartMarker struct {
+	Time time.Time // When the event was observed
+	Kind string    // dhcp, roam or flap
+}
+
+// markerSymbols are the timeline glyphs per marker kind, highest priority first
+var markerSymbols = []struct {
+	Kind   string // Marker kind
+	Symbol string // Glyph drawn below the latency column
+}{
+	{"flap", "F"},
+	{"roam", "R"},
+	{"dhcp", "D"},
+}
+
+// noteLinkMarkers records roams and link flaps between two link snapshots
+func (w *WiFiMonitor) noteLinkMarkers(prev, info *LinkInfo) {
+	if prev == nil {
+		return
+	}
+
+	switch {
+	case prev.Up != info.Up, (prev.WiFi == nil) != (info.WiFi == nil):
+		w.linkMarkers = append(w.linkMarkers, ChartMarker{Time: info.Timestamp, Kind: "flap"})
+	case prev.WiFi != nil && info.WiFi != nil && prev.WiFi.BSSID != info.WiFi.BSSID:
+		w.linkMarkers = append(w.linkMarkers, ChartMarker{Time: info.Timestamp, Kind: "roam"})
+	}
+	if len(w.linkMarkers) > maxChartMarkers {
+		w.linkMarkers = w.linkMarkers[len(w.linkMarkers)-maxChartMarkers:]
+	}
+}
+
+// chartMarkers returns DHCP renewals, roams and flaps, the renewals taken from the DHCP test history
+func (w *WiFiMonitor) chartMarkers() []ChartMarker {
+	markers := make([]ChartMarker, 0, len(w.dhcpTests)+len(w.linkMarkers))
+	for _, test := range w.dhcpTests {
+		markers = append(markers, ChartMarker{Time: test.Timestamp, Kind: "dhcp"})
+	}
+	return append(markers, w.linkMarkers...)
+}
+
+// markerSymbol returns the glyph of the highest priority marker in (from, to], or "" when there is none
+func markerSymbol(markers []ChartMarker, from, to time.Time) string {
+	kinds := make(map[string]bool)
+	for _, m := range markers {
+		if m.Time.After(from) && !m.Time.After(to) {
+			kinds[m.Kind] = true
+		}
+	}
+	for _, s := range markerSymbols {
+		if kinds[s.Kind] {
+			return s.Symbol
+		}
+	}
+	return ""
+}
+
+// latencyChartText draws the latest ping latencies as a sparkline with a
+// row of event markers below, so spikes that follow a DHCP renewal, roam or
+// link flap stand out. Each column covers the time since the previous test.
+func (w *WiFiMonitor) latencyChartText(width int) string {
+	if len(w.pingTests) < 2 {
+		return ""
+	}
+
+	// The first test only bounds the span of the second
+	tests := w.pingTests
+	if len(tests) > width+1 {
+		tests = tests[len(tests)-width-1:]
+	}
+
+	// Local and upstream latency share one scale, so the rows compare directly
+	var max time.Duration
+	hasLocal := false
+	for _, t := range tests[1:] {
+		if t.Latency > max {
+			max = t.Latency
+		}
+		if t.LocalLatency > max {
+			max = t.LocalLatency
+		}
+		hasLocal = hasLocal || t.LocalLatency > 0
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	levels := []rune("▁▂▃▄▅▆▇█")
+	markers := w.chartMarkers()
+	var line, local, marks strings.Builder
+	var near, other []time.Duration
+	for i := 1; i < len(tests); i++ {
+		t := tests[i]
+		symbol := markerSymbol(markers, tests[i-1].Timestamp, t.Timestamp)
+
+		switch {
+		case !t.Success:
+			line.WriteString("[red]x[white]")
+		default:
+			level := int(float64(len(levels)-1) * float64(t.Latency) / float64(max))
+			line.WriteRune(levels[level])
+			if symbol != "" {
+				near = append(near, t.Latency)
+			} else {
+				other = append(other, t.Latency)
+			}
+		}
+
+		if t.LocalLatency > 0 {
+			local.WriteRune(levels[int(float64(len(levels)-1)*float64(t.LocalLatency)/float64(max))])
+		} else {
+			local.WriteString("[red]x[white]")
+		}
+
+		if symbol == "" {
+			symbol = " "
+		}
+		marks.WriteString(symbol)
+	}
+
+	text := fmt.Sprintf("\n[yellow]Latency Timeline (max %v, markers: D=DHCP renewal R=roam F=link flap):[white]\n",
+		max.Round(100*time.Microsecond))
+	if hasLocal {
+		text += "  " + line.String() + " upstream\n"
+		text += "  " + local.String() + " local\n"
+	} else {
+		text += "  " + line.String() + "\n"
+	}
+	text += "  [fuchsia]" + marks.String() + "[white]\n"
+	if len(near) > 0 && len(other) > 0 {
+		text += fmt.Sprintf("  Avg latency after events: %v (n=%d) vs %v otherwise\n",
+			meanDuration(near).Round(100*time.Microsecond), len(near), meanDuration(other).Round(100*time.Microsecond))
+	}
+	return text
+}
+
+// latencySplitSummary shows the latest local (gateway) and upstream latency
+// side by side with their averages over the health window, so a degrading
+// wireless segment can be told apart from a degrading transit link
+func (w *WiFiMonitor) latencySplitSummary(now time.Time) string {
+	var latest *WiFiTest
+	var local, upstream []time.Duration
+	for i := range w.pingTests {
+		t := &w.pingTests[i]
+		if t.LocalLatency <= 0 {
+			continue
+		}
+		latest = t
+		if now.Sub(t.Timestamp) <= healthWindow && t.Latency > 0 {
+			local = append(local, t.LocalLatency)
+			upstream = append(upstream, t.Latency)
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	text := fmt.Sprintf("%v | %v", latest.LocalLatency.Round(100*time.Microsecond), latest.Latency.Round(100*time.Microsecond))
+	if len(local) > 0 {
+		text += fmt.Sprintf(" (1h avg %v | %v)", meanDuration(local).Round(100*time.Microsecond), meanDuration(upstream).Round(100*time.Microsecond))
+	}
+	return text
+}
+
+// meanDuration returns the average of durations
+func meanDuration(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// MetricRule alerts when any series of an exported metric crosses a
+// threshold for a while, so new probes become alertable without new code
+type MetricRule struct {
+	labelMatcher         // Series labels the rule applies to
+	Name         string  `json:"name"`      // Rule name; the alert is metric_<name>
+	Metric       string  `json:"metric"`    // Metric name as exported via remote-write
+	Op           string  `json:"op"`        // Comparison: >, >=, < or <=
+	Threshold    float64 `json:"threshold"` // Value compared with
+	For          string  `json:"for"`       // How long the condition must hold before firing (e.g. 5m)
+	Webhook      string  `json:"webhook"`   // Optional webhook receiving this rule's alerts
+
+	forDuration time.Duration // Parsed For
+	since       time.Time     // When the condition started to hold (zero while it does not)
+}
+
+// loadMetricRules reads the threshold rules from the JSON file in METRIC_RULES
+func loadMetricRules(s *config.Settings) []*MetricRule {
+	path := s.Get("METRIC_RULES")
+	if path == "" {
+		return nil
+	}
+
+	var rules []*MetricRule
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading metric rules: %v\n", err)
+		return nil
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		fmt.Printf("Error parsing metric rules: %v\n", err)
+		return nil
+	}
+
+	valid := rules[:0]
+	for _, rule := range rules {
+		if rule.For != "" {
+			d, err := time.ParseDuration(rule.For)
+			if err != nil {
+				fmt.Printf("Error parsing metric rule %s: invalid for %q\n", rule.Name, rule.For)
+				continue
+			}
+			rule.forDuration = d
+		}
+		if rule.Name == "" || rule.Metric == "" || !validMetricOp(rule.Op) {
+			fmt.Printf("Error parsing metric rule %q: name, metric and op (>, >=, <, <=) are required\n", rule.Name)
+			continue
+		}
+		rule.compile()
+		valid = append(valid, rule)
+	}
+	return valid
+}
+
+// validMetricOp reports whether op is a supported comparison
+func validMetricOp(op string) bool {
+	return op == ">" || op == ">=" || op == "<" || op == "<="
+}
+
+// crossed reports whether value is beyond the rule's threshold
+func (r *MetricRule) crossed(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	default:
+		return value <= r.Threshold
+	}
+}
+
+// metricRuleRoutes sends the alerts of rules with their own webhook there,
+// ahead of the label routes from ALERT_ROUTES
+func metricRuleRoutes(rules []*MetricRule) []AlertRoute {
+	var routes []AlertRoute
+	for _, rule := range rules {
+		if rule.Webhook == "" {
+			continue
+		}
+		route := AlertRoute{Webhook: rule.Webhook, Continue: true}
+		route.Match = map[string]string{"alertname": "metric_" + rule.Name}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// runMetricRules evaluates the threshold rules against the current values of
+// every exported series. A rule fires once a matching series has been beyond
+// the threshold for the rule's duration and resolves when none is.
+func (w *WiFiMonitor) runMetricRules() {
+	hostname, _ := os.Hostname()
+	series := w.remoteWriteSeries(hostname)
+	now := time.Now()
+
+	for _, rule := range w.metricRules {
+		var offending []string
+		for _, s := range series {
+			if s.labels["__name__"] != rule.Metric || !rule.matches(s.labels) || !rule.crossed(s.value) {
+				continue
+			}
+			if labels := seriesLabels(s.labels); labels != "" {
+				offending = append(offending, fmt.Sprintf("%s=%g", labels, s.value))
+			} else {
+				offending = append(offending, fmt.Sprintf("%g", s.value))
+			}
+		}
+
+		if len(offending) == 0 {
+			rule.since = time.Time{}
+		} else if rule.since.IsZero() {
+			rule.since = now
+		}
+
+		firing := len(offending) > 0 && now.Sub(rule.since) >= rule.forDuration
+		message := fmt.Sprintf("%s %s %g for %v: %s", rule.Metric, rule.Op, rule.Threshold,
+			now.Sub(rule.since).Round(time.Second), strings.Join(offending, ", "))
+		if !firing {
+			message = fmt.Sprintf("%s back within %s %g", rule.Metric, rule.Op, rule.Threshold)
+		}
+		w.setAlert("metric_"+rule.Name, firing, message)
+	}
+}
+
+// seriesLabels formats the identifying labels of a series, e.g. {sensor="temp"},
+// or "" when it has none besides the agent's own
+func seriesLabels(labels map[string]string) string {
+	var pairs []string
+	for name, value := range labels {
+		if name == "__name__" || name == "instance" || name == "job" || name == "interface" {
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsCommand is the control command that renders the exposition text
+const metricsCommand = "metrics"
+
+// labelEscaper escapes label values for the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// startMetricsServer serves the current samples in the Prometheus text
+// format on METRICS_LISTEN (e.g. :9101), over (mutual) TLS with
+// METRICS_TLS_*. Scrapes are answered by the monitoring loop like control
+// commands, so they see consistent state. It returns a function stopping
+// the server.
+func (w *WiFiMonitor) startMetricsServer() func() {
+	addr := w.settings.Get("METRICS_LISTEN")
+	if addr == "" {
+		return func() {}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		text, ok := w.queryMonitor(rw, r, metricsCommand)
+		if !ok {
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		rw.Write([]byte(text))
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return serveHTTP(w.settings, server, "METRICS", "metrics")
+}
+
+// metricsText renders the samples of remoteWriteSeries in the Prometheus
+// text format
+func (w *WiFiMonitor) metricsText() string {
+	return expositionText(w.remoteWriteSeries(""))
+}
+
+// expositionText renders samples in the Prometheus text format, grouped
+// into families with one TYPE line each. The scraper sets instance and job
+// itself, so they are left out, and samples carry no timestamp.
+func expositionText(series []remoteSeries) string {
+	families := make(map[string][]remoteSeries)
+	for _, s := range series {
+		name := s.labels["__name__"]
+		families[name] = append(families[name], s)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	typed := make(map[string]bool)
+	for _, name := range names {
+		// Histogram parts share one TYPE line under their base name
+		family, kind := name, "gauge"
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			base := strings.TrimSuffix(name, suffix)
+			if base != name && families[base+"_bucket"] != nil {
+				family, kind = base, "histogram"
+			}
+		}
+		if kind == "gauge" && strings.HasSuffix(name, "_total") {
+			kind = "counter"
+		}
+		if !typed[family] {
+			fmt.Fprintf(&b, "# TYPE %s %s\n", family, kind)
+			typed[family] = true
+		}
+
+		for _, s := range families[name] {
+			b.WriteString(name)
+			var labels []string
+			for key, value := range s.labels {
+				if key != "__name__" && key != "instance" && key != "job" {
+					labels = append(labels, key+`="`+labelEscaper.Replace(value)+`"`)
+				}
+			}
+			if len(labels) > 0 {
+				sort.Strings(labels)
+				b.WriteString("{" + strings.Join(labels, ",") + "}")
+			}
+			fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	return b.String()
+}
+
+// countProbeFailure adds a failed run to the failure counter of a probe type
+func (w *WiFiMonitor) countProbeFailure(probe string, failed bool) {
+	if failed {
+		w.probeFailures[probe]++
+	}
+}
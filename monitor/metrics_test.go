@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testSeries builds a series with its name and label pairs
+func testSeries(name string, value float64, labels ...string) remoteSeries {
+	s := remoteSeries{labels: map[string]string{"__name__": name}, value: value, timestamp: time.Now()}
+	for i := 0; i+1 < len(labels); i += 2 {
+		s.labels[labels[i]] = labels[i+1]
+	}
+	return s
+}
+
+func TestExpositionText(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []remoteSeries
+		want   string
+	}{
+		{
+			name:   "empty",
+			series: nil,
+			want:   "",
+		},
+		{
+			name:   "gauge without labels",
+			series: []remoteSeries{testSeries("noc_watch_up", 1)},
+			want:   "# TYPE noc_watch_up gauge\nnoc_watch_up 1\n",
+		},
+		{
+			name: "labels sorted, instance and job dropped",
+			series: []remoteSeries{
+				testSeries("noc_watch_latency_seconds", 0.0125, "target", "gw", "interface", "wlan0", "instance", "probe01", "job", "noc-watch"),
+				testSeries("noc_watch_latency_seconds", 0.03, "target", "isp", "interface", "wlan0"),
+			},
+			want: "# TYPE noc_watch_latency_seconds gauge\n" +
+				"noc_watch_latency_seconds{interface=\"wlan0\",target=\"gw\"} 0.0125\n" +
+				"noc_watch_latency_seconds{interface=\"wlan0\",target=\"isp\"} 0.03\n",
+		},
+		{
+			name:   "label values escaped",
+			series: []remoteSeries{testSeries("noc_watch_agent_location", 1, "room", "Hall \"A\"\nback\\door")},
+			want:   "# TYPE noc_watch_agent_location gauge\nnoc_watch_agent_location{room=\"Hall \\\"A\\\"\\nback\\\\door\"} 1\n",
+		},
+		{
+			name:   "counter",
+			series: []remoteSeries{testSeries("noc_watch_probe_failures_total", 12, "probe", "dns")},
+			want:   "# TYPE noc_watch_probe_failures_total counter\nnoc_watch_probe_failures_total{probe=\"dns\"} 12\n",
+		},
+		{
+			name: "families sorted by name",
+			series: []remoteSeries{
+				testSeries("noc_watch_b", 2),
+				testSeries("noc_watch_a", 1),
+			},
+			want: "# TYPE noc_watch_a gauge\nnoc_watch_a 1\n# TYPE noc_watch_b gauge\nnoc_watch_b 2\n",
+		},
+		{
+			name: "histogram shares one TYPE line",
+			series: []remoteSeries{
+				testSeries("noc_watch_dhcp_renew_seconds_bucket", 3, "le", "1"),
+				testSeries("noc_watch_dhcp_renew_seconds_bucket", 5, "le", "+Inf"),
+				testSeries("noc_watch_dhcp_renew_seconds_sum", 4.5),
+				testSeries("noc_watch_dhcp_renew_seconds_count", 5),
+			},
+			want: "# TYPE noc_watch_dhcp_renew_seconds histogram\n" +
+				"noc_watch_dhcp_renew_seconds_bucket{le=\"1\"} 3\n" +
+				"noc_watch_dhcp_renew_seconds_bucket{le=\"+Inf\"} 5\n" +
+				"noc_watch_dhcp_renew_seconds_count 5\n" +
+				"noc_watch_dhcp_renew_seconds_sum 4.5\n",
+		},
+		{
+			name:   "_count without buckets is a gauge",
+			series: []remoteSeries{testSeries("noc_watch_roam_count", 2)},
+			want:   "# TYPE noc_watch_roam_count gauge\nnoc_watch_roam_count 2\n",
+		},
+		{
+			name: "special values",
+			series: []remoteSeries{
+				testSeries("noc_watch_x", math.Inf(1), "v", "inf"),
+				testSeries("noc_watch_x", math.Inf(-1), "v", "-inf"),
+				testSeries("noc_watch_x", math.NaN(), "v", "nan"),
+				testSeries("noc_watch_x", 1e-9, "v", "small"),
+				testSeries("noc_watch_x", 123456789, "v", "large"),
+			},
+			want: "# TYPE noc_watch_x gauge\n" +
+				"noc_watch_x{v=\"inf\"} +Inf\n" +
+				"noc_watch_x{v=\"-inf\"} -Inf\n" +
+				"noc_watch_x{v=\"nan\"} NaN\n" +
+				"noc_watch_x{v=\"small\"} 1e-09\n" +
+				"noc_watch_x{v=\"large\"} 1.23456789e+08\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expositionText(tt.series); got != tt.want {
+				t.Errorf("expositionText() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
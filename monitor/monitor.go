@@ -0,0 +1,1445 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+	"github.com/marokiki/noc-watch/storage"
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// WiFiTest represents a single WiFi quality test result
+type WiFiTest struct {
+	DHCPRenewTime    time.Duration      `json:"dhcp_renew_time_ns"`         // Time taken for DHCP renewal
+	IPv4Connectivity bool               `json:"ipv4"`                       // IPv4 connectivity status
+	IPv6Connectivity bool               `json:"ipv6"`                       // IPv6 connectivity status
+	Latency          time.Duration      `json:"latency_ns"`                 // Measured latency
+	MinLatency       time.Duration      `json:"latency_min_ns,omitempty"`   // Minimum round trip time of the burst
+	MaxLatency       time.Duration      `json:"latency_max_ns,omitempty"`   // Maximum round trip time of the burst
+	Jitter           time.Duration      `json:"jitter_ns,omitempty"`        // RFC 3550 interarrival jitter of the burst
+	Loss             float64            `json:"loss,omitempty"`             // Packet loss of the burst in percent
+	Sent             int                `json:"sent,omitempty"`             // Echo requests sent in the burst
+	Received         int                `json:"received,omitempty"`         // Echo replies received in the burst
+	LocalLatency     time.Duration      `json:"local_latency_ns,omitempty"` // Average round trip time to the default gateway (wireless segment)
+	LocalJitter      time.Duration      `json:"local_jitter_ns,omitempty"`  // Interarrival jitter towards the default gateway
+	LocalLoss        float64            `json:"local_loss,omitempty"`       // Packet loss towards the default gateway in percent
+	Success          bool               `json:"success"`                    // Overall test success status
+	Timestamp        time.Time          `json:"timestamp"`                  // Test execution timestamp
+	Sensor           string             `json:"sensor,omitempty"`           // External sensor hook output of the cycle
+	UpstreamFailure  bool               `json:"upstream_failure,omitempty"` // Wired reference failed too, so not blamed on WiFi
+	Disrupted        bool               `json:"disrupted,omitempty"`        // Taken right after the monitor's own DHCP renewal
+	Targets          []TargetResult     `json:"targets,omitempty"`          // Result per ping target
+	Station          *probe.StationInfo `json:"station,omitempty"`          // WiFi signal, bitrates and retries of the cycle
+	AuthFailure      string             `json:"auth_failure,omitempty"`     // wpa_supplicant authentication failure not yet followed by a connection
+	Lease            *probe.DHCPLease   `json:"lease,omitempty"`            // Address, subnet, gateway, DNS and duration of the renewed lease
+	Gateways         []GatewayProbe     `json:"gateways,omitempty"`         // ARP/NDP reachability of the default gateways in the cycle
+}
+
+// WiFiMonitor manages WiFi quality testing and UI updates
+type WiFiMonitor struct {
+	settings         *config.Settings // Configuration by environment variable name
+	dhcpTests        []WiFiTest       // DHCP test history
+	pingTests        []WiFiTest       // Ping test history
+	successCount     int              // Total successful tests
+	totalCount       int              // Total tests executed
+	upstreamFailures int              // Failed tests the wired reference failed too
+	tui              *ui.TUI          // Terminal dashboard (nil in headless mode)
+	statsRows        []TargetStats    // Rows shown in the stats table; only accessed on the UI goroutine
+	statsSortColumn  int              // Stats table sort column; only accessed on the UI goroutine
+	statsSortDesc    bool             // Stats table sorts in descending order
+	statusText       string           // One-line status summary; only accessed on the UI goroutine
+
+	wifiInterface  string // Network interface used for tests (e.g., wlan0)
+	wiredInterface string // Optional wired management interface (e.g., eth0)
+	logFile        string // Log file path for persistent storage
+	headless       bool   // Run in headless mode (no TUI)
+
+	remoteWriter *RemoteWriter                  // Optional Prometheus remote-write client
+	signer       *storage.ResultSigner          // Optional signer for tamper-evident log blocks
+	notifier     *Notifier                      // Optional label-routed alert webhooks
+	mailer       *Mailer                        // Optional SMTP alerts and daily summary
+	nextSummary  time.Time                      // When the next daily summary email is due
+	silences     *silenceStore                  // Silences muting alert notifications
+	runbooks     []AlertRunbook                 // Runbook links and suggested actions per alert
+	metricRules  []*MetricRule                  // Generic threshold rules on exported metrics
+	alertRules   []*AlertRule                   // Rules evaluated against every test result
+	ispTargets   []*ISPTarget                   // ISP measurement endpoints reported separately for SLA talks
+	ha           *HAPair                        // Optional active/standby pairing
+	heartbeats   chan string                    // Heartbeat datagrams received by the standby
+	wpaEvents    chan WPAEvent                  // Events from the wpa_supplicant control socket (nil if not followed)
+	raEvents     chan probe.RouterAdvertisement // Router advertisements seen on the interface (nil if not monitored)
+	traceReports chan TraceReport               // Path traces finished in the background
+
+	checks             []*periodicCheck         // Auxiliary probes run by the monitoring loop
+	controlRequests    chan controlRequest      // Commands from the control socket, answered by the monitoring loop
+	probeFailures      map[string]int           // Failed runs per probe type since start
+	tailSubscriptions  chan *tailSubscriber     // New `tail` clients, registered by the monitoring loop
+	tailSubscribers    map[*tailSubscriber]bool // Connected `tail` clients
+	probeCache         map[probeKey]cachedProbe // Recent ping results shared between checks
+	coalescedProbes    int                      // Pings answered from probeCache instead of the network
+	activeAlerts       map[string]bool          // Currently firing alerts by name
+	pendingAlerts      []Alert                  // Alert transitions not yet written to the log file
+	incident           *Incident                // Ongoing outage and its timeline
+	pendingIncidents   []Incident               // Resolved incidents not yet written to the log file
+	dhcpRenewHistogram *histogram               // Successful DHCP renewal times since start
+	recentAlerts       []Alert                  // Latest alert transitions for the UI
+	dnsTransport       *DNSTransportResult      // Latest UDP/TCP DNS transport probe result
+	connectivity       connectivityState        // Healthy/degraded/down state announced on transitions
+
+	maintenance    []maintenanceWindow  // Planned windows without alert notifications
+	notifiedAlerts map[string]bool      // Firing alerts whose notification was sent
+	lastNotified   map[string]time.Time // When each alert's firing was last notified
+	heldAlerts     map[string]Alert     // Firings held back by flood control, notified later if they last
+
+	streamSubscribers   map[*streamSubscriber]bool // Connected /api/stream clients
+	streamSubscriptions chan *streamSubscriber     // New /api/stream clients, registered by the monitoring loop
+
+	resolverFingerprint *ResolverFingerprint       // Latest resolver behavior fingerprint
+	resolverHealth      map[string]*resolverHealth // Health of each candidate resolver
+	dnsRecommendation   string                     // Suggested resolver change ("" if none)
+	conntrack           *ConntrackSample           // Latest conntrack table sample
+	snmpTargets         []SNMPTarget               // Upstream devices polled via SNMP
+	snmpSamples         map[string]SNMPSample      // Latest SNMP sample per device name
+	lldpNeighbor        *LLDPNeighbor              // Latest LLDP/CDP neighbor of the wired port
+	lldpBaseline        string                     // First neighbor seen, used to detect changes
+	wiredTest           *WiredTest                 // Latest wired uplink sanity test
+	throughputTests     []ThroughputTest           // Throughput test history
+	reassocTests        []ReassocTest              // Full reassociation test history
+	ipv6Provisions      []IPv6ProvisionTest        // IPv6 provisioning test history
+	gateways            []GatewayProbe             // Latest ARP/NDP probes of the default gateways
+	raRouters           map[string]*raRouter       // Routers that advertised on the interface, by link-local address
+	raBaseline          string                     // First router seen, expected when RA_ROUTERS is unset
+	raSince             time.Time                  // When router advertisement monitoring started
+	wpaControl          string                     // wpa_supplicant control socket path ("" if not followed)
+	wpaEventLog         []WPAEvent                 // Recent wpa_supplicant events
+	wpaAttempt          map[string]time.Time       // First time of each event in the connection attempt in progress
+	wpaConnection       *WPAConnection             // Phases of the latest completed connection
+	authFailure         *WPAEvent                  // Authentication failure since the last successful connection
+	history             *storage.History           // Database the DHCP and ping tests are persisted in (nil if off)
+	linkRates           map[string]*LinkRate       // Negotiated link rate per interface
+	hostnameCheck       *HostnameCheck             // Latest hostname / reverse DNS check
+	publicIP            *PublicIP                  // Latest public address discovery
+	natType             *NATType                   // Latest STUN NAT behavior discovery
+	proxyCheck          *ProxyCheck                // Latest direct vs proxied HTTP comparison
+	pacCheck            *PACCheck                  // Latest PAC fetch-and-evaluate result
+	pacProxy            *url.URL                   // Proxy chosen by the PAC file for the check URL
+	serviceChecks       []ServiceCheck             // Internal venue services to check
+	serviceStatus       map[string]ServiceStatus   // Latest status per service name
+	budgets             []SegmentBudget            // Latency/loss budget attribution history
+	pathHops            []string                   // First hops towards the upstream target
+	traces              []TraceReport              // Path traces taken after failed or slow tests
+	tracing             bool                       // A path trace is running
+	lastTrace           time.Time                  // When the last path trace started
+	pendingTraces       []TraceReport              // Path traces not yet written to the log file
+	availability        availabilityTracker        // Time-weighted availability of the monitored interface
+	tenants             []*Tenant                  // Tenant networks (SSIDs/VLANs) reported separately
+	linkInfo            *LinkInfo                  // Current interface and association facts
+	station             *probe.StationInfo         // Latest nl80211 station info of the association
+	roams               int                        // BSSID changes seen between station samples since start
+	sensor              *SensorReading             // Latest external sensor hook reading
+	anycastPOPs         map[string]*AnycastPOP     // Answering POP per anycast target
+	mtuSweep            *MTUSweep                  // Latest DF payload size sweep
+	ttlProbe            *TTLProbe                  // Latest TTL-limited loss probe
+	profileSchedule     []ProfileWindow            // Daily windows selecting the probe profile
+	profiles            map[string]Profile         // Profiles referenced by the schedule
+	profile             Profile                    // Active probe profile
+	pause               *ProbePause                // Operator pause of active probing (nil while probing)
+	linkMarkers         []ChartMarker              // Roams and link flaps for the latency timeline
+	serviceRates        map[string]*rateEstimate   // Success counts per service check
+	serviceHistory      map[string][]ServiceStatus // Recent results per service check for the stats table
+	dnsLookups          map[string][]DNSLookup     // Recent lookups per name@resolver
+	dnsLookupKeys       []string                   // Keys of dnsLookups in first-seen order
+	httpCheckTargets    []HTTPCheckTarget          // URLs fetched by the HTTP check
+	httpChecks          map[string][]HTTPCheck     // Recent fetches per HTTP check name
+	serviceFailures     map[string]int             // Consecutive failures per service check
+	quarantined         map[string]*Quarantine     // Service checks excluded from the rates as down on their side
+	rateWeights         map[string]float64         // Probe weights of the blended success rate
+	disruptedUntil      time.Time                  // End of the window after the monitor's own DHCP renewal
+	lowPower            *LowPower                  // Low-power probing state (nil when disabled)
+	configHash          string                     // Hash of the active configuration
+	stopRequests        chan string                // Shutdown requests with their reason
+	stopped             chan struct{}              // Closed once the monitoring loop has returned
+	backgroundResults   chan func()                // Recorders of the measurements run off the loop
+	backgroundRuns      map[string]bool            // Measurements running off the loop by name
+	rawOutputs          *probe.RawOutputStore      // Raw outputs of the probe commands for /api/debug
+	reloadRequests      chan struct{}              // SIGHUP requests to re-read the config files
+	dhcpProbe           probe.Probe                // DHCP release/renew of the monitored interface
+	pingTargets         []PingTarget               // Destinations of the connectivity test
+	customProbes        []probe.Probe              // Probes added by an embedding program
+	probeResults        map[string]probe.Result    // Latest result per custom probe
+}
+
+// NewWiFiMonitor creates a new WiFi monitor instance
+func NewWiFiMonitor(s *config.Settings) *WiFiMonitor {
+	// Get WiFi interface from WIFI_INTERFACE, default to wlan0
+	wifiInterface := s.Get("WIFI_INTERFACE")
+	if wifiInterface == "" {
+		wifiInterface = "wlan0"
+	}
+
+	// Get log file path from LOG_FILE, default to current directory
+	logFile := s.Get("LOG_FILE")
+	if logFile == "" {
+		logFile = "noc-watch.log"
+	}
+
+	// Check if running in headless mode
+	headless := s.Get("HEADLESS") == "true"
+
+	w := &WiFiMonitor{
+		settings:          s,
+		rawOutputs:        probe.NewRawOutputStore(s.Int("RAW_OUTPUT_LIMIT", 20)),
+		dhcpTests:         make([]WiFiTest, 0),
+		pingTests:         make([]WiFiTest, 0),
+		wifiInterface:     wifiInterface,
+		wiredInterface:    s.Get("WIRED_INTERFACE"),
+		logFile:           logFile,
+		headless:          headless,
+		remoteWriter:      NewRemoteWriter(s),
+		signer:            storage.NewResultSigner(s, logFile),
+		silences:          newSilenceStore(silenceFile(s)),
+		runbooks:          loadRunbooks(s),
+		metricRules:       loadMetricRules(s),
+		alertRules:        loadAlertRules(s),
+		ispTargets:        parseISPTargets(s),
+		ha:                NewHAPair(s),
+		lowPower:          NewLowPower(s),
+		configHash:        configHash(s),
+		stopRequests:      make(chan string),
+		stopped:           make(chan struct{}),
+		backgroundResults: make(chan func()),
+		backgroundRuns:    make(map[string]bool),
+		reloadRequests:    make(chan struct{}, 1),
+		activeAlerts:      make(map[string]bool),
+		maintenance:       maintenanceWindows(s),
+		notifiedAlerts:    make(map[string]bool),
+		lastNotified:      make(map[string]time.Time),
+		heldAlerts:        make(map[string]Alert),
+
+		dhcpRenewHistogram: newHistogram(dhcpRenewBuckets),
+
+		controlRequests:   make(chan controlRequest),
+		tailSubscriptions: make(chan *tailSubscriber),
+		tailSubscribers:   make(map[*tailSubscriber]bool),
+
+		streamSubscribers:   make(map[*streamSubscriber]bool),
+		streamSubscriptions: make(chan *streamSubscriber),
+
+		resolverHealth:   make(map[string]*resolverHealth),
+		anycastPOPs:      make(map[string]*AnycastPOP),
+		snmpTargets:      parseSNMPTargets(s),
+		snmpSamples:      make(map[string]SNMPSample),
+		raRouters:        make(map[string]*raRouter),
+		traceReports:     make(chan TraceReport, 1),
+		linkRates:        make(map[string]*LinkRate),
+		serviceChecks:    parseServiceChecks(s),
+		serviceStatus:    make(map[string]ServiceStatus),
+		serviceRates:     make(map[string]*rateEstimate),
+		serviceHistory:   make(map[string][]ServiceStatus),
+		dnsLookups:       make(map[string][]DNSLookup),
+		httpCheckTargets: parseHTTPCheckTargets(s),
+		httpChecks:       make(map[string][]HTTPCheck),
+		serviceFailures:  make(map[string]int),
+		quarantined:      make(map[string]*Quarantine),
+		rateWeights:      probeWeights(s),
+		availability:     newAvailabilityTracker(),
+		tenants:          parseTenants(s),
+
+		profileSchedule: parseProfileSchedule(s),
+		probeResults:    make(map[string]probe.Result),
+		probeFailures:   make(map[string]int),
+	}
+
+	// The built-in tests run as probes of the monitored interface
+	w.dhcpProbe = probe.NewDHCPProbe(s, wifiInterface)
+	w.pingTargets = parsePingTargets(s)
+	w.profiles = loadProfiles(s, w.profileSchedule)
+	w.notifier = NewNotifier(s, metricRuleRoutes(w.metricRules))
+	w.mailer = NewMailer(s)
+	w.profile = w.scheduledProfile(time.Now())
+
+	// Register auxiliary checks; probes send traffic, the others only collect
+	w.addProbe("dns-transport", s.Duration("DNS_CHECK_INTERVAL", 5*time.Minute), w.runDNSTransportCheck)
+	w.addProbe("dns-fingerprint", s.Duration("DNS_FINGERPRINT_INTERVAL", 30*time.Minute), w.runResolverFingerprint)
+	w.addProbe("dns-lookup", s.Duration("DNS_LOOKUP_INTERVAL", 1*time.Minute), w.runDNSLookups)
+	w.addProbe("dns-ranking", s.Duration("DNS_RANKING_INTERVAL", 1*time.Minute), w.runResolverRanking)
+	w.addProbe("hostname", s.Duration("HOSTNAME_CHECK_INTERVAL", 10*time.Minute), w.runHostnameCheck)
+	w.addProbe("proxy", s.Duration("PROXY_CHECK_INTERVAL", 5*time.Minute), w.runProxyCheck)
+	w.addProbe("pac", s.Duration("PAC_CHECK_INTERVAL", 5*time.Minute), w.runPACCheck)
+	w.addCheck("conntrack", s.Duration("CONNTRACK_CHECK_INTERVAL", 30*time.Second), w.runConntrackCheck)
+	w.addProbe("path-discovery", s.Duration("PATH_DISCOVERY_INTERVAL", 10*time.Minute), w.runPathDiscovery)
+	w.addProbe("budget", s.Duration("BUDGET_INTERVAL", 1*time.Minute), w.runBudgetAttribution)
+	w.addCheck("link-rate", s.Duration("LINK_RATE_INTERVAL", 30*time.Second), w.runLinkRateCheck)
+	w.addCheck("link-info", s.Duration("LINK_INFO_INTERVAL", 10*time.Second), w.runLinkInfoCheck)
+	w.addCheck("silences", 10*time.Second, func() {
+		// Pick up silences written to the file while the control socket
+		// was unavailable
+		if err := w.silences.reload(); err != nil {
+			fmt.Printf("Error loading silences: %v\n", err)
+		}
+	})
+	if s.Get("TTL_PROBE") == "true" {
+		w.addProbe("ttl-probe", s.Duration("TTL_PROBE_INTERVAL", 1*time.Minute), w.runTTLProbe)
+	}
+	if s.Get("MTU_SWEEP") == "true" {
+		w.addProbe("mtu-sweep", s.Duration("MTU_SWEEP_INTERVAL", 5*time.Minute), w.runMTUSweep)
+	}
+	if len(s.List("ANYCAST_TARGETS")) > 0 {
+		w.addProbe("anycast", s.Duration("ANYCAST_CHECK_INTERVAL", 10*time.Minute), w.runAnycastCheck)
+	}
+	if s.Get("SENSOR_COMMAND") != "" {
+		w.addCheck("sensor", s.Duration("SENSOR_INTERVAL", 1*time.Minute), w.runSensorHook)
+	}
+	if w.ha != nil && w.ha.role == "active" {
+		if w.ha.peer == "" {
+			fmt.Println("Error: HA_ROLE=active requires HA_PEER (standby host:port)")
+		} else {
+			w.addCheck("heartbeat", s.Duration("HA_HEARTBEAT_INTERVAL", 5*time.Second), w.sendHeartbeat)
+		}
+	}
+	if w.ha != nil && w.ha.role == "standby" {
+		w.heartbeats = make(chan string, 1)
+	}
+	if w.wpaControl = wpaControlPath(s, w.wifiInterface); w.wpaControl != "" {
+		w.wpaEvents = make(chan WPAEvent, 16)
+	}
+	if s.Get("RA_MONITOR") == "true" {
+		w.raEvents = make(chan probe.RouterAdvertisement, 16)
+		w.addCheck("ra", raCheckInterval, w.checkRouterAdvertisements)
+	}
+	if interval := s.Duration("PUBLIC_IP_INTERVAL", 5*time.Minute); interval > 0 {
+		w.addProbe("public-ip", interval, w.runPublicIPCheck)
+	}
+	if interval := s.Duration("NAT_TYPE_INTERVAL", 30*time.Minute); interval > 0 {
+		w.addProbe("nat-type", interval, w.runNATTypeCheck)
+	}
+	if interval := s.Duration("REASSOC_INTERVAL", 0); interval > 0 {
+		w.addProbe("reassoc", interval, w.runReassocTest)
+	}
+	if interval := s.Duration("IPV6_PROVISION_INTERVAL", 0); interval > 0 {
+		w.addProbe("ipv6-provision", interval, w.runIPv6ProvisionTest)
+	}
+	if throughputMethod(s) != "" {
+		w.addProbe("throughput", s.Duration("THROUGHPUT_INTERVAL", 30*time.Minute), w.runThroughputTest)
+	}
+	if len(w.httpCheckTargets) > 0 {
+		w.addProbe("http", s.Duration("HTTP_CHECK_INTERVAL", 1*time.Minute), w.runHTTPChecks)
+	}
+	if len(w.ispTargets) > 0 {
+		w.addProbe("isp-sla", s.Duration("ISP_CHECK_INTERVAL", 1*time.Minute), w.runISPChecks)
+	}
+	if s.Get("METRIC_RULES") != "" {
+		w.addCheck("metric-rules", s.Duration("METRIC_RULE_INTERVAL", 15*time.Second), w.runMetricRules)
+	}
+	w.addCheck("alert-hold", 15*time.Second, w.releaseHeldAlerts)
+	if s.Duration("RETENTION", 0) > 0 {
+		w.addCheck("retention", s.Duration("RETENTION_CHECK_INTERVAL", 1*time.Hour), w.runRetention)
+	}
+	if w.mailer != nil && s.Get("SMTP_SUMMARY_AT") != "off" {
+		w.nextSummary = nextSummaryTime(s, time.Now())
+		w.addCheck("email-summary", time.Minute, w.runDailySummary)
+	}
+	if len(w.tenants) > 0 {
+		w.addProbe("tenants", s.Duration("TENANT_CHECK_INTERVAL", 1*time.Minute), w.runTenantTests)
+	}
+	if len(w.serviceChecks) > 0 {
+		w.addProbe("services", s.Duration("SERVICE_CHECK_INTERVAL", 1*time.Minute), w.runServiceChecks)
+	}
+	if len(w.snmpTargets) > 0 {
+		w.addCheck("snmp", s.Duration("SNMP_INTERVAL", 1*time.Minute), w.runSNMPPoll)
+	}
+	if w.wiredInterface != "" || s.Get("LLDP_INTERFACE") != "" {
+		w.addCheck("lldp", s.Duration("LLDP_INTERVAL", 1*time.Minute), w.runLLDPCheck)
+	}
+	if w.wiredInterface != "" {
+		w.addProbe("wired", s.Duration("WIRED_CHECK_INTERVAL", 1*time.Minute), func() { w.runWiredTest(false) })
+		// Renewing the lease on the wired port is disruptive, so it is opt-in
+		if s.Get("WIRED_DHCP_TEST") == "true" {
+			w.addProbe("wired-dhcp", s.Duration("WIRED_DHCP_INTERVAL", 5*time.Minute), func() { w.runWiredTest(true) })
+		}
+	}
+
+	// Link facts are shown from startup instead of waiting for the first interval
+	w.runLinkInfoCheck()
+
+	return w
+}
+
+// runTest executes a complete WiFi quality test
+func (w *WiFiMonitor) runTest() WiFiTest {
+	test := WiFiTest{
+		Timestamp: time.Now(),
+	}
+
+	// DHCP renewal test
+	dhcp := w.runProbe(w.dhcpProbe, coreProbeTimeout)
+	test.DHCPRenewTime = dhcp.Latency
+	if p, ok := w.dhcpProbe.(*probe.DHCPProbe); ok {
+		test.Lease = p.Lease()
+	}
+
+	// Connectivity and latency tests against every ping target
+	w.runPingTargets(&test)
+
+	// Determine overall success
+	test.Success = dhcp.Success && test.IPv4Connectivity && (test.Latency > 0)
+
+	return test
+}
+
+// updateUI updates all UI components with current test data
+func (w *WiFiMonitor) updateUI() {
+	if w.headless {
+		return // No UI updates in headless mode
+	}
+
+	// Calculate success rates; the per-target breakdown goes to the stats table
+	overall := w.blendedSuccessRate()
+	targetRows := w.targetStats()
+
+	// Get current time
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+
+	// Update statistics display
+	statsText := fmt.Sprintf(
+		"[white]Current Time: [cyan]%s[white]\n"+
+			"Total Tests: %d | [green]Success: %d[white] | [red]Failure: %d[white]\n"+
+			"Success Rate: [yellow]%s[white]%s\n"+
+			"Availability: [yellow]%s[white] | Health: [yellow]%s[white]\n",
+		currentTime, w.totalCount, w.successCount, w.totalCount-w.successCount, overall, disruptionNote(w.settings, w.pingTests), w.availability.String(), w.health(time.Now()),
+	)
+	if w.wiredInterface != "" {
+		statsText += fmt.Sprintf("WiFi Success Rate: [yellow]%s[white] (%d upstream failures excluded)\n",
+			w.accessEstimate().format(w.minRateSamples()), w.upstreamFailures)
+	}
+	if w.publicIP != nil {
+		statsText += fmt.Sprintf("Public IP: [yellow]%s[white]\n", w.publicIP)
+	}
+	if w.natType != nil {
+		statsText += fmt.Sprintf("NAT Type: [yellow]%s[white]\n", ui.Escape(w.natType.String()))
+	}
+	if summary := w.latencySplitSummary(time.Now()); summary != "" {
+		statsText += fmt.Sprintf("Latency local | upstream: [yellow]%s[white]\n", summary)
+	}
+	if w.lowPower != nil {
+		statsText += fmt.Sprintf("Low Power: [yellow]%s[white]\n", w.lowPower)
+	}
+	if summary := w.throughputSummary(); summary != "" {
+		statsText += fmt.Sprintf("Throughput: [yellow]%s[white]\n", summary)
+	}
+	if n := len(w.reassocTests); n > 0 {
+		statsText += fmt.Sprintf("Reassociation: [yellow]%s[white]\n", ui.Escape(w.reassocTests[n-1].String()))
+	}
+	if n := len(w.ipv6Provisions); n > 0 {
+		statsText += fmt.Sprintf("IPv6 Provisioning: [yellow]%s[white]\n", ui.Escape(w.ipv6Provisions[n-1].String()))
+	}
+	if summary := gatewaySummary(w.gateways); summary != "" {
+		statsText += fmt.Sprintf("Gateway: [yellow]%s[white]\n", ui.Escape(summary))
+	}
+	if summary := w.raSummary(); summary != "" {
+		statsText += fmt.Sprintf("Router Adverts: [yellow]%s[white]\n", ui.Escape(summary))
+	}
+	if summary := w.wpaSummary(); summary != "" {
+		statsText += fmt.Sprintf("Supplicant: [yellow]%s[white]\n", ui.Escape(summary))
+	}
+
+	// Update chart display (ASCII art)
+	chartText := "Test Results:\n\n"
+
+	// DHCP Test Results
+	chartText += fmt.Sprintf("[yellow]DHCP Test Results (Every %v):[white]\n", w.dhcpInterval())
+	if len(w.dhcpTests) == 0 {
+		chartText += "  [yellow]Waiting for first DHCP test...[white]\n"
+	} else {
+		for i, test := range w.dhcpTests[max(len(w.dhcpTests)-10, 0):] { // Show only latest 10 DHCP tests
+			status := "[red]x"
+			if test.Success {
+				status = "[green]o"
+			}
+			chartText += fmt.Sprintf("  [%d] %s DHCP: %v\n",
+				i+1, status, test.DHCPRenewTime)
+		}
+	}
+
+	chartText += fmt.Sprintf("\n[yellow]Ping Test Results (Every %v):[white]\n", w.pingInterval())
+	if len(w.pingTests) == 0 {
+		chartText += "  [yellow]Waiting for first ping test...[white]\n"
+	} else {
+		for i, test := range w.pingTests[max(len(w.pingTests)-10, 0):] { // Show only latest 10 ping tests
+			status := "[red]x"
+			if test.Success {
+				status = "[green]o"
+			}
+			chartText += fmt.Sprintf("  [%d] %s IPv4: %v IPv6: %v Latency: %v Jitter: %v Loss: %.0f%%\n",
+				i+1, status, test.IPv4Connectivity, test.IPv6Connectivity, test.Latency, test.Jitter.Round(10*time.Microsecond), test.Loss)
+		}
+	}
+
+	chartText += w.latencyChartText(40)
+	chartText += w.budgetChartText(40)
+
+	// Update log display
+	logText := "Latest Test Results:\n\n"
+
+	// Latest DHCP Test
+	logText += "[yellow]Latest DHCP Test:[white]\n"
+	if len(w.dhcpTests) > 0 {
+		latest := w.dhcpTests[len(w.dhcpTests)-1]
+		logText += fmt.Sprintf("Time: %s\n", latest.Timestamp.Format("15:04:05"))
+		logText += fmt.Sprintf("DHCP Renew: %v\n", latest.DHCPRenewTime)
+		if latest.Lease != nil {
+			logText += fmt.Sprintf("Lease: %s\n", latest.Lease)
+		}
+		logText += fmt.Sprintf("Success: %v\n", latest.Success)
+	} else {
+		logText += "[yellow]No DHCP tests completed yet.[white]\n"
+	}
+
+	logText += "\n[yellow]Latest Ping Test:[white]\n"
+	if len(w.pingTests) > 0 {
+		latest := w.pingTests[len(w.pingTests)-1]
+		logText += fmt.Sprintf("Time: %s\n", latest.Timestamp.Format("15:04:05"))
+		logText += fmt.Sprintf("IPv4: %v\n", latest.IPv4Connectivity)
+		logText += fmt.Sprintf("IPv6: %v\n", latest.IPv6Connectivity)
+		logText += fmt.Sprintf("Latency: %v (min %v, max %v)\n", latest.Latency, latest.MinLatency, latest.MaxLatency)
+		if latest.LocalLatency > 0 {
+			logText += fmt.Sprintf("Local Latency: %v (jitter %v, loss %.1f%%)\n", latest.LocalLatency, latest.LocalJitter, latest.LocalLoss)
+		}
+		logText += fmt.Sprintf("Jitter: %v\n", latest.Jitter)
+		logText += fmt.Sprintf("Loss: %.1f%%\n", latest.Loss)
+		logText += fmt.Sprintf("Success: %v\n", latest.Success)
+	} else {
+		logText += "[yellow]No ping tests completed yet.[white]\n"
+	}
+
+	if n := len(w.traces); n > 0 {
+		logText += "\n[yellow]Latest Trace:[white]\n"
+		logText += fmt.Sprintf("Time: %s\n", w.traces[n-1].Timestamp.Format("15:04:05"))
+		logText += ui.Escape(w.traces[n-1].String()) + "\n"
+	}
+
+	if w.wiredTest != nil {
+		logText += "\n[yellow]Latest Wired Test:[white]\n"
+		logText += fmt.Sprintf("Time: %s\n", w.wiredTest.Timestamp.Format("15:04:05"))
+		logText += fmt.Sprintf("Link: %v %dMb/s %s VLAN %s\n", w.wiredTest.LinkUp, w.wiredTest.Speed, w.wiredTest.Duplex, w.wiredTest.VLAN)
+		if w.wiredTest.DHCPTested {
+			logText += fmt.Sprintf("DHCP Renew: %v\n", w.wiredTest.DHCPTime)
+		}
+		logText += fmt.Sprintf("Success: %v\n", w.wiredTest.Success)
+	}
+
+	if lines := w.customProbeLines(); len(lines) > 0 {
+		logText += "\n[yellow]Custom Probes:[white]\n"
+		for _, line := range lines {
+			logText += ui.Escape(line) + "\n"
+		}
+	}
+
+	if lookups := w.latestDNSLookups(); len(lookups) > 0 {
+		logText += "\n[yellow]DNS Lookups:[white]\n"
+		for _, lookup := range lookups {
+			color := "[green]"
+			if lookup.Error != "" {
+				color = "[red]"
+			}
+			logText += color + ui.Escape(lookup.String()) + "[white]\n"
+		}
+	}
+
+	if checks := w.latestHTTPChecks(); len(checks) > 0 {
+		logText += "\n[yellow]HTTP Checks:[white]\n"
+		for _, check := range checks {
+			color := "[green]"
+			if check.Error != "" {
+				color = "[red]"
+			}
+			logText += color + ui.Escape(check.String()) + "[white]\n"
+		}
+	}
+
+	if len(w.ispTargets) > 0 {
+		logText += "\n[yellow]ISP SLA Targets:[white]\n"
+		for _, target := range w.ispTargets {
+			logText += ui.Escape(target.String()) + "\n"
+		}
+	}
+
+	if w.dnsRecommendation != "" {
+		logText += "\n[yellow]DNS Recommendation:[white]\n"
+		logText += w.dnsRecommendation + "\n"
+	}
+
+	if silences := w.silences.active(time.Now()); len(silences) > 0 {
+		logText += "\n[yellow]Active Silences:[white]\n"
+		for _, silence := range silences {
+			logText += "[gray]" + ui.Escape(silence.String()) + "[white]\n"
+		}
+	}
+
+	if len(w.recentAlerts) > 0 {
+		logText += "\n[yellow]Recent Alerts:[white]\n"
+		for i := len(w.recentAlerts) - 1; i >= 0; i-- {
+			alert := w.recentAlerts[i]
+			color := "[red]"
+			if alert.Silenced != "" || alert.Suppressed != "" {
+				color = "[gray]"
+			} else if alert.Event {
+				color = "[yellow]"
+			} else if alert.Resolved {
+				color = "[green]"
+			}
+			logText += color + ui.Escape(alert.String()) + "[white]\n"
+			// Firing alerts show what to do next
+			if hint := strings.TrimSpace(alert.Action + " " + alert.Runbook); hint != "" {
+				logText += "  [gray]-> " + ui.Escape(hint) + "[white]\n"
+			}
+		}
+	}
+
+	var serviceText string
+	if len(w.serviceChecks) > 0 {
+		serviceText = w.serviceChecklistText()
+	}
+
+	var linkText string
+	if w.linkInfo != nil {
+		linkText = w.linkInfo.paneText()
+	}
+	if w.station != nil {
+		linkText += stationPaneText(w.station, w.settings.Int("WIFI_MIN_SIGNAL_DBM", -75))
+	}
+
+	statusLine := w.statusLine()
+
+	// Update UI components (thread-safe)
+	w.tui.Queue(func() {
+		w.statusText = statusLine
+		w.tui.SetPanes(ui.Panes{Stats: statsText, Link: linkText, Chart: chartText, Service: serviceText, Log: logText})
+		w.statsRows = targetRows
+		w.renderStatsTable()
+	})
+}
+
+// writeResultsToFile writes test results to a text file
+func (w *WiFiMonitor) writeResultsToFile() error {
+	// Build the block in memory so it can be signed before it is written
+	var block bytes.Buffer
+	var err error
+
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+
+	// Write summary
+	_, err = fmt.Fprintf(&block, "\n=== WiFi Quality Test Results - %s ===\nStamp: %s\n", currentTime, w.stamp())
+	if err != nil {
+		return err
+	}
+
+	// Write DHCP test results
+	if len(w.dhcpTests) > 0 {
+		latest := w.dhcpTests[len(w.dhcpTests)-1]
+		_, err = fmt.Fprintf(&block, "DHCP Test: Success=%v, Time=%v\n", latest.Success, latest.DHCPRenewTime)
+		if err != nil {
+			return err
+		}
+		if latest.Lease != nil {
+			_, err = fmt.Fprintf(&block, "DHCP Lease: %s\n", latest.Lease)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write ping test results
+	if len(w.pingTests) > 0 {
+		latest := w.pingTests[len(w.pingTests)-1]
+		_, err = fmt.Fprintf(&block, "Ping Test: Success=%v, IPv4=%v, IPv6=%v, Latency=%v, Min=%v, Max=%v, Jitter=%v, Loss=%.1f%%\n",
+			latest.Success, latest.IPv4Connectivity, latest.IPv6Connectivity, latest.Latency,
+			latest.MinLatency, latest.MaxLatency, latest.Jitter, latest.Loss)
+		if err != nil {
+			return err
+		}
+		if latest.LocalLatency > 0 {
+			_, err = fmt.Fprintf(&block, "  Local (gateway): Latency=%v, Jitter=%v, Loss=%.1f%%\n",
+				latest.LocalLatency, latest.LocalJitter, latest.LocalLoss)
+			if err != nil {
+				return err
+			}
+		}
+		for _, result := range latest.Targets {
+			_, err = fmt.Fprintf(&block, "  Target %s: Success=%v, Latency=%v, Jitter=%v, Loss=%.1f%%\n",
+				result.Name, result.Success, result.Latency, result.Jitter, result.Loss)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write the traces taken since the last block
+	for _, report := range w.pendingTraces {
+		_, err = fmt.Fprintf(&block, "Trace at %s %s\n", report.Timestamp.Format("15:04:05"), report)
+		if err != nil {
+			return err
+		}
+	}
+	w.pendingTraces = nil
+
+	// Write the probing pause
+	if w.pause != nil {
+		_, err = fmt.Fprintf(&block, "Probing: paused since %s %s\n", w.pause.Since.Format("15:04:05"), w.pause)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the low-power state
+	if w.lowPower != nil {
+		_, err = fmt.Fprintf(&block, "Low Power: %s\n", w.lowPower)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the active/standby state
+	if w.ha != nil {
+		_, err = fmt.Fprintf(&block, "HA: %s\n", w.ha)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the active probe profile
+	if len(w.profileSchedule) > 0 {
+		_, err = fmt.Fprintf(&block, "Profile: %s (%s)\n", w.profile.Name, w.profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write link facts
+	if w.linkInfo != nil {
+		_, err = fmt.Fprintf(&block, "Link Info: %s\n", w.linkInfo)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write WiFi station info
+	if w.station != nil {
+		_, err = fmt.Fprintf(&block, "Station: %s\n", w.station)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write external sensor reading
+	if w.sensor != nil {
+		_, err = fmt.Fprintf(&block, "Sensor: %s\n", w.sensor)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write DNS transport probe result
+	if w.dnsTransport != nil {
+		_, err = fmt.Fprintf(&block, "DNS Transport: %s\n", w.dnsTransport)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write resolver behavior section
+	if w.resolverFingerprint != nil {
+		_, err = fmt.Fprintf(&block, "Resolver Behavior: %s\n", w.resolverFingerprint)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write resolver ranking and failover recommendation
+	if ranking := w.resolverRankingText(); ranking != "" {
+		_, err = fmt.Fprintf(&block, "Resolver Ranking: %s\n", ranking)
+		if err != nil {
+			return err
+		}
+	}
+	if w.dnsRecommendation != "" {
+		_, err = fmt.Fprintf(&block, "DNS Recommendation: %s\n", w.dnsRecommendation)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the public addresses of the interface
+	if w.publicIP != nil {
+		_, err = fmt.Fprintf(&block, "Public IP: %s\n", w.publicIP)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the NAT behavior of the uplink
+	if w.natType != nil {
+		_, err = fmt.Fprintf(&block, "NAT Type: %s\n", w.natType)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write hostname and reverse DNS sanity check
+	if w.hostnameCheck != nil {
+		_, err = fmt.Fprintf(&block, "Hostname Check: %s\n", w.hostnameCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write proxy detection and direct vs proxied comparison
+	if w.proxyCheck != nil {
+		_, err = fmt.Fprintf(&block, "Proxy Check: %s\n", w.proxyCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write PAC evaluation
+	if w.pacCheck != nil {
+		_, err = fmt.Fprintf(&block, "PAC Check: %s\n", w.pacCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write internal service checklist
+	for _, check := range w.serviceChecks {
+		if status, ok := w.serviceStatus[check.Name]; ok {
+			_, err = fmt.Fprintf(&block, "Service %s (%s %s): OK=%v, Latency=%v, Error=%s\n",
+				check.Name, check.Kind, check.Target, status.OK, status.Latency, status.Error)
+			if err != nil {
+				return err
+			}
+		}
+		if q := w.quarantined[check.Name]; q != nil {
+			_, err = fmt.Fprintf(&block, "Service %s: %s\n", check.Name, q)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write conntrack table occupancy
+	if w.conntrack != nil {
+		_, err = fmt.Fprintf(&block, "Conntrack: %s\n", w.conntrack)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write discovered path
+	if len(w.pathHops) > 0 {
+		_, err = fmt.Fprintf(&block, "Path: %s\n", formatHops(w.pathHops))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write TTL-limited loss isolation
+	if w.ttlProbe != nil {
+		_, err = fmt.Fprintf(&block, "TTL Probe: %s\n", w.ttlProbe)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write DF payload size sweep
+	if w.mtuSweep != nil {
+		_, err = fmt.Fprintf(&block, "MTU Sweep: %s\n", w.mtuSweep)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write answering anycast POPs
+	for _, target := range w.settings.List("ANYCAST_TARGETS") {
+		if pop, ok := w.anycastPOPs[target]; ok {
+			_, err = fmt.Fprintf(&block, "Anycast POP: %s\n", pop)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write the latest result of every custom probe
+	for _, line := range w.customProbeLines() {
+		_, err = fmt.Fprintf(&block, "Probe: %s\n", line)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the latest DNS lookup per name and resolver
+	for _, lookup := range w.latestDNSLookups() {
+		_, err = fmt.Fprintf(&block, "DNS Lookup: %s\n", lookup)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the latest throughput test
+	if n := len(w.throughputTests); n > 0 {
+		_, err = fmt.Fprintf(&block, "Throughput: %s\n", w.throughputTests[n-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the latest reassociation test
+	if n := len(w.reassocTests); n > 0 {
+		_, err = fmt.Fprintf(&block, "Reassociation: %s\n", w.reassocTests[n-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the latest IPv6 provisioning test
+	if n := len(w.ipv6Provisions); n > 0 {
+		_, err = fmt.Fprintf(&block, "IPv6 Provisioning: %s\n", w.ipv6Provisions[n-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the link-layer reachability of the default gateways
+	if summary := gatewaySummary(w.gateways); summary != "" {
+		_, err = fmt.Fprintf(&block, "Gateway: %s\n", summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the routers advertising on the link
+	if summary := w.raSummary(); summary != "" {
+		_, err = fmt.Fprintf(&block, "Router Adverts: %s\n", summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the supplicant's connection state
+	if summary := w.wpaSummary(); summary != "" {
+		_, err = fmt.Fprintf(&block, "Supplicant: %s\n", summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the latest fetch of every HTTP check with its phases
+	for _, check := range w.latestHTTPChecks() {
+		_, err = fmt.Fprintf(&block, "HTTP Check: %s\n", check)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the ISP endpoint statistics, kept apart from the venue targets
+	for _, target := range w.ispTargets {
+		_, err = fmt.Fprintf(&block, "ISP SLA: %s\n", target)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write latency/loss budget attribution
+	if summary := w.budgetSummary(); summary != "" {
+		_, err = fmt.Fprintf(&block, "Latency Budget: %s\n", summary)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write wired uplink test results
+	if w.wiredTest != nil {
+		_, err = fmt.Fprintf(&block, "Wired Test: %s\n", w.wiredTest)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write negotiated link rates
+	for _, iface := range []string{w.wifiInterface, w.wiredInterface} {
+		if rate, ok := w.linkRates[iface]; ok {
+			_, err = fmt.Fprintf(&block, "Link Rate: %s\n", rate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write physical attachment point of the wired port
+	if w.lldpNeighbor != nil {
+		_, err = fmt.Fprintf(&block, "LLDP Neighbor: %s\n", w.lldpNeighbor)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write upstream device counters
+	for _, target := range w.snmpTargets {
+		if sample, ok := w.snmpSamples[target.Name]; ok {
+			_, err = fmt.Fprintf(&block, "SNMP %s\n", sample)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write alert transitions since the last write
+	for _, alert := range w.pendingAlerts {
+		_, err = fmt.Fprintf(&block, "%s\n", alert)
+		if err != nil {
+			return err
+		}
+	}
+	w.pendingAlerts = nil
+
+	// Write timelines of outages resolved since the last write
+	for _, incident := range w.pendingIncidents {
+		_, err = fmt.Fprintf(&block, "Incident Timeline: %s - %s (%s)\n",
+			incident.Start.Format("2006-01-02 15:04:05"), incident.End.Format("15:04:05"), incident.Class)
+		if err != nil {
+			return err
+		}
+		for _, entry := range incident.Timeline {
+			_, err = fmt.Fprintf(&block, "  %s\n", entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.pendingIncidents = nil
+
+	// Write statistics
+	overall := w.blendedSuccessRate()
+	_, err = fmt.Fprintf(&block, "Total Tests: %d, Success: %d, Success Rate: %s\n",
+		w.totalCount, w.successCount, overall)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(&block, "Availability: %s\n", w.availability.String())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(&block, "Health: %s\n", w.health(time.Now()))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(&block, "DHCP Success Rate: %s\n", successEstimate(w.dhcpTests).format(w.minRateSamples()))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(&block, "Ping Success Rate: %s%s\n", successEstimate(headlineTests(w.settings, w.pingTests)).format(w.minRateSamples()), disruptionNote(w.settings, w.pingTests))
+	if err != nil {
+		return err
+	}
+	for _, line := range w.rateLines() {
+		_, err = fmt.Fprintln(&block, line)
+		if err != nil {
+			return err
+		}
+	}
+	if w.wiredInterface != "" {
+		_, err = fmt.Fprintf(&block, "WiFi Success Rate: %s (%d upstream failures excluded)\n",
+			w.accessEstimate().format(w.minRateSamples()), w.upstreamFailures)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(&block, "DHCP Renew Time: %s\n",
+		w.recentDHCPRenewals(time.Now(), w.settings.Duration("DHCP_P95_WINDOW", 1*time.Hour)))
+	if err != nil {
+		return err
+	}
+
+	// Write per-tenant sections
+	for _, tenant := range w.tenants {
+		if err := tenant.writeReport(&block, w.minRateSamples()); err != nil {
+			return err
+		}
+	}
+	if err := w.writeTenantFiles(); err != nil {
+		return err
+	}
+
+	return w.appendLogBlock(&block)
+}
+
+// appendLogBlock signs a block, terminates it with the footer and appends it to the log file
+func (w *WiFiMonitor) appendLogBlock(block *bytes.Buffer) error {
+	file, err := os.OpenFile(w.logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Sign the block so the log can be shown to be unmodified
+	if w.signer != nil {
+		_, err = fmt.Fprintf(block, "%s\n", w.signer.Sign(block.Bytes()))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(block, "%s\n", storage.LogFooter)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(block.Bytes())
+	return err
+}
+
+// startMonitoring begins periodic WiFi quality testing
+func (w *WiFiMonitor) startMonitoring() {
+	// Continue from the persisted history
+	w.openHistory()
+	defer w.closeHistory()
+
+	// Test intervals come from the scheduled profile
+	dhcpTicker := time.NewTicker(w.dhcpInterval())
+	defer dhcpTicker.Stop()
+
+	pingTicker := time.NewTicker(w.pingInterval())
+	defer pingTicker.Stop()
+
+	fileTicker := time.NewTicker(1 * time.Minute)
+	defer fileTicker.Stop()
+
+	// UI refresh only runs in TUI mode; a nil channel never fires.
+	// Low-power mode redraws on new results only.
+	var uiTick <-chan time.Time
+	if !w.headless {
+		if w.lowPower == nil {
+			uiTicker := time.NewTicker(1 * time.Second)
+			defer uiTicker.Stop()
+			uiTick = uiTicker.C
+		}
+
+		// Initial UI update to show the framework
+		w.updateUI()
+	}
+
+	// Remote-write push only runs when an endpoint is configured
+	var remoteWriteTick <-chan time.Time
+	if w.remoteWriter != nil {
+		remoteWriteTicker := time.NewTicker(w.remoteWriter.interval)
+		defer remoteWriteTicker.Stop()
+		remoteWriteTick = remoteWriteTicker.C
+	}
+
+	// Auxiliary checks are scheduled individually and polled every second
+	// (less often in low-power mode, where probes run in batches anyway)
+	checkPoll := 1 * time.Second
+	if w.lowPower != nil {
+		checkPoll = lowPowerPoll
+	}
+	checkTicker := time.NewTicker(checkPoll)
+	defer checkTicker.Stop()
+
+	// Commands from `noc-watch status` and friends, and Prometheus scrapes.
+	// The listeners close when the loop returns, after w.stopped has told
+	// waiting handlers, so an embedding program's Run leaves nothing behind.
+	stopControl := w.startControlServer()
+	defer stopControl()
+	stopMetrics := w.startMetricsServer()
+	defer stopMetrics()
+	stopAPI := w.startAPIServer()
+	defer stopAPI()
+
+	// Mark the start in the data; stop requests record the shutdown
+	defer close(w.stopped)
+	w.recordLifecycle("started", "")
+
+	// A standby listens for the active agent's heartbeats
+	if w.heartbeats != nil {
+		stopHA := w.startHAListener()
+		defer stopHA()
+	}
+
+	// Follow the supplicant's association, handshake and EAP events
+	if w.wpaEvents != nil {
+		w.startWPAListener(w.wpaControl)
+	}
+
+	// Follow the routers advertising on the link
+	if w.raEvents != nil {
+		w.raSince = time.Now()
+		w.startRAListener()
+	}
+
+	for {
+		select {
+		case <-dhcpTicker.C:
+			// A passive standby never releases the lease the active agent depends on,
+			// and nothing is sent while an operator has paused probing
+			if w.ha.passive() || w.pause != nil {
+				break
+			}
+
+			// Run full test including DHCP renewal
+			start := time.Now()
+			test := w.runTest()
+			w.attachGatewayProbes(&test)
+			w.attachSensor(&test)
+			w.attachStation(&test)
+			w.attachAuthFailure(&test)
+			w.classifyUpstreamFailure(&test)
+			w.dhcpTests = append(w.dhcpTests, test)
+			w.publishResult("dhcp", test)
+			w.writeJSONL("dhcp", test)
+			w.saveTest("dhcp", test)
+			w.countTest(test)
+			w.countProbeFailure("dhcp", !test.Success)
+			w.trackIncident("dhcp", test)
+			w.traceOnFailure(test)
+			w.observeConnectivity("dhcp", test)
+			w.checkAlertRules("dhcp", test)
+			w.checkTargetAlerts(test)
+			if test.Success {
+				w.dhcpRenewHistogram.observe(test.DHCPRenewTime.Seconds())
+			}
+			// Pings right after a release/renew measure the monitor's own disruption
+			if p, ok := w.dhcpProbe.(*probe.DHCPProbe); ok && p.Disruptive() {
+				w.startDisruption()
+			}
+			w.checkSuccessRateAlerts()
+			w.checkDHCPTailAlert()
+			w.lowPower.track(start)
+
+			w.updateUI()
+
+		case <-pingTicker.C:
+			// Nothing is sent while an operator has paused probing
+			if w.pause != nil {
+				break
+			}
+
+			// Run only connectivity and latency tests (skip DHCP)
+			start := time.Now()
+			test := w.runConnectivityTest()
+			w.attachGatewayProbes(&test)
+			w.attachSensor(&test)
+			w.attachStation(&test)
+			w.attachAuthFailure(&test)
+			w.classifyUpstreamFailure(&test)
+			w.markDisruption(&test)
+			w.pingTests = append(w.pingTests, test)
+			w.publishResult("ping", test)
+			w.writeJSONL("ping", test)
+			w.saveTest("ping", test)
+			w.countTest(test)
+			w.countProbeFailure("ping", !test.Success)
+			w.trackIncident("ping", test)
+			w.traceOnFailure(test)
+			w.observeConnectivity("ping", test)
+			w.checkAlertRules("ping", test)
+			w.checkTargetAlerts(test)
+			w.checkSuccessRateAlerts()
+			w.lowPower.track(start)
+
+			// Low-power mode backs off while results are stable and runs the
+			// probes that fell due in one batch behind the ping test
+			if w.lowPower != nil {
+				if w.lowPower.observe(test) {
+					dhcpTicker.Reset(w.dhcpInterval())
+					pingTicker.Reset(w.pingInterval())
+				}
+				w.runProbeBatch()
+			}
+
+			w.updateUI()
+
+		case <-uiTick:
+			// Update UI every second for current time display
+			w.updateUI()
+
+		case <-fileTicker.C:
+			// Write results to file every minute
+			if err := w.writeResultsToFile(); err != nil {
+				fmt.Printf("Error writing to file: %v\n", err)
+			}
+
+		case req := <-w.controlRequests:
+			req.reply <- w.handleControl(req.command)
+
+		case record := <-w.backgroundResults:
+			record()
+
+		case sub := <-w.tailSubscriptions:
+			w.tailSubscribers[sub] = true
+
+		case sub := <-w.streamSubscriptions:
+			w.streamSubscribers[sub] = true
+
+		case data := <-w.heartbeats:
+			w.receiveHeartbeat(data)
+
+		case event := <-w.wpaEvents:
+			w.noteWPAEvent(event)
+
+		case ra := <-w.raEvents:
+			w.noteRouterAdvertisement(ra)
+
+		case report := <-w.traceReports:
+			w.noteTrace(report)
+
+		case <-w.reloadRequests:
+			w.reloadConfig()
+
+		case reason := <-w.stopRequests:
+			w.recordLifecycle("stopped", reason)
+			if !w.headless {
+				w.tui.Stop()
+			}
+			return
+
+		case now := <-checkTicker.C:
+			// Follow the profile schedule and the standby role
+			profileChanged := w.applyScheduledProfile(now)
+			roleChanged := w.updateHARole(now)
+			w.checkPauseExpiry(now)
+			if profileChanged || roleChanged {
+				dhcpTicker.Reset(w.dhcpInterval())
+				pingTicker.Reset(w.pingInterval())
+			}
+
+			// Run auxiliary checks that are due
+			if w.runDueChecks(now) {
+				w.updateUI()
+			}
+
+		case now := <-remoteWriteTick:
+			// Collect current samples and push the batch once the flush interval has passed
+			w.remoteWriter.enqueue(w.remoteWriteSeries(w.remoteWriter.instance))
+			if w.remoteWriter.flushDue(now) {
+				if err := w.remoteWriter.flush(); err != nil {
+					fmt.Printf("Error pushing remote write: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// countTest adds a finished test to the success counters and availability,
+// unless it was taken in a disruption window that is excluded from the stats
+func (w *WiFiMonitor) countTest(test WiFiTest) {
+	if !countsTowardsStats(w.settings, test) {
+		return
+	}
+	w.totalCount++
+	w.availability.mark(test.Timestamp, test.IPv4Connectivity)
+	if test.Success {
+		w.successCount++
+	}
+	if test.UpstreamFailure {
+		w.upstreamFailures++
+	}
+}
+
+// runConnectivityTest executes connectivity and latency tests without DHCP renewal
+func (w *WiFiMonitor) runConnectivityTest() WiFiTest {
+	test := WiFiTest{
+		Timestamp: time.Now(),
+	}
+
+	// Skip DHCP renewal test
+	test.DHCPRenewTime = 0
+
+	// Connectivity and latency tests against every ping target
+	w.runPingTargets(&test)
+
+	// Determine overall success (DHCP is not required for this test)
+	test.Success = test.IPv4Connectivity && (test.Latency > 0)
+
+	return test
+}
+
+// Main runs the noc-watch command line with the arguments after the program
+// name and returns the process exit code
+func Main(args []string) int {
+	// Flags and the config file fill in the settings for every command
+	s := config.New(nil)
+	fs, f := newRunFlagSet("noc-watch")
+	args, err := parseRunFlags(s, fs, f, args)
+	if err != nil {
+		return exitUsage
+	}
+
+	// Subcommands (e.g., noc-watch schema) run instead of the monitor
+	if len(args) > 0 {
+		return runSubcommand(s, args)
+	}
+	runMonitor(s)
+	return exitOK
+}
+
+// runMonitor starts the monitor with the TUI, or headless, until it is
+// stopped by a signal or by quitting the TUI
+func runMonitor(s *config.Settings) {
+	monitor := NewWiFiMonitor(s)
+	monitor.watchSignals()
+
+	// Create TUI application if not headless
+	if !monitor.headless {
+		// Get current time for initial display
+		currentTime := time.Now().Format("2006-01-02 15:04:05")
+
+		// Set initial content
+		initial := ui.Panes{
+			Stats: fmt.Sprintf("[white]Current Time: [cyan]%s[white]\n"+
+				"Total Tests: 0 | [green]Success: 0[white] | [red]Failure: 0[white]\n"+
+				"Success Rate: [yellow]insufficient data (n=0)[white]\n", currentTime),
+			Chart: "Test Results:\n\n" +
+				fmt.Sprintf("[yellow]DHCP Test Results (Every %v):[white]\n", monitor.dhcpInterval()) +
+				"  [yellow]Waiting for first DHCP test...[white]\n\n" +
+				fmt.Sprintf("[yellow]Ping Test Results (Every %v):[white]\n", monitor.pingInterval()) +
+				"  [yellow]Waiting for first ping test...[white]",
+			Log: "Latest Test Results:\n\n" +
+				"[yellow]Latest DHCP Test:[white]\n" +
+				"[yellow]No DHCP tests completed yet.[white]\n\n" +
+				"[yellow]Latest Ping Test:[white]\n" +
+				"[yellow]No ping tests completed yet.[white]",
+		}
+		if monitor.linkInfo != nil {
+			initial.Link = monitor.linkInfo.paneText()
+		}
+
+		// Show the service checklist next to the chart when services are configured
+		if len(monitor.serviceChecks) > 0 {
+			initial.Service = monitor.serviceChecklistText()
+		}
+
+		tui, err := ui.New(initial, statsTableTitle, len(monitor.serviceChecks) > 0)
+		if err != nil {
+			panic(err)
+		}
+		monitor.tui = tui
+		monitor.bindKeys()
+
+		// Start monitoring
+		go monitor.startMonitoring()
+
+		// Run application; quitting the TUI stops the monitor cleanly
+		if err := tui.Run(); err != nil {
+			panic(err)
+		}
+		monitor.stop("quit from the TUI")
+	} else {
+		// In headless mode, just start monitoring and write results
+		monitor.startMonitoring()
+	}
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// icmpOverhead is the IPv4 + ICMP header size added to a ping payload
+const icmpOverhead = 28
+
+// MTUSweepStep is the loss observed at one payload size
+type MTUSweepStep struct {
+	Size int     // ICMP payload size in bytes
+	Loss float64 // Packet loss in percent
+}
+
+// MTUSweep is the result of pinging one target at increasing sizes with DF set
+type MTUSweep struct {
+	Target    string         // Swept destination
+	Steps     []MTUSweepStep // Loss per payload size, in ascending size order
+	PathMTU   int            // Largest packet size (payload + headers) that got through (0 if none)
+	Blackhole bool           // Small packets pass but larger ones are lost: MTU/fragmentation loss
+	Timestamp time.Time      // Sweep time
+}
+
+// mtuSweepSizes returns the payload sizes to sweep from MTU_SWEEP_SIZES
+func mtuSweepSizes(s *config.Settings) []int {
+	var sizes []int
+	for _, entry := range s.List("MTU_SWEEP_SIZES") {
+		if n, err := strconv.Atoi(entry); err == nil && n > 0 {
+			sizes = append(sizes, n)
+		}
+	}
+	if len(sizes) == 0 {
+		sizes = []int{64, 512, 1200, 1400, 1472}
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// runMTUSweep pings the sweep target at each size with DF set. Loss that only
+// affects the larger sizes is reported as an MTU problem, not ordinary loss.
+func (w *WiFiMonitor) runMTUSweep() {
+	sweep := MTUSweep{
+		Target:    w.probeTarget("MTU_SWEEP_TARGET", w.settings.String("UPSTREAM_TARGET", "8.8.8.8")),
+		Timestamp: time.Now(),
+	}
+	if sweep.Target == "" {
+		return
+	}
+
+	for _, size := range mtuSweepSizes(w.settings) {
+		stats := w.coalescedPing(sweep.Target, 3, size, true)
+		sweep.Steps = append(sweep.Steps, MTUSweepStep{Size: size, Loss: stats.Loss})
+		if stats.Loss < 100 {
+			sweep.PathMTU = size + icmpOverhead
+		}
+	}
+
+	// Blackhole: the smallest size gets through while the largest is lost completely
+	first, last := sweep.Steps[0], sweep.Steps[len(sweep.Steps)-1]
+	sweep.Blackhole = first.Loss < 100 && last.Loss == 100
+	w.mtuSweep = &sweep
+
+	w.setAlert("mtu_blackhole", sweep.Blackhole,
+		fmt.Sprintf("Packets above %d bytes to %s are dropped with DF set (path MTU problem, not ordinary loss)",
+			sweep.PathMTU, sweep.Target))
+}
+
+// String formats the sweep for the log file
+func (s MTUSweep) String() string {
+	var steps []string
+	for _, step := range s.Steps {
+		steps = append(steps, fmt.Sprintf("%dB %.0f%%", step.Size, step.Loss))
+	}
+	return fmt.Sprintf("%s %s path MTU>=%d", s.Target, strings.Join(steps, " | "), s.PathMTU)
+}
@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// natTestTimeout bounds each binding test of the NAT discovery, including
+// the filtering tests whose responses a filtering NAT drops
+const natTestTimeout = 2 * time.Second
+
+// natTraceHops is how far the CGNAT check follows the path towards the
+// STUN server looking for shared address space
+const natTraceHops = 6
+
+// cgnatRange is the shared address space of carrier-grade NAT (RFC 6598)
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// NATType is the NAT behavior of the uplink as discovered with STUN
+// binding tests (RFC 5780), which decides whether peer-to-peer media such
+// as WebRTC and VoIP can connect directly or needs a relay
+type NATType struct {
+	Type      string    `json:"type"`                 // open, full cone, restricted cone, port-restricted cone, cone, symmetric or unknown
+	Mapping   string    `json:"mapping,omitempty"`    // none, endpoint-independent, address-dependent, address-and-port-dependent or endpoint-dependent
+	Filtering string    `json:"filtering,omitempty"`  // endpoint-independent, address-dependent or address-and-port-dependent ("" if the server cannot test it)
+	Local     string    `json:"local,omitempty"`      // Local address and port of the test socket
+	Mapped    string    `json:"mapped,omitempty"`     // Address and port the primary server saw
+	Servers   []string  `json:"servers"`              // STUN servers of the test
+	CGNAT     bool      `json:"cgnat"`                // Carrier-grade NAT detected
+	CGNATHint string    `json:"cgnat_hint,omitempty"` // Evidence of the carrier-grade NAT
+	Error     string    `json:"error,omitempty"`      // Why the discovery failed
+	Timestamp time.Time `json:"timestamp"`            // Test time
+}
+
+// String formats the NAT type for the log and the UI
+func (n NATType) String() string {
+	if n.Error != "" {
+		return fmt.Sprintf("%s (%s)", n.Type, n.Error)
+	}
+	text := fmt.Sprintf("%s (mapping %s, filtering %s, %s)", n.Type, orDash(n.Mapping), orDash(n.Filtering), orDash(n.Mapped))
+	if n.CGNAT {
+		text += ", CGNAT: " + n.CGNATHint
+	}
+	return text
+}
+
+// natTypeName names the combination of mapping and filtering behavior with
+// the classic RFC 3489 terms
+func natTypeName(mapping, filtering string) string {
+	switch mapping {
+	case "none":
+		return "open"
+	case "":
+		return "unknown"
+	case "endpoint-independent":
+	default:
+		return "symmetric"
+	}
+	switch filtering {
+	case "endpoint-independent":
+		return "full cone"
+	case "address-dependent":
+		return "restricted cone"
+	case "address-and-port-dependent":
+		return "port-restricted cone"
+	}
+	return "cone"
+}
+
+// detectCGNAT looks for the shared address space of carrier-grade NAT on
+// the interface, in the mapped address and on the first hops towards the
+// STUN server
+func (w *WiFiMonitor) detectCGNAT(nat *NATType, local, mapped, server net.IP) {
+	switch {
+	case local != nil && cgnatRange.Contains(local):
+		nat.CGNAT, nat.CGNATHint = true, fmt.Sprintf("interface address %s is in %s", local, cgnatRange)
+		return
+	case cgnatRange.Contains(mapped):
+		nat.CGNAT, nat.CGNATHint = true, fmt.Sprintf("mapped address %s is in %s", mapped, cgnatRange)
+		return
+	}
+
+	// Behind a home router the carrier's NAT shows up as a hop in the shared range
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report := traceRoute(ctx, w.wifiInterface, server.String(), 1, natTraceHops)
+	for _, hop := range report.Hops {
+		if ip := net.ParseIP(hop.Address); ip != nil && cgnatRange.Contains(ip) {
+			nat.CGNAT, nat.CGNATHint = true, fmt.Sprintf("hop %d %s is in %s", hop.TTL, ip, cgnatRange)
+			return
+		}
+	}
+}
+
+// discoverNATType runs the RFC 5780 mapping and filtering tests from one
+// socket on the monitored interface. Servers that name an alternate address
+// (OTHER-ADDRESS or CHANGED-ADDRESS) allow the full test; with plain STUN
+// servers the mapping is compared across the first two servers and the
+// filtering stays unknown.
+func (w *WiFiMonitor) discoverNATType(servers []string) NATType {
+	nat := NATType{Type: "unknown", Servers: servers, Timestamp: time.Now()}
+	primary, err := net.ResolveUDPAddr("udp4", servers[0])
+	if err != nil {
+		nat.Error = err.Error()
+		return nat
+	}
+	conn, err := w.listenInterfaceUDP(context.Background(), "udp4")
+	if err != nil {
+		nat.Error = err.Error()
+		return nat
+	}
+	defer conn.Close()
+	local := probe.InterfaceIPv4(w.wifiInterface)
+	if local != nil {
+		nat.Local = (&net.UDPAddr{IP: local, Port: conn.LocalAddr().(*net.UDPAddr).Port}).String()
+	}
+	binding := func(server net.Addr, change uint32) (probe.STUNResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), natTestTimeout)
+		defer cancel()
+		return probe.STUNRequest(ctx, conn, server, change)
+	}
+
+	// Test I: the mapping seen by the primary server
+	first, err := binding(primary, 0)
+	if err != nil {
+		nat.Error = err.Error()
+		return nat
+	}
+	nat.Mapped = first.Mapped.String()
+	if first.Mapped.String() == nat.Local {
+		nat.Mapping, nat.Type = "none", "open"
+		return nat
+	}
+	w.detectCGNAT(&nat, local, first.Mapped.IP, primary.IP)
+
+	// Tests II and III: the same socket towards the alternate IP, then the
+	// alternate IP and port of the server
+	if first.Other != nil {
+		if second, err := binding(&net.UDPAddr{IP: first.Other.IP, Port: primary.Port}, 0); err == nil {
+			if second.Mapped.String() == first.Mapped.String() {
+				nat.Mapping = "endpoint-independent"
+			} else if third, err := binding(first.Other, 0); err == nil {
+				nat.Mapping = "address-and-port-dependent"
+				if third.Mapped.String() == second.Mapped.String() {
+					nat.Mapping = "address-dependent"
+				}
+			}
+		}
+	}
+	if nat.Mapping == "" && len(servers) > 1 {
+		if other, err := net.ResolveUDPAddr("udp4", servers[1]); err == nil {
+			if second, err := binding(other, 0); err == nil {
+				nat.Mapping = "endpoint-dependent"
+				if second.Mapped.String() == first.Mapped.String() {
+					nat.Mapping = "endpoint-independent"
+				}
+			}
+		}
+	}
+
+	// Filtering: whether responses from the alternate IP and port, or only
+	// the alternate port, get through. A server that ignores CHANGE-REQUEST
+	// and answers from its primary address proves nothing.
+	if first.Other != nil {
+		if response, err := binding(primary, probe.STUNChangeIP|probe.STUNChangePort); err == nil {
+			if !probe.AddrIP(response.Source).Equal(primary.IP) {
+				nat.Filtering = "endpoint-independent"
+			}
+		} else if err == probe.ErrNoSTUNResponse {
+			if response, err := binding(primary, probe.STUNChangePort); err == nil {
+				if source, ok := response.Source.(*net.UDPAddr); ok && source.Port != primary.Port {
+					nat.Filtering = "address-dependent"
+				}
+			} else if err == probe.ErrNoSTUNResponse {
+				nat.Filtering = "address-and-port-dependent"
+			}
+		}
+	}
+	nat.Type = natTypeName(nat.Mapping, nat.Filtering)
+	return nat
+}
+
+// runNATTypeCheck classifies the NAT between the interface and the internet
+// with the STUN servers of NAT_STUN_SERVERS and records a change of the
+// type or of the CGNAT verdict as a nat_type_changed event
+func (w *WiFiMonitor) runNATTypeCheck() {
+	servers := w.settings.List("NAT_STUN_SERVERS")
+	if len(servers) == 0 {
+		servers = []string{"stun.l.google.com:19302", "stun1.l.google.com:19302"}
+	}
+	nat := w.discoverNATType(servers)
+
+	previous := w.natType
+	if previous != nil && previous.Error == "" && nat.Error == "" && (previous.Type != nat.Type || previous.CGNAT != nat.CGNAT) {
+		w.notifyEvent("nat_type_changed", fmt.Sprintf("NAT type of %s changed: %s -> %s", w.wifiInterface, previous, nat))
+		if w.incident != nil {
+			w.incident.add(nat.Timestamp, "nat", fmt.Sprintf("NAT type %s -> %s", previous.Type, nat.Type))
+		}
+	}
+	w.natType = &nat
+	w.writeJSONL("nat_type", nat)
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNATTypeName(t *testing.T) {
+	tests := []struct {
+		mapping   string
+		filtering string
+		want      string
+	}{
+		{mapping: "none", filtering: "", want: "open"},
+		{mapping: "", filtering: "endpoint-independent", want: "unknown"},
+		{mapping: "endpoint-independent", filtering: "endpoint-independent", want: "full cone"},
+		{mapping: "endpoint-independent", filtering: "address-dependent", want: "restricted cone"},
+		{mapping: "endpoint-independent", filtering: "address-and-port-dependent", want: "port-restricted cone"},
+		{mapping: "endpoint-independent", filtering: "", want: "cone"},
+		{mapping: "address-dependent", filtering: "endpoint-independent", want: "symmetric"},
+		{mapping: "address-and-port-dependent", filtering: "address-and-port-dependent", want: "symmetric"},
+		{mapping: "endpoint-dependent", filtering: "", want: "symmetric"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mapping+"/"+tt.filtering, func(t *testing.T) {
+			if got := natTypeName(tt.mapping, tt.filtering); got != tt.want {
+				t.Errorf("natTypeName(%q, %q) = %q, want %q", tt.mapping, tt.filtering, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNATTypeString(t *testing.T) {
+	tests := []struct {
+		name string
+		nat  NATType
+		want string
+	}{
+		{
+			name: "error",
+			nat:  NATType{Type: "unknown", Error: "no STUN response"},
+			want: "unknown (no STUN response)",
+		},
+		{
+			name: "full test",
+			nat:  NATType{Type: "port-restricted cone", Mapping: "endpoint-independent", Filtering: "address-and-port-dependent", Mapped: "198.51.100.7:40000"},
+			want: "port-restricted cone (mapping endpoint-independent, filtering address-and-port-dependent, 198.51.100.7:40000)",
+		},
+		{
+			name: "unknown filtering behind CGNAT",
+			nat:  NATType{Type: "cone", Mapping: "endpoint-independent", Mapped: "100.64.3.9:1024", CGNAT: true, CGNATHint: "mapped address 100.64.3.9 is in 100.64.0.0/10"},
+			want: "cone (mapping endpoint-independent, filtering -, 100.64.3.9:1024), CGNAT: mapped address 100.64.3.9 is in 100.64.0.0/10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.nat.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCGNATRange(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "100.64.0.0", want: true},
+		{ip: "100.127.255.255", want: true},
+		{ip: "100.63.255.255", want: false},
+		{ip: "100.128.0.0", want: false},
+		{ip: "192.168.1.10", want: false},
+		{ip: "2001:db8::1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := cgnatRange.Contains(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("cgnatRange.Contains(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package monitor
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// interfaceDialer returns a dialer whose sockets are bound to the monitored interface,
+// so DNS/TCP/HTTP probes leave through the same link as the ping tests.
+// Binding requires CAP_NET_RAW; without it the socket falls back to normal routing.
+func (w *WiFiMonitor) interfaceDialer(timeout time.Duration) *net.Dialer {
+	iface := w.wifiInterface
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+			})
+		},
+	}
+}
@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"fmt"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// stationPaneText formats the station info for the TUI link pane, with the
+// signal in red below minSignal dBm
+func stationPaneText(s *probe.StationInfo, minSignal int) string {
+	color := "[green]"
+	if s.SignalDBM < minSignal {
+		color = "[red]"
+	}
+	text := fmt.Sprintf("Signal: %s%d dBm[white]", color, s.SignalDBM)
+	if s.NoiseDBM != 0 {
+		text += fmt.Sprintf("  Noise: %d dBm  SNR: %d dB", s.NoiseDBM, s.SNR())
+	}
+	return text + fmt.Sprintf("\nTx/Rx: %.1f/%.1f Mbit/s  Retries: %.1f%%  Failed: %d\n",
+		s.TxMbps, s.RxMbps, s.RetryPercent, s.TxFailed)
+}
+
+// attachStation samples the station info for a test and keeps it as the
+// latest layer 2 state. Retries are reported per packet since the previous
+// sample, as the counters only grow while associated and restart on a roam.
+func (w *WiFiMonitor) attachStation(test *WiFiTest) {
+	info, err := probe.ReadStationInfo(w.probeContext(), w.wifiInterface)
+	if err != nil {
+		w.station = nil
+		return
+	}
+	previous := w.station
+	if previous != nil && previous.BSSID != info.BSSID && previous.BSSID != "" && info.BSSID != "" {
+		w.noteRoam(previous, info)
+	} else if previous != nil && info.TxPackets > previous.TxPackets && info.TxRetries >= previous.TxRetries {
+		info.RetryPercent = float64(info.TxRetries-previous.TxRetries) / float64(info.TxPackets-previous.TxPackets) * 100
+	}
+	w.station = info
+	test.Station = info
+
+	minSignal := w.settings.Int("WIFI_MIN_SIGNAL_DBM", -75)
+	minSNR := w.settings.Int("WIFI_MIN_SNR_DB", 15)
+	weak := info.SignalDBM < minSignal || (info.SNR() != 0 && info.SNR() < minSNR)
+	w.setAlert("wifi_signal_weak", weak, fmt.Sprintf("Weak WiFi signal on %s: %s (minimum %d dBm, SNR %d dB)",
+		w.wifiInterface, info, minSignal, minSNR))
+}
+
+// noteRoam marks a sample taken after the client moved to another access
+// point and announces the roam as a wifi_roamed event, with the signal on
+// both sides so latency spikes can be traced to a move to a distant AP
+func (w *WiFiMonitor) noteRoam(previous, info *probe.StationInfo) {
+	info.RoamedFrom = previous.BSSID
+	w.roams++
+	w.notifyEvent("wifi_roamed", fmt.Sprintf("%s roamed from %s (channel %d, %d dBm) to %s (channel %d, %d dBm)",
+		w.wifiInterface, previous.BSSID, previous.Channel, previous.SignalDBM, info.BSSID, info.Channel, info.SignalDBM))
+}
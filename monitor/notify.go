@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// criticalAlertPrefixes marks alerts that page rather than warn
+var criticalAlertPrefixes = []string{"connectivity_down", "slo_breach_", "service_down_", "wired_link_down", "dhcp_success_rate_low", "ping_success_rate_low"}
+
+// labelMatcher selects alerts by label equality and regular expressions
+type labelMatcher struct {
+	Match   map[string]string `json:"match"`    // Labels that must be equal
+	MatchRE map[string]string `json:"match_re"` // Labels that must match a regular expression
+
+	matchRE map[string]*regexp.Regexp // Compiled MatchRE
+}
+
+// AlertRoute sends alerts whose labels match to a webhook, like an
+// Alertmanager route. Routes are evaluated in order; the first match wins
+// unless Continue is set.
+type AlertRoute struct {
+	labelMatcher
+	Webhook  string `json:"webhook"`  // Notifier target URL
+	Continue bool   `json:"continue"` // Keep evaluating later routes after a match
+}
+
+// Notifier delivers alert records to webhook targets selected by label routing
+type Notifier struct {
+	routes      []AlertRoute // Routing rules from ALERT_ROUTES
+	defaultURLs []string     // Targets when no route matches (ALERT_WEBHOOK_URL, comma separated)
+	chatURLs    []string     // Slack, Discord and Telegram targets receiving every alert
+	client      *http.Client // HTTP client used for deliveries
+	configHash  string       // Config hash stamped on every payload
+}
+
+// alertPayload is the JSON body posted to webhook targets
+type alertPayload struct {
+	Name      string            `json:"alertname"`
+	Status    string            `json:"status"` // firing, resolved or event
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels"`
+	Runbook   string            `json:"runbook_url,omitempty"`
+	Action    string            `json:"suggested_action,omitempty"`
+	Timeline  []string          `json:"timeline,omitempty"`
+	State     string            `json:"state,omitempty"`          // Connectivity state entered
+	Previous  string            `json:"previous_state,omitempty"` // Connectivity state left
+	Summary   string            `json:"status_line,omitempty"`    // Recent metrics when the alert was raised
+	Timestamp time.Time         `json:"timestamp"`
+	Version   string            `json:"version"`     // noc-watch version of the sender
+	Config    string            `json:"config_hash"` // Config hash of the sender
+}
+
+// NewNotifier loads the routing tree from the JSON file in ALERT_ROUTES,
+// evaluated after the given routes (e.g., those of metric rules).
+// It returns nil when neither routes nor a default webhook or chat are configured.
+func NewNotifier(s *config.Settings, first []AlertRoute) *Notifier {
+	n := &Notifier{
+		defaultURLs: s.List("ALERT_WEBHOOK_URL"),
+		chatURLs:    chatTargets(s),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		configHash:  configHash(s),
+	}
+
+	var routes []AlertRoute
+	if path := s.Get("ALERT_ROUTES"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading alert routes: %v\n", err)
+		} else if err := json.Unmarshal(data, &routes); err != nil {
+			fmt.Printf("Error parsing alert routes: %v\n", err)
+		}
+	}
+
+	for i := range routes {
+		routes[i].compile()
+	}
+	n.routes = append(first, routes...)
+
+	if len(n.routes) == 0 && len(n.defaultURLs) == 0 && len(n.chatURLs) == 0 {
+		return nil
+	}
+	return n
+}
+
+// compile compiles the MatchRE patterns, anchored to the whole label value.
+// An invalid pattern is kept as nil so the matcher never matches, rather
+// than dropping the condition and matching every alert.
+func (m *labelMatcher) compile() {
+	m.matchRE = make(map[string]*regexp.Regexp)
+	for label, pattern := range m.MatchRE {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			fmt.Printf("Error compiling alert label pattern %q: %v\n", pattern, err)
+		}
+		m.matchRE[label] = re
+	}
+}
+
+// matches reports whether a label set satisfies the matcher
+func (m *labelMatcher) matches(labels map[string]string) bool {
+	for label, value := range m.Match {
+		if labels[label] != value {
+			return false
+		}
+	}
+	for label, re := range m.matchRE {
+		if re == nil || !re.MatchString(labels[label]) {
+			return false
+		}
+	}
+	return true
+}
+
+// targets returns the webhook URLs an alert with the given labels is routed to
+func (n *Notifier) targets(labels map[string]string) []string {
+	var urls []string
+	for i := range n.routes {
+		route := &n.routes[i]
+		if !route.matches(labels) {
+			continue
+		}
+		urls = append(urls, route.Webhook)
+		if !route.Continue {
+			break
+		}
+	}
+	if len(urls) == 0 {
+		urls = append(urls, n.defaultURLs...)
+	}
+	for _, chat := range n.chatURLs {
+		if !slices.Contains(urls, chat) {
+			urls = append(urls, chat)
+		}
+	}
+	return urls
+}
+
+// payload converts the alert to its JSON form, stamped with the config hash
+func (a Alert) payload(configHash string) alertPayload {
+	status := "firing"
+	if a.Event {
+		status = "event"
+	} else if a.Resolved {
+		status = "resolved"
+	}
+
+	var timeline []string
+	for _, entry := range a.Timeline {
+		timeline = append(timeline, entry.String())
+	}
+
+	return alertPayload{
+		Name:      a.Name,
+		Status:    status,
+		Message:   a.Message,
+		Labels:    a.Labels,
+		Runbook:   a.Runbook,
+		Action:    a.Action,
+		Timeline:  timeline,
+		State:     a.State,
+		Previous:  a.Previous,
+		Summary:   a.Summary,
+		Timestamp: a.Timestamp,
+		Version:   version,
+		Config:    configHash,
+	}
+}
+
+// notify posts the alert to its routed targets without blocking the
+// monitoring loop. Chat targets get a formatted message, webhooks the JSON payload.
+func (n *Notifier) notify(alert Alert) {
+	payload := alert.payload(n.configHash)
+	generic, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	for _, target := range n.targets(alert.Labels) {
+		body := generic
+		if kind := chatKind(target); kind != "" {
+			if body, err = chatBody(kind, target, payload); err != nil {
+				fmt.Printf("Error sending alert %s to %s: %v\n", alert.Name, kind, err)
+				continue
+			}
+		}
+
+		go func(target string, body []byte) {
+			resp, err := n.client.Post(target, "application/json", bytes.NewReader(body))
+			if err != nil {
+				// The URL may hold a token, so only the cause is printed
+				if urlErr, ok := err.(*url.Error); ok {
+					err = urlErr.Err
+				}
+				fmt.Printf("Error sending alert %s to %s: %v\n", alert.Name, targetName(target), err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				fmt.Printf("Error sending alert %s to %s: webhook returned %s\n", alert.Name, targetName(target), resp.Status)
+			}
+		}(target, body)
+	}
+}
+
+// alertLabels returns the routing labels of an alert: its name, severity,
+// component (the name prefix) and the agent placement from AGENT_LOCATION
+func (w *WiFiMonitor) alertLabels(name string) map[string]string {
+	labels := agentLocation(w.settings)
+	labels["alertname"] = name
+	labels["interface"] = w.wifiInterface
+	labels["component"], _, _ = strings.Cut(name, "_")
+	if workspace := w.settings.Get("WORKSPACE"); workspace != "" {
+		labels["workspace"] = workspace
+	}
+
+	labels["severity"] = "warning"
+	for _, prefix := range criticalAlertPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			labels["severity"] = "critical"
+		}
+	}
+	if severity := w.alertRuleSeverity(name); severity != "" {
+		labels["severity"] = severity
+	}
+	return labels
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNotifierTargets(t *testing.T) {
+	route := func(webhook string, match, matchRE map[string]string, cont bool) AlertRoute {
+		r := AlertRoute{labelMatcher: labelMatcher{Match: match, MatchRE: matchRE}, Webhook: webhook, Continue: cont}
+		r.compile()
+		return r
+	}
+	routes := []AlertRoute{
+		route("https://pager.example/critical", map[string]string{"severity": "critical"}, nil, true),
+		route("https://hooks.example/hall", nil, map[string]string{"room": "Hall [AB]"}, false),
+		route("https://hooks.example/dns", map[string]string{"alertname": "dns_failed"}, nil, false),
+		route("https://hooks.example/unreachable", map[string]string{"alertname": "dns_failed", "room": "Hall A"}, nil, false),
+		route("https://hooks.example/broken", nil, map[string]string{"room": "("}, false),
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{name: "first match wins", labels: map[string]string{"alertname": "dns_failed", "room": "Hall A"}, want: []string{"https://hooks.example/hall"}},
+		{
+			name:   "continue keeps evaluating",
+			labels: map[string]string{"alertname": "connectivity_down", "severity": "critical", "room": "Hall B"},
+			want:   []string{"https://pager.example/critical", "https://hooks.example/hall"},
+		},
+		{
+			name:   "continue without a later match",
+			labels: map[string]string{"alertname": "connectivity_down", "severity": "critical", "room": "Foyer"},
+			want:   []string{"https://pager.example/critical"},
+		},
+		{name: "regular expressions match the whole value", labels: map[string]string{"alertname": "dns_failed", "room": "Hall AB"}, want: []string{"https://hooks.example/dns"}},
+		{name: "invalid pattern never matches", labels: map[string]string{"room": "("}, want: []string{"https://hooks.example/default"}},
+		{name: "missing label does not match", labels: map[string]string{"alertname": "ping_loss"}, want: []string{"https://hooks.example/default"}},
+		{name: "no match falls back to the default", labels: map[string]string{"alertname": "ping_loss", "room": "Room 201"}, want: []string{"https://hooks.example/default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &Notifier{routes: routes, defaultURLs: []string{"https://hooks.example/default"}}
+			if got := n.targets(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifierTargetsChats(t *testing.T) {
+	hall := AlertRoute{labelMatcher: labelMatcher{Match: map[string]string{"room": "Hall A"}}, Webhook: "https://hooks.slack.com/services/hall"}
+	hall.compile()
+	n := &Notifier{
+		routes:      []AlertRoute{hall},
+		defaultURLs: []string{"https://hooks.example/default"},
+		chatURLs:    []string{"https://hooks.slack.com/services/noc", "https://hooks.slack.com/services/hall"},
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{
+			name:   "routed alert also reaches the chats",
+			labels: map[string]string{"room": "Hall A"},
+			want:   []string{"https://hooks.slack.com/services/hall", "https://hooks.slack.com/services/noc"},
+		},
+		{
+			name:   "default alert also reaches the chats",
+			labels: map[string]string{"room": "Foyer"},
+			want:   []string{"https://hooks.example/default", "https://hooks.slack.com/services/noc", "https://hooks.slack.com/services/hall"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.targets(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
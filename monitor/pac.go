@@ -0,0 +1,178 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pacProxyPattern finds proxy directives mentioned literally in a PAC file
+var pacProxyPattern = regexp.MustCompile(`(?:PROXY|HTTPS|SOCKS5?)\s+[A-Za-z0-9._\-\[\]:]+`)
+
+// PACCheck holds the result of fetching and evaluating the network's PAC file
+type PACCheck struct {
+	URL        string            // PAC/WPAD URL that was fetched
+	Hash       string            // SHA-256 of the PAC content
+	Changed    bool              // Content differs from the previous fetch
+	Proxies    []string          // Proxy directives found in the PAC source
+	Results    map[string]string // FindProxyForURL result per key URL
+	Unexpected []string          // Key URLs that evaluated to an unexpected proxy
+	Timestamp  time.Time         // Check execution timestamp
+}
+
+// pacURL returns the configured PAC URL or the first WPAD URL found by the proxy check
+func (w *WiFiMonitor) pacURL() string {
+	if configured := w.settings.Get("PAC_URL"); configured != "" {
+		return configured
+	}
+	if w.proxyCheck != nil {
+		return w.proxyCheck.WPADURL
+	}
+	return ""
+}
+
+// evaluatePAC runs FindProxyForURL for a URL using pactester (pacparser)
+func evaluatePAC(pacFile, target string) (string, error) {
+	output, err := exec.Command("pactester", "-p", pacFile, "-u", target).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// runPACCheck fetches the advertised PAC file, evaluates it for key URLs and
+// alerts when it changes or returns proxies outside PAC_EXPECTED_PROXIES
+func (w *WiFiMonitor) runPACCheck() {
+	pacURL := w.pacURL()
+	if pacURL == "" {
+		return
+	}
+
+	resp, _, err := w.httpFetchBody(pacURL, 10*time.Second)
+	if err != nil {
+		w.setAlert("pac_unavailable", true, fmt.Sprintf("PAC file %s could not be fetched: %v", pacURL, err))
+		return
+	}
+	w.setAlert("pac_unavailable", false, fmt.Sprintf("PAC file %s is reachable again", pacURL))
+
+	sum := sha256.Sum256(resp)
+	check := PACCheck{
+		URL:       pacURL,
+		Hash:      hex.EncodeToString(sum[:]),
+		Results:   make(map[string]string),
+		Timestamp: time.Now(),
+	}
+	check.Changed = w.pacCheck != nil && w.pacCheck.Hash != check.Hash
+	check.Proxies = pacProxyPattern.FindAllString(string(resp), -1)
+
+	// pactester needs the script on disk
+	pacFile := filepath.Join(os.TempDir(), "noc-watch.pac")
+	if err := os.WriteFile(pacFile, resp, 0600); err == nil {
+		expected := w.settings.List("PAC_EXPECTED_PROXIES")
+		for _, target := range w.settings.List("PAC_TEST_URLS") {
+			result, err := evaluatePAC(pacFile, target)
+			if err != nil {
+				continue
+			}
+			check.Results[target] = result
+			if len(expected) > 0 && !pacResultExpected(result, expected) {
+				check.Unexpected = append(check.Unexpected, target)
+			}
+		}
+	}
+
+	// Use the first proxy of the evaluated check URL for the proxied HTTP probe
+	if result, ok := check.Results[w.settings.String("PROXY_CHECK_URL", "http://connectivitycheck.gstatic.com/generate_204")]; ok {
+		w.pacProxy = pacResultProxy(result)
+	}
+
+	w.pacCheck = &check
+
+	if check.Changed {
+		w.notifyEvent("pac_changed", fmt.Sprintf("PAC file %s changed (sha256 %s)", pacURL, check.Hash[:12]))
+	}
+	w.setAlert("pac_unexpected_proxy", len(check.Unexpected) > 0,
+		fmt.Sprintf("PAC returns unexpected proxies for %s", strings.Join(check.Unexpected, ", ")))
+}
+
+// pacResultExpected reports whether every directive of a PAC result is DIRECT or an expected proxy
+func pacResultExpected(result string, expected []string) bool {
+	for _, directive := range strings.Split(result, ";") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" || directive == "DIRECT" {
+			continue
+		}
+		fields := strings.Fields(directive)
+		if len(fields) < 2 {
+			return false
+		}
+		found := false
+		for _, proxy := range expected {
+			if fields[1] == proxy {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// pacResultProxy converts the first PROXY directive of a PAC result into a proxy URL
+func pacResultProxy(result string) *url.URL {
+	for _, directive := range strings.Split(result, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 2 && fields[0] == "PROXY" {
+			if u, err := url.Parse("http://" + fields[1]); err == nil {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// httpFetchBody performs a direct GET over the monitored interface and returns the body
+func (w *WiFiMonitor) httpFetchBody(target string, timeout time.Duration) ([]byte, int, error) {
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: w.interfaceDialer(timeout).DialContext},
+		Timeout:   timeout,
+	}
+	resp, err := client.Get(target)
+	w.rawOutputs.AddResponse(target, resp, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return body, resp.StatusCode, err
+}
+
+// String formats the check for logs
+func (c PACCheck) String() string {
+	s := fmt.Sprintf("URL=%s, SHA256=%s, Changed=%v, Proxies=%s", c.URL, c.Hash[:12], c.Changed, strings.Join(c.Proxies, " | "))
+
+	targets := make([]string, 0, len(c.Results))
+	for target := range c.Results {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		s += fmt.Sprintf("\n  %s -> %s", target, c.Results[target])
+	}
+	return s
+}
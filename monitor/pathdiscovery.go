@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxDiscoveredHops is the number of intermediate hops kept as probe targets
+const maxDiscoveredHops = 3
+
+// traceHops runs traceroute over the monitored interface and returns the
+// responding hop addresses in order ("" for hops that did not answer)
+func (w *WiFiMonitor) traceHops(target string, maxHops int) []string {
+	output, err := probe.CaptureCommand(w.probeContext(), "traceroute", "-n", "-i", w.wifiInterface, "-m", strconv.Itoa(maxHops),
+		"-q", "1", "-w", "2", target)
+	if err != nil {
+		return nil
+	}
+
+	var hops []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			continue // header line
+		}
+		if net.ParseIP(fields[1]) != nil {
+			hops = append(hops, fields[1])
+		} else {
+			hops = append(hops, "")
+		}
+	}
+	return hops
+}
+
+// runPathDiscovery derives intermediate probe targets from the first hops
+// towards the upstream target and records when the path changes. The
+// traceroute waits for every silent hop, so it runs off the monitoring loop.
+func (w *WiFiMonitor) runPathDiscovery() {
+	upstream := w.probeTarget("UPSTREAM_TARGET", "8.8.8.8")
+	if upstream == "" {
+		return
+	}
+	w.runInBackground("path-discovery", func() func() {
+		hops := w.traceHops(upstream, maxDiscoveredHops)
+		return func() { w.recordPath(upstream, hops) }
+	})
+}
+
+// recordPath keeps the hops towards the upstream target and notifies a change
+func (w *WiFiMonitor) recordPath(upstream string, hops []string) {
+	if len(hops) == 0 {
+		return
+	}
+
+	changed := len(w.pathHops) > 0 && strings.Join(hops, ",") != strings.Join(w.pathHops, ",")
+	if changed {
+		w.notifyEvent("path_changed", fmt.Sprintf("Path to %s changed: %s -> %s",
+			upstream, formatHops(w.pathHops), formatHops(hops)))
+	}
+	w.pathHops = hops
+}
+
+// formatHops renders a hop list, marking silent hops with *
+func formatHops(hops []string) string {
+	parts := make([]string, len(hops))
+	for i, hop := range hops {
+		if hop == "" {
+			hop = "*"
+		}
+		parts[i] = hop
+	}
+	return strings.Join(parts, " > ")
+}
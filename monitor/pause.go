@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// ProbePause stops active probing for a while. Passive collection (link
+// events, signal, interface counters, sensors) keeps running so the timeline
+// has no blind spots.
+type ProbePause struct {
+	Since time.Time // When probing was paused
+	Until time.Time // Automatic resume time (zero until resumed by hand)
+}
+
+// pauseProbing stops active probing, for duration or until resumed when duration is zero
+func (w *WiFiMonitor) pauseProbing(duration time.Duration) string {
+	now := time.Now()
+	pause := &ProbePause{Since: now}
+	if duration > 0 {
+		pause.Until = now.Add(duration)
+	}
+	w.pause = pause
+
+	w.notifyEvent("probing_paused", "Active probing paused "+pause.String()+"; passive collection continues")
+	return "probing paused " + pause.String() + "\n"
+}
+
+// resumeProbing restarts active probing after a pause
+func (w *WiFiMonitor) resumeProbing(reason string) string {
+	if w.pause == nil {
+		return "error: probing is not paused\n"
+	}
+	paused := time.Since(w.pause.Since).Round(time.Second)
+	w.pause = nil
+
+	w.notifyEvent("probing_resumed", fmt.Sprintf("Active probing resumed after %v (%s)", paused, reason))
+	return fmt.Sprintf("probing resumed after %v\n", paused)
+}
+
+// checkPauseExpiry resumes probing once a timed pause has run out
+func (w *WiFiMonitor) checkPauseExpiry(now time.Time) {
+	if w.pause != nil && !w.pause.Until.IsZero() && !now.Before(w.pause.Until) {
+		w.resumeProbing("pause expired")
+	}
+}
+
+// String describes how long the pause lasts
+func (p *ProbePause) String() string {
+	if p.Until.IsZero() {
+		return "until resumed"
+	}
+	return "until " + p.Until.Format("2006-01-02 15:04:05")
+}
+
+// runPauseCommand implements `noc-watch pause [DURATION]`, stopping active
+// probes of the running monitor while passive collection continues
+func runPauseCommand(s *config.Settings, args []string) int {
+	command := "pause"
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch pause [DURATION]")
+		return exitUsage
+	}
+	if len(args) == 1 {
+		if duration, err := time.ParseDuration(args[0]); err != nil || duration <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid duration %q\n", args[0])
+			return exitUsage
+		}
+		command += " " + args[0]
+	}
+
+	response, err := sendControl(s, command)
+	if err != nil {
+		fmt.Printf("Error pausing probing: %v\n", err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
+
+// runResumeCommand implements `noc-watch resume`
+func runResumeCommand(s *config.Settings, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch resume")
+		return exitUsage
+	}
+
+	response, err := sendControl(s, "resume")
+	if err != nil {
+		fmt.Printf("Error resuming probing: %v\n", err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
@@ -0,0 +1,11 @@
+package monitor
+
+import (
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// pingTarget sends count echo requests over the monitored interface and parses
+// the summary, sharing recent results with other checks probing the same target
+func (w *WiFiMonitor) pingTarget(target string, count int) probe.PingStats {
+	return w.coalescedPing(target, count, probe.PingPayloadSize(w.settings, target), false)
+}
@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// defaultPingTargets keeps the connectivity test on Google's public DNS
+// unless PING_TARGETS is set
+var defaultPingTargets = []string{"8.8.8.8", "2001:4860:4860::8888"}
+
+// PingTarget is one destination of the connectivity test
+type PingTarget struct {
+	Name    string // Display name (defaults to the address)
+	Address string // Address, host name or target template (e.g., {{gateway}})
+}
+
+// TargetResult is the outcome for one ping target within a test
+type TargetResult struct {
+	Name     string        `json:"name"`               // Target name
+	IPv6     bool          `json:"ipv6,omitempty"`     // Target was pinged over IPv6
+	Success  bool          `json:"success"`            // At least one reply arrived
+	Latency  time.Duration `json:"latency_ns"`         // Average round trip time
+	Min      time.Duration `json:"latency_min_ns"`     // Minimum round trip time
+	Max      time.Duration `json:"latency_max_ns"`     // Maximum round trip time
+	Jitter   time.Duration `json:"jitter_ns"`          // RFC 3550 interarrival jitter
+	Loss     float64       `json:"loss"`               // Packet loss in percent
+	Sent     int           `json:"sent,omitempty"`     // Echo requests sent
+	Received int           `json:"received,omitempty"` // Echo replies received
+	Error    string        `json:"error,omitempty"`    // Failure reason
+}
+
+// parsePingTargets parses PING_TARGETS entries of the form name=address or
+// address, e.g. gateway={{gateway}},isp-dns=203.0.113.53,1.1.1.1
+func parsePingTargets(s *config.Settings) []PingTarget {
+	entries := s.List("PING_TARGETS")
+	if len(entries) == 0 {
+		entries = defaultPingTargets
+	}
+
+	var targets []PingTarget
+	for _, entry := range entries {
+		name, address, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, address = entry, entry
+		}
+		targets = append(targets, PingTarget{Name: strings.TrimSpace(name), Address: strings.TrimSpace(address)})
+	}
+	return targets
+}
+
+// resolvePingTarget expands templates and names of a target and reports
+// whether it is reached over IPv6
+func resolvePingTarget(s *config.Settings, iface string, target PingTarget) (string, bool, error) {
+	address, err := expandTarget(s, iface, target.Address)
+	if err != nil {
+		return "", false, err
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return address, ip.To4() == nil, nil
+	}
+	resolved, err := net.ResolveIPAddr("ip", address)
+	if err != nil {
+		return "", false, err
+	}
+	return resolved.String(), resolved.IP.To4() == nil, nil
+}
+
+// pingBurstCount returns the echo requests sent per target and test from PING_COUNT
+func pingBurstCount(s *config.Settings) int {
+	return max(s.Int("PING_COUNT", 20), 1)
+}
+
+// runPingTargets pings every target concurrently, so one unreachable target
+// does not delay the others, and fills in the headline connectivity: a
+// family is up when any of its targets answers, and the latency, loss and
+// jitter are those of the first IPv4 target that answered (or of the first
+// IPv4 target when none did).
+func (w *WiFiMonitor) runPingTargets(test *WiFiTest) {
+	results := make([]TargetResult, len(w.pingTargets))
+	var wg sync.WaitGroup
+	for i, target := range w.pingTargets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = w.pingTargetResult(target)
+		}()
+	}
+
+	// The gateway is pinged alongside, so the wireless segment's share of the latency is known
+	var local TargetResult
+	if w.settings.Get("LOCAL_LATENCY") != "false" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local = w.pingTargetResult(PingTarget{Name: "local", Address: "{{gateway}}"})
+		}()
+	}
+	wg.Wait()
+	if local.Success {
+		test.LocalLatency, test.LocalJitter, test.LocalLoss = local.Latency, local.Jitter, local.Loss
+	}
+
+	test.Targets = results
+	headline := -1
+	for i, result := range results {
+		if result.IPv6 {
+			test.IPv6Connectivity = test.IPv6Connectivity || result.Success
+			continue
+		}
+		if headline < 0 || (result.Success && !test.IPv4Connectivity) {
+			headline = i
+		}
+		test.IPv4Connectivity = test.IPv4Connectivity || result.Success
+	}
+
+	if headline >= 0 {
+		result := results[headline]
+		test.Loss, test.Sent, test.Received = result.Loss, result.Sent, result.Received
+		if result.Success {
+			test.Latency, test.MinLatency, test.MaxLatency, test.Jitter = result.Latency, result.Min, result.Max, result.Jitter
+		}
+	}
+}
+
+// pingTargetResult runs the latency probe against one target
+func (w *WiFiMonitor) pingTargetResult(target PingTarget) TargetResult {
+	result := TargetResult{Name: target.Name, Loss: 100}
+	address, v6, err := resolvePingTarget(w.settings, w.wifiInterface, target)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.IPv6 = v6
+
+	run := w.runProbe(probe.NewLatencyProbe(w.settings, target.Name, w.wifiInterface, address, pingBurstCount(w.settings)), coreProbeTimeout)
+	result.Success, result.Latency, result.Error = run.Success, run.Latency, run.Error
+	if loss, ok := run.Metrics["loss_percent"]; ok {
+		result.Loss = loss
+	}
+	result.Sent, result.Received = int(run.Metrics["sent"]), int(run.Metrics["received"])
+	result.Min = metricMillis(run.Metrics, "rtt_min_ms")
+	result.Max = metricMillis(run.Metrics, "rtt_max_ms")
+	result.Jitter = metricMillis(run.Metrics, "jitter_ms")
+	return result
+}
+
+// metricMillis converts a millisecond probe metric back into a duration (0 if missing)
+func metricMillis(metrics map[string]float64, name string) time.Duration {
+	return time.Duration(metrics[name] * float64(time.Millisecond))
+}
+
+// checkTargetAlerts raises an alert for each target that failed while
+// others answered, i.e. a destination rather than the uplink is down. While
+// nothing answers the alert states are kept as they are.
+func (w *WiFiMonitor) checkTargetAlerts(test WiFiTest) {
+	if !test.IPv4Connectivity && !test.IPv6Connectivity {
+		return
+	}
+	for _, result := range test.Targets {
+		w.setAlert("target_down_"+result.Name, !result.Success,
+			fmt.Sprintf("Ping target %s unreachable while the uplink is up: %s", result.Name, result.Error))
+	}
+}
+
+// pingTargetStats builds a stats table row per ping target from the test history
+func (w *WiFiMonitor) pingTargetStats(tests []WiFiTest) []TargetStats {
+	var rows []TargetStats
+	for _, target := range w.pingTargets {
+		stats := TargetStats{Target: target.Name}
+		for _, test := range tests {
+			for _, result := range test.Targets {
+				if result.Name != target.Name {
+					continue
+				}
+				stats.Success.total++
+				stats.Loss += result.Loss
+				if result.Success {
+					stats.Success.successes++
+					stats.Latencies = append(stats.Latencies, result.Latency)
+				}
+			}
+		}
+		if stats.Success.total > 0 {
+			stats.Loss /= float64(stats.Success.total)
+		}
+		rows = append(rows, stats)
+	}
+	return rows
+}
+
+// failedTargets names the targets of a test that did not answer
+func failedTargets(test WiFiTest) []string {
+	var names []string
+	for _, result := range test.Targets {
+		if !result.Success {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// coreProbeTimeout bounds one run of a built-in DHCP, ping or latency probe
+const coreProbeTimeout = 1 * time.Minute
+
+// runProbe runs a probe with a timeout and stamps the result
+func (w *WiFiMonitor) runProbe(p probe.Probe, timeout time.Duration) probe.Result {
+	ctx, cancel := context.WithTimeout(w.probeContext(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := p.Run(ctx)
+	if result.Timestamp.IsZero() {
+		result.Timestamp = start
+	}
+	return result
+}
+
+// addCustomProbe schedules a probe supplied by an embedding program. Each
+// run may take up to one interval.
+func (w *WiFiMonitor) addCustomProbe(p probe.Probe, interval time.Duration) {
+	name := p.Name()
+	w.customProbes = append(w.customProbes, p)
+	w.addProbe(name, interval, func() {
+		result := w.runProbe(p, interval)
+		w.probeResults[name] = result
+		w.countProbeFailure(name, !result.Success)
+		w.writeJSONL(name, result)
+		w.setAlert("probe_failed_"+name, !result.Success,
+			fmt.Sprintf("Probe %s failed: %s", name, result.Error))
+	})
+}
+
+// customProbeLines lists the latest result of every custom probe
+func (w *WiFiMonitor) customProbeLines() []string {
+	var lines []string
+	for _, p := range w.customProbes {
+		result, ok := w.probeResults[p.Name()]
+		if !ok {
+			lines = append(lines, p.Name()+": pending")
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s at %s", p.Name(), result, result.Timestamp.Format("15:04:05")))
+	}
+	return lines
+}
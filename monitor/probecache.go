@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// probeKey identifies pings that are interchangeable for coalescing
+type probeKey struct {
+	iface        string // Source interface
+	target       string // Destination address
+	size         int    // ICMP payload size (0 for the default)
+	dontFragment bool   // Don't Fragment bit set
+}
+
+// cachedProbe is a recent ping result shared by checks probing the same target
+type cachedProbe struct {
+	stats     probe.PingStats // Result of the burst
+	timestamp time.Time       // Time the burst finished
+}
+
+// coalescedPing returns a ping result for the target, reusing a burst of at
+// least count packets sent within PROBE_COALESCE_WINDOW instead of probing the
+// same host again. Checks that share a target (e.g., the gateway in the
+// latency budget and the service checklist) then report identical statistics.
+func (w *WiFiMonitor) coalescedPing(target string, count, size int, dontFragment bool) probe.PingStats {
+	window := w.settings.Duration("PROBE_COALESCE_WINDOW", 10*time.Second)
+	key := probeKey{iface: w.wifiInterface, target: target, size: size, dontFragment: dontFragment}
+	now := time.Now()
+
+	// Expired results are dropped on every lookup; the cache only holds the last few seconds
+	for k, cached := range w.probeCache {
+		if now.Sub(cached.timestamp) > window {
+			delete(w.probeCache, k)
+		}
+	}
+
+	if cached, ok := w.probeCache[key]; ok && cached.stats.Sent >= count {
+		w.coalescedProbes++
+		return cached.stats
+	}
+
+	stats := probe.PingSized(w.probeContext(), w.settings, w.wifiInterface, target, count, size, dontFragment)
+	if window > 0 {
+		if w.probeCache == nil {
+			w.probeCache = make(map[probeKey]cachedProbe)
+		}
+		w.probeCache[key] = cachedProbe{stats: stats, timestamp: time.Now()}
+	}
+	return stats
+}
@@ -0,0 +1,167 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Profile is a set of probe intervals selected by the schedule
+type Profile struct {
+	Name         string        // Profile name (e.g., conference, night)
+	PingInterval time.Duration // Connectivity test interval
+	DHCPInterval time.Duration // DHCP renewal test interval
+	CheckScale   float64       // Multiplier applied to every auxiliary check interval
+	Throughput   bool          // Scheduled throughput tests run (off keeps the AP free)
+}
+
+// ProfileWindow activates a profile during a daily time window
+type ProfileWindow struct {
+	Profile string        // Profile name
+	Start   time.Duration // Window start as offset from midnight
+	End     time.Duration // Window end; windows may wrap past midnight
+}
+
+// defaultProfile returns the built-in test intervals, adjusted by PING_INTERVAL and DHCP_INTERVAL
+func defaultProfile(s *config.Settings) Profile {
+	return Profile{
+		Name:         "default",
+		PingInterval: s.Duration("PING_INTERVAL", time.Minute),
+		DHCPInterval: s.Duration("DHCP_INTERVAL", 5*time.Minute),
+		CheckScale:   1,
+		Throughput:   true,
+	}
+}
+
+// parseProfileSchedule parses PROFILE_SCHEDULE entries of the form name@HH:MM-HH:MM
+func parseProfileSchedule(s *config.Settings) []ProfileWindow {
+	var windows []ProfileWindow
+	for _, entry := range s.List("PROFILE_SCHEDULE") {
+		name, span, ok := strings.Cut(entry, "@")
+		startText, endText, ok2 := strings.Cut(span, "-")
+		start, err1 := parseClock(startText)
+		end, err2 := parseClock(endText)
+		if !ok || !ok2 || err1 != nil || err2 != nil {
+			fmt.Printf("Error parsing profile schedule entry %q: expected name@HH:MM-HH:MM\n", entry)
+			continue
+		}
+		windows = append(windows, ProfileWindow{Profile: name, Start: start, End: end})
+	}
+	return windows
+}
+
+// parseClock parses HH:MM into an offset from midnight
+func parseClock(text string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether the window covers the time of day of now
+func (p ProfileWindow) contains(now time.Time) bool {
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if p.Start <= p.End {
+		return offset >= p.Start && offset < p.End
+	}
+	return offset >= p.Start || offset < p.End // wraps past midnight
+}
+
+// loadProfile reads PROFILE_<NAME>=ping=30s,dhcp=5m,checks=0.5,throughput=off;
+// unset keys keep the defaults
+func loadProfile(s *config.Settings, name string) Profile {
+	profile := defaultProfile(s)
+	profile.Name = name
+
+	key := "PROFILE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	for _, entry := range s.List(key) {
+		setting, value, _ := strings.Cut(entry, "=")
+		var err error
+		switch setting {
+		case "ping":
+			profile.PingInterval, err = time.ParseDuration(value)
+		case "dhcp":
+			profile.DHCPInterval, err = time.ParseDuration(value)
+		case "checks":
+			profile.CheckScale, err = strconv.ParseFloat(value, 64)
+		case "throughput":
+			profile.Throughput = value != "off"
+			if value != "on" && value != "off" {
+				err = fmt.Errorf("expected on or off")
+			}
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			fmt.Printf("Error parsing %s entry %q: %v\n", key, entry, err)
+		}
+	}
+
+	// Guard against zero or negative intervals from typos
+	if profile.PingInterval <= 0 {
+		profile.PingInterval = defaultProfile(s).PingInterval
+	}
+	if profile.DHCPInterval <= 0 {
+		profile.DHCPInterval = defaultProfile(s).DHCPInterval
+	}
+	if profile.CheckScale <= 0 {
+		profile.CheckScale = 1
+	}
+	return profile
+}
+
+// loadProfiles reads every profile referenced by the schedule and PROFILE_DEFAULT
+func loadProfiles(s *config.Settings, schedule []ProfileWindow) map[string]Profile {
+	profiles := map[string]Profile{"default": defaultProfile(s)}
+	names := []string{s.Get("PROFILE_DEFAULT")}
+	for _, window := range schedule {
+		names = append(names, window.Profile)
+	}
+	for _, name := range names {
+		if _, ok := profiles[name]; name != "" && !ok {
+			profiles[name] = loadProfile(s, name)
+		}
+	}
+	return profiles
+}
+
+// scheduledProfile returns the profile whose window covers now; the first
+// matching window wins and PROFILE_DEFAULT applies outside all windows
+func (w *WiFiMonitor) scheduledProfile(now time.Time) Profile {
+	for _, window := range w.profileSchedule {
+		if window.contains(now) {
+			return w.profiles[window.Profile]
+		}
+	}
+	if name := w.settings.Get("PROFILE_DEFAULT"); name != "" {
+		return w.profiles[name]
+	}
+	return defaultProfile(w.settings)
+}
+
+// applyScheduledProfile switches to the scheduled profile if it changed and
+// reports whether the test intervals need to be updated
+func (w *WiFiMonitor) applyScheduledProfile(now time.Time) bool {
+	profile := w.scheduledProfile(now)
+	if profile == w.profile {
+		return false
+	}
+
+	w.notifyEvent("profile_switched", fmt.Sprintf("Switched from profile %s to %s (%s)",
+		w.profile.Name, profile.Name, profile))
+	w.profile = profile
+	return true
+}
+
+// String formats the profile settings
+func (p Profile) String() string {
+	text := fmt.Sprintf("ping=%v dhcp=%v checks=x%g", p.PingInterval, p.DHCPInterval, p.CheckScale)
+	if !p.Throughput {
+		text += " throughput=off"
+	}
+	return text
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+func TestParseProfileSchedule(t *testing.T) {
+	s := config.New(map[string]string{"PROFILE_SCHEDULE": "conference@08:30-18:00, night@22:00-06:00, broken@8-9, nowindow, late@25:00-26:00"})
+	want := []ProfileWindow{
+		{Profile: "conference", Start: 8*time.Hour + 30*time.Minute, End: 18 * time.Hour},
+		{Profile: "night", Start: 22 * time.Hour, End: 6 * time.Hour},
+	}
+	if got := parseProfileSchedule(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProfileSchedule() = %+v, want %+v", got, want)
+	}
+}
+
+func TestScheduledProfile(t *testing.T) {
+	day := func(clock string) time.Time {
+		t, _ := time.ParseInLocation("15:04", clock, time.Local)
+		return time.Date(2026, 10, 16, t.Hour(), t.Minute(), 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		fallback string
+		at       string
+		want     string
+	}{
+		{name: "no schedule", at: "12:00", want: "default"},
+		{name: "inside a window", schedule: "conference@08:30-18:00", at: "12:00", want: "conference"},
+		{name: "window start is inclusive", schedule: "conference@08:30-18:00", at: "08:30", want: "conference"},
+		{name: "window end is exclusive", schedule: "conference@08:30-18:00", at: "18:00", want: "default"},
+		{name: "before midnight in a wrapping window", schedule: "night@22:00-06:00", at: "23:59", want: "night"},
+		{name: "after midnight in a wrapping window", schedule: "night@22:00-06:00", at: "05:59", want: "night"},
+		{name: "outside a wrapping window", schedule: "night@22:00-06:00", at: "06:00", want: "default"},
+		{name: "first matching window wins", schedule: "keynote@09:00-10:00,conference@08:30-18:00", at: "09:30", want: "keynote"},
+		{name: "PROFILE_DEFAULT outside the windows", schedule: "conference@08:30-18:00", fallback: "quiet", at: "20:00", want: "quiet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"PROFILE_SCHEDULE": tt.schedule, "PROFILE_DEFAULT": tt.fallback})
+			schedule := parseProfileSchedule(s)
+			w := &WiFiMonitor{settings: s, profileSchedule: schedule, profiles: loadProfiles(s, schedule)}
+			if got := w.scheduledProfile(day(tt.at)).Name; got != tt.want {
+				t.Errorf("scheduledProfile(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		want    Profile
+	}{
+		{
+			name: "unset keeps the defaults",
+			want: Profile{Name: "night-shift", PingInterval: 2 * time.Minute, DHCPInterval: 5 * time.Minute, CheckScale: 1, Throughput: true},
+		},
+		{
+			name:    "every setting",
+			setting: "ping=30s,dhcp=1m,checks=0.5,throughput=off",
+			want:    Profile{Name: "night-shift", PingInterval: 30 * time.Second, DHCPInterval: time.Minute, CheckScale: 0.5, Throughput: false},
+		},
+		{
+			name:    "invalid values fall back to the defaults",
+			setting: "ping=0s,dhcp=soon,checks=-1,throughput=maybe,colour=blue",
+			want:    Profile{Name: "night-shift", PingInterval: 2 * time.Minute, DHCPInterval: 5 * time.Minute, CheckScale: 1, Throughput: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"PING_INTERVAL": "2m", "PROFILE_NIGHT_SHIFT": tt.setting})
+			if got := loadProfile(s, "night-shift"); got != tt.want {
+				t.Errorf("loadProfile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
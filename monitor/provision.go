@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// Exit codes of the provisioning commands
+const (
+	exitOK    = 0 // No errors / no changes needed
+	exitError = 1 // Errors found or an action failed
+	exitUsage = 2 // Invalid command line
+	exitDrift = 3 // init --check: changes would be made
+)
+
+// Finding is a single configuration check result
+type Finding struct {
+	Level   string `json:"level"`   // error or warning
+	Key     string `json:"key"`     // Environment variable or component
+	Message string `json:"message"` // Human readable description
+}
+
+// ProvisionAction is one idempotent step performed by init
+type ProvisionAction struct {
+	Name    string `json:"name"`            // Action description
+	Changed bool   `json:"changed"`         // Action changed (or would change) the system
+	Error   string `json:"error,omitempty"` // Failure reason
+}
+
+// configSchema is the subset of the JSON Schema used for validation
+type configSchema struct {
+	Properties map[string]struct {
+		Pattern string   `json:"pattern"`
+		Enum    []string `json:"enum"`
+		Format  string   `json:"format"`
+	} `json:"properties"`
+}
+
+// checkConfig validates the configuration and the host prerequisites
+func checkConfig(s *config.Settings) []Finding {
+	var findings []Finding
+	add := func(level, key, format string, args ...any) {
+		findings = append(findings, Finding{Level: level, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Syntax checks driven by the published config schema
+	var schema configSchema
+	data, _ := schemaFiles.ReadFile("config.schema.json")
+	if err := json.Unmarshal(data, &schema); err != nil {
+		add("error", "schema", "embedded config schema is invalid: %v", err)
+		return findings
+	}
+	keys := make([]string, 0, len(schema.Properties))
+	for key := range schema.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, set := s.Lookup(key)
+		if !set || value == "" {
+			continue
+		}
+		prop := schema.Properties[key]
+		if prop.Pattern != "" && !regexp.MustCompile(prop.Pattern).MatchString(value) {
+			add("error", key, "value %q does not match %s", value, prop.Pattern)
+		}
+		if len(prop.Enum) > 0 && !contains(prop.Enum, value) {
+			add("error", key, "value %q must be one of %v", value, prop.Enum)
+		}
+		if prop.Format == "uri" {
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+				add("error", key, "value %q is not an absolute URL", value)
+			}
+		}
+	}
+
+	// Interfaces must exist on this host
+	for _, key := range []string{"WIFI_INTERFACE", "WIRED_INTERFACE"} {
+		iface := s.Get(key)
+		if key == "WIFI_INTERFACE" && iface == "" {
+			iface = "wlan0"
+		}
+		if iface == "" {
+			continue
+		}
+		if _, err := net.InterfaceByName(iface); err != nil {
+			add("error", key, "interface %s not found", iface)
+		}
+	}
+
+	// External tools used by the enabled probes
+	tools := map[string]string{"ip": "routing", "traceroute": "path-discovery", "iw": "link-rate"}
+	client := probe.DHCPClient(s, s.String("WIFI_INTERFACE", "wlan0"))
+	if tool, ok := probe.DHCPClientTools[client]; ok {
+		tools[tool] = "dhcp"
+	}
+	if probe.ICMPMode(s) == "exec" {
+		tools["ping"], tools["ping6"] = "ping", "ping"
+	} else if s.Get("TTL_PROBE") == "true" {
+		tools["ping"] = "ttl-probe"
+	}
+	if s.Get("WIRED_INTERFACE") != "" {
+		tools["ethtool"] = "wired"
+		tools["lldpctl"] = "lldp"
+	}
+	if s.Get("PAC_TEST_URLS") != "" {
+		tools["pactester"] = "pac"
+	}
+	if throughputMethod(s) == "iperf3" {
+		tools["iperf3"] = "throughput"
+	}
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			add("warning", tools[name], "%s not found in PATH; the %s probe will report failures", name, tools[name])
+		}
+	}
+
+	// NetworkManager must be reachable and manage the WiFi interface
+	if client == "networkmanager" {
+		if err := probe.CheckNetworkManager(s.String("WIFI_INTERFACE", "wlan0")); err != nil {
+			add("error", "DHCP_CLIENT", "NetworkManager backend unusable: %v", err)
+		}
+	}
+
+	// Log file directory must exist for results to be written
+	logFile := s.String("LOG_FILE", "noc-watch.log")
+	if _, err := os.Stat(filepath.Dir(logFile)); err != nil {
+		add("error", "LOG_FILE", "directory of %s does not exist (run noc-watch init)", logFile)
+	}
+
+	return findings
+}
+
+// contains reports whether list includes value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// provision creates the directories noc-watch writes to. It is idempotent:
+// actions report changed=false when the system already matches.
+func provision(s *config.Settings, dryRun bool) []ProvisionAction {
+	dirs := []string{filepath.Dir(s.String("LOG_FILE", "noc-watch.log"))}
+	if dir := s.Get("TENANT_REPORT_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	var actions []ProvisionAction
+	for _, dir := range dirs {
+		action := ProvisionAction{Name: "directory " + dir}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			actions = append(actions, action)
+			continue
+		}
+		action.Changed = true
+		if !dryRun {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				action.Error = err.Error()
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// runCheckConfigCommand implements `noc-watch check-config [--json]`
+func runCheckConfigCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print findings as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	findings := checkConfig(s)
+	code := exitOK
+	for _, f := range findings {
+		if f.Level == "error" {
+			code = exitError
+		}
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"ok":       code == exitOK,
+			"findings": append([]Finding{}, findings...),
+		})
+		return code
+	}
+
+	for _, f := range findings {
+		fmt.Printf("%-7s %-24s %s\n", f.Level, f.Key, f.Message)
+	}
+	if code == exitOK {
+		fmt.Println("configuration OK")
+	}
+	return code
+}
+
+// runInitCommand implements `noc-watch init [--check] [--json]`
+func runInitCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	dryRun := fs.Bool("check", false, "report what would change without changing anything")
+	asJSON := fs.Bool("json", false, "print actions as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	actions := provision(s, *dryRun)
+	changed := false
+	code := exitOK
+	for _, a := range actions {
+		changed = changed || a.Changed
+		if a.Error != "" {
+			code = exitError
+		}
+	}
+	if code == exitOK && *dryRun && changed {
+		code = exitDrift
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"changed": changed,
+			"actions": actions,
+		})
+		return code
+	}
+
+	for _, a := range actions {
+		state := "ok"
+		if a.Error != "" {
+			state = "failed: " + a.Error
+		} else if a.Changed {
+			state = "changed"
+		}
+		fmt.Printf("%-40s %s\n", a.Name, state)
+	}
+	return code
+}
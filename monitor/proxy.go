@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// ProxyCheck compares HTTP probes sent directly and through the detected proxy
+type ProxyCheck struct {
+	Source      string        // Where the proxy came from (config, env, wpad)
+	ProxyURL    string        // Proxy used for the proxied probe ("" if none detected)
+	WPADURL     string        // WPAD/PAC URL found on the network ("" if none)
+	TargetURL   string        // URL fetched by both probes
+	DirectOK    bool          // Direct fetch succeeded
+	DirectTime  time.Duration // Direct fetch duration
+	ProxyOK     bool          // Proxied fetch succeeded
+	ProxyTime   time.Duration // Proxied fetch duration
+	Transparent bool          // Direct response carried proxy headers (Via/X-Cache)
+	Timestamp   time.Time     // Check execution timestamp
+}
+
+// Delta returns how much slower the proxied fetch was than the direct one
+func (c ProxyCheck) Delta() time.Duration {
+	if !c.DirectOK || !c.ProxyOK {
+		return 0
+	}
+	return c.ProxyTime - c.DirectTime
+}
+
+// detectProxy returns the configured or environment proxy for the target URL
+func detectProxy(s *config.Settings, target string) (*url.URL, string) {
+	if configured := s.Get("PROXY_URL"); configured != "" {
+		if u, err := url.Parse(configured); err == nil {
+			return u, "config"
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, ""
+	}
+	if u, err := http.ProxyFromEnvironment(req); err == nil && u != nil {
+		return u, "env"
+	}
+	return nil, ""
+}
+
+// wpadCandidates returns WPAD URLs derived from the DHCP search domains
+func wpadCandidates() []string {
+	var urls []string
+	for _, domain := range probe.SystemSearchDomains() {
+		urls = append(urls, "http://wpad."+domain+"/wpad.dat")
+	}
+	return urls
+}
+
+// httpFetch performs a GET over the monitored interface, optionally through a proxy
+func (w *WiFiMonitor) httpFetch(target string, proxy *url.URL, timeout time.Duration) (*http.Response, time.Duration, error) {
+	transport := &http.Transport{
+		DialContext:       w.interfaceDialer(timeout).DialContext,
+		DisableKeepAlives: true,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	client := &http.Client{Transport: transport, Timeout: timeout}
+
+	start := time.Now()
+	resp, err := client.Get(target)
+	w.rawOutputs.AddResponse(target, resp, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp, time.Since(start), nil
+}
+
+// runProxyCheck detects proxies on the network and compares direct vs proxied HTTP
+func (w *WiFiMonitor) runProxyCheck() {
+	target := w.settings.String("PROXY_CHECK_URL", "http://connectivitycheck.gstatic.com/generate_204")
+	check := ProxyCheck{TargetURL: target, Timestamp: time.Now()}
+
+	proxy, source := detectProxy(w.settings, target)
+
+	// Look for an advertised WPAD file
+	for _, candidate := range wpadCandidates() {
+		if resp, _, err := w.httpFetch(candidate, nil, 5*time.Second); err == nil && resp.StatusCode == http.StatusOK {
+			check.WPADURL = candidate
+			break
+		}
+	}
+
+	// Fall back to the proxy returned by the evaluated PAC file
+	if proxy == nil && w.pacProxy != nil {
+		proxy, source = w.pacProxy, "pac"
+	}
+
+	if resp, elapsed, err := w.httpFetch(target, nil, 10*time.Second); err == nil {
+		check.DirectOK = resp.StatusCode < 400
+		check.DirectTime = elapsed
+		check.Transparent = resp.Header.Get("Via") != "" || resp.Header.Get("X-Cache") != ""
+	}
+
+	if proxy != nil {
+		check.Source = source
+		check.ProxyURL = proxy.String()
+		if resp, elapsed, err := w.httpFetch(target, proxy, 10*time.Second); err == nil {
+			check.ProxyOK = resp.StatusCode < 400
+			check.ProxyTime = elapsed
+		}
+	}
+
+	w.proxyCheck = &check
+}
+
+// String formats the check for logs
+func (c ProxyCheck) String() string {
+	s := fmt.Sprintf("Direct=%v (%v), Transparent=%v", c.DirectOK, c.DirectTime, c.Transparent)
+	if c.ProxyURL != "" {
+		s += fmt.Sprintf(", Proxy=%s [%s] %v (%v), Delta=%v", c.ProxyURL, c.Source, c.ProxyOK, c.ProxyTime, c.Delta())
+	}
+	if c.WPADURL != "" {
+		s += ", WPAD=" + c.WPADURL
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// PublicIP is the address the internet sees the monitored interface behind
+type PublicIP struct {
+	IPv4      string    `json:"ipv4,omitempty"`       // Public IPv4 address (NAT pool address behind NAT)
+	IPv6      string    `json:"ipv6,omitempty"`       // Public IPv6 address
+	Method    string    `json:"method"`               // stun or http
+	IPv4Error string    `json:"ipv4_error,omitempty"` // Why the IPv4 address could not be determined
+	IPv6Error string    `json:"ipv6_error,omitempty"` // Why the IPv6 address could not be determined
+	Since     time.Time `json:"since"`                // When the addresses were first seen
+	Timestamp time.Time `json:"timestamp"`            // Check time
+}
+
+// String formats the public addresses for the log and the UI
+func (p PublicIP) String() string {
+	return fmt.Sprintf("%s / %s (%s, since %s)", orDash(p.IPv4), orDash(p.IPv6), p.Method, p.Since.Format("01-02 15:04"))
+}
+
+// listenInterfaceUDP opens an unconnected UDP socket bound to the monitored
+// interface, for protocols that talk to several servers from one port
+func (w *WiFiMonitor) listenInterfaceUDP(ctx context.Context, network string) (net.PacketConn, error) {
+	lc := net.ListenConfig{Control: w.interfaceDialer(0).Control}
+	return lc.ListenPacket(ctx, network, "")
+}
+
+// publicIPSTUN asks the STUN server PUBLIC_IP_STUN_SERVER for the mapped
+// address over the given family ("4" or "6")
+func (w *WiFiMonitor) publicIPSTUN(ctx context.Context, family string) (string, error) {
+	server, err := net.ResolveUDPAddr("udp"+family, w.settings.String("PUBLIC_IP_STUN_SERVER", "stun.l.google.com:19302"))
+	if err != nil {
+		return "", err
+	}
+	conn, err := w.listenInterfaceUDP(ctx, "udp"+family)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	mapped, err := probe.STUNBinding(ctx, conn, server)
+	if err != nil {
+		return "", err
+	}
+	return mapped.IP.String(), nil
+}
+
+// publicIPHTTP fetches PUBLIC_IP_URL, an echo service answering with the
+// client address as plain text, over the given family ("4" or "6")
+func (w *WiFiMonitor) publicIPHTTP(ctx context.Context, family string) (string, error) {
+	dialer := w.interfaceDialer(10 * time.Second)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp"+family, address)
+		},
+		DisableKeepAlives: true,
+	}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.settings.String("PUBLIC_IP_URL", "https://api64.ipify.org"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("echo service answered %s", resp.Status)
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("echo service answered %q", strings.TrimSpace(string(body)))
+	}
+	return ip.String(), nil
+}
+
+// runPublicIPCheck determines the public IPv4 and IPv6 addresses with
+// PUBLIC_IP_METHOD (stun, default, or http) and records an event when one
+// changes, e.g. after a NAT pool change or an uplink failover. Failed
+// lookups keep the previous address, so an outage is not taken for a change.
+func (w *WiFiMonitor) runPublicIPCheck() {
+	check := PublicIP{Method: "stun", Timestamp: time.Now()}
+	discover := w.publicIPSTUN
+	if w.settings.Get("PUBLIC_IP_METHOD") == "http" {
+		check.Method, discover = "http", w.publicIPHTTP
+	}
+
+	// Each family gets its own time, so a missing IPv6 uplink does not delay IPv4
+	lookup := func(family string) (string, string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		address, err := discover(ctx, family)
+		if err != nil {
+			return "", err.Error()
+		}
+		return address, ""
+	}
+	check.IPv4, check.IPv4Error = lookup("4")
+	check.IPv6, check.IPv6Error = lookup("6")
+
+	previous := w.publicIP
+	if previous != nil {
+		for _, family := range []struct{ name, old, new string }{
+			{"IPv4", previous.IPv4, check.IPv4},
+			{"IPv6", previous.IPv6, check.IPv6},
+		} {
+			if family.old != "" && family.new != "" && family.old != family.new {
+				w.notifyEvent("public_ip_changed", fmt.Sprintf("Public %s address of %s changed: %s -> %s",
+					family.name, w.wifiInterface, family.old, family.new))
+				if w.incident != nil {
+					w.incident.add(check.Timestamp, "public_ip", fmt.Sprintf("public %s %s -> %s", family.name, family.old, family.new))
+				}
+			}
+		}
+		if check.IPv4 == "" {
+			check.IPv4 = previous.IPv4
+		}
+		if check.IPv6 == "" {
+			check.IPv6 = previous.IPv6
+		}
+	}
+	if previous == nil || check.IPv4 != previous.IPv4 || check.IPv6 != previous.IPv6 {
+		check.Since = check.Timestamp
+	} else {
+		check.Since = previous.Since
+	}
+	w.publicIP = &check
+	w.writeJSONL("public_ip", check)
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Quarantine takes a service check target that is down on its own side out
+// of the success rates until a periodic re-test reaches it again
+type Quarantine struct {
+	Since      time.Time // When the target was quarantined
+	NextRetest time.Time // Next re-test of the target
+	Error      string    // Failure reason when it was quarantined
+}
+
+// quarantineAfter returns the consecutive failures that quarantine a target; 0 disables quarantining
+func quarantineAfter(s *config.Settings) int {
+	return s.Int("QUARANTINE_AFTER", 10)
+}
+
+// retestDue reports whether a quarantined service check should be probed now
+func (q *Quarantine) retestDue(now time.Time) bool {
+	return q == nil || !now.Before(q.NextRetest)
+}
+
+// othersHealthy reports whether every other target is reachable: the latest
+// connectivity test passed and all other service checks not in quarantine are
+// OK. Only then is a failing target down on its own side rather than ours.
+func (w *WiFiMonitor) othersHealthy(name string) bool {
+	if n := len(w.pingTests); n == 0 || !w.pingTests[n-1].Success {
+		return false
+	}
+	for _, check := range w.serviceChecks {
+		if check.Name == name || w.quarantined[check.Name] != nil {
+			continue
+		}
+		if !w.serviceStatus[check.Name].OK {
+			return false
+		}
+	}
+	return true
+}
+
+// updateQuarantine quarantines a service check that kept failing while
+// everything else was healthy, and reinstates a quarantined one once its
+// re-test succeeds. It reports whether the result counts towards the rates.
+func (w *WiFiMonitor) updateQuarantine(check ServiceCheck, status ServiceStatus) bool {
+	now := status.Timestamp
+	if q := w.quarantined[check.Name]; q != nil {
+		if !status.OK {
+			q.NextRetest = now.Add(w.settings.Duration("QUARANTINE_RETEST_INTERVAL", 15*time.Minute))
+			return false
+		}
+		delete(w.quarantined, check.Name)
+		w.serviceFailures[check.Name] = 0
+		w.notifyEvent("target_reinstated", fmt.Sprintf("%s (%s %s) is reachable again after %v in quarantine; back in the success rates",
+			check.Name, check.Kind, check.Target, now.Sub(q.Since).Round(time.Second)))
+		return true
+	}
+
+	if status.OK {
+		w.serviceFailures[check.Name] = 0
+		return true
+	}
+	w.serviceFailures[check.Name]++
+
+	after := quarantineAfter(w.settings)
+	if after <= 0 || w.serviceFailures[check.Name] < after || !w.othersHealthy(check.Name) {
+		return true
+	}
+
+	w.quarantined[check.Name] = &Quarantine{
+		Since:      now,
+		NextRetest: now.Add(w.settings.Duration("QUARANTINE_RETEST_INTERVAL", 15*time.Minute)),
+		Error:      status.Error,
+	}
+	w.notifyEvent("target_quarantined", fmt.Sprintf("%s (%s %s) failed %d times in a row while all other targets are healthy; "+
+		"excluded from the success rates and re-tested every %v", check.Name, check.Kind, check.Target,
+		w.serviceFailures[check.Name], w.settings.Duration("QUARANTINE_RETEST_INTERVAL", 15*time.Minute)))
+	return false
+}
+
+// String describes the quarantine for the log file and the checklist
+func (q *Quarantine) String() string {
+	return fmt.Sprintf("quarantined since %s (%s), next re-test %s",
+		q.Since.Format("2006-01-02 15:04:05"), q.Error, q.NextRetest.Format("15:04:05"))
+}
@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// raReopenDelay is the pause before the router advertisement socket is
+// opened again after it failed
+const raReopenDelay = 10 * time.Second
+
+// raCheckInterval is how often missing and unexpected routers are evaluated
+const raCheckInterval = 1 * time.Minute
+
+// raRouter is what the monitor knows about one advertising router
+type raRouter struct {
+	last  probe.RouterAdvertisement // Latest advertisement of the router
+	count int                       // Advertisements received since start
+}
+
+// startRAListener follows the router advertisements on the interface and
+// forwards them to the monitoring loop. Solicited and unsolicited
+// advertisements are both received; the listener sends nothing itself.
+func (w *WiFiMonitor) startRAListener() {
+	go func() {
+		for {
+			conn, err := probe.ListenRouterAdvertisements(w.wifiInterface)
+			if err != nil {
+				fmt.Printf("Error listening for router advertisements: %v\n", err)
+				time.Sleep(raReopenDelay)
+				continue
+			}
+			for {
+				ra, err := probe.ReadRouterAdvertisement(conn, time.Time{})
+				if err != nil {
+					break
+				}
+				select {
+				case w.raEvents <- ra:
+				default: // The loop is busy; the next advertisement will do
+				}
+			}
+			conn.Close()
+			time.Sleep(raReopenDelay)
+		}
+	}()
+}
+
+// expectedRouter reports whether a router may advertise on the link: one of
+// RA_ROUTERS, or the first router seen when none are configured
+func (w *WiFiMonitor) expectedRouter(router string) bool {
+	expected := w.settings.List("RA_ROUTERS")
+	if len(expected) == 0 {
+		if w.raBaseline == "" {
+			w.raBaseline = router
+		}
+		expected = []string{w.raBaseline}
+	}
+	for _, r := range expected {
+		if strings.EqualFold(r, router) {
+			return true
+		}
+	}
+	return false
+}
+
+// noteRouterAdvertisement records an advertisement on the monitoring
+// goroutine with the time since the router's previous one
+func (w *WiFiMonitor) noteRouterAdvertisement(ra probe.RouterAdvertisement) {
+	router, ok := w.raRouters[ra.Router]
+	if !ok {
+		router = &raRouter{}
+		w.raRouters[ra.Router] = router
+	} else {
+		ra.Interval = ra.Received.Sub(router.last.Received)
+	}
+	router.last = ra
+	router.count++
+	w.writeJSONL("ra", ra)
+
+	// A rogue router is reported as soon as it advertises
+	if !w.expectedRouter(ra.Router) {
+		w.setAlert("ra_unexpected_router", true, fmt.Sprintf("Unexpected router %s advertises on %s: %s",
+			ra.Router, w.wifiInterface, ra))
+		if w.incident != nil && router.count == 1 {
+			w.incident.add(ra.Received, "ra", "unexpected router "+ra.String())
+		}
+		return
+	}
+	w.setAlert("ra_missing", false, fmt.Sprintf("Router advertisements from %s received again on %s", ra.Router, w.wifiInterface))
+}
+
+// checkRouterAdvertisements raises ra_missing when no expected router has
+// advertised for RA_TIMEOUT, and resolves ra_unexpected_router once the
+// unexpected routers have been quiet that long
+func (w *WiFiMonitor) checkRouterAdvertisements() {
+	now := time.Now()
+	timeout := w.settings.Duration("RA_TIMEOUT", 30*time.Minute)
+
+	lastExpected := w.raSince
+	var unexpected []string
+	for name, router := range w.raRouters {
+		switch {
+		case w.expectedRouter(name):
+			if router.last.Received.After(lastExpected) {
+				lastExpected = router.last.Received
+			}
+		case now.Sub(router.last.Received) < timeout:
+			unexpected = append(unexpected, name)
+		}
+	}
+
+	w.setAlert("ra_missing", now.Sub(lastExpected) >= timeout, fmt.Sprintf("No router advertisement on %s for %v",
+		w.wifiInterface, now.Sub(lastExpected).Round(time.Second)))
+	if len(unexpected) == 0 {
+		w.setAlert("ra_unexpected_router", false, fmt.Sprintf("No unexpected router advertised on %s for %v",
+			w.wifiInterface, timeout))
+	}
+}
+
+// raSummary describes the advertising routers for the UI and the log
+func (w *WiFiMonitor) raSummary() string {
+	names := make([]string, 0, len(w.raRouters))
+	for name := range w.raRouters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		ra := w.raRouters[name].last
+		text := fmt.Sprintf("%s lifetime %v", name, ra.Lifetime)
+		if ra.Interval > 0 {
+			text += fmt.Sprintf(" every %v", ra.Interval.Round(time.Second))
+		}
+		for _, prefix := range ra.Prefixes {
+			text += " " + prefix.String()
+		}
+		if !w.expectedRouter(name) {
+			text += " UNEXPECTED"
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,193 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// probeTypes are the probe types a success rate is computed for, in display order
+var probeTypes = []string{"dhcp", "ping", "ipv6", "service", "dns", "http"}
+
+// defaultProbeWeights blend DHCP and ping equally, as the pooled rate roughly did
+var defaultProbeWeights = map[string]float64{"dhcp": 1, "ping": 1}
+
+// probeWeights parses SUCCESS_RATE_WEIGHTS entries of the form probe=weight
+// (e.g., ping=3,dhcp=1,service=1). Probe types without a weight stay out of the blend.
+func probeWeights(s *config.Settings) map[string]float64 {
+	entries := s.List("SUCCESS_RATE_WEIGHTS")
+	if len(entries) == 0 {
+		return defaultProbeWeights
+	}
+
+	weights := make(map[string]float64)
+	for _, entry := range entries {
+		probe, value, _ := strings.Cut(entry, "=")
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			fmt.Printf("Error parsing SUCCESS_RATE_WEIGHTS entry %q: expected probe=weight\n", entry)
+			continue
+		}
+		weights[strings.TrimSpace(probe)] = weight
+	}
+	return weights
+}
+
+// ipv6Estimate counts tests with IPv6 connectivity among the tests that
+// pinged an IPv6 target
+func ipv6Estimate(tests []WiFiTest) rateEstimate {
+	var r rateEstimate
+	for _, t := range tests {
+		if !pingedIPv6(t) {
+			continue
+		}
+		r.total++
+		if t.IPv6Connectivity {
+			r.successes++
+		}
+	}
+	return r
+}
+
+// pingedIPv6 reports whether a test had an IPv6 ping target. Tests from
+// before the target list always pinged one.
+func pingedIPv6(test WiFiTest) bool {
+	if len(test.Targets) == 0 {
+		return true
+	}
+	for _, result := range test.Targets {
+		if result.IPv6 {
+			return true
+		}
+	}
+	return false
+}
+
+// probeRates returns the success rate of each probe type. DHCP and ping
+// tests are never pooled into one denominator.
+func (w *WiFiMonitor) probeRates() map[string]rateEstimate {
+	pings := headlineTests(w.settings, w.pingTests)
+	rates := map[string]rateEstimate{
+		"dhcp": successEstimate(w.dhcpTests),
+		"ping": successEstimate(pings),
+		"ipv6": ipv6Estimate(pings),
+	}
+
+	var services rateEstimate
+	for name, r := range w.serviceRates {
+		if w.quarantined[name] != nil {
+			continue
+		}
+		services.successes += r.successes
+		services.total += r.total
+	}
+	if services.total > 0 {
+		rates["service"] = services
+	}
+
+	var lookups rateEstimate
+	for _, stats := range w.dnsLookupStats() {
+		lookups.successes += stats.Success.successes
+		lookups.total += stats.Success.total
+	}
+	if lookups.total > 0 {
+		rates["dns"] = lookups
+	}
+
+	var fetches rateEstimate
+	for _, stats := range w.httpCheckStats() {
+		fetches.successes += stats.Success.successes
+		fetches.total += stats.Success.total
+	}
+	if fetches.total > 0 {
+		rates["http"] = fetches
+	}
+	return rates
+}
+
+// targetRates returns the success rate per probe target: the ping targets,
+// every service check not in quarantine, every DNS lookup and every HTTP check
+func (w *WiFiMonitor) targetRates() map[string]rateEstimate {
+	rates := make(map[string]rateEstimate)
+	for _, stats := range w.pingTargetStats(headlineTests(w.settings, w.pingTests)) {
+		rates[stats.Target] = stats.Success
+	}
+	for name, r := range w.serviceRates {
+		if w.quarantined[name] == nil {
+			rates["service:"+name] = *r
+		}
+	}
+	for _, stats := range append(w.dnsLookupStats(), w.httpCheckStats()...) {
+		rates[stats.Target] = stats.Success
+	}
+	return rates
+}
+
+// blendedRate is the headline success rate: the weighted mean of the
+// per-probe rates that have enough samples
+type blendedRate struct {
+	rate       float64  // Blended success rate in percent
+	parts      []string // Contributing probes with their weights
+	sufficient bool     // At least one weighted probe has enough samples
+}
+
+// blendedSuccessRate blends the per-probe rates with SUCCESS_RATE_WEIGHTS
+func (w *WiFiMonitor) blendedSuccessRate() blendedRate {
+	rates, weights := w.probeRates(), w.rateWeights
+	if weights == nil {
+		weights = defaultProbeWeights
+	}
+
+	var blended blendedRate
+	var sum, total float64
+	for _, probe := range probeTypes {
+		r, ok := rates[probe]
+		weight := weights[probe]
+		if !ok || weight == 0 || !r.sufficient(w.minRateSamples()) {
+			continue
+		}
+		sum += weight * r.rate()
+		total += weight
+		blended.parts = append(blended.parts, fmt.Sprintf("%s×%g", probe, weight))
+	}
+	if total > 0 {
+		blended.rate = sum / total
+		blended.sufficient = true
+	}
+	return blended
+}
+
+// String formats the blended rate with the probes it is made of
+func (b blendedRate) String() string {
+	if !b.sufficient {
+		return "insufficient data"
+	}
+	return fmt.Sprintf("%.2f%% (%s)", b.rate, strings.Join(b.parts, ", "))
+}
+
+// rateLines formats the per-probe and per-target rates for the log file
+func (w *WiFiMonitor) rateLines() []string {
+	lines := []string{"Success Rates by Probe:"}
+	minimum := w.minRateSamples()
+	rates := w.probeRates()
+	for _, probe := range probeTypes {
+		if r, ok := rates[probe]; ok {
+			lines = append(lines, fmt.Sprintf("  %s: %s", probe, r.format(minimum)))
+		}
+	}
+
+	targets := w.targetRates()
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines = append(lines, "Success Rates by Target:")
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("  %s: %s", name, targets[name].format(minimum)))
+	}
+	return lines
+}
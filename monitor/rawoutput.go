@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// probeContext returns a background context keeping probe commands in the
+// raw output store of the monitor
+func (w *WiFiMonitor) probeContext() context.Context {
+	return probe.WithRawOutputs(context.Background(), w.rawOutputs)
+}
+
+// formatRawOutputs renders stored outputs for the debug view and command
+func formatRawOutputs(entries []probe.RawOutput) string {
+	if len(entries) == 0 {
+		return "no raw outputs recorded\n"
+	}
+
+	var text strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&text, "=== %s %s", entry.Time.Format("2006-01-02 15:04:05"), entry.Source)
+		if entry.Error != "" {
+			fmt.Fprintf(&text, " (%s)", entry.Error)
+		}
+		fmt.Fprintf(&text, "\n$ %s\n", entry.Command)
+		if entry.Stdout != "" {
+			text.WriteString(strings.TrimRight(entry.Stdout, "\r\n") + "\n")
+		}
+		if entry.Stderr != "" {
+			text.WriteString("--- stderr\n" + strings.TrimRight(entry.Stderr, "\n") + "\n")
+		}
+	}
+	return text.String()
+}
+
+// runDebugCommand implements `noc-watch debug [SOURCE]`, printing the recent
+// raw probe outputs of the running monitor
+func runDebugCommand(s *config.Settings, args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch debug [SOURCE]")
+		return exitUsage
+	}
+
+	response, err := sendControl(s, strings.TrimSpace("debug "+strings.Join(args, "")))
+	if err != nil {
+		fmt.Printf("Error reading raw outputs: %v\n", err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
@@ -0,0 +1,217 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxReassocHistory limits the number of reassociation tests kept in memory
+const maxReassocHistory = 50
+
+// wpaStatePollInterval is how often the supplicant state is read while
+// timing the association phases
+const wpaStatePollInterval = 20 * time.Millisecond
+
+// wpaStateLevels orders the wpa_supplicant states a reconnection passes
+// through, so states skipped between two polls still close their phase
+var wpaStateLevels = map[string]int{
+	"DISCONNECTED":       0,
+	"INACTIVE":           0,
+	"INTERFACE_DISABLED": 0,
+	"SCANNING":           1,
+	"AUTHENTICATING":     2,
+	"ASSOCIATING":        3,
+	"ASSOCIATED":         4,
+	"4WAY_HANDSHAKE":     4,
+	"GROUP_HANDSHAKE":    4,
+	"COMPLETED":          5,
+}
+
+// ReassocTest is one full disconnect and reconnect of the WiFi interface,
+// timed the way a newly arriving client experiences it
+type ReassocTest struct {
+	Scan      time.Duration `json:"scan_ns"`         // Reconnect request until authentication starts
+	Auth      time.Duration `json:"auth_ns"`         // Authentication until association starts
+	Assoc     time.Duration `json:"assoc_ns"`        // Association and key handshake until the link is usable
+	DHCP      time.Duration `json:"dhcp_ns"`         // DHCP exchange after association
+	FirstPing time.Duration `json:"first_ping_ns"`   // Until the first echo reply after DHCP
+	Total     time.Duration `json:"total_ns"`        // Reconnect request until the first echo reply
+	BSSID     string        `json:"bssid,omitempty"` // Access point the client associated with
+	Success   bool          `json:"success"`         // Every phase completed
+	Phase     string        `json:"phase,omitempty"` // Phase that failed (disconnect, scan, auth, association, dhcp, ping)
+	Error     string        `json:"error,omitempty"` // Failure reason
+	Timestamp time.Time     `json:"timestamp"`       // Test start
+}
+
+// wpaCLI runs a wpa_cli command against an interface and fails unless the
+// supplicant answers OK
+func wpaCLI(ctx context.Context, iface, command string) error {
+	output, err := probe.CaptureCommand(ctx, "wpa_cli", "-i", iface, command)
+	if err != nil {
+		return fmt.Errorf("wpa_cli %s: %v", command, err)
+	}
+	if strings.TrimSpace(string(output)) != "OK" {
+		return fmt.Errorf("wpa_cli %s: %s", command, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// wpaStatus returns the fields of `wpa_cli status`
+func wpaStatus(ctx context.Context, iface string) (map[string]string, error) {
+	output, err := probe.CaptureCommand(ctx, "wpa_cli", "-i", iface, "status")
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			status[key] = value
+		}
+	}
+	if status["wpa_state"] == "" {
+		return nil, errors.New("no wpa_state in wpa_cli status")
+	}
+	return status, nil
+}
+
+// waitWPAState polls the supplicant until it reaches a state of at least
+// level. Every phase boundary passed on the way is stamped with the time
+// it was first seen.
+func waitWPAState(ctx context.Context, iface string, level int, reached map[int]time.Time) (map[string]string, error) {
+	for {
+		status, err := wpaStatus(ctx, iface)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		current := wpaStateLevels[status["wpa_state"]]
+		for l := 0; l <= current; l++ {
+			if _, ok := reached[l]; !ok {
+				reached[l] = now
+			}
+		}
+		if current >= level {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out in state %s", status["wpa_state"])
+		case <-time.After(wpaStatePollInterval):
+		}
+	}
+}
+
+// reassociate disconnects the interface from the network, reconnects it and
+// times scan, authentication, association, DHCP and the first echo reply
+func (w *WiFiMonitor) reassociate(ctx context.Context) ReassocTest {
+	iface := w.wifiInterface
+	test := ReassocTest{Timestamp: time.Now()}
+	fail := func(phase string, err error) ReassocTest {
+		test.Phase, test.Error = phase, err.Error()
+		// Never leave the interface disconnected after a failed test
+		if phase != "disconnect" {
+			wpaCLI(context.WithoutCancel(ctx), iface, "reconnect")
+		}
+		return test
+	}
+
+	// Drop the association and wait until the supplicant has let go
+	if err := wpaCLI(ctx, iface, "disconnect"); err != nil {
+		return fail("disconnect", err)
+	}
+	settle, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for {
+		status, err := wpaStatus(settle, iface)
+		if err != nil {
+			return fail("disconnect", err)
+		}
+		if wpaStateLevels[status["wpa_state"]] == 0 {
+			break
+		}
+		select {
+		case <-settle.Done():
+			return fail("disconnect", fmt.Errorf("still %s after disconnect", status["wpa_state"]))
+		case <-time.After(wpaStatePollInterval):
+		}
+	}
+
+	// Reconnect and follow the supplicant through the phases
+	start := time.Now()
+	if err := wpaCLI(ctx, iface, "reconnect"); err != nil {
+		return fail("scan", err)
+	}
+	reached := make(map[int]time.Time)
+	status, err := waitWPAState(ctx, iface, wpaStateLevels["COMPLETED"], reached)
+	if err != nil {
+		phase := "scan"
+		if _, ok := reached[wpaStateLevels["ASSOCIATING"]]; ok {
+			phase = "association"
+		} else if _, ok := reached[wpaStateLevels["AUTHENTICATING"]]; ok {
+			phase = "auth"
+		}
+		return fail(phase, err)
+	}
+	authStart := reached[wpaStateLevels["AUTHENTICATING"]]
+	assocStart := reached[wpaStateLevels["ASSOCIATING"]]
+	completed := reached[wpaStateLevels["COMPLETED"]]
+	test.Scan, test.Auth, test.Assoc = authStart.Sub(start), assocStart.Sub(authStart), completed.Sub(assocStart)
+	test.BSSID = status["bssid"]
+
+	// DHCP with the configured client, as a new client would do it
+	dhcpStart := time.Now()
+	if dhcp := probe.NewDHCPProbe(w.settings, iface).Run(ctx); !dhcp.Success {
+		return fail("dhcp", errors.New(dhcp.Error))
+	}
+	test.DHCP = time.Since(dhcpStart)
+
+	// First echo reply from the upstream target
+	target := w.probeTarget("UPSTREAM_TARGET", "8.8.8.8")
+	pingStart := time.Now()
+	for {
+		if stats := probe.Ping(ctx, w.settings, iface, target, 1, 0, false, 500*time.Millisecond); stats.Loss < 100 {
+			break
+		}
+		if ctx.Err() != nil {
+			return fail("ping", fmt.Errorf("no reply from %s", target))
+		}
+	}
+	test.FirstPing = time.Since(pingStart)
+	test.Total = time.Since(start)
+	test.Success = true
+	return test
+}
+
+// runReassocTest runs a reassociation test on the REASSOC_INTERVAL
+// schedule. Pings right after it measure the monitor's own disruption.
+func (w *WiFiMonitor) runReassocTest() {
+	ctx, cancel := context.WithTimeout(w.probeContext(), w.settings.Duration("REASSOC_TIMEOUT", 1*time.Minute))
+	defer cancel()
+
+	test := w.reassociate(ctx)
+	w.startDisruption()
+	w.reassocTests = append(w.reassocTests, test)
+	if len(w.reassocTests) > maxReassocHistory {
+		w.reassocTests = w.reassocTests[len(w.reassocTests)-maxReassocHistory:]
+	}
+	w.writeJSONL("reassoc", test)
+	w.countProbeFailure("reassoc", !test.Success)
+	w.setAlert("reassoc_failed", !test.Success,
+		fmt.Sprintf("Reassociation test failed in %s phase: %s", test.Phase, test.Error))
+}
+
+// String formats the reassociation test for the log and the UI
+func (t ReassocTest) String() string {
+	if !t.Success {
+		return fmt.Sprintf("FAIL in %s phase (%s)", t.Phase, t.Error)
+	}
+	ms := func(d time.Duration) string { return d.Round(time.Millisecond).String() }
+	return fmt.Sprintf("OK %s (scan %s, auth %s, assoc %s, dhcp %s, first ping %s) bssid=%s",
+		ms(t.Total), ms(t.Scan), ms(t.Auth), ms(t.Assoc), ms(t.DHCP), ms(t.FirstPing), t.BSSID)
+}
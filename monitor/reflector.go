@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// reflectorIdleTimeout closes TCP echo connections that stay silent this long
+const reflectorIdleTimeout = 60 * time.Second
+
+// runReflectorCommand implements `noc-watch reflector`, serving UDP echo, TCP
+// echo and HTTP 204 endpoints as a venue-local measurement target for agents
+// whose external targets are blocked or unrepresentative
+func runReflectorCommand(args []string) int {
+	fs := flag.NewFlagSet("reflector", flag.ContinueOnError)
+	udpAddr := fs.String("udp", ":7777", "UDP echo listen address (empty to disable)")
+	tcpAddr := fs.String("tcp", ":7777", "TCP echo listen address (empty to disable)")
+	httpAddr := fs.String("http", ":8080", "HTTP 204 listen address (empty to disable)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	errs := make(chan error, 3)
+
+	if *udpAddr != "" {
+		conn, err := net.ListenPacket("udp", *udpAddr)
+		if err != nil {
+			fmt.Printf("Error starting UDP echo: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("UDP echo listening on %s\n", conn.LocalAddr())
+		go func() { errs <- serveUDPEcho(conn) }()
+	}
+
+	if *tcpAddr != "" {
+		listener, err := net.Listen("tcp", *tcpAddr)
+		if err != nil {
+			fmt.Printf("Error starting TCP echo: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("TCP echo listening on %s\n", listener.Addr())
+		go func() { errs <- serveTCPEcho(listener) }()
+	}
+
+	if *httpAddr != "" {
+		listener, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			fmt.Printf("Error starting HTTP 204 endpoint: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("HTTP 204 listening on %s\n", listener.Addr())
+		go func() { errs <- http.Serve(listener, http.HandlerFunc(serveNoContent)) }()
+	}
+
+	if *udpAddr == "" && *tcpAddr == "" && *httpAddr == "" {
+		fmt.Println("Error starting reflector: all endpoints are disabled")
+		return exitUsage
+	}
+
+	// Run until one of the endpoints fails
+	err := <-errs
+	fmt.Printf("Error serving reflector: %v\n", err)
+	return exitError
+}
+
+// serveUDPEcho sends every datagram back to its sender
+func serveUDPEcho(conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		conn.WriteTo(buf[:n], addr)
+	}
+}
+
+// serveTCPEcho echoes each connection's bytes back until the client closes it or goes idle
+func serveTCPEcho(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 32<<10)
+			for {
+				conn.SetDeadline(time.Now().Add(reflectorIdleTimeout))
+				n, err := conn.Read(buf)
+				if n > 0 {
+					if _, werr := conn.Write(buf[:n]); werr != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// serveNoContent answers any request with 204 No Content, like captive-portal probes expect
+func serveNoContent(rw http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20))
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,651 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/marokiki/noc-watch/config"
+)
+
+// remoteSeries is a single labelled sample sent via remote-write
+type remoteSeries struct {
+	labels    map[string]string // Series labels including __name__
+	value     float64           // Sample value
+	timestamp time.Time         // Sample timestamp
+}
+
+// RemoteWriter pushes samples to a Prometheus remote-write endpoint
+// (Mimir, Thanos Receive, VictoriaMetrics, ...)
+type RemoteWriter struct {
+	url       string            // Remote-write endpoint URL
+	username  string            // Optional basic auth username
+	password  string            // Optional basic auth password
+	interval  time.Duration     // Sample collection interval
+	instance  string            // Value of the instance label
+	workspace string            // Event or venue the agent reports to ("" if unset)
+	limits    cardinalityLimits // Label allow-list and per-metric series cap
+	capped    string            // Metrics aggregated by the last push, to log changes only
+	client    *http.Client      // HTTP client used for pushes
+	encoding  string            // Body compression: snappy, or gzip for receivers that accept it
+
+	flushInterval time.Duration        // Minimum time between pushes; samples are batched in between
+	batchSize     int                  // Maximum series per WriteRequest
+	maxBuffered   int                  // Buffered series kept while the endpoint is unreachable
+	buffer        []remoteSeries       // Samples collected but not yet pushed
+	maxAge        time.Duration        // Samples older than this are outside the receiver's window and dropped
+	expired       int                  // Samples dropped as older than maxAge so far
+	newest        map[string]time.Time // Newest enqueued timestamp per series, to drop repeats and older samples
+	lastFlush     time.Time            // Time of the last successful flush
+	lastBatch     int                  // Series sent by the last flush
+	lastBytes     int                  // Compressed bytes sent by the last flush
+	lastLatency   time.Duration        // Duration of the last flush
+	lastError     string               // Error of the last failed flush ("" once a flush succeeds)
+}
+
+// NewRemoteWriter creates a remote writer from environment variables.
+// It returns nil when REMOTE_WRITE_URL is not set.
+func NewRemoteWriter(s *config.Settings) *RemoteWriter {
+	url := s.Get("REMOTE_WRITE_URL")
+	if url == "" {
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+
+	// mTLS and certificate pinning for collectors reached over untrusted networks
+	tlsConfig, err := clientTLSConfig(s, "REMOTE_WRITE_TLS")
+	if err != nil {
+		fmt.Printf("Error loading remote-write TLS configuration: %v\n", err)
+		return nil
+	}
+
+	encoding := s.String("REMOTE_WRITE_COMPRESSION", "snappy")
+	if encoding != "snappy" && encoding != "gzip" {
+		fmt.Printf("Error configuring remote write: unknown REMOTE_WRITE_COMPRESSION %q, using snappy\n", encoding)
+		encoding = "snappy"
+	}
+
+	return &RemoteWriter{
+		url:       url,
+		username:  s.Get("REMOTE_WRITE_USERNAME"),
+		password:  s.Get("REMOTE_WRITE_PASSWORD"),
+		interval:  s.Duration("REMOTE_WRITE_INTERVAL", 1*time.Minute),
+		instance:  s.String("REMOTE_WRITE_INSTANCE", hostname),
+		workspace: s.Get("WORKSPACE"),
+		limits:    cardinalityLimitsFromEnv(s),
+		encoding:  encoding,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		flushInterval: s.Duration("REMOTE_WRITE_FLUSH_INTERVAL", 1*time.Minute),
+		batchSize:     s.Int("REMOTE_WRITE_BATCH_SIZE", 2000),
+		maxBuffered:   s.Int("REMOTE_WRITE_MAX_BUFFERED", 50000),
+		maxAge:        s.Duration("REMOTE_WRITE_MAX_AGE", time.Hour),
+		newest:        make(map[string]time.Time),
+	}
+}
+
+// agentLocation parses AGENT_LOCATION entries of the form key=value
+// (e.g., floor=2,room=Hall A,x=120,y=340) describing where the agent is placed
+func agentLocation(s *config.Settings) map[string]string {
+	location := make(map[string]string)
+	for _, entry := range s.List("AGENT_LOCATION") {
+		if key, value, ok := strings.Cut(entry, "="); ok && key != "" && !strings.HasPrefix(key, "__") {
+			location[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return location
+}
+
+// remoteWriteSeries collects the current monitor state as remote-write samples
+func (w *WiFiMonitor) remoteWriteSeries(instance string) []remoteSeries {
+	now := time.Now()
+	var series []remoteSeries
+
+	// Measurements carry the time they were taken rather than the push time, so a
+	// retransmitted push writes identical samples and the receiver deduplicates them
+	addAt := func(name string, value float64, timestamp time.Time) {
+		series = append(series, remoteSeries{
+			labels: map[string]string{
+				"__name__":  name,
+				"interface": w.wifiInterface,
+				"instance":  instance,
+				"job":       "noc-watch",
+			},
+			value:     value,
+			timestamp: timestamp,
+		})
+	}
+	add := func(name string, value float64) {
+		addAt(name, value, now)
+	}
+
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	// Build info stamps the push with the version and config of this agent
+	add("noc_watch_build_info", 1)
+	series[len(series)-1].labels["version"] = version
+	series[len(series)-1].labels["config_hash"] = w.configHash
+
+	add("noc_watch_tests_total", float64(w.totalCount))
+	add("noc_watch_tests_success_total", float64(w.successCount))
+	add("noc_watch_tests_upstream_failure_total", float64(w.upstreamFailures))
+
+	// Success rates per probe type and target, never pooled, plus the configured blend
+	if blended := w.blendedSuccessRate(); blended.sufficient {
+		add("noc_watch_success_rate_blended_percent", blended.rate)
+	}
+	for probe, r := range w.probeRates() {
+		if r.sufficient(w.minRateSamples()) {
+			add("noc_watch_success_rate_percent", r.rate())
+			series[len(series)-1].labels["probe"] = probe
+		}
+	}
+	for target, r := range w.targetRates() {
+		if r.sufficient(w.minRateSamples()) {
+			add("noc_watch_target_success_rate_percent", r.rate())
+			series[len(series)-1].labels["target"] = target
+		}
+	}
+	add("noc_watch_probes_coalesced_total", float64(w.coalescedProbes))
+	for probe, failures := range w.probeFailures {
+		add("noc_watch_probe_failures_total", float64(failures))
+		series[len(series)-1].labels["probe"] = probe
+	}
+
+	if len(w.dhcpTests) > 0 {
+		latest := w.dhcpTests[len(w.dhcpTests)-1]
+		addAt("noc_watch_dhcp_renew_seconds", latest.DHCPRenewTime.Seconds(), latest.Timestamp)
+		addAt("noc_watch_dhcp_success", boolValue(latest.Success), latest.Timestamp)
+	}
+
+	// Renewal time distribution, e.g. histogram_quantile(0.95, rate(noc_watch_dhcp_renew_duration_seconds_bucket[1h]))
+	if h := w.dhcpRenewHistogram; h != nil {
+		les, counts := h.cumulative()
+		for i, le := range les {
+			add("noc_watch_dhcp_renew_duration_seconds_bucket", float64(counts[i]))
+			series[len(series)-1].labels["le"] = le
+		}
+		add("noc_watch_dhcp_renew_duration_seconds_sum", h.sum)
+		add("noc_watch_dhcp_renew_duration_seconds_count", float64(h.count))
+	}
+
+	if len(w.pingTests) > 0 {
+		latest := w.pingTests[len(w.pingTests)-1]
+		addAt("noc_watch_latency_seconds", latest.Latency.Seconds(), latest.Timestamp)
+		addAt("noc_watch_jitter_seconds", latest.Jitter.Seconds(), latest.Timestamp)
+		addAt("noc_watch_loss_percent", latest.Loss, latest.Timestamp)
+		if latest.LocalLatency > 0 {
+			addAt("noc_watch_local_latency_seconds", latest.LocalLatency.Seconds(), latest.Timestamp)
+			addAt("noc_watch_local_jitter_seconds", latest.LocalJitter.Seconds(), latest.Timestamp)
+			addAt("noc_watch_local_loss_percent", latest.LocalLoss, latest.Timestamp)
+		}
+		addAt("noc_watch_ipv4_up", boolValue(latest.IPv4Connectivity), latest.Timestamp)
+		addAt("noc_watch_ipv6_up", boolValue(latest.IPv6Connectivity), latest.Timestamp)
+		addAt("noc_watch_ping_success", boolValue(latest.Success), latest.Timestamp)
+
+		// Per-target series tell an uplink outage from one unreachable destination
+		for _, result := range latest.Targets {
+			addAt("noc_watch_target_up", boolValue(result.Success), latest.Timestamp)
+			series[len(series)-1].labels["target"] = result.Name
+			addAt("noc_watch_target_loss_percent", result.Loss, latest.Timestamp)
+			series[len(series)-1].labels["target"] = result.Name
+			if result.Success {
+				addAt("noc_watch_target_latency_seconds", result.Latency.Seconds(), latest.Timestamp)
+				series[len(series)-1].labels["target"] = result.Name
+				addAt("noc_watch_target_jitter_seconds", result.Jitter.Seconds(), latest.Timestamp)
+				series[len(series)-1].labels["target"] = result.Name
+			}
+		}
+	}
+
+	if rate, ok := w.linkRates[w.wifiInterface]; ok {
+		add("noc_watch_link_rate_mbps", rate.Mbps)
+	}
+
+	// Layer 2 quality of the association from nl80211
+	if sta := w.station; sta != nil {
+		add("noc_watch_wifi_signal_dbm", float64(sta.SignalDBM))
+		if sta.NoiseDBM != 0 {
+			add("noc_watch_wifi_noise_dbm", float64(sta.NoiseDBM))
+		}
+		add("noc_watch_wifi_tx_bitrate_mbps", sta.TxMbps)
+		add("noc_watch_wifi_rx_bitrate_mbps", sta.RxMbps)
+		add("noc_watch_wifi_tx_retries_total", float64(sta.TxRetries))
+		add("noc_watch_wifi_tx_failed_total", float64(sta.TxFailed))
+	}
+	add("noc_watch_wifi_roams_total", float64(w.roams))
+
+	// Health score and dominant failure class let the backend rank the fleet,
+	// e.g. bottomk(5, noc_watch_health_score)
+	health := w.health(now)
+	add("noc_watch_health_score", health.Score)
+	if health.Dominant != "" {
+		add("noc_watch_dominant_failure", 1)
+		series[len(series)-1].labels["class"] = health.Dominant
+	}
+
+	// Placement on the venue floor plan, joined by map panels on the instance label
+	if location := agentLocation(w.settings); len(location) > 0 {
+		add("noc_watch_agent_location", 1)
+		for key, value := range location {
+			series[len(series)-1].labels[key] = value
+		}
+	}
+
+	// Numeric sensor values, one series per key
+	if w.sensor != nil {
+		for key, value := range w.sensor.Values {
+			addAt("noc_watch_sensor_value", value, w.sensor.Timestamp)
+			series[len(series)-1].labels["sensor"] = key
+		}
+	}
+
+	if w.lowPower != nil {
+		add("noc_watch_duty_cycle_percent", w.lowPower.dutyCycle())
+		add("noc_watch_interval_stretch", w.lowPower.stretch)
+	}
+
+	// DNS lookups per name and resolver, apart from the ICMP results
+	for _, lookup := range w.latestDNSLookups() {
+		addAt("noc_watch_dns_lookup_success", boolValue(lookup.Error == ""), lookup.Timestamp)
+		series[len(series)-1].labels["name"] = lookup.Name
+		series[len(series)-1].labels["server"] = lookup.Server
+		if lookup.Error == "" {
+			addAt("noc_watch_dns_lookup_seconds", lookup.Latency.Seconds(), lookup.Timestamp)
+			series[len(series)-1].labels["name"] = lookup.Name
+			series[len(series)-1].labels["server"] = lookup.Server
+		}
+	}
+
+	// Latest successful throughput test per direction
+	if test, ok := w.latestThroughput(); ok {
+		addAt("noc_watch_throughput_mbps", test.DownloadMbps, test.Timestamp)
+		series[len(series)-1].labels["direction"] = "download"
+		addAt("noc_watch_throughput_mbps", test.UploadMbps, test.Timestamp)
+		series[len(series)-1].labels["direction"] = "upload"
+	}
+
+	// Phases of the latest successful reassociation test, stacked they add up to the total
+	for i := len(w.reassocTests) - 1; i >= 0; i-- {
+		test := w.reassocTests[i]
+		if !test.Success {
+			continue
+		}
+		phases := []struct {
+			name  string
+			value time.Duration
+		}{{"scan", test.Scan}, {"auth", test.Auth}, {"assoc", test.Assoc}, {"dhcp", test.DHCP}, {"first_ping", test.FirstPing}}
+		for _, phase := range phases {
+			addAt("noc_watch_reassoc_phase_seconds", phase.value.Seconds(), test.Timestamp)
+			series[len(series)-1].labels["phase"] = phase.name
+		}
+		break
+	}
+
+	// Latest successful IPv6 provisioning test, next to the DHCP renewal time
+	for i := len(w.ipv6Provisions) - 1; i >= 0; i-- {
+		if test := w.ipv6Provisions[i]; test.Success {
+			addAt("noc_watch_ipv6_time_to_address_seconds", test.TimeToAddress.Seconds(), test.Timestamp)
+			series[len(series)-1].labels["method"] = test.Method
+			addAt("noc_watch_ipv6_router_advert_seconds", test.RouterAdvert.Seconds(), test.Timestamp)
+			break
+		}
+	}
+
+	// Link-layer reachability of the default gateways, apart from the ping targets behind them
+	if n := len(w.pingTests); n > 0 {
+		test := w.pingTests[n-1]
+		for _, gateway := range test.Gateways {
+			addAt("noc_watch_gateway_reachable", boolValue(gateway.Reachable), test.Timestamp)
+			series[len(series)-1].labels["family"] = gateway.Family
+			if gateway.Reachable {
+				addAt("noc_watch_gateway_resolve_seconds", gateway.RTT.Seconds(), test.Timestamp)
+				series[len(series)-1].labels["family"] = gateway.Family
+			}
+		}
+	}
+
+	// Advertising routers with their interval and lifetimes
+	for name, router := range w.raRouters {
+		ra := router.last
+		addAt("noc_watch_ra_router_lifetime_seconds", ra.Lifetime.Seconds(), ra.Received)
+		series[len(series)-1].labels["router"] = name
+		if ra.Interval > 0 {
+			addAt("noc_watch_ra_interval_seconds", ra.Interval.Seconds(), ra.Received)
+			series[len(series)-1].labels["router"] = name
+		}
+		for _, prefix := range ra.Prefixes {
+			addAt("noc_watch_ra_prefix_valid_seconds", prefix.Valid.Seconds(), ra.Received)
+			series[len(series)-1].labels["router"] = name
+			series[len(series)-1].labels["prefix"] = prefix.Prefix
+			addAt("noc_watch_ra_prefix_preferred_seconds", prefix.Preferred.Seconds(), ra.Received)
+			series[len(series)-1].labels["router"] = name
+			series[len(series)-1].labels["prefix"] = prefix.Prefix
+		}
+	}
+
+	// HTTP checks with one series per phase, e.g. for a stacked timing panel
+	for _, check := range w.latestHTTPChecks() {
+		addAt("noc_watch_http_success", boolValue(check.Error == ""), check.Timestamp)
+		series[len(series)-1].labels["check"] = check.Name
+		phases := []struct {
+			name  string
+			value time.Duration
+		}{{"dns", check.DNS}, {"connect", check.Connect}, {"tls", check.TLS}, {"ttfb", check.TTFB}, {"total", check.Total}}
+		for _, phase := range phases {
+			addAt("noc_watch_http_phase_seconds", phase.value.Seconds(), check.Timestamp)
+			series[len(series)-1].labels["check"] = check.Name
+			series[len(series)-1].labels["phase"] = phase.name
+		}
+	}
+
+	// ISP endpoints as their own target class, e.g. for an SLA dashboard per ISP host
+	for _, target := range w.ispTargets {
+		if n := len(target.Samples); n > 0 {
+			latest := target.Samples[n-1]
+			if latest.Loss < 100 {
+				addAt("noc_watch_isp_latency_seconds", latest.Latency.Seconds(), latest.Time)
+				series[len(series)-1].labels["target"] = target.Name
+			}
+			addAt("noc_watch_isp_loss_percent", latest.Loss, latest.Time)
+			series[len(series)-1].labels["target"] = target.Name
+		}
+	}
+
+	// Custom probes: success, main timing and every probe-specific metric
+	for _, p := range w.customProbes {
+		result, ok := w.probeResults[p.Name()]
+		if !ok {
+			continue
+		}
+		success := 0.0
+		if result.Success {
+			success = 1
+		}
+		addAt("noc_watch_probe_success", success, result.Timestamp)
+		series[len(series)-1].labels["probe"] = p.Name()
+		if result.Latency > 0 {
+			addAt("noc_watch_probe_latency_seconds", result.Latency.Seconds(), result.Timestamp)
+			series[len(series)-1].labels["probe"] = p.Name()
+		}
+		for metric, value := range result.Metrics {
+			addAt("noc_watch_probe_metric", value, result.Timestamp)
+			series[len(series)-1].labels["probe"] = p.Name()
+			series[len(series)-1].labels["metric"] = metric
+		}
+	}
+
+	if w.conntrack != nil {
+		add("noc_watch_conntrack_entries", float64(w.conntrack.Count))
+		add("noc_watch_conntrack_max", float64(w.conntrack.Max))
+	}
+
+	return series
+}
+
+// enqueue applies the cardinality guardrails and buffers the collected series
+// together with the exporter's own batch metrics. The oldest samples are
+// dropped when the buffer is full.
+func (r *RemoteWriter) enqueue(series []remoteSeries) {
+	series, aggregated := r.limits.apply(series)
+	if capped := strings.Join(aggregated, ", "); capped != r.capped {
+		r.capped = capped
+		if capped != "" {
+			fmt.Printf("Remote write: aggregating high-cardinality metrics %s\n", capped)
+		}
+	}
+
+	now := time.Now()
+	self := func(name string, value float64) {
+		series = append(series, remoteSeries{
+			labels:    map[string]string{"__name__": name, "instance": r.instance, "job": "noc-watch"},
+			value:     value,
+			timestamp: now,
+		})
+	}
+	self("noc_watch_exporter_aggregated_metrics", float64(len(aggregated)))
+	self("noc_watch_exporter_batch_series", float64(r.lastBatch))
+	self("noc_watch_exporter_batch_bytes", float64(r.lastBytes))
+	self("noc_watch_exporter_flush_seconds", r.lastLatency.Seconds())
+	self("noc_watch_exporter_buffered_series", float64(len(r.buffer)))
+	self("noc_watch_exporter_expired_series_total", float64(r.expired))
+
+	// Every series is tagged with the workspace so events sharing a backend stay separable
+	if r.workspace != "" {
+		for _, s := range series {
+			s.labels["workspace"] = r.workspace
+		}
+	}
+
+	r.buffer = append(r.buffer, r.fresh(series)...)
+	if excess := len(r.buffer) - r.maxBuffered; r.maxBuffered > 0 && excess > 0 {
+		r.buffer = r.buffer[excess:]
+	}
+}
+
+// fresh drops the samples whose series already has a sample at the same or
+// a later time. Latest measurements are collected again every cycle with
+// the time they were taken, and Prometheus refuses repeated or out-of-order
+// samples, so each sample of an agent is only buffered once and in order.
+func (r *RemoteWriter) fresh(series []remoteSeries) []remoteSeries {
+	if r.newest == nil {
+		r.newest = make(map[string]time.Time)
+	}
+	kept := series[:0]
+	for _, s := range series {
+		key := seriesKey(s.labels)
+		if newest, seen := r.newest[key]; seen && !s.timestamp.After(newest) {
+			continue
+		}
+		r.newest[key] = s.timestamp
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// expire drops the buffered samples older than maxAge, which the receiver
+// would refuse as out of bounds along with the rest of their batch
+func (r *RemoteWriter) expire(now time.Time) {
+	if r.maxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-r.maxAge)
+	kept := r.buffer[:0]
+	for _, s := range r.buffer {
+		if s.timestamp.After(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	if dropped := len(r.buffer) - len(kept); dropped > 0 {
+		r.expired += dropped
+		fmt.Printf("Remote write: dropped %d buffered series older than %v\n", dropped, r.maxAge)
+	}
+	r.buffer = kept
+}
+
+// flushDue reports whether the flush interval has elapsed since the last flush
+func (r *RemoteWriter) flushDue(now time.Time) bool {
+	return len(r.buffer) > 0 && now.Sub(r.lastFlush) >= r.flushInterval
+}
+
+// flush pushes the buffered series in batches of at most batchSize, oldest
+// first, after dropping the samples older than maxAge. Series of a failed
+// batch stay buffered and are retried on the next flush, so later batches
+// never overtake them.
+func (r *RemoteWriter) flush() error {
+	start := time.Now()
+	sent, bytesSent := 0, 0
+	r.expire(start)
+
+	for len(r.buffer) > 0 {
+		n := len(r.buffer)
+		if r.batchSize > 0 && n > r.batchSize {
+			n = r.batchSize
+		}
+		size, err := r.push(r.buffer[:n])
+		if errors.As(err, &rejectedError{}) {
+			r.buffer = r.buffer[n:] // The receiver refuses this batch; do not retry it
+		}
+		if err != nil {
+			r.lastError = err.Error()
+			return err
+		}
+		r.buffer = r.buffer[n:]
+		sent += n
+		bytesSent += size
+	}
+
+	r.lastFlush = start
+	r.lastBatch = sent
+	r.lastBytes = bytesSent
+	r.lastLatency = time.Since(start)
+	r.lastError = ""
+	return nil
+}
+
+// rejectedError marks a push the receiver refused permanently (HTTP 4xx)
+type rejectedError struct {
+	error
+}
+
+// push encodes the series as a compressed WriteRequest, sends it and returns
+// the request body size
+func (r *RemoteWriter) push(series []remoteSeries) (int, error) {
+	if len(series) == 0 {
+		return 0, nil
+	}
+
+	body, encoding, err := r.compress(encodeWriteRequest(series))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", encoding)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "noc-watch")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	// Multi-tenant receivers (Mimir, Cortex) isolate storage and retention per tenant
+	if r.workspace != "" {
+		req.Header.Set("X-Scope-OrgID", r.workspace)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+		// Client errors other than rate limiting will not succeed on retry
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return 0, rejectedError{err}
+		}
+		return 0, err
+	}
+
+	return len(body), nil
+}
+
+// compress compresses a WriteRequest with snappy, the only compression the
+// remote-write protocol requires receivers to accept, or with gzip when
+// REMOTE_WRITE_COMPRESSION=gzip (VictoriaMetrics, vmagent) for a smaller
+// body on constrained uplinks. It returns the body and its Content-Encoding.
+func (r *RemoteWriter) compress(data []byte) ([]byte, string, error) {
+	if r.encoding != "gzip" {
+		return snappy.Encode(nil, data), "snappy", nil
+	}
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := gz.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "gzip", nil
+}
+
+// encodeWriteRequest builds a prometheus.WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries) []byte {
+	var req []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		// Labels must be sorted by name
+		names := make([]string, 0, len(s.labels))
+		for name := range s.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var label []byte
+			label = appendProtoBytes(label, 1, []byte(name))
+			label = appendProtoBytes(label, 2, []byte(s.labels[name]))
+			ts = appendProtoBytes(ts, 1, label)
+		}
+
+		var sample []byte
+		sample = appendProtoVarint(sample, 1<<3|1) // field 1, fixed64
+		sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.value))
+		sample = appendProtoVarint(sample, 2<<3|0) // field 2, varint
+		sample = appendProtoVarint(sample, uint64(s.timestamp.UnixMilli()))
+		ts = appendProtoBytes(ts, 2, sample)
+
+		req = appendProtoBytes(req, 1, ts)
+	}
+
+	return req
+}
+
+// appendProtoVarint appends a base-128 varint
+func appendProtoVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendProtoBytes appends a length-delimited field
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendProtoVarint(b, uint64(field)<<3|2)
+	b = appendProtoVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,360 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// The prompb* types mirror prompb.WriteRequest of github.com/prometheus/prometheus
+// (prompb/remote.proto and prompb/types.proto) field for field. They are
+// decoded from the protobuf wire format by hand, as a receiver decodes the
+// request, without pulling in a protobuf module.
+
+// prompbTimeSeries mirrors prompb.TimeSeries
+type prompbTimeSeries struct {
+	Labels  []*prompbLabel  // Field 1
+	Samples []*prompbSample // Field 2
+}
+
+// prompbLabel mirrors prompb.Label
+type prompbLabel struct {
+	Name  string // Field 1
+	Value string // Field 2
+}
+
+// prompbSample mirrors prompb.Sample
+type prompbSample struct {
+	Value     float64 // Field 1 (fixed64)
+	Timestamp int64   // Field 2 (varint)
+}
+
+// protoField is one field of a protobuf message
+type protoField struct {
+	num   uint64 // Field number
+	wire  uint64 // Wire type: 0 varint, 1 fixed64, 2 length-delimited, 5 fixed32
+	value uint64 // Value of varint and fixed fields
+	bytes []byte // Value of length-delimited fields
+}
+
+// decodeProtoFields splits a protobuf message into its fields
+func decodeProtoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		b = b[n:]
+		field := protoField{num: key >> 3, wire: key & 7}
+		switch field.wire {
+		case 0:
+			if field.value, n = binary.Uvarint(b); n <= 0 {
+				return nil, fmt.Errorf("field %d: invalid varint", field.num)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("field %d: fixed64 cut short", field.num)
+			}
+			field.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, fmt.Errorf("field %d: length-delimited value cut short", field.num)
+			}
+			field.bytes, b = b[n:n+int(length)], b[n+int(length):]
+		case 5:
+			if len(b) < 4 {
+				return nil, fmt.Errorf("field %d: fixed32 cut short", field.num)
+			}
+			field.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return nil, fmt.Errorf("field %d: unsupported wire type %d", field.num, field.wire)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// decodeWriteRequest decodes the time series of a prompb.WriteRequest,
+// checking the wire type of every known field
+func decodeWriteRequest(b []byte) ([]*prompbTimeSeries, error) {
+	fields, err := decodeProtoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var timeseries []*prompbTimeSeries
+	for _, field := range fields {
+		if field.num != 1 || field.wire != 2 {
+			return nil, fmt.Errorf("WriteRequest: unexpected field %d (wire type %d)", field.num, field.wire)
+		}
+		ts := &prompbTimeSeries{}
+		tsFields, err := decodeProtoFields(field.bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range tsFields {
+			if f.wire != 2 || (f.num != 1 && f.num != 2) {
+				return nil, fmt.Errorf("TimeSeries: unexpected field %d (wire type %d)", f.num, f.wire)
+			}
+			inner, err := decodeProtoFields(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			if f.num == 1 {
+				label := &prompbLabel{}
+				for _, l := range inner {
+					switch {
+					case l.num == 1 && l.wire == 2:
+						label.Name = string(l.bytes)
+					case l.num == 2 && l.wire == 2:
+						label.Value = string(l.bytes)
+					default:
+						return nil, fmt.Errorf("Label: unexpected field %d (wire type %d)", l.num, l.wire)
+					}
+				}
+				ts.Labels = append(ts.Labels, label)
+				continue
+			}
+			sample := &prompbSample{}
+			for _, v := range inner {
+				switch {
+				case v.num == 1 && v.wire == 1:
+					sample.Value = math.Float64frombits(v.value)
+				case v.num == 2 && v.wire == 0:
+					sample.Timestamp = int64(v.value)
+				default:
+					return nil, fmt.Errorf("Sample: unexpected field %d (wire type %d)", v.num, v.wire)
+				}
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		timeseries = append(timeseries, ts)
+	}
+	return timeseries, nil
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 30, 0, 123456789, time.UTC)
+	ms := at.UnixMilli()
+
+	tests := []struct {
+		name   string
+		series []remoteSeries
+		want   []*prompbTimeSeries
+	}{
+		{
+			name:   "empty",
+			series: nil,
+			want:   nil,
+		},
+		{
+			name: "labels sorted by name",
+			series: []remoteSeries{{
+				labels:    map[string]string{"job": "noc-watch", "__name__": "noc_watch_up", "interface": "wlan0"},
+				value:     1,
+				timestamp: at,
+			}},
+			want: []*prompbTimeSeries{{
+				Labels: []*prompbLabel{
+					{Name: "__name__", Value: "noc_watch_up"},
+					{Name: "interface", Value: "wlan0"},
+					{Name: "job", Value: "noc-watch"},
+				},
+				Samples: []*prompbSample{{Value: 1, Timestamp: ms}},
+			}},
+		},
+		{
+			name: "several series",
+			series: []remoteSeries{
+				{labels: map[string]string{"__name__": "a"}, value: 0.25, timestamp: at},
+				{labels: map[string]string{"__name__": "b", "room": "Hall A"}, value: -3, timestamp: at.Add(time.Minute)},
+			},
+			want: []*prompbTimeSeries{
+				{Labels: []*prompbLabel{{Name: "__name__", Value: "a"}}, Samples: []*prompbSample{{Value: 0.25, Timestamp: ms}}},
+				{Labels: []*prompbLabel{{Name: "__name__", Value: "b"}, {Name: "room", Value: "Hall A"}}, Samples: []*prompbSample{{Value: -3, Timestamp: ms + 60000}}},
+			},
+		},
+		{
+			name:   "zero value and empty label value",
+			series: []remoteSeries{{labels: map[string]string{"__name__": "z", "floor": ""}, value: 0, timestamp: at}},
+			want: []*prompbTimeSeries{{
+				Labels:  []*prompbLabel{{Name: "__name__", Value: "z"}, {Name: "floor"}},
+				Samples: []*prompbSample{{Timestamp: ms}},
+			}},
+		},
+		{
+			name:   "infinity and non-ASCII label",
+			series: []remoteSeries{{labels: map[string]string{"__name__": "inf", "room": "会議室"}, value: math.Inf(1), timestamp: at}},
+			want: []*prompbTimeSeries{{
+				Labels:  []*prompbLabel{{Name: "__name__", Value: "inf"}, {Name: "room", Value: "会議室"}},
+				Samples: []*prompbSample{{Value: math.Inf(1), Timestamp: ms}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The body as push sends it
+			body := snappy.Encode(nil, encodeWriteRequest(tt.series))
+			raw, err := snappy.Decode(nil, body)
+			if err != nil {
+				t.Fatalf("snappy decode: %v", err)
+			}
+			timeseries, err := decodeWriteRequest(raw)
+			if err != nil {
+				t.Fatalf("decode WriteRequest: %v", err)
+			}
+			if !reflect.DeepEqual(timeseries, tt.want) {
+				t.Errorf("decoded %v, want %v", timeseries, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeWriteRequestNaN(t *testing.T) {
+	// Staleness markers are NaN, which DeepEqual cannot compare
+	raw := encodeWriteRequest([]remoteSeries{{labels: map[string]string{"__name__": "stale"}, value: math.NaN(), timestamp: time.UnixMilli(1)}})
+	timeseries, err := decodeWriteRequest(raw)
+	if err != nil {
+		t.Fatalf("decode WriteRequest: %v", err)
+	}
+	if len(timeseries) != 1 || len(timeseries[0].Samples) != 1 {
+		t.Fatalf("decoded %v, want one sample", timeseries)
+	}
+	if sample := timeseries[0].Samples[0]; !math.IsNaN(sample.Value) || sample.Timestamp != 1 {
+		t.Errorf("sample %v, want NaN at 1", sample)
+	}
+}
+
+func TestRemoteWriterOrderAndAge(t *testing.T) {
+	var failures int
+	var received []int64 // Timestamps of the noc_watch_latency_seconds samples in arrival order
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timeseries, err := decodeWriteRequest(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ts := range timeseries {
+			for _, label := range ts.Labels {
+				if label.Name == "__name__" && label.Value == "noc_watch_latency_seconds" {
+					received = append(received, ts.Samples[0].Timestamp)
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	r := &RemoteWriter{url: server.URL, client: server.Client(), instance: "probe01", batchSize: 1, maxAge: time.Hour}
+	now := time.Now()
+	latency := func(at time.Time) remoteSeries {
+		return remoteSeries{
+			labels:    map[string]string{"__name__": "noc_watch_latency_seconds", "instance": "probe01"},
+			value:     0.01,
+			timestamp: at,
+		}
+	}
+
+	// A sample from before the window of the receiver is dropped
+	r.enqueue([]remoteSeries{latency(now.Add(-2 * time.Hour))})
+	// The latest test is collected again each cycle, and an older one arrives late
+	r.enqueue([]remoteSeries{latency(now.Add(-10 * time.Minute))})
+	r.enqueue([]remoteSeries{latency(now.Add(-10 * time.Minute))})
+	r.enqueue([]remoteSeries{latency(now.Add(-20 * time.Minute))})
+
+	// The endpoint is down for the first push: nothing overtakes the failed batch
+	failures = 1
+	if err := r.flush(); err == nil {
+		t.Fatal("flush() succeeded against a failing endpoint")
+	}
+	r.enqueue([]remoteSeries{latency(now.Add(-5 * time.Minute))})
+	if err := r.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{
+		now.Add(-10 * time.Minute).UnixMilli(),
+		now.Add(-5 * time.Minute).UnixMilli(),
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("received latency samples at %v, want %v", received, want)
+	}
+	if r.expired != 1 {
+		t.Errorf("expired = %d, want 1", r.expired)
+	}
+}
+
+func TestRemoteWriterCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		want     string
+	}{
+		{name: "snappy by default", want: "snappy"},
+		{name: "snappy", encoding: "snappy", want: "snappy"},
+		{name: "gzip", encoding: "gzip", want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			var timeseries []*prompbTimeSeries
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Content-Encoding")
+				body, _ := io.ReadAll(r.Body)
+				var data []byte
+				var err error
+				switch got {
+				case "snappy":
+					data, err = snappy.Decode(nil, body)
+				case "gzip":
+					var gz *gzip.Reader
+					if gz, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+						data, err = io.ReadAll(gz)
+					}
+				}
+				if err != nil {
+					t.Errorf("decoding %s body: %v", got, err)
+					return
+				}
+				if timeseries, err = decodeWriteRequest(data); err != nil {
+					t.Error(err)
+				}
+			}))
+			defer server.Close()
+
+			r := &RemoteWriter{url: server.URL, client: server.Client(), encoding: tt.encoding}
+			series := []remoteSeries{{labels: map[string]string{"__name__": "noc_watch_up"}, value: 1, timestamp: time.Now()}}
+			if _, err := r.push(series); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if len(timeseries) != 1 {
+				t.Errorf("received %d series, want 1", len(timeseries))
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package monitor
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// apiCommand prefixes the control commands that answer the REST API
+const apiCommand = "api "
+
+// apiRate is a success rate with its sample size and confidence interval
+type apiRate struct {
+	Successes  int     `json:"successes"`        // Successful samples
+	Total      int     `json:"total"`            // Total samples
+	Percent    float64 `json:"percent"`          // Observed success rate
+	Lower      float64 `json:"ci_lower_percent"` // Lower bound of the 95% Wilson interval
+	Upper      float64 `json:"ci_upper_percent"` // Upper bound of the 95% Wilson interval
+	Sufficient bool    `json:"sufficient"`       // At least MIN_RATE_SAMPLES samples
+}
+
+// newAPIRate converts a rate estimate for the API
+func newAPIRate(r rateEstimate, minimum int) apiRate {
+	lower, upper := r.interval()
+	return apiRate{
+		Successes:  r.successes,
+		Total:      r.total,
+		Percent:    r.rate(),
+		Lower:      lower,
+		Upper:      upper,
+		Sufficient: r.sufficient(minimum),
+	}
+}
+
+// apiStatus is the response of /api/status
+type apiStatus struct {
+	Agent      string            `json:"agent"`                 // Host name of the agent
+	Workspace  string            `json:"workspace,omitempty"`   // WORKSPACE (event or venue) the agent reports to
+	Location   map[string]string `json:"location,omitempty"`    // AGENT_LOCATION placement (floor, room, x, y, ...)
+	Interface  string            `json:"interface"`             // Monitored WiFi interface
+	Link       string            `json:"link"`                  // UP, DOWN or UNKNOWN
+	State      string            `json:"connectivity"`          // healthy, degraded or down ("" before the first test)
+	Health     float64           `json:"health_score"`          // Success percentage of the last hour
+	Dominant   string            `json:"dominant_failure"`      // Most frequent failure class of the last hour
+	Paused     bool              `json:"paused"`                // Probing paused by an operator
+	Profile    string            `json:"profile"`               // Active probing profile
+	Alerts     []string          `json:"alerts"`                // Firing alerts by name
+	LatestDHCP *WiFiTest         `json:"latest_dhcp,omitempty"` // Newest DHCP test
+	LatestPing *WiFiTest         `json:"latest_ping,omitempty"` // Newest connectivity test
+	Version    string            `json:"version"`               // noc-watch release
+	ConfigHash string            `json:"config_hash"`           // Hash of the effective configuration
+	Timestamp  time.Time         `json:"timestamp"`             // Time of the response
+}
+
+// apiSummary is the response of /api/summary
+type apiSummary struct {
+	Availability float64            `json:"availability_percent"`   // Time-weighted availability
+	Downtime     time.Duration      `json:"downtime_ns"`            // Total outage duration
+	Outages      int                `json:"outages"`                // Number of outages
+	Since        time.Time          `json:"since"`                  // Start of the observation period
+	SuccessRate  *float64           `json:"success_rate_percent"`   // Blended rate, null with insufficient data
+	Probes       map[string]apiRate `json:"probes"`                 // Success rate per probe type
+	Targets      map[string]apiRate `json:"targets"`                // Success rate per ping target
+	DHCPRenewP95 float64            `json:"dhcp_renew_p95_seconds"` // p95 of the DHCP renewal histogram
+	DHCPTests    int                `json:"dhcp_tests"`             // DHCP tests in memory
+	PingTests    int                `json:"ping_tests"`             // Connectivity tests in memory
+	Throughput   *ThroughputTest    `json:"throughput,omitempty"`   // Newest successful throughput test
+	NAT          *NATType           `json:"nat,omitempty"`          // Newest NAT behavior discovery
+}
+
+// apiStatusOf builds the /api/status response
+func (w *WiFiMonitor) apiStatusOf() apiStatus {
+	now := time.Now()
+	health := w.health(now)
+	hostname, _ := os.Hostname()
+	status := apiStatus{
+		Agent:      hostname,
+		Workspace:  w.settings.Get("WORKSPACE"),
+		Location:   agentLocation(w.settings),
+		Interface:  w.wifiInterface,
+		Link:       "UNKNOWN",
+		State:      w.connectivity.state,
+		Health:     health.Score,
+		Dominant:   health.Dominant,
+		Paused:     w.pause != nil,
+		Profile:    w.profile.Name,
+		Alerts:     []string{},
+		Version:    version,
+		ConfigHash: w.configHash,
+		Timestamp:  now,
+	}
+	if w.linkInfo != nil {
+		status.Link = "DOWN"
+		if w.linkInfo.Up {
+			status.Link = "UP"
+		}
+	}
+	for name := range w.activeAlerts {
+		status.Alerts = append(status.Alerts, name)
+	}
+	sort.Strings(status.Alerts)
+	if len(w.dhcpTests) > 0 {
+		status.LatestDHCP = &w.dhcpTests[len(w.dhcpTests)-1]
+	}
+	if len(w.pingTests) > 0 {
+		status.LatestPing = &w.pingTests[len(w.pingTests)-1]
+	}
+	return status
+}
+
+// apiSummaryOf builds the /api/summary response
+func (w *WiFiMonitor) apiSummaryOf() apiSummary {
+	availability, downtime := w.availability.percent(time.Now())
+	summary := apiSummary{
+		Availability: availability,
+		Downtime:     downtime,
+		Outages:      len(w.availability.outages),
+		Since:        w.availability.start,
+		Probes:       make(map[string]apiRate),
+		Targets:      make(map[string]apiRate),
+		DHCPRenewP95: w.dhcpRenewHistogram.quantile(0.95),
+		DHCPTests:    len(w.dhcpTests),
+		PingTests:    len(w.pingTests),
+		NAT:          w.natType,
+	}
+	if blended := w.blendedSuccessRate(); blended.sufficient {
+		summary.SuccessRate = &blended.rate
+	}
+	for probe, r := range w.probeRates() {
+		summary.Probes[probe] = newAPIRate(r, w.minRateSamples())
+	}
+	for target, r := range w.targetRates() {
+		summary.Targets[target] = newAPIRate(r, w.minRateSamples())
+	}
+	if latest, ok := w.latestThroughput(); ok {
+		summary.Throughput = &latest
+	}
+	return summary
+}
+
+// parseAPISince accepts a duration before now (e.g. 2h) or an RFC 3339 time
+func parseAPISince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now().Add(-time.Hour), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: expected a duration (e.g. 2h) or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// handleAPICommand answers `api status`, `api summary`,
+// `api tests SINCE [PROBE]` and `api debug [SOURCE]` with JSON for the REST
+// API
+func (w *WiFiMonitor) handleAPICommand(arg string) string {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return "error: missing API query\n"
+	}
+
+	var response any
+	switch fields[0] {
+	case "status":
+		response = w.apiStatusOf()
+	case "summary":
+		response = w.apiSummaryOf()
+	case "tests":
+		since := ""
+		if len(fields) > 1 {
+			since = fields[1]
+		}
+		cutoff, err := parseAPISince(since)
+		if err != nil {
+			return fmt.Sprintf("error: %v\n", err)
+		}
+		tests := []exportedTest{}
+		for _, test := range w.historySince(cutoff) {
+			if len(fields) < 3 || test.Probe == fields[2] {
+				tests = append(tests, test)
+			}
+		}
+		response = tests
+	case "debug":
+		source := ""
+		if len(fields) > 1 {
+			source = fields[1]
+		}
+		outputs := w.rawOutputs.Recent(source)
+		if outputs == nil {
+			outputs = []probe.RawOutput{}
+		}
+		response = outputs
+	default:
+		return fmt.Sprintf("error: unknown API query %q\n", fields[0])
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Sprintf("error: %v\n", err)
+	}
+	return string(data) + "\n"
+}
+
+// queryMonitor runs a control command on the monitoring loop for an HTTP
+// request. It writes an error response and returns false when the monitor
+// has stopped or the client went away.
+func (w *WiFiMonitor) queryMonitor(rw http.ResponseWriter, r *http.Request, command string) (string, bool) {
+	req := controlRequest{command: command, reply: make(chan string, 1)}
+	select {
+	case w.controlRequests <- req:
+		return <-req.reply, true
+	case <-r.Context().Done():
+		return "", false
+	case <-w.stopped:
+		http.Error(rw, "monitor stopped", http.StatusServiceUnavailable)
+		return "", false
+	}
+}
+
+// workspaceTokens parses WORKSPACE_TOKENS entries of the form
+// workspace=token into the workspace of each token
+func workspaceTokens(s *config.Settings) map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range s.List("WORKSPACE_TOKENS") {
+		workspace, token, ok := strings.Cut(entry, "=")
+		workspace, token = strings.TrimSpace(workspace), strings.TrimSpace(token)
+		if ok && token != "" && workspaceName.MatchString(workspace) {
+			tokens[token] = workspace
+		}
+	}
+	return tokens
+}
+
+// apiScope checks the bearer token of a request and returns the workspace
+// it is limited to. API_TOKEN sees every workspace (scope ""); a token of
+// WORKSPACE_TOKENS only sees its own, so events sharing a collector cannot
+// read each other's agents. Without either setting every request passes.
+// Only the stream accepts the token as ?token= (queryToken), as EventSource
+// cannot set headers; elsewhere it would end up in proxy and access logs.
+func apiScope(s *config.Settings, r *http.Request, queryToken bool) (string, bool) {
+	token := s.Get("API_TOKEN")
+	tokens := workspaceTokens(s)
+	if token == "" && len(tokens) == 0 {
+		return "", true
+	}
+	given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if given == "" && queryToken {
+		given = r.URL.Query().Get("token")
+	}
+	if given == "" {
+		return "", false
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+		return "", true
+	}
+	for candidate, workspace := range tokens {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(candidate)) == 1 {
+			return workspace, true
+		}
+	}
+	return "", false
+}
+
+// apiAuthorized checks the token of a request for the data of this agent:
+// API_TOKEN, or the token of the WORKSPACE the agent reports to
+func apiAuthorized(s *config.Settings, r *http.Request, queryToken bool) bool {
+	scope, ok := apiScope(s, r, queryToken)
+	return ok && (scope == "" || scope == s.Get("WORKSPACE"))
+}
+
+// apiWriteScope checks a request that changes the agent, such as a floor
+// plan upload, and returns the workspace it is limited to. Beyond localhost
+// writes need API_TOKEN, a workspace token or a client certificate verified
+// against API_TLS_CLIENT_CA (mutual TLS).
+func apiWriteScope(s *config.Settings, r *http.Request) (string, bool) {
+	if s.Get("API_TOKEN") != "" || len(workspaceTokens(s)) > 0 {
+		return apiScope(s, r, false)
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "", true
+	}
+	return "", loopbackAddress(s.Get("API_LISTEN"))
+}
+
+// apiWriteAuthorized checks a request that changes the data of this agent
+func apiWriteAuthorized(s *config.Settings, r *http.Request) bool {
+	scope, ok := apiWriteScope(s, r)
+	return ok && (scope == "" || scope == s.Get("WORKSPACE"))
+}
+
+// apiAllowed checks the token and the method of a read-only API request.
+// It writes the error response when the request is refused.
+func apiAllowed(s *config.Settings, rw http.ResponseWriter, r *http.Request, queryToken bool) bool {
+	if !apiAuthorized(s, r, queryToken) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// scopedWorkspace returns the ?workspace= filter of a request to the fleet
+// or the floor plan, checked against the scope of its token. A workspace
+// token always filters by its own workspace and is refused any other; the
+// error response is written then.
+func scopedWorkspace(rw http.ResponseWriter, r *http.Request, scope string) (workspace string, filtered, ok bool) {
+	query := r.URL.Query()
+	workspace, filtered = query.Get("workspace"), query.Has("workspace")
+	if scope == "" {
+		return workspace, filtered, true
+	}
+	if filtered && workspace != scope {
+		writeAPIError(rw, http.StatusForbidden, fmt.Sprintf("token is limited to workspace %q", scope))
+		return "", false, false
+	}
+	return scope, true, true
+}
+
+// apiReadScope checks the token and the method of a read-only request to
+// the fleet or the floor plan, which serve several workspaces, and returns
+// the workspace the token is limited to ("" for every workspace). It writes
+// the error response when the request is refused.
+func apiReadScope(s *config.Settings, rw http.ResponseWriter, r *http.Request) (string, bool) {
+	scope, ok := apiScope(s, r, false)
+	if !ok {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	return scope, true
+}
+
+// apiHandler serves one API query as JSON. Errors from the monitor become
+// 400 responses with a JSON error object.
+func (w *WiFiMonitor) apiHandler(query func(*http.Request) string) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !apiAllowed(w.settings, rw, r, false) {
+			return
+		}
+
+		response, ok := w.queryMonitor(rw, r, query(r))
+		if !ok {
+			return
+		}
+		if message, failed := strings.CutPrefix(response, "error: "); failed {
+			writeAPIError(rw, http.StatusBadRequest, strings.TrimSpace(message))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(response))
+	}
+}
+
+// writeAPIError writes an error response with a JSON error object
+func writeAPIError(rw http.ResponseWriter, code int, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(map[string]string{"error": message})
+}
+
+// apiMux routes /api/status, /api/summary, /api/tests?since=2h&probe=ping,
+// the raw probe outputs of /api/debug?source=ping, the silences, the live
+// /api/stream, the fleet ranking, the floor plan and the web dashboard at /
+func (w *WiFiMonitor) apiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", w.apiHandler(func(*http.Request) string {
+		return apiCommand + "status"
+	}))
+	mux.HandleFunc("/api/summary", w.apiHandler(func(*http.Request) string {
+		return apiCommand + "summary"
+	}))
+	mux.HandleFunc("/api/tests", w.apiHandler(func(r *http.Request) string {
+		since := r.URL.Query().Get("since")
+		if since == "" {
+			since = "1h"
+		}
+		command := apiCommand + "tests " + strings.ReplaceAll(since, " ", "")
+		if probe := r.URL.Query().Get("probe"); probe != "" {
+			command += " " + strings.ReplaceAll(probe, " ", "")
+		}
+		return command
+	}))
+	mux.HandleFunc("/api/debug", w.apiHandler(func(r *http.Request) string {
+		return strings.TrimSpace(apiCommand + "debug " + strings.ReplaceAll(r.URL.Query().Get("source"), " ", ""))
+	}))
+	mux.HandleFunc("/api/silences", w.serveSilences)
+	mux.HandleFunc("/api/silences/", w.serveSilences)
+	mux.HandleFunc("/api/stream", w.serveStream)
+	mux.HandleFunc("/api/fleet", w.serveFleet)
+	mux.HandleFunc("/api/floorplan", w.serveFloorPlan)
+	mux.HandleFunc("/api/floorplan/image", w.serveFloorPlanImage)
+	if w.settings.Get("DASHBOARD") != "false" {
+		mux.Handle("/", ui.DashboardHandler())
+	}
+	return mux
+}
+
+// loopbackAddress reports whether a listen address only accepts local
+// connections
+func loopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// startAPIServer serves the REST API on API_LISTEN (e.g. 127.0.0.1:9102),
+// over (mutual) TLS with API_TLS_*. Beyond localhost the API is only served
+// over TLS, so neither the token nor the data cross the network in clear
+// text, and only with API_TOKEN, WORKSPACE_TOKENS or API_TLS_CLIENT_CA,
+// so nobody on the network can write to it. Like scrapes, queries are
+// answered by the monitoring loop. It returns a function stopping the server.
+func (w *WiFiMonitor) startAPIServer() func() {
+	addr := w.settings.Get("API_LISTEN")
+	if addr == "" {
+		return func() {}
+	}
+	if !loopbackAddress(addr) {
+		if w.settings.Get("API_TLS_CERT") == "" {
+			fmt.Printf("Error serving API: %s is reachable beyond localhost; set API_TLS_CERT and API_TLS_KEY or listen on 127.0.0.1\n", addr)
+			return func() {}
+		}
+		if w.settings.Get("API_TOKEN") == "" && len(workspaceTokens(w.settings)) == 0 && w.settings.Get("API_TLS_CLIENT_CA") == "" {
+			fmt.Printf("Error serving API: %s is reachable beyond localhost; set API_TOKEN, WORKSPACE_TOKENS or API_TLS_CLIENT_CA or listen on 127.0.0.1\n", addr)
+			return func() {}
+		}
+	}
+
+	server := &http.Server{Addr: addr, Handler: w.apiMux(), ReadHeaderTimeout: 10 * time.Second}
+	return serveHTTP(w.settings, server, "API", "API")
+}
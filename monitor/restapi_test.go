@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+func TestAPIWriteAuthorized(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+
+	tests := []struct {
+		name   string
+		listen string
+		token  string
+		tokens string
+		given  string
+		tls    *tls.ConnectionState
+		want   bool
+	}{
+		{name: "localhost without a token", listen: "127.0.0.1:9102", want: true},
+		{name: "beyond localhost without a token", listen: "0.0.0.0:9102", want: false},
+		{name: "beyond localhost with a client certificate", listen: "0.0.0.0:9102", tls: verified, want: true},
+		{name: "beyond localhost over TLS without a client certificate", listen: "0.0.0.0:9102", tls: &tls.ConnectionState{}, want: false},
+		{name: "token", listen: "0.0.0.0:9102", token: "secret", given: "Bearer secret", want: true},
+		{name: "wrong token", listen: "0.0.0.0:9102", token: "secret", given: "Bearer guess", want: false},
+		{name: "token required on localhost too", listen: "127.0.0.1:9102", token: "secret", want: false},
+		{name: "token required with a client certificate", listen: "0.0.0.0:9102", token: "secret", tls: verified, want: false},
+		{name: "token of the agent's workspace", listen: "0.0.0.0:9102", tokens: "hall-a=alpha", given: "Bearer alpha", want: true},
+		{name: "token of another workspace", listen: "0.0.0.0:9102", tokens: "hall-b=bravo", given: "Bearer bravo", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"API_LISTEN": tt.listen, "API_TOKEN": tt.token, "WORKSPACE_TOKENS": tt.tokens, "WORKSPACE": "hall-a"})
+			r := httptest.NewRequest("PUT", "/api/floorplan/image", nil)
+			r.TLS = tt.tls
+			if tt.given != "" {
+				r.Header.Set("Authorization", tt.given)
+			}
+			if got := apiWriteAuthorized(s, r); got != tt.want {
+				t.Errorf("apiWriteAuthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIScope(t *testing.T) {
+	tokens := "hall-a=alpha, hall-b = bravo, bad name=charlie, hall-c="
+
+	tests := []struct {
+		name      string
+		token     string
+		tokens    string
+		given     string
+		query     string
+		wantScope string
+		wantOK    bool
+	}{
+		{name: "no tokens", wantOK: true},
+		{name: "API_TOKEN", token: "secret", tokens: tokens, given: "Bearer secret", wantOK: true},
+		{name: "workspace token", token: "secret", tokens: tokens, given: "Bearer bravo", wantScope: "hall-b", wantOK: true},
+		{name: "workspace token without API_TOKEN", tokens: tokens, given: "Bearer alpha", wantScope: "hall-a", wantOK: true},
+		{name: "workspace tokens require a token", tokens: tokens},
+		{name: "unknown token", token: "secret", tokens: tokens, given: "Bearer delta"},
+		{name: "invalid workspace is ignored", tokens: tokens, given: "Bearer charlie"},
+		{name: "query token is not accepted", tokens: tokens, query: "?token=alpha"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.New(map[string]string{"API_TOKEN": tt.token, "WORKSPACE_TOKENS": tt.tokens})
+			r := httptest.NewRequest("GET", "/api/fleet"+tt.query, nil)
+			if tt.given != "" {
+				r.Header.Set("Authorization", tt.given)
+			}
+			scope, ok := apiScope(s, r, false)
+			if scope != tt.wantScope || ok != tt.wantOK {
+				t.Errorf("apiScope() = %q, %v, want %q, %v", scope, ok, tt.wantScope, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScopedWorkspace(t *testing.T) {
+	tests := []struct {
+		name         string
+		scope        string
+		query        string
+		want         string
+		wantFiltered bool
+		wantCode     int
+	}{
+		{name: "every workspace", query: "/api/fleet"},
+		{name: "filter", query: "/api/fleet?workspace=hall-b", want: "hall-b", wantFiltered: true},
+		{name: "agents without workspace", query: "/api/fleet?workspace=", wantFiltered: true},
+		{name: "workspace token filters by its workspace", scope: "hall-a", query: "/api/fleet", want: "hall-a", wantFiltered: true},
+		{name: "workspace token with its workspace", scope: "hall-a", query: "/api/fleet?workspace=hall-a", want: "hall-a", wantFiltered: true},
+		{name: "workspace token with another workspace", scope: "hall-a", query: "/api/fleet?workspace=hall-b", wantCode: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			workspace, filtered, ok := scopedWorkspace(rw, httptest.NewRequest("GET", tt.query, nil), tt.scope)
+			if tt.wantCode != 0 {
+				if ok || rw.Code != tt.wantCode {
+					t.Errorf("scopedWorkspace() ok = %v with status %d, want refused with %d", ok, rw.Code, tt.wantCode)
+				}
+				return
+			}
+			if !ok || workspace != tt.want || filtered != tt.wantFiltered {
+				t.Errorf("scopedWorkspace() = %q, %v, %v, want %q, %v", workspace, filtered, ok, tt.want, tt.wantFiltered)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// AlertRunbook attaches a runbook link and a suggested action to alerts whose
+// labels match, so volunteer staff know what to do when an alert fires
+type AlertRunbook struct {
+	labelMatcher
+	Runbook string `json:"runbook_url"` // Link to the runbook page
+	Action  string `json:"action"`      // Short suggested first action
+}
+
+// loadRunbooks reads the ordered runbook rules from the JSON file in ALERT_RUNBOOKS
+func loadRunbooks(s *config.Settings) []AlertRunbook {
+	path := s.Get("ALERT_RUNBOOKS")
+	if path == "" {
+		return nil
+	}
+
+	var runbooks []AlertRunbook
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading alert runbooks: %v\n", err)
+		return nil
+	}
+	if err := json.Unmarshal(data, &runbooks); err != nil {
+		fmt.Printf("Error parsing alert runbooks: %v\n", err)
+		return nil
+	}
+
+	for i := range runbooks {
+		runbooks[i].compile()
+	}
+	return runbooks
+}
+
+// runbookFor returns the first runbook rule matching the labels, or nil
+func (w *WiFiMonitor) runbookFor(labels map[string]string) *AlertRunbook {
+	for i := range w.runbooks {
+		if w.runbooks[i].matches(labels) {
+			return &w.runbooks[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// Self-test topology: a veth pair whose peer lives in its own network
+// namespace, so probe traffic really crosses the impaired link. (netem on a
+// dummy interface would never see the replies, which are delivered locally.)
+const (
+	selfTestNamespace = "noc-watch-selftest"
+	selfTestLocal     = "nwself0"
+	selfTestPeer      = "nwself1"
+	selfTestLocalAddr = "10.254.254.1/30"
+	selfTestPeerAddr  = "10.254.254.2"
+)
+
+// selfTestStep is one impairment scenario and the expected detection
+type selfTestStep struct {
+	name  string                                            // Scenario description
+	netem string                                            // tc netem arguments ("" for an unimpaired link)
+	check func(stats probe.PingStats, w *WiFiMonitor) error // Verifies probes, classification and alerts
+}
+
+// runSelfTestCommand implements `noc-watch selftest`: it applies tc netem
+// impairments to a throwaway link and verifies the pipeline reacts as expected
+func runSelfTestCommand(s *config.Settings, args []string) int {
+	if os.Geteuid() != 0 {
+		fmt.Println("Error running self-test: root privileges are required for ip netns and tc")
+		return exitError
+	}
+
+	if err := setupSelfTestLink(); err != nil {
+		fmt.Printf("Error creating self-test link: %v\n", err)
+		teardownSelfTestLink()
+		return exitError
+	}
+	defer teardownSelfTestLink()
+
+	steps := []selfTestStep{
+		{"baseline", "", func(stats probe.PingStats, w *WiFiMonitor) error {
+			if stats.Loss > 0 || stats.Avg > 50*time.Millisecond {
+				return fmt.Errorf("unimpaired link shows loss=%.0f%% avg=%v", stats.Loss, stats.Avg)
+			}
+			return nil
+		}},
+		{"latency 200ms", "delay 200ms", func(stats probe.PingStats, w *WiFiMonitor) error {
+			if stats.Avg < 200*time.Millisecond {
+				return fmt.Errorf("measured avg %v is below the injected 200ms", stats.Avg)
+			}
+			return nil
+		}},
+		{"loss 30%", "loss 30%", func(stats probe.PingStats, w *WiFiMonitor) error {
+			if stats.Loss == 0 {
+				return fmt.Errorf("no loss detected")
+			}
+			return nil
+		}},
+		{"outage", "loss 100%", func(stats probe.PingStats, w *WiFiMonitor) error {
+			if health := w.health(time.Now()); health.Dominant != "ipv4" {
+				return fmt.Errorf("failures classified as %q, expected ipv4", health.Dominant)
+			}
+			if !w.activeAlerts["ping_success_rate_low"] {
+				return fmt.Errorf("ping_success_rate_low did not fire")
+			}
+			return nil
+		}},
+	}
+
+	// A scratch monitor runs the real classification and alert logic
+	w := &WiFiMonitor{
+		wifiInterface: selfTestLocal,
+		headless:      true,
+		activeAlerts:  make(map[string]bool),
+		silences:      &silenceStore{},
+		availability:  newAvailabilityTracker(),
+	}
+
+	failed := 0
+	for _, step := range steps {
+		if err := applyNetem(step.netem); err != nil {
+			fmt.Printf("FAIL %-14s tc: %v\n", step.name, err)
+			failed++
+			continue
+		}
+
+		// Enough samples for the success rate alert to be evaluated
+		var stats probe.PingStats
+		w.pingTests = nil
+		for i := 0; i < w.minRateSamples(); i++ {
+			stats = probe.PingFrom(w.probeContext(), s, selfTestLocal, selfTestPeerAddr, 5)
+			test := WiFiTest{
+				IPv4Connectivity: stats.Loss < 100,
+				Latency:          stats.Avg,
+				Timestamp:        time.Now(),
+			}
+			test.Success = test.IPv4Connectivity && test.Latency > 0
+			w.pingTests = append(w.pingTests, test)
+			w.checkSuccessRateAlerts()
+			if step.netem == "" || !strings.Contains(step.netem, "100%") {
+				break // A single burst is enough to verify measurements
+			}
+		}
+
+		if err := step.check(stats, w); err != nil {
+			fmt.Printf("FAIL %-14s %v\n", step.name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("PASS %-14s loss=%.0f%% avg=%v\n", step.name, stats.Loss, stats.Avg.Round(time.Millisecond))
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d self-test steps failed\n", failed, len(steps))
+		return exitError
+	}
+	fmt.Println("self-test passed")
+	return exitOK
+}
+
+// setupSelfTestLink creates the namespace and veth pair used by the self-test
+func setupSelfTestLink() error {
+	commands := [][]string{
+		{"ip", "netns", "add", selfTestNamespace},
+		{"ip", "link", "add", selfTestLocal, "type", "veth", "peer", "name", selfTestPeer},
+		{"ip", "link", "set", selfTestPeer, "netns", selfTestNamespace},
+		{"ip", "addr", "add", selfTestLocalAddr, "dev", selfTestLocal},
+		{"ip", "link", "set", selfTestLocal, "up"},
+		{"ip", "-n", selfTestNamespace, "addr", "add", selfTestPeerAddr + "/30", "dev", selfTestPeer},
+		{"ip", "-n", selfTestNamespace, "link", "set", selfTestPeer, "up"},
+	}
+	for _, args := range commands {
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// teardownSelfTestLink removes the self-test link; deleting one veth end removes both
+func teardownSelfTestLink() {
+	exec.Command("ip", "link", "del", selfTestLocal).Run()
+	exec.Command("ip", "netns", "del", selfTestNamespace).Run()
+}
+
+// applyNetem replaces the impairment on the self-test link
+func applyNetem(netem string) error {
+	exec.Command("tc", "qdisc", "del", "dev", selfTestLocal, "root").Run()
+	if netem == "" {
+		return nil
+	}
+
+	args := append([]string{"qdisc", "add", "dev", selfTestLocal, "root", "netem"}, strings.Fields(netem)...)
+	if output, err := exec.Command("tc", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSensorOutput limits how much sensor output is stored per cycle
+const maxSensorOutput = 512
+
+// SensorReading is the output of the external sensor hook for one cycle
+type SensorReading struct {
+	Output    string             // Raw output collapsed to one line
+	Values    map[string]float64 // Numeric key=value pairs found in the output
+	Error     string             // Hook failure, if any
+	Timestamp time.Time          // Time the hook ran
+}
+
+// runSensorCommand runs the hook through the shell and parses key=value pairs,
+// e.g. "temp_c=31.5 noise_dbm=-92 busy_pct=41"
+func runSensorCommand(command, iface string, timeout time.Duration) SensorReading {
+	reading := SensorReading{Values: make(map[string]float64), Timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "NOC_WATCH_INTERFACE="+iface)
+	output, err := cmd.Output()
+	if err != nil {
+		reading.Error = err.Error()
+	}
+
+	reading.Output = strings.Join(strings.Fields(string(output)), " ")
+	if len(reading.Output) > maxSensorOutput {
+		reading.Output = reading.Output[:maxSensorOutput]
+	}
+
+	for _, field := range strings.Fields(reading.Output) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		if number, err := strconv.ParseFloat(strings.TrimRight(value, ",;"), 64); err == nil {
+			reading.Values[key] = number
+		}
+	}
+	return reading
+}
+
+// runSensorHook runs SENSOR_COMMAND and keeps its reading for the current cycle
+func (w *WiFiMonitor) runSensorHook() {
+	reading := runSensorCommand(w.settings.Get("SENSOR_COMMAND"), w.wifiInterface,
+		w.settings.Duration("SENSOR_TIMEOUT", 20*time.Second))
+	w.sensor = &reading
+
+	w.setAlert("sensor_hook_failed", reading.Error != "",
+		fmt.Sprintf("Sensor hook failed: %s", reading.Error))
+}
+
+// attachSensor stores the latest sensor output with a test result so
+// environmental factors can be correlated with the measurement
+func (w *WiFiMonitor) attachSensor(test *WiFiTest) {
+	if w.sensor != nil && w.sensor.Error == "" {
+		test.Sensor = w.sensor.Output
+	}
+}
+
+// String formats the reading for the log file
+func (r SensorReading) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("error=%s output=%q", r.Error, r.Output)
+	}
+	return r.Output
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// ServiceCheck is a named reachability check of an internal venue service
+type ServiceCheck struct {
+	Name   string // Display name (e.g., Badge printer)
+	Kind   string // ping, tcp, udp or http
+	Target string // Host, host:port or URL depending on Kind
+}
+
+// ServiceStatus is the latest result of a service check
+type ServiceStatus struct {
+	OK        bool          `json:"success"`         // Service reachable
+	Latency   time.Duration `json:"latency_ns"`      // Check duration
+	Error     string        `json:"error,omitempty"` // Failure reason
+	Timestamp time.Time     `json:"timestamp"`       // Check execution timestamp
+}
+
+// parseServiceChecks parses SERVICE_CHECKS entries of the form
+// name=ping:host, name=tcp:host:port, name=udp:host:port (UDP echo, e.g. a
+// noc-watch reflector) or name=http(s)://url
+func parseServiceChecks(s *config.Settings) []ServiceCheck {
+	var checks []ServiceCheck
+	for _, entry := range s.List("SERVICE_CHECKS") {
+		name, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		check := ServiceCheck{Name: strings.TrimSpace(name)}
+		switch {
+		case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+			check.Kind, check.Target = "http", spec
+		case strings.HasPrefix(spec, "tcp:"):
+			check.Kind, check.Target = "tcp", strings.TrimPrefix(spec, "tcp:")
+		case strings.HasPrefix(spec, "udp:"):
+			check.Kind, check.Target = "udp", strings.TrimPrefix(spec, "udp:")
+		default:
+			check.Kind, check.Target = "ping", strings.TrimPrefix(spec, "ping:")
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// runServiceCheck executes one service check over the monitored interface
+func (w *WiFiMonitor) runServiceCheck(check ServiceCheck) ServiceStatus {
+	status := ServiceStatus{Timestamp: time.Now()}
+	start := time.Now()
+
+	// Templates resolve on every run so the checklist follows the current network
+	target, err := expandTarget(w.settings, w.wifiInterface, check.Target)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	check.Target = target
+
+	switch check.Kind {
+	case "http":
+		resp, elapsed, err := w.httpFetch(check.Target, nil, 10*time.Second)
+		if err != nil {
+			status.Error = err.Error()
+		} else if resp.StatusCode >= 400 {
+			status.Error = resp.Status
+		} else {
+			status.OK = true
+		}
+		status.Latency = elapsed
+	case "tcp":
+		conn, err := w.interfaceDialer(5*time.Second).Dial("tcp", check.Target)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			conn.Close()
+			status.OK = true
+		}
+		status.Latency = time.Since(start)
+	case "udp":
+		if err := w.udpEcho(check.Target, 5*time.Second); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.OK = true
+		}
+		status.Latency = time.Since(start)
+	default:
+		stats := w.pingTarget(check.Target, 1)
+		if stats.Loss >= 100 {
+			status.Error = "no reply"
+		} else {
+			status.OK = true
+		}
+		status.Latency = stats.Avg
+	}
+
+	return status
+}
+
+// udpEcho sends a datagram to a UDP echo service and waits for it to come back
+func (w *WiFiMonitor) udpEcho(target string, timeout time.Duration) error {
+	conn, err := w.interfaceDialer(timeout).Dial("udp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	payload := []byte(fmt.Sprintf("noc-watch %d", time.Now().UnixNano()))
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(payload); err != nil {
+		return err
+	}
+	reply := make([]byte, len(payload)+1)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return err
+	}
+	if string(reply[:n]) != string(payload) {
+		return fmt.Errorf("echo mismatch")
+	}
+	return nil
+}
+
+// runServiceChecks runs the internal service checklist. Quarantined targets
+// are only re-tested on their own schedule and never count towards the rates.
+func (w *WiFiMonitor) runServiceChecks() {
+	for _, check := range w.serviceChecks {
+		if !w.quarantined[check.Name].retestDue(time.Now()) {
+			continue
+		}
+
+		status := w.runServiceCheck(check)
+		w.serviceStatus[check.Name] = status
+		w.recordServiceHistory(check.Name, status)
+		w.countProbeFailure("service", !status.OK)
+		w.writeJSONL("service", struct {
+			Name string `json:"name"` // Service check name
+			ServiceStatus
+		}{check.Name, status})
+		w.setAlert("service_down_"+check.Name, !status.OK,
+			fmt.Sprintf("%s (%s %s) unreachable: %s", check.Name, check.Kind, check.Target, status.Error))
+		if !w.updateQuarantine(check, status) {
+			continue
+		}
+
+		rate, ok := w.serviceRates[check.Name]
+		if !ok {
+			rate = &rateEstimate{}
+			w.serviceRates[check.Name] = rate
+		}
+		rate.total++
+		if status.OK {
+			rate.successes++
+		}
+	}
+}
+
+// serviceChecklistText renders the green/red checklist for the service-desk panel
+func (w *WiFiMonitor) serviceChecklistText() string {
+	text := "[yellow]Internal Services:[white]\n\n"
+	for _, check := range w.serviceChecks {
+		status, ok := w.serviceStatus[check.Name]
+		switch {
+		case w.quarantined[check.Name] != nil:
+			text += fmt.Sprintf("  [gray]-[white] %s [gray](quarantined)[white]\n", check.Name)
+		case !ok:
+			text += fmt.Sprintf("  [yellow]?[white] %s\n", check.Name)
+		case status.OK:
+			text += fmt.Sprintf("  [green]o[white] %s [gray](%v)[white]\n", check.Name, status.Latency.Round(time.Millisecond))
+		default:
+			text += fmt.Sprintf("  [red]x[white] %s [gray](%s)[white]\n", check.Name, status.Error)
+		}
+	}
+	return text
+}
@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// runVerifyLogCommand implements `noc-watch verify-log --pub KEY LOGFILE`
+func runVerifyLogCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("verify-log", flag.ContinueOnError)
+	pubPath := fs.String("pub", "signing-key.pem.pub", "Ed25519 public key of the agent")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	logFile := s.String("LOG_FILE", "noc-watch.log")
+	if fs.NArg() > 0 {
+		logFile = fs.Arg(0)
+	}
+
+	pub, err := storage.LoadVerifyKey(*pubPath)
+	if err != nil {
+		fmt.Printf("Error loading public key: %v\n", err)
+		return exitError
+	}
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		fmt.Printf("Error reading log file: %v\n", err)
+		return exitError
+	}
+
+	verified, err := storage.VerifyLog(content, pub)
+	if err != nil {
+		fmt.Printf("FAILED after %d verified blocks: %v\n", verified, err)
+		return exitError
+	}
+	fmt.Printf("OK: %d signed blocks verified\n", verified)
+	return exitOK
+}
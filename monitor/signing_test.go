@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// signedLogBlocks writes unsigned blocks and then signed blocks through
+// appendLogBlock, and returns the blocks of the log file with their footers
+func signedLogBlocks(t *testing.T, unsigned, signed int) ([]string, ed25519.PublicKey) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "signing-key.pem")
+	if err := storage.GenerateSigningKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := storage.LoadVerifyKey(keyPath + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WiFiMonitor{logFile: filepath.Join(dir, "wifi_monitor.log")}
+	for i := 0; i < unsigned+signed; i++ {
+		if i == unsigned {
+			w.signer = storage.NewResultSigner(config.New(map[string]string{"SIGNING_KEY": keyPath}), w.logFile)
+		}
+		block := bytes.NewBufferString(fmt.Sprintf("Timestamp: 2026-10-16 10:%02d:00\nPing: 12.3 ms\n", i))
+		if err := w.appendLogBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(w.logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := strings.SplitAfter(string(content), storage.LogFooter+"\n")
+	return blocks[:len(blocks)-1], pub
+}
+
+func TestVerifyLog(t *testing.T) {
+	otherKey := filepath.Join(t.TempDir(), "other-key.pem")
+	if err := storage.GenerateSigningKey(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := storage.LoadVerifyKey(otherKey + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		unsigned int
+		tamper   func(blocks []string) []string
+		wrongKey bool
+		want     int
+		wantErr  bool
+	}{
+		{name: "signed", want: 4},
+		{name: "unsigned blocks before signing was enabled", unsigned: 2, want: 4},
+		{name: "empty log", tamper: func([]string) []string { return nil }},
+		{
+			name: "edited block",
+			tamper: func(blocks []string) []string {
+				blocks[2] = strings.Replace(blocks[2], "12.3 ms", "1.2 ms", 1)
+				return blocks
+			},
+			want:    2,
+			wantErr: true,
+		},
+		{
+			name: "unsigned lines inserted into a block",
+			tamper: func(blocks []string) []string {
+				blocks[1] = "Note: all clear\n" + blocks[1]
+				return blocks
+			},
+			want:    1,
+			wantErr: true,
+		},
+		{
+			name: "unsigned block inserted between signed blocks",
+			tamper: func(blocks []string) []string {
+				forged := "Timestamp: 2026-10-16 10:01:30\nPing: 1.0 ms\n" + storage.LogFooter + "\n"
+				return append(blocks[:2], append([]string{forged}, blocks[2:]...)...)
+			},
+			want:    2,
+			wantErr: true,
+		},
+		{
+			name: "unsigned block appended",
+			tamper: func(blocks []string) []string {
+				return append(blocks, "Timestamp: 2026-10-16 11:00:00\nPing: 1.0 ms\n"+storage.LogFooter+"\n")
+			},
+			want:    4,
+			wantErr: true,
+		},
+		{
+			name: "signature moved off the end of its block",
+			tamper: func(blocks []string) []string {
+				blocks[3] = strings.Replace(blocks[3], storage.LogFooter, "Note: all clear\n"+storage.LogFooter, 1)
+				return blocks
+			},
+			want:    4,
+			wantErr: true,
+		},
+		{
+			name: "deleted block",
+			tamper: func(blocks []string) []string {
+				return append(blocks[:1], blocks[2:]...)
+			},
+			want:    1,
+			wantErr: true,
+		},
+		{
+			name: "reordered blocks",
+			tamper: func(blocks []string) []string {
+				blocks[1], blocks[2] = blocks[2], blocks[1]
+				return blocks
+			},
+			want:    1,
+			wantErr: true,
+		},
+		{
+			name: "truncated inside a block",
+			tamper: func(blocks []string) []string {
+				blocks[3] = blocks[3][:20]
+				return blocks
+			},
+			want:    3,
+			wantErr: true,
+		},
+		{
+			name: "truncated before the footer",
+			tamper: func(blocks []string) []string {
+				blocks[3] = strings.TrimSuffix(blocks[3], storage.LogFooter+"\n")
+				return blocks
+			},
+			want:    4,
+			wantErr: true,
+		},
+		{name: "wrong key", wrongKey: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, pub := signedLogBlocks(t, tt.unsigned, 4)
+			if tt.tamper != nil {
+				blocks = tt.tamper(blocks[tt.unsigned:])
+			}
+			if tt.wrongKey {
+				pub = otherPub
+			}
+
+			got, err := storage.VerifyLog([]byte(strings.Join(blocks, "")), pub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyLog() = %d verified blocks, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultSignerResumesChain(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "signing-key.pem")
+	if err := storage.GenerateSigningKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := storage.LoadVerifyKey(keyPath + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := config.New(map[string]string{"SIGNING_KEY": keyPath})
+
+	w := &WiFiMonitor{logFile: filepath.Join(dir, "wifi_monitor.log")}
+	for run := 0; run < 3; run++ {
+		// Every run of the agent starts a new signer from the log file
+		w.signer = storage.NewResultSigner(s, w.logFile)
+		if err := w.appendLogBlock(bytes.NewBufferString(fmt.Sprintf("Run: %d\n", run))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(w.logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.VerifyLog(content, pub); err != nil || got != 3 {
+		t.Errorf("VerifyLog() = %d, %v, want 3 verified blocks", got, err)
+	}
+}
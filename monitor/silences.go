@@ -0,0 +1,413 @@
+package monitor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marokiki/noc-watch/client"
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Silence mutes notifications for alerts matching a label set until it ends.
+// Silenced alerts are still evaluated and logged.
+type Silence struct {
+	ID       string            `json:"id"`       // Short random identifier
+	Matchers map[string]string `json:"matchers"` // Labels that must be equal for the silence to apply
+	Start    time.Time         `json:"start"`    // Creation time
+	End      time.Time         `json:"end"`      // Expiry time
+	Reason   string            `json:"reason"`   // Why the alerts are muted (e.g., incident reference)
+	Author   string            `json:"author"`   // Who created the silence
+}
+
+// silenceRequest creates a silence through the control socket or POST
+// /api/silences
+type silenceRequest struct {
+	Matchers map[string]string `json:"matchers"`         // Labels that must be equal for the silence to apply
+	For      string            `json:"for"`              // How long the silence lasts (e.g. 2h)
+	Reason   string            `json:"reason"`           // Why the alerts are muted
+	Author   string            `json:"author,omitempty"` // Who creates the silence
+}
+
+// silenceStore holds silences in a JSON file shared by the monitor, the TUI
+// and the `silence` command
+type silenceStore struct {
+	mu       sync.Mutex // Guards silences; the TUI adds silences from its own goroutine
+	path     string     // JSON file path
+	silences []Silence  // Loaded silences, including expired ones
+}
+
+// silenceFile returns the silence file path from SILENCE_FILE, defaulting to
+// a file next to the log file
+func silenceFile(s *config.Settings) string {
+	logFile := s.String("LOG_FILE", "noc-watch.log")
+	return s.String("SILENCE_FILE", filepath.Join(filepath.Dir(logFile), "noc-watch-silences.json"))
+}
+
+// newSilenceStore opens the silence file at path
+func newSilenceStore(path string) *silenceStore {
+	s := &silenceStore{path: path}
+	if err := s.reload(); err != nil {
+		fmt.Printf("Error loading silences: %v\n", err)
+	}
+	return s
+}
+
+// reload reads the silence file, picking up changes made by the CLI
+func (s *silenceStore) reload() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var silences []Silence
+	if err := json.Unmarshal(data, &silences); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.silences = silences
+	s.mu.Unlock()
+	return nil
+}
+
+// update reloads the file, applies change to the silences and saves the result
+func (s *silenceStore) update(change func([]Silence) ([]Silence, error)) error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silences, err := change(s.silences)
+	if err != nil {
+		return err
+	}
+
+	// Drop silences that expired more than a day ago
+	var kept []Silence
+	for _, silence := range silences {
+		if time.Since(silence.End) < 24*time.Hour {
+			kept = append(kept, silence)
+		}
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	s.silences = kept
+	return nil
+}
+
+// add stores a new silence and returns it with its ID
+func (s *silenceStore) add(matchers map[string]string, duration time.Duration, reason, author string) (Silence, error) {
+	if len(matchers) == 0 {
+		return Silence{}, errors.New("a silence needs at least one label matcher")
+	}
+
+	id := make([]byte, 4)
+	rand.Read(id)
+	now := time.Now()
+	silence := Silence{
+		ID:       hex.EncodeToString(id),
+		Matchers: matchers,
+		Start:    now,
+		End:      now.Add(duration),
+		Reason:   reason,
+		Author:   author,
+	}
+
+	err := s.update(func(silences []Silence) ([]Silence, error) {
+		return append(silences, silence), nil
+	})
+	return silence, err
+}
+
+// expire ends a silence immediately
+func (s *silenceStore) expire(id string) error {
+	return s.update(func(silences []Silence) ([]Silence, error) {
+		for i := range silences {
+			if silences[i].ID == id {
+				silences[i].End = time.Now()
+				return silences, nil
+			}
+		}
+		return nil, fmt.Errorf("silence %s not found", id)
+	})
+}
+
+// active returns the silences in effect at now
+func (s *silenceStore) active(now time.Time) []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active []Silence
+	for _, silence := range s.silences {
+		if !now.Before(silence.Start) && now.Before(silence.End) {
+			active = append(active, silence)
+		}
+	}
+	return active
+}
+
+// match returns the active silence covering an alert's labels, if any
+func (s *silenceStore) match(labels map[string]string, now time.Time) *Silence {
+	for _, silence := range s.active(now) {
+		matched := true
+		for label, value := range silence.Matchers {
+			if labels[label] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &silence
+		}
+	}
+	return nil
+}
+
+// handleCommand answers `silence list`, `silence add REQUEST` (a JSON
+// silenceRequest) and `silence expire ID`. The monitor runs it on the
+// monitoring loop, so a change applies to the next alert at once; the
+// `silence` command runs it on the file while no monitor is running.
+func (s *silenceStore) handleCommand(arg string) string {
+	action, rest, _ := strings.Cut(arg, " ")
+	var response any
+	switch action {
+	case "list":
+		response = append([]Silence{}, s.active(time.Now())...)
+	case "add":
+		var req silenceRequest
+		if err := json.Unmarshal([]byte(rest), &req); err != nil {
+			return fmt.Sprintf("error: invalid silence: %v\n", err)
+		}
+		duration, err := time.ParseDuration(req.For)
+		if err != nil || duration <= 0 {
+			return fmt.Sprintf("error: invalid duration %q\n", req.For)
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			return "error: a reason is required\n"
+		}
+		silence, err := s.add(req.Matchers, duration, req.Reason, req.Author)
+		if err != nil {
+			return fmt.Sprintf("error: %v\n", err)
+		}
+		response = silence
+	case "expire":
+		id := strings.TrimSpace(rest)
+		if err := s.expire(id); err != nil {
+			return fmt.Sprintf("error: %v\n", err)
+		}
+		return fmt.Sprintf("silence %s expired\n", id)
+	default:
+		return fmt.Sprintf("error: unknown silence action %q\n", action)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Sprintf("error: %v\n", err)
+	}
+	return string(data) + "\n"
+}
+
+// silenceRequestMaxSize caps the body of POST /api/silences
+const silenceRequestMaxSize = 64 << 10
+
+// serveSilences implements /api/silences: GET lists the active silences,
+// POST adds the silenceRequest of the body and DELETE /api/silences/ID
+// expires one. Changes are writes, so beyond localhost they need API_TOKEN
+// or a client certificate.
+func (w *WiFiMonitor) serveSilences(rw http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/silences"), "/")
+	if r.Method == http.MethodGet && id == "" {
+		if !apiAllowed(w.settings, rw, r, false) {
+			return
+		}
+		w.answerSilences(rw, r, "silence list", http.StatusOK)
+		return
+	}
+
+	if !apiWriteAuthorized(w.settings, r) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		var req silenceRequest
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, silenceRequestMaxSize)).Decode(&req); err != nil {
+			writeAPIError(rw, http.StatusBadRequest, fmt.Sprintf("invalid silence: %v", err))
+			return
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			writeAPIError(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.answerSilences(rw, r, "silence add "+string(data), http.StatusCreated)
+	case r.Method == http.MethodDelete && id != "" && !strings.ContainsAny(id, " /"):
+		w.answerSilences(rw, r, "silence expire "+id, http.StatusNoContent)
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// answerSilences runs a silence command on the monitoring loop and writes
+// its JSON response with code, or the error it returned
+func (w *WiFiMonitor) answerSilences(rw http.ResponseWriter, r *http.Request, command string, code int) {
+	response, ok := w.queryMonitor(rw, r, command)
+	if !ok {
+		return
+	}
+	if message, failed := strings.CutPrefix(response, "error: "); failed {
+		message = strings.TrimSpace(message)
+		if strings.HasSuffix(message, "not found") {
+			writeAPIError(rw, http.StatusNotFound, message)
+		} else {
+			writeAPIError(rw, http.StatusBadRequest, message)
+		}
+		return
+	}
+	if code == http.StatusNoContent {
+		rw.WriteHeader(code)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	rw.Write([]byte(response))
+}
+
+// parseMatchers parses label=value arguments into a matcher set
+func parseMatchers(args []string) (map[string]string, error) {
+	matchers := make(map[string]string)
+	for _, arg := range args {
+		label, value, ok := strings.Cut(arg, "=")
+		if !ok || label == "" {
+			return nil, fmt.Errorf("invalid matcher %q (expected label=value)", arg)
+		}
+		matchers[strings.TrimSpace(label)] = strings.TrimSpace(value)
+	}
+	return matchers, nil
+}
+
+// String formats the silence for the UI and the `silence list` command
+func (s Silence) String() string {
+	var matchers []string
+	for label, value := range s.Matchers {
+		matchers = append(matchers, label+"="+value)
+	}
+	sort.Strings(matchers)
+	return fmt.Sprintf("%s %s until %s by %s: %s", s.ID, strings.Join(matchers, ","),
+		s.End.Format("2006-01-02 15:04"), s.Author, s.Reason)
+}
+
+// runSilenceCommand implements `noc-watch silence add|list|expire`. A
+// running monitor makes the change itself through the control socket; the
+// silence file is only edited directly while no monitor is listening.
+func runSilenceCommand(s *config.Settings, args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch silence add --for 2h --reason TEXT [--author NAME] label=value...")
+		fmt.Fprintln(os.Stderr, "       noc-watch silence list [--json]")
+		fmt.Fprintln(os.Stderr, "       noc-watch silence expire ID")
+		return exitUsage
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	var command string
+	asJSON := false
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("silence add", flag.ContinueOnError)
+		duration := fs.Duration("for", time.Hour, "how long the silence lasts")
+		reason := fs.String("reason", "", "why the alerts are muted")
+		author := fs.String("author", os.Getenv("USER"), "who creates the silence")
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitUsage
+		}
+		matchers, err := parseMatchers(fs.Args())
+		if err != nil || *reason == "" || *duration <= 0 {
+			return usage()
+		}
+		req, err := json.Marshal(silenceRequest{Matchers: matchers, For: duration.String(), Reason: *reason, Author: *author})
+		if err != nil {
+			fmt.Printf("Error adding silence: %v\n", err)
+			return exitError
+		}
+		command = "silence add " + string(req)
+
+	case "list":
+		fs := flag.NewFlagSet("silence list", flag.ContinueOnError)
+		fs.BoolVar(&asJSON, "json", false, "print silences as JSON")
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitUsage
+		}
+		command = "silence list"
+
+	case "expire":
+		if len(args) != 2 {
+			return usage()
+		}
+		command = "silence expire " + args[1]
+
+	default:
+		return usage()
+	}
+
+	response, err := sendControl(s, command)
+	if errors.Is(err, client.ErrUnreachable) {
+		response = newSilenceStore(silenceFile(s)).handleCommand(strings.TrimPrefix(command, "silence "))
+		if message, failed := strings.CutPrefix(response, "error: "); failed {
+			err = errors.New(strings.TrimSpace(message))
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error running silence %s: %v\n", args[0], err)
+		return exitError
+	}
+
+	switch args[0] {
+	case "add":
+		var silence Silence
+		if err := json.Unmarshal([]byte(response), &silence); err != nil {
+			fmt.Printf("Error adding silence: %v\n", err)
+			return exitError
+		}
+		fmt.Println(silence.ID)
+	case "list":
+		if asJSON {
+			fmt.Print(response)
+			return exitOK
+		}
+		var silences []Silence
+		if err := json.Unmarshal([]byte(response), &silences); err != nil {
+			fmt.Printf("Error listing silences: %v\n", err)
+			return exitError
+		}
+		for _, silence := range silences {
+			fmt.Println(silence)
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSilenceStoreHandleCommand(t *testing.T) {
+	store := newSilenceStore(filepath.Join(t.TempDir(), "silences.json"))
+
+	response := store.handleCommand(`add {"matchers":{"room":"Hall A"},"for":"2h","reason":"AP reboot","author":"alice"}`)
+	var added Silence
+	if err := json.Unmarshal([]byte(response), &added); err != nil || added.ID == "" {
+		t.Fatalf("add = %q, want the new silence", response)
+	}
+	if store.match(map[string]string{"room": "Hall A", "alertname": "ping_loss"}, added.Start) == nil {
+		t.Errorf("added silence does not match its labels")
+	}
+
+	var listed []Silence
+	if err := json.Unmarshal([]byte(store.handleCommand("list")), &listed); err != nil || len(listed) != 1 || listed[0].ID != added.ID {
+		t.Errorf("list = %v (%v), want the added silence", listed, err)
+	}
+
+	// A store reading the same file sees the silence, like a restarted monitor
+	if active := newSilenceStore(store.path).active(added.Start); len(active) != 1 {
+		t.Errorf("reloaded store has %d active silences, want 1", len(active))
+	}
+
+	if response := store.handleCommand("expire " + added.ID); response != "silence "+added.ID+" expired\n" {
+		t.Errorf("expire = %q", response)
+	}
+	if response := store.handleCommand("list"); response != "[]\n" {
+		t.Errorf("list after expire = %q, want []", response)
+	}
+
+	failures := []struct {
+		name    string
+		command string
+	}{
+		{name: "unknown silence", command: "expire 00000000"},
+		{name: "no matchers", command: `add {"for":"1h","reason":"test"}`},
+		{name: "invalid duration", command: `add {"matchers":{"room":"Hall A"},"for":"soon","reason":"test"}`},
+		{name: "negative duration", command: `add {"matchers":{"room":"Hall A"},"for":"-1h","reason":"test"}`},
+		{name: "no reason", command: `add {"matchers":{"room":"Hall A"},"for":"1h"}`},
+		{name: "invalid JSON", command: `add {"matchers":`},
+		{name: "unknown action", command: "mute"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if response := store.handleCommand(tt.command); !strings.HasPrefix(response, "error: ") {
+				t.Errorf("handleCommand(%q) = %q, want an error", tt.command, response)
+			}
+		})
+	}
+}
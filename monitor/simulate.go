@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// simulationPatterns maps a degradation pattern to the probability that the
+// test at elapsed time t (of total) fails
+var simulationPatterns = map[string]func(t, total time.Duration) float64{
+	// Slow ramp: failure probability rises linearly to 60%
+	"ramp": func(t, total time.Duration) float64 {
+		return 0.6 * float64(t) / float64(total)
+	},
+	// Flap: five minutes up, five minutes down
+	"flap": func(t, total time.Duration) float64 {
+		if (t/(5*time.Minute))%2 == 1 {
+			return 1
+		}
+		return 0
+	},
+	// Micro-outages: one failed minute every 30 minutes
+	"micro-outage": func(t, total time.Duration) float64 {
+		if t%(30*time.Minute) == 29*time.Minute {
+			return 1
+		}
+		return 0
+	},
+}
+
+// SimulationReport summarizes how the pipeline reacted to one pattern
+type SimulationReport struct {
+	Pattern      string   `json:"pattern"`      // Degradation pattern name
+	Tests        int      `json:"tests"`        // Synthetic tests fed through the pipeline
+	Availability float64  `json:"availability"` // Time-weighted availability in percent
+	Health       string   `json:"health"`       // Health score at the end of the run
+	Alerts       []string `json:"alerts"`       // Alert transitions with their simulated offset
+}
+
+// simulate feeds synthetic tests for a pattern through the real availability,
+// health and alert logic using simulated time, so hours run in milliseconds
+func simulate(pattern string, duration time.Duration, seed int64) SimulationReport {
+	failureProbability := simulationPatterns[pattern]
+	rng := rand.New(rand.NewSource(seed))
+	start := time.Now().Truncate(time.Minute)
+
+	w := &WiFiMonitor{
+		activeAlerts: make(map[string]bool),
+		silences:     &silenceStore{},
+		availability: availabilityTracker{start: start},
+	}
+	report := SimulationReport{Pattern: pattern, Alerts: []string{}}
+
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += time.Minute {
+		now := start.Add(elapsed)
+		up := rng.Float64() >= failureProbability(elapsed, duration)
+
+		test := WiFiTest{IPv4Connectivity: up, IPv6Connectivity: up, Success: up, Timestamp: now}
+		if up {
+			test.Latency = time.Duration(10+rng.Intn(20)) * time.Millisecond
+		}
+		w.pingTests = append(w.pingTests, test)
+
+		// DHCP renewals run every five minutes like the monitoring loop
+		if elapsed%(5*time.Minute) == 0 {
+			dhcp := test
+			dhcp.DHCPRenewTime = 800 * time.Millisecond
+			w.dhcpTests = append(w.dhcpTests, dhcp)
+		}
+
+		w.availability.mark(now, up)
+		w.checkSuccessRateAlerts()
+		report.Tests++
+
+		// Alerts are stamped with wall-clock time; report the simulated offset instead
+		for _, alert := range w.pendingAlerts {
+			state := "ALERT"
+			if alert.Resolved {
+				state = "RESOLVED"
+			}
+			report.Alerts = append(report.Alerts, fmt.Sprintf("T+%s %s %s: %s",
+				formatOffset(elapsed), state, alert.Name, alert.Message))
+		}
+		w.pendingAlerts = nil
+	}
+
+	end := start.Add(duration)
+	report.Availability, _ = w.availability.percent(end)
+	report.Health = w.health(end).String()
+	return report
+}
+
+// formatOffset formats a simulated offset as hh:mm
+func formatOffset(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// runSimulateCommand implements `noc-watch simulate`
+func runSimulateCommand(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	pattern := fs.String("pattern", "all", "ramp, flap, micro-outage or all")
+	duration := fs.Duration("duration", 6*time.Hour, "simulated period")
+	seed := fs.Int64("seed", 1, "random seed, so runs are reproducible while thresholds are tuned")
+	asJSON := fs.Bool("json", false, "print reports as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	patterns := []string{*pattern}
+	if *pattern == "all" {
+		patterns = []string{"ramp", "flap", "micro-outage"}
+	}
+
+	var reports []SimulationReport
+	for _, name := range patterns {
+		if simulationPatterns[name] == nil {
+			fmt.Fprintf(os.Stderr, "unknown pattern %q (available: ramp, flap, micro-outage, all)\n", name)
+			return exitUsage
+		}
+		reports = append(reports, simulate(name, *duration, *seed))
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(reports)
+		return exitOK
+	}
+
+	for _, report := range reports {
+		fmt.Printf("=== %s (%d tests) ===\n", report.Pattern, report.Tests)
+		fmt.Printf("Availability: %.3f%%, Health: %s\n", report.Availability, report.Health)
+		if len(report.Alerts) == 0 {
+			fmt.Println("no alerts fired")
+		}
+		for _, alert := range report.Alerts {
+			fmt.Println(alert)
+		}
+		fmt.Println()
+	}
+	return exitOK
+}
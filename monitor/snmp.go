@@ -0,0 +1,164 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/marokiki/noc-watch/config"
+)
+
+// SNMP OIDs polled on upstream devices
+const (
+	oidIfHCInOctets    = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets   = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfInErrors      = ".1.3.6.1.2.1.2.2.1.14"
+	oidIfOutErrors     = ".1.3.6.1.2.1.2.2.1.20"
+	oidHrProcessorLoad = ".1.3.6.1.2.1.25.3.3.1.2"
+)
+
+// SNMPTarget is an upstream device interface polled via SNMP
+type SNMPTarget struct {
+	Name    string // Display name (e.g., core-sw)
+	Host    string // Device address (host or host:port)
+	IfIndex int    // Uplink interface index
+}
+
+// SNMPSample holds interface counters and CPU load of one poll
+type SNMPSample struct {
+	Target    SNMPTarget // Polled device
+	InOctets  uint64     // ifHCInOctets counter
+	OutOctets uint64     // ifHCOutOctets counter
+	InErrors  uint64     // ifInErrors counter
+	OutErrors uint64     // ifOutErrors counter
+	InBps     float64    // Inbound rate since previous poll (bits/s)
+	OutBps    float64    // Outbound rate since previous poll (bits/s)
+	NewErrors uint64     // Errors since previous poll
+	CPU       float64    // Average hrProcessorLoad (-1 if unavailable)
+	Error     string     // Poll error, if any
+	Timestamp time.Time  // Poll time
+}
+
+// parseSNMPTargets parses SNMP_TARGETS entries of the form name=host/ifIndex
+func parseSNMPTargets(s *config.Settings) []SNMPTarget {
+	var targets []SNMPTarget
+	for _, entry := range s.List("SNMP_TARGETS") {
+		name, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, rest = entry, entry
+		}
+		host, index, _ := strings.Cut(rest, "/")
+		ifIndex, err := strconv.Atoi(index)
+		if err != nil {
+			ifIndex = 1
+		}
+		targets = append(targets, SNMPTarget{Name: name, Host: host, IfIndex: ifIndex})
+	}
+	return targets
+}
+
+// pollSNMP reads the uplink counters and CPU load of a device
+func pollSNMP(target SNMPTarget, community string) SNMPSample {
+	sample := SNMPSample{Target: target, CPU: -1, Timestamp: time.Now()}
+
+	host, port := target.Host, uint16(161)
+	if h, p, err := net.SplitHostPort(target.Host); err == nil {
+		if n, err := strconv.Atoi(p); err == nil {
+			host, port = h, uint16(n)
+		}
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      port,
+		Community: community,
+		Version:   gosnmp.Version2c,
+		Timeout:   5 * time.Second,
+		Retries:   1,
+	}
+	if err := client.Connect(); err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	defer client.Conn.Close()
+
+	suffix := "." + strconv.Itoa(target.IfIndex)
+	result, err := client.Get([]string{
+		oidIfHCInOctets + suffix,
+		oidIfHCOutOctets + suffix,
+		oidIfInErrors + suffix,
+		oidIfOutErrors + suffix,
+	})
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+
+	for _, v := range result.Variables {
+		value := gosnmp.ToBigInt(v.Value).Uint64()
+		switch strings.TrimSuffix(v.Name, suffix) {
+		case oidIfHCInOctets:
+			sample.InOctets = value
+		case oidIfHCOutOctets:
+			sample.OutOctets = value
+		case oidIfInErrors:
+			sample.InErrors = value
+		case oidIfOutErrors:
+			sample.OutErrors = value
+		}
+	}
+
+	// CPU is averaged over all processors in HOST-RESOURCES-MIB
+	if loads, err := client.BulkWalkAll(oidHrProcessorLoad); err == nil && len(loads) > 0 {
+		var total float64
+		for _, v := range loads {
+			total += float64(gosnmp.ToBigInt(v.Value).Int64())
+		}
+		sample.CPU = total / float64(len(loads))
+	}
+
+	return sample
+}
+
+// runSNMPPoll polls every configured upstream device and derives rates from the previous poll
+func (w *WiFiMonitor) runSNMPPoll() {
+	community := w.settings.String("SNMP_COMMUNITY", "public")
+
+	for _, target := range w.snmpTargets {
+		sample := pollSNMP(target, community)
+
+		if prev, ok := w.snmpSamples[target.Name]; ok && prev.Error == "" && sample.Error == "" {
+			elapsed := sample.Timestamp.Sub(prev.Timestamp).Seconds()
+			if elapsed > 0 && sample.InOctets >= prev.InOctets && sample.OutOctets >= prev.OutOctets {
+				sample.InBps = float64(sample.InOctets-prev.InOctets) * 8 / elapsed
+				sample.OutBps = float64(sample.OutOctets-prev.OutOctets) * 8 / elapsed
+			}
+			if errs := sample.InErrors + sample.OutErrors; errs >= prev.InErrors+prev.OutErrors {
+				sample.NewErrors = errs - prev.InErrors - prev.OutErrors
+			}
+		}
+
+		w.snmpSamples[target.Name] = sample
+
+		w.setAlert("snmp_unreachable_"+target.Name, sample.Error != "",
+			fmt.Sprintf("SNMP poll of %s (%s) failed: %s", target.Name, target.Host, sample.Error))
+	}
+}
+
+// String formats the sample for the log timeline
+func (s SNMPSample) String() string {
+	if s.Error != "" {
+		return fmt.Sprintf("%s: error=%s", s.Target.Name, s.Error)
+	}
+
+	cpu := "-"
+	if s.CPU >= 0 {
+		cpu = fmt.Sprintf("%.0f%%", s.CPU)
+	}
+
+	return fmt.Sprintf("%s if%d: in=%.2fMbps out=%.2fMbps errors=+%d cpu=%s",
+		s.Target.Name, s.Target.IfIndex, s.InBps/1e6, s.OutBps/1e6, s.NewErrors, cpu)
+}
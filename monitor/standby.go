@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// heartbeatPrefix starts every heartbeat datagram
+const heartbeatPrefix = "noc-watch-heartbeat"
+
+// HAPair is this agent's side of an active/standby pair. The active agent
+// sends heartbeats to the standby; the standby probes lightly and promotes
+// itself to full probing when the heartbeats stop.
+type HAPair struct {
+	role          string        // Configured role: active or standby
+	peer          string        // Standby address heartbeats are sent to (active only)
+	listen        string        // Address heartbeats are received on (standby only)
+	timeout       time.Duration // Missing heartbeats for this long promote the standby
+	secret        string        // Optional shared secret authenticating heartbeats
+	instance      string        // Name sent in heartbeats
+	promoted      bool          // Standby has taken over full probing
+	lastHeartbeat time.Time     // Last valid heartbeat from the active agent
+	lastPeer      string        // Instance name of the last heartbeat
+}
+
+// NewHAPair reads HA_ROLE and friends. It returns nil when HA is not configured.
+func NewHAPair(s *config.Settings) *HAPair {
+	role := s.Get("HA_ROLE")
+	if role != "active" && role != "standby" {
+		if role != "" {
+			fmt.Printf("Error: HA_ROLE must be active or standby, got %q\n", role)
+		}
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	return &HAPair{
+		role:          role,
+		peer:          s.Get("HA_PEER"),
+		listen:        s.String("HA_LISTEN", ":7946"),
+		timeout:       s.Duration("HA_TIMEOUT", 30*time.Second),
+		secret:        s.Get("HA_SECRET"),
+		instance:      hostname,
+		lastHeartbeat: time.Now(), // Grace period before the first heartbeat is due
+	}
+}
+
+// passive reports whether this agent is a standby that has not taken over
+func (h *HAPair) passive() bool {
+	return h != nil && h.role == "standby" && !h.promoted
+}
+
+// signature authenticates a heartbeat payload with the shared secret
+func (h *HAPair) signature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(h.secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendHeartbeat tells the standby that the active agent is alive. It runs as
+// an auxiliary check, so a stuck monitoring loop also stops the heartbeats.
+func (w *WiFiMonitor) sendHeartbeat() {
+	h := w.ha
+	payload := fmt.Sprintf("%s %s %d", heartbeatPrefix, h.instance, time.Now().UnixNano())
+	if h.secret != "" {
+		payload += " " + h.signature(payload)
+	}
+
+	conn, err := net.Dial("udp", h.peer)
+	if err != nil {
+		fmt.Printf("Error sending heartbeat: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(payload))
+}
+
+// parseHeartbeat validates a heartbeat datagram and returns the sender's instance name
+func (h *HAPair) parseHeartbeat(data string, now time.Time) (string, bool) {
+	fields := strings.Fields(data)
+	if len(fields) < 3 || fields[0] != heartbeatPrefix {
+		return "", false
+	}
+
+	if h.secret != "" {
+		if len(fields) != 4 || !hmac.Equal([]byte(fields[3]), []byte(h.signature(strings.Join(fields[:3], " ")))) {
+			return "", false
+		}
+		// Signed heartbeats also carry a fresh timestamp so recordings cannot be replayed
+		sent, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || now.Sub(time.Unix(0, sent)).Abs() > h.timeout {
+			return "", false
+		}
+	}
+	return fields[1], true
+}
+
+// startHAListener receives heartbeats on the standby and forwards them to
+// the monitoring loop. It returns a function closing the listener.
+func (w *WiFiMonitor) startHAListener() func() {
+	conn, err := net.ListenPacket("udp", w.ha.listen)
+	if err != nil {
+		fmt.Printf("Error listening for heartbeats: %v\n", err)
+		return func() {}
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case w.heartbeats <- string(buf[:n]):
+			default: // The loop is busy; the next heartbeat will do
+			}
+		}
+	}()
+	return func() { conn.Close() }
+}
+
+// receiveHeartbeat records a heartbeat on the monitoring goroutine
+func (w *WiFiMonitor) receiveHeartbeat(data string) {
+	now := time.Now()
+	if instance, ok := w.ha.parseHeartbeat(data, now); ok {
+		w.ha.lastHeartbeat = now
+		w.ha.lastPeer = instance
+	}
+}
+
+// updateHARole promotes the standby when heartbeats stop and hands probing
+// back when they resume. It reports whether the probing mode changed.
+func (w *WiFiMonitor) updateHARole(now time.Time) bool {
+	h := w.ha
+	if h == nil || h.role != "standby" {
+		return false
+	}
+
+	silent := now.Sub(h.lastHeartbeat)
+	switch {
+	case !h.promoted && silent > h.timeout:
+		h.promoted = true
+		w.notifyEvent("standby_promoted", fmt.Sprintf("No heartbeat from the active agent for %v; taking over full probing",
+			silent.Round(time.Second)))
+		return true
+	case h.promoted && silent <= h.timeout:
+		h.promoted = false
+		w.notifyEvent("standby_demoted", fmt.Sprintf("Heartbeats from %s resumed; returning to passive monitoring", h.lastPeer))
+		return true
+	}
+	return false
+}
+
+// pingInterval returns the connectivity test interval for the current role and profile
+func (w *WiFiMonitor) pingInterval() time.Duration {
+	if w.ha.passive() {
+		return w.settings.Duration("STANDBY_PING_INTERVAL", 5*time.Minute)
+	}
+	return w.stretched(w.profile.PingInterval)
+}
+
+// String formats the HA state for the log file
+func (h *HAPair) String() string {
+	switch {
+	case h.role == "active":
+		return "active, heartbeats to " + h.peer
+	case h.promoted:
+		return fmt.Sprintf("standby, promoted (no heartbeat since %s)", h.lastHeartbeat.Format("15:04:05"))
+	default:
+		return fmt.Sprintf("standby, passive (last heartbeat %s)", h.lastHeartbeat.Format("15:04:05"))
+	}
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+)
+
+// wilsonZ is the z-score for a 95% confidence interval
+const wilsonZ = 1.96
+
+// rateEstimate is a success proportion with its sample size
+type rateEstimate struct {
+	successes int // Successful samples
+	total     int // Total samples
+}
+
+// successEstimate counts successful tests
+func successEstimate(tests []WiFiTest) rateEstimate {
+	r := rateEstimate{total: len(tests)}
+	for _, t := range tests {
+		if t.Success {
+			r.successes++
+		}
+	}
+	return r
+}
+
+// minRateSamples returns the sample count below which rates are reported
+// as insufficient data (MIN_RATE_SAMPLES)
+func (w *WiFiMonitor) minRateSamples() int {
+	return w.settings.Int("MIN_RATE_SAMPLES", 10)
+}
+
+// rate returns the observed success rate in percent
+func (r rateEstimate) rate() float64 {
+	if r.total == 0 {
+		return 0
+	}
+	return float64(r.successes) / float64(r.total) * 100
+}
+
+// sufficient reports whether the minimum number of samples exists to present or alert on the rate
+func (r rateEstimate) sufficient(minimum int) bool {
+	return r.total >= minimum
+}
+
+// interval returns the 95% Wilson score interval in percent
+func (r rateEstimate) interval() (float64, float64) {
+	if r.total == 0 {
+		return 0, 100
+	}
+	n := float64(r.total)
+	p := float64(r.successes) / n
+	z2 := wilsonZ * wilsonZ
+
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	margin := wilsonZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+
+	return math.Max(0, center-margin) * 100, math.Min(1, center+margin) * 100
+}
+
+// format formats the rate with its confidence interval, or flags fewer
+// than minimum samples as insufficient data
+func (r rateEstimate) format(minimum int) string {
+	if !r.sufficient(minimum) {
+		return fmt.Sprintf("insufficient data (n=%d)", r.total)
+	}
+	lo, hi := r.interval()
+	return fmt.Sprintf("%.2f%% (95%% CI %.1f-%.1f%%)", r.rate(), lo, hi)
+}
+
+// checkSuccessRateAlerts fires when a success rate is confidently below the
+// threshold, i.e. even the upper bound of its confidence interval is lower
+func (w *WiFiMonitor) checkSuccessRateAlerts() {
+	threshold := float64(w.settings.Int("SUCCESS_RATE_ALERT_PERCENT", 90))
+	minimum := w.minRateSamples()
+
+	for name, r := range map[string]rateEstimate{
+		"dhcp_success_rate_low": successEstimate(w.dhcpTests),
+		"ping_success_rate_low": successEstimate(headlineTests(w.settings, w.pingTests)),
+	} {
+		_, hi := r.interval()
+		w.setAlert(name, r.sufficient(minimum) && hi < threshold,
+			fmt.Sprintf("Success rate %s is below %.0f%%", r.format(minimum), threshold))
+	}
+}
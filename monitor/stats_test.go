@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRateEstimateInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		successes int
+		total     int
+		wantRate  float64
+		wantLo    float64
+		wantHi    float64
+	}{
+		{name: "no samples", wantLo: 0, wantHi: 100},
+		{name: "single success", successes: 1, total: 1, wantRate: 100, wantLo: 20.65, wantHi: 100},
+		{name: "all failed", successes: 0, total: 10, wantRate: 0, wantLo: 0, wantHi: 27.75},
+		{name: "all succeeded", successes: 10, total: 10, wantRate: 100, wantLo: 72.25, wantHi: 100},
+		{name: "half", successes: 5, total: 10, wantRate: 50, wantLo: 23.66, wantHi: 76.34},
+		{name: "95 of 100", successes: 95, total: 100, wantRate: 95, wantLo: 88.82, wantHi: 97.85},
+		{name: "990 of 1000", successes: 990, total: 1000, wantRate: 99, wantLo: 98.17, wantHi: 99.46},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rateEstimate{successes: tt.successes, total: tt.total}
+			if got := r.rate(); math.Abs(got-tt.wantRate) > 0.005 {
+				t.Errorf("rate() = %.2f, want %.2f", got, tt.wantRate)
+			}
+			lo, hi := r.interval()
+			if math.Abs(lo-tt.wantLo) > 0.005 || math.Abs(hi-tt.wantHi) > 0.005 {
+				t.Errorf("interval() = %.2f-%.2f, want %.2f-%.2f", lo, hi, tt.wantLo, tt.wantHi)
+			}
+			if lo > tt.wantRate || hi < tt.wantRate {
+				t.Errorf("interval() = %.2f-%.2f does not contain the rate %.2f", lo, hi, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestSuccessEstimate(t *testing.T) {
+	tests := []WiFiTest{{Success: true}, {Success: false}, {Success: true}}
+	if got := successEstimate(tests); got != (rateEstimate{successes: 2, total: 3}) {
+		t.Errorf("successEstimate() = %+v, want 2 of 3", got)
+	}
+}
+
+func TestRateEstimateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       rateEstimate
+		minimum int
+		want    string
+	}{
+		{name: "below the minimum", r: rateEstimate{successes: 9, total: 9}, minimum: 10, want: "insufficient data (n=9)"},
+		{name: "at the minimum", r: rateEstimate{successes: 5, total: 10}, minimum: 10, want: "50.00% (95% CI 23.7-76.3%)"},
+		{name: "lower minimum of another monitor", r: rateEstimate{successes: 5, total: 10}, minimum: 3, want: "50.00% (95% CI 23.7-76.3%)"},
+		{name: "higher minimum of another monitor", r: rateEstimate{successes: 5, total: 10}, minimum: 30, want: "insufficient data (n=10)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.format(tt.minimum); got != tt.want {
+				t.Errorf("format(%d) = %q, want %q", tt.minimum, got, tt.want)
+			}
+		})
+	}
+}
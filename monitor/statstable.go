@@ -0,0 +1,176 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// statsTableTitle names the table and its sort keybindings
+const statsTableTitle = " Targets (o: sort column, O: reverse) "
+
+// serviceHistoryLimit is the number of results kept per service check for the stats table
+const serviceHistoryLimit = 500
+
+// statsColumns are the stats table headers in display order
+var statsColumns = []string{"Target", "Last", "Min", "Avg", "p95", "Max", "Loss", "Success"}
+
+// TargetStats is one row of the stats table
+type TargetStats struct {
+	Target    string          // Target name
+	Latencies []time.Duration // Latencies of answered probes in time order
+	Loss      float64         // Packet loss where the probe measures it, failed probes otherwise (percent)
+	Success   rateEstimate    // Successful probes
+}
+
+// latencySummary returns last, min, avg, p95 and max of the answered probes
+func (s TargetStats) latencySummary() []time.Duration {
+	n := len(s.Latencies)
+	if n == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), s.Latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return []time.Duration{s.Latencies[n-1], sorted[0], meanDuration(sorted), sorted[(n*95-1)/100], sorted[n-1]}
+}
+
+// testStats builds a row from DHCP or ping test results; value picks the latency of a test
+func testStats(target string, tests []WiFiTest, value func(WiFiTest) time.Duration) TargetStats {
+	stats := TargetStats{Target: target, Success: successEstimate(tests)}
+	for _, test := range tests {
+		if test.Success && value(test) > 0 {
+			stats.Latencies = append(stats.Latencies, value(test))
+		}
+	}
+	if stats.Success.total > 0 {
+		stats.Loss = 100 - stats.Success.rate()
+	}
+	return stats
+}
+
+// targetStats collects a row per probe target: the DHCP server, every
+// ping target, every service check, every DNS lookup, every HTTP check and
+// every ISP endpoint
+func (w *WiFiMonitor) targetStats() []TargetStats {
+	rows := []TargetStats{
+		testStats("dhcp", w.dhcpTests, func(t WiFiTest) time.Duration { return t.DHCPRenewTime }),
+	}
+	rows = append(rows, w.pingTargetStats(headlineTests(w.settings, w.pingTests))...)
+
+	for _, check := range w.serviceChecks {
+		history := w.serviceHistory[check.Name]
+		stats := TargetStats{Target: "service:" + check.Name, Success: rateEstimate{total: len(history)}}
+		if w.quarantined[check.Name] != nil {
+			stats.Target += " (quarantined)"
+		}
+		for _, status := range history {
+			if status.OK {
+				stats.Success.successes++
+				stats.Latencies = append(stats.Latencies, status.Latency)
+			}
+		}
+		if stats.Success.total > 0 {
+			stats.Loss = 100 - stats.Success.rate()
+		}
+		rows = append(rows, stats)
+	}
+
+	rows = append(rows, w.dnsLookupStats()...)
+	rows = append(rows, w.httpCheckStats()...)
+
+	for _, target := range w.ispTargets {
+		stats := TargetStats{Target: "isp:" + target.Name, Success: rateEstimate{total: len(target.Samples)}}
+		for _, sample := range target.Samples {
+			stats.Loss += sample.Loss
+			if sample.Loss < 100 {
+				stats.Success.successes++
+				stats.Latencies = append(stats.Latencies, sample.Latency)
+			}
+		}
+		if stats.Success.total > 0 {
+			stats.Loss /= float64(stats.Success.total)
+		}
+		rows = append(rows, stats)
+	}
+	return rows
+}
+
+// recordServiceHistory keeps the latest results of a service check for the stats table
+func (w *WiFiMonitor) recordServiceHistory(name string, status ServiceStatus) {
+	history := append(w.serviceHistory[name], status)
+	if len(history) > serviceHistoryLimit {
+		history = history[len(history)-serviceHistoryLimit:]
+	}
+	w.serviceHistory[name] = history
+}
+
+// sortValue returns the value a row is ordered by for a table column
+func (s TargetStats) sortValue(column int, summary []time.Duration) float64 {
+	switch {
+	case column >= 1 && column <= 5:
+		if summary == nil {
+			return -1 // Rows without answers sort below the fastest target
+		}
+		return float64(summary[column-1])
+	case column == 6:
+		return s.Loss
+	case column == 7:
+		return s.Success.rate()
+	}
+	return 0
+}
+
+// cycleStatsSort moves the sort to the next column; reverse flips the order
+// of the current column instead
+func (w *WiFiMonitor) cycleStatsSort(reverse bool) {
+	if reverse {
+		w.statsSortDesc = !w.statsSortDesc
+	} else {
+		w.statsSortColumn = (w.statsSortColumn + 1) % len(statsColumns)
+	}
+	w.renderStatsTable()
+}
+
+// renderStatsTable fills the stats table from the latest rows in the current
+// sort order. It runs on the UI goroutine, which owns the rows and sort state.
+func (w *WiFiMonitor) renderStatsTable() {
+	rows := append([]TargetStats(nil), w.statsRows...)
+	summaries := make(map[string][]time.Duration, len(rows))
+	for _, row := range rows {
+		summaries[row.Target] = row.latencySummary()
+	}
+
+	column := w.statsSortColumn
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if w.statsSortDesc {
+			a, b = b, a
+		}
+		if column == 0 {
+			return a.Target < b.Target
+		}
+		return a.sortValue(column, summaries[a.Target]) < b.sortValue(column, summaries[b.Target])
+	})
+
+	table := ui.Table{Headers: append([]string(nil), statsColumns...), AlignRight: true}
+	table.Headers[column] += map[bool]string{false: " ▲", true: " ▼"}[w.statsSortDesc]
+	for _, row := range rows {
+		cells := []string{row.Target}
+		if summary := summaries[row.Target]; summary != nil {
+			for _, value := range summary {
+				cells = append(cells, value.Round(100*time.Microsecond).String())
+			}
+		} else {
+			cells = append(cells, "-", "-", "-", "-", "-")
+		}
+		if row.Success.total > 0 {
+			cells = append(cells, fmt.Sprintf("%.1f%%", row.Loss), fmt.Sprintf("%.1f%% (n=%d)", row.Success.rate(), row.Success.total))
+		} else {
+			cells = append(cells, "-", "-")
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	w.tui.SetTable(table)
+}
@@ -0,0 +1,114 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// statusFields returns the compact status summary as ordered name/value pairs
+func (w *WiFiMonitor) statusFields() [][2]string {
+	now := time.Now()
+
+	state := "UNKNOWN"
+	if w.linkInfo != nil {
+		state = "DOWN"
+		if w.linkInfo.Up {
+			state = "UP"
+		}
+	}
+
+	// Latency percentile and packet loss of the last hour of ping tests
+	var latencies []time.Duration
+	var sent, received int
+	for _, test := range headlineTests(w.settings, w.pingTests) {
+		if now.Sub(test.Timestamp) > healthWindow {
+			continue
+		}
+		sent += test.Sent
+		received += test.Received
+		if test.Success && test.Latency > 0 {
+			latencies = append(latencies, test.Latency)
+		}
+	}
+
+	p95 := "n/a"
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		p95 = latencies[(len(latencies)*95-1)/100].Round(time.Millisecond).String()
+	}
+	loss := "n/a"
+	if sent > 0 {
+		loss = fmt.Sprintf("%.1f%%", float64(sent-received)/float64(sent)*100)
+	}
+
+	dhcp := "n/a"
+	if len(w.dhcpTests) > 0 {
+		latest := w.dhcpTests[len(w.dhcpTests)-1]
+		dhcp = latest.DHCPRenewTime.Round(100 * time.Millisecond).String()
+		if !latest.Success {
+			dhcp = "FAIL"
+		}
+	}
+
+	ipv6 := "n/a"
+	if len(w.pingTests) > 0 {
+		ipv6 = "FAIL"
+		if w.pingTests[len(w.pingTests)-1].IPv6Connectivity {
+			ipv6 = "OK"
+		}
+	}
+
+	fields := [][2]string{
+		{w.wifiInterface, state},
+		{"p95", p95},
+		{"loss", loss},
+		{"DHCP", dhcp},
+		{"IPv6", ipv6},
+		{"score", fmt.Sprintf("%.0f", w.health(now).Score)},
+	}
+	// Stale numbers should not be mistaken for a healthy network
+	if w.pause != nil {
+		fields = append(fields, [2]string{"probing", "paused " + w.pause.String()})
+	}
+	if w.lowPower != nil {
+		fields = append(fields, [2]string{"duty", fmt.Sprintf("%.1f%%", w.lowPower.dutyCycle())})
+	}
+	return fields
+}
+
+// statusLine formats the status summary as one shareable line, e.g.
+// "wlan0 UP | p95 38ms | loss 0.4% | DHCP 1.2s | IPv6 OK | score 92"
+func (w *WiFiMonitor) statusLine() string {
+	var parts []string
+	for _, field := range w.statusFields() {
+		parts = append(parts, field[0]+" "+field[1])
+	}
+	return strings.Join(parts, " | ")
+}
+
+// runStatusCommand implements `noc-watch status [--oneline]` by asking the
+// running monitor over the control socket
+func runStatusCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	oneline := fs.Bool("oneline", false, "print a compact line for pasting into chat")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	command := "status"
+	if *oneline {
+		command = "status --oneline"
+	}
+	response, err := sendControl(s, command)
+	if err != nil {
+		fmt.Printf("Error querying status: %v\n", err)
+		return exitError
+	}
+	fmt.Print(response)
+	return exitOK
+}
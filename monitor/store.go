@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marokiki/noc-watch/storage"
+)
+
+// historyKinds are the kinds of tests kept in the history database
+var historyKinds = []string{"dhcp", "ping"}
+
+// openHistory opens the history database and loads the tests of the last
+// HISTORY_LOAD (default 72h), replaying them into the counters, the
+// availability and the DHCP histogram as if they had just been run
+func (w *WiFiMonitor) openHistory() {
+	path := storage.HistoryPath(w.settings, w.logFile)
+	if path == "" {
+		return
+	}
+	store, err := storage.OpenHistory(path, historyKinds...)
+	if err != nil {
+		fmt.Printf("Error opening history database: %v\n", err)
+		return
+	}
+	w.history = store
+
+	cutoff := time.Now().Add(-w.settings.Duration("HISTORY_LOAD", 72*time.Hour))
+	var dhcpTests, pingTests []WiFiTest
+	if err := store.Load("dhcp", cutoff, &dhcpTests); err != nil {
+		fmt.Printf("Error loading history: %v\n", err)
+		return
+	}
+	if err := store.Load("ping", cutoff, &pingTests); err != nil {
+		fmt.Printf("Error loading history: %v\n", err)
+		return
+	}
+	w.dhcpTests = append(dhcpTests, w.dhcpTests...)
+	w.pingTests = append(pingTests, w.pingTests...)
+
+	// Availability is measured from the oldest loaded test
+	for _, tests := range [][]WiFiTest{dhcpTests, pingTests} {
+		if len(tests) > 0 && tests[0].Timestamp.Before(w.availability.start) {
+			w.availability.start = tests[0].Timestamp
+		}
+	}
+	for _, test := range w.historySince(cutoff) {
+		w.countTest(test.WiFiTest)
+		if test.Probe == "dhcp" && test.Success {
+			w.dhcpRenewHistogram.observe(test.DHCPRenewTime.Seconds())
+		}
+	}
+	if n := len(dhcpTests) + len(pingTests); n > 0 {
+		fmt.Printf("Loaded %d tests since %s from %s\n", n, cutoff.Format("2006-01-02 15:04"), path)
+	}
+}
+
+// saveTest persists a finished test when the history database is open
+func (w *WiFiMonitor) saveTest(kind string, test WiFiTest) {
+	if w.history == nil {
+		return
+	}
+	if err := w.history.Save(kind, test.Timestamp, test); err != nil {
+		fmt.Printf("Error saving test to history database: %v\n", err)
+	}
+}
+
+// closeHistory closes the history database
+func (w *WiFiMonitor) closeHistory() {
+	if w.history != nil {
+		w.history.Close()
+	}
+}
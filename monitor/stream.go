@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// streamBuffer is the number of events queued for a slow stream client
+// before further events are dropped
+const streamBuffer = 256
+
+// streamKeepAlive is the interval of comment lines that keep idle
+// connections open through proxies
+const streamKeepAlive = 15 * time.Second
+
+// streamSubscriber receives results and alerts for one /api/stream client
+type streamSubscriber struct {
+	probes map[string]bool // Probe types streamed (empty for every probe)
+	events chan string     // Formatted server-sent events
+	done   chan struct{}   // Closed when the client disconnects
+}
+
+// formatStreamEvent formats one server-sent event carrying a JSON object
+func formatStreamEvent(event string, data []byte) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event, data)
+}
+
+// publishStream queues an event for every stream client interested in the
+// probe ("" for alerts, which reach every client). Slow clients lose events
+// instead of stalling the monitoring loop.
+func (w *WiFiMonitor) publishStream(event, probe string, data []byte) {
+	for sub := range w.streamSubscribers {
+		select {
+		case <-sub.done:
+			delete(w.streamSubscribers, sub)
+			continue
+		default:
+		}
+		if probe != "" && len(sub.probes) > 0 && !sub.probes[probe] {
+			continue
+		}
+		select {
+		case sub.events <- formatStreamEvent(event, data):
+		default:
+		}
+	}
+}
+
+// publishAlert streams an alert transition in its webhook JSON form
+func (w *WiFiMonitor) publishAlert(alert Alert) {
+	if len(w.streamSubscribers) == 0 {
+		return
+	}
+	data, err := json.Marshal(alert.payload(w.configHash))
+	if err != nil {
+		return
+	}
+	w.publishStream("alert", "", data)
+}
+
+// serveStream implements /api/stream: every finished result is pushed as a
+// server-sent "result" event with the same JSON object as the JSON Lines
+// output, and alert transitions as "alert" events. ?probe=ping,dns limits
+// the results to some probe types.
+func (w *WiFiMonitor) serveStream(rw http.ResponseWriter, r *http.Request) {
+	if !apiAllowed(w.settings, rw, r, true) {
+		return
+	}
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := &streamSubscriber{probes: make(map[string]bool), events: make(chan string, streamBuffer), done: make(chan struct{})}
+	for _, probe := range config.SplitList(r.URL.Query().Get("probe")) {
+		sub.probes[probe] = true
+	}
+	defer close(sub.done)
+	select {
+	case w.streamSubscriptions <- sub:
+	case <-r.Context().Done():
+		return
+	case <-w.stopped:
+		http.Error(rw, "monitor stopped", http.StatusServiceUnavailable)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-sub.events:
+			if _, err := fmt.Fprint(rw, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-w.stopped:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// tailBuffer is the number of result lines queued for a slow tail client
+// before further lines are dropped
+const tailBuffer = 64
+
+// tailCondition is one field comparison of a tail filter (e.g., success=false)
+type tailCondition struct {
+	Field string // Result field (type, success, ipv4, ipv6, latency, jitter, loss, dhcp, signal)
+	Op    string // Comparison operator (=, !=, >, <)
+	Value string // Value to compare with
+}
+
+// tailSubscriber receives formatted results matching its filter
+type tailSubscriber struct {
+	filter []tailCondition // Conditions that must all match
+	lines  chan string     // Formatted result lines
+	done   chan struct{}   // Closed when the client disconnects
+}
+
+// tailOperators are tried in order so != is not split at its =
+var tailOperators = []string{"!=", "=", ">", "<"}
+
+// parseTailFilter parses comma separated conditions such as
+// "success=false,type=ping" or "latency>100ms"
+func parseTailFilter(text string) ([]tailCondition, error) {
+	var filter []tailCondition
+	for _, entry := range config.SplitList(text) {
+		condition, ok := tailCondition{}, false
+		for _, op := range tailOperators {
+			if field, value, found := strings.Cut(entry, op); found {
+				condition, ok = tailCondition{Field: strings.TrimSpace(field), Op: op, Value: strings.TrimSpace(value)}, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid condition %q: expected field=value, field!=value, field>value or field<value", entry)
+		}
+
+		switch condition.Field {
+		case "type", "success", "ipv4", "ipv6":
+			if condition.Op == ">" || condition.Op == "<" {
+				return nil, fmt.Errorf("field %s only supports = and !=", condition.Field)
+			}
+		case "latency", "jitter", "dhcp":
+			if _, err := time.ParseDuration(condition.Value); err != nil {
+				return nil, fmt.Errorf("invalid duration in %q: %v", entry, err)
+			}
+		case "loss":
+			if _, err := strconv.ParseFloat(strings.TrimSuffix(condition.Value, "%"), 64); err != nil {
+				return nil, fmt.Errorf("invalid percentage in %q: %v", entry, err)
+			}
+		case "signal":
+			if _, err := strconv.Atoi(strings.TrimSuffix(condition.Value, "dBm")); err != nil {
+				return nil, fmt.Errorf("invalid signal in %q: expected dBm, e.g. -75", entry)
+			}
+		default:
+			return nil, fmt.Errorf("unknown field %q (type, success, ipv4, ipv6, latency, jitter, loss, dhcp, signal)", condition.Field)
+		}
+		filter = append(filter, condition)
+	}
+	return filter, nil
+}
+
+// matches reports whether the condition holds for a test result of the given kind
+func (c tailCondition) matches(kind string, test WiFiTest) bool {
+	var equal, less, greater bool
+	switch c.Field {
+	case "type":
+		equal = kind == c.Value
+	case "success", "ipv4", "ipv6":
+		value := map[string]bool{"success": test.Success, "ipv4": test.IPv4Connectivity, "ipv6": test.IPv6Connectivity}[c.Field]
+		equal = strconv.FormatBool(value) == c.Value
+	case "latency", "jitter", "dhcp":
+		value := map[string]time.Duration{"latency": test.Latency, "jitter": test.Jitter, "dhcp": test.DHCPRenewTime}[c.Field]
+		limit, _ := time.ParseDuration(c.Value)
+		equal, less, greater = value == limit, value < limit, value > limit
+	case "loss":
+		limit, _ := strconv.ParseFloat(strings.TrimSuffix(c.Value, "%"), 64)
+		equal, less, greater = test.Loss == limit, test.Loss < limit, test.Loss > limit
+	case "signal":
+		// Results without station info match no signal condition
+		if test.Station == nil {
+			return false
+		}
+		limit, _ := strconv.Atoi(strings.TrimSuffix(c.Value, "dBm"))
+		value := test.Station.SignalDBM
+		equal, less, greater = value == limit, value < limit, value > limit
+	}
+
+	switch c.Op {
+	case "!=":
+		return !equal
+	case ">":
+		return greater
+	case "<":
+		return less
+	default:
+		return equal
+	}
+}
+
+// formatTailLine formats a result for the tail output
+func formatTailLine(kind string, test WiFiTest) string {
+	line := fmt.Sprintf("[%s] %-4s success=%v ipv4=%v ipv6=%v latency=%v",
+		test.Timestamp.Format("2006-01-02 15:04:05"), kind, test.Success,
+		test.IPv4Connectivity, test.IPv6Connectivity, test.Latency.Round(100*time.Microsecond))
+	if test.LocalLatency > 0 {
+		line += fmt.Sprintf(" local=%v", test.LocalLatency.Round(100*time.Microsecond))
+	}
+	if kind == "dhcp" {
+		line += fmt.Sprintf(" dhcp=%v", test.DHCPRenewTime.Round(time.Millisecond))
+		if test.Lease != nil {
+			line += fmt.Sprintf(" addr=%s subnet=%s gw=%s", test.Lease.Address, orDash(test.Lease.Subnet), orDash(test.Lease.Gateway))
+		}
+	}
+	if sta := test.Station; sta != nil {
+		line += fmt.Sprintf(" bssid=%s ch=%d signal=%ddBm", sta.BSSID, sta.Channel, sta.SignalDBM)
+		if sta.RoamedFrom != "" {
+			line += " roamed_from=" + sta.RoamedFrom
+		}
+	}
+	for _, gateway := range test.Gateways {
+		if gateway.Reachable {
+			line += fmt.Sprintf(" gw_%s=%v", gateway.Family, gateway.RTT.Round(10*time.Microsecond))
+		} else {
+			line += fmt.Sprintf(" gw_%s=unreachable", gateway.Family)
+		}
+	}
+	if test.AuthFailure != "" {
+		line += fmt.Sprintf(" auth_failure=%q", test.AuthFailure)
+	}
+	if failed := failedTargets(test); len(failed) > 0 {
+		line += " failed=" + strings.Join(failed, ",")
+	}
+	return line + "\n"
+}
+
+// publishResult sends a finished test to every tail subscriber whose filter
+// matches. Slow clients lose lines instead of stalling the monitoring loop.
+func (w *WiFiMonitor) publishResult(kind string, test WiFiTest) {
+	for sub := range w.tailSubscribers {
+		matched := true
+		for _, condition := range sub.filter {
+			matched = matched && condition.matches(kind, test)
+		}
+		if matched {
+			w.sendTail(sub, formatTailLine(kind, test))
+		}
+	}
+}
+
+// sendTail queues a line for a tail subscriber without blocking and forgets
+// subscribers whose client has disconnected
+func (w *WiFiMonitor) sendTail(sub *tailSubscriber, line string) {
+	select {
+	case <-sub.done:
+		delete(w.tailSubscribers, sub)
+		return
+	default:
+	}
+
+	select {
+	case sub.lines <- line:
+	default:
+	}
+}
+
+// serveTail streams matching results to a control connection until the client disconnects
+func (w *WiFiMonitor) serveTail(conn net.Conn, filterText string) {
+	filter, err := parseTailFilter(filterText)
+	if err != nil {
+		fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+
+	sub := &tailSubscriber{filter: filter, lines: make(chan string, tailBuffer), done: make(chan struct{})}
+	defer close(sub.done)
+	select {
+	case w.tailSubscriptions <- sub:
+	case <-w.stopped:
+		return
+	}
+
+	// The client sends nothing more; EOF means it went away
+	gone := make(chan struct{})
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case line := <-sub.lines:
+			if _, err := conn.Write([]byte(line)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-w.stopped:
+			return
+		}
+	}
+}
+
+// runTailCommand implements `noc-watch tail [--filter EXPR]` by following the
+// results of the running monitor over the control socket
+func runTailCommand(s *config.Settings, args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	filterText := fs.String("filter", "", "comma separated conditions, e.g. success=false,type=ping or latency>100ms")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if _, err := parseTailFilter(*filterText); err != nil {
+		fmt.Printf("Error parsing filter: %v\n", err)
+		return exitUsage
+	}
+
+	conn, err := net.DialTimeout("unix", controlSocketPath(s), 5*time.Second)
+	if err != nil {
+		fmt.Printf("Error following results: monitor not reachable on %s: %v\n", controlSocketPath(s), err)
+		return exitError
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.TrimSpace("tail "+*filterText) + "\n")); err != nil {
+		fmt.Printf("Error following results: %v\n", err)
+		return exitError
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, "error: ") {
+			fmt.Printf("Error following results: %s", strings.TrimPrefix(line, "error: "))
+			return exitError
+		}
+		os.Stdout.WriteString(line)
+		if err != nil {
+			fmt.Println("Monitor closed the connection")
+			return exitError
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// targetVariablePattern matches {{gateway}}, {{resolver}}, {{resolver[1]}} and {{dhcp_server}}
+var targetVariablePattern = regexp.MustCompile(`\{\{\s*([a-z_]+)(?:\[(\d+)\])?\s*\}\}`)
+
+// expandTarget resolves template variables in a probe target from the current
+// network state of the interface, so one configuration works at every venue:
+//
+//	{{gateway}}      default gateway of the interface
+//	{{resolver[N]}}  N-th nameserver in /etc/resolv.conf ({{resolver}} is the first)
+//	{{dhcp_server}}  server that handed out the current DHCP lease
+func expandTarget(s *config.Settings, iface, target string) (string, error) {
+	var unresolved []string
+	expanded := targetVariablePattern.ReplaceAllStringFunc(target, func(match string) string {
+		groups := targetVariablePattern.FindStringSubmatch(match)
+		index, _ := strconv.Atoi(groups[2])
+
+		var value string
+		switch groups[1] {
+		case "gateway":
+			value = probe.DefaultGateway(iface)
+		case "resolver":
+			if resolvers := probe.SystemResolvers(); index < len(resolvers) {
+				value = resolvers[index]
+			}
+		case "dhcp_server":
+			value = dhcpServer(s, iface)
+		}
+		if value == "" {
+			unresolved = append(unresolved, match)
+		}
+		return value
+	})
+
+	if len(unresolved) > 0 {
+		return "", fmt.Errorf("cannot resolve %s in target %q", strings.Join(unresolved, ", "), target)
+	}
+	return expanded, nil
+}
+
+// probeTarget returns the target configured in the environment variable key
+// (or fallback) with template variables resolved. Unresolvable targets are
+// reported and returned as "" so the probe is skipped rather than failing.
+func (w *WiFiMonitor) probeTarget(key, fallback string) string {
+	target, err := expandTarget(w.settings, w.wifiInterface, w.settings.String(key, fallback))
+	if err != nil {
+		fmt.Printf("Error resolving %s: %v\n", key, err)
+		return ""
+	}
+	return target
+}
+
+// dhcpServer returns the dhcp-server-identifier of the latest lease of an
+// interface from DHCP_LEASE_FILE or the usual dhclient lease files
+func dhcpServer(s *config.Settings, iface string) string {
+	if lease := probe.ReadDHCPLeaseFile(s, iface); lease != nil {
+		return lease.Server
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxTenantTests limits the per-tenant test history kept in memory
+const maxTenantTests = 1440
+
+// Tenant is a separately owned network (SSID or VLAN) with its own SLO
+type Tenant struct {
+	Name         string              // Tenant name (attendee, staff, av, ...)
+	Interface    string              // Interface attached to the tenant network
+	SLO          float64             // Availability objective in percent
+	Tests        []WiFiTest          // Connectivity test history
+	Availability availabilityTracker // Time-weighted availability
+}
+
+// parseTenants parses TENANTS entries of the form name=interface[:slo]
+func parseTenants(s *config.Settings) []*Tenant {
+	var tenants []*Tenant
+	for _, entry := range s.List("TENANTS") {
+		name, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		iface, sloText, _ := strings.Cut(spec, ":")
+		slo, err := strconv.ParseFloat(sloText, 64)
+		if err != nil {
+			slo = 99.0
+		}
+		tenants = append(tenants, &Tenant{
+			Name:         name,
+			Interface:    iface,
+			SLO:          slo,
+			Availability: newAvailabilityTracker(),
+		})
+	}
+	return tenants
+}
+
+// runTenantTests runs a connectivity and latency test on every tenant network
+func (w *WiFiMonitor) runTenantTests() {
+	for _, tenant := range w.tenants {
+		// Templates resolve against the tenant's own network (e.g., its gateway)
+		target, err := expandTarget(w.settings, tenant.Interface, w.settings.String("UPSTREAM_TARGET", "8.8.8.8"))
+		if err != nil {
+			fmt.Printf("Error resolving UPSTREAM_TARGET for tenant %s: %v\n", tenant.Name, err)
+			continue
+		}
+		stats := probe.PingFrom(w.probeContext(), w.settings, tenant.Interface, target, 3)
+		test := WiFiTest{
+			IPv4Connectivity: stats.Loss < 100,
+			Latency:          stats.Avg,
+			Timestamp:        time.Now(),
+		}
+		test.Success = test.IPv4Connectivity && test.Latency > 0
+
+		tenant.Tests = append(tenant.Tests, test)
+		if len(tenant.Tests) > maxTenantTests {
+			tenant.Tests = tenant.Tests[len(tenant.Tests)-maxTenantTests:]
+		}
+		tenant.Availability.mark(test.Timestamp, test.IPv4Connectivity)
+
+		availability, _ := tenant.Availability.percent(time.Now())
+		w.setAlert("slo_breach_"+tenant.Name, availability < tenant.SLO,
+			fmt.Sprintf("Tenant %s (%s) availability %.3f%% is below its %.2f%% SLO",
+				tenant.Name, tenant.Interface, availability, tenant.SLO))
+	}
+}
+
+// writeReport writes the tenant's report section, flagging success rates of
+// fewer than minimum samples as insufficient data
+func (t *Tenant) writeReport(out io.Writer, minimum int) error {
+	availability, _ := t.Availability.percent(time.Now())
+	slo := "MET"
+	if availability < t.SLO {
+		slo = "BREACHED"
+	}
+
+	var latency time.Duration
+	var samples int
+	for _, test := range t.Tests {
+		if test.Success {
+			latency += test.Latency
+			samples++
+		}
+	}
+	if samples > 0 {
+		latency /= time.Duration(samples)
+	}
+
+	_, err := fmt.Fprintf(out, "--- Tenant %s (%s) ---\n"+
+		"Success Rate: %s\n"+
+		"Availability: %s\n"+
+		"Average Latency: %v\n"+
+		"SLO %.2f%%: %s\n",
+		t.Name, t.Interface, successEstimate(t.Tests).format(minimum), &t.Availability, latency, t.SLO, slo)
+	return err
+}
+
+// writeTenantFiles writes each tenant section to its own file when TENANT_REPORT_DIR is set
+func (w *WiFiMonitor) writeTenantFiles() error {
+	dir := w.settings.Get("TENANT_REPORT_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	for _, tenant := range w.tenants {
+		file, err := os.OpenFile(filepath.Join(dir, tenant.Name+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(file, "\n=== %s Tenant Report - %s ===\nStamp: %s\n", tenant.Name, time.Now().Format("2006-01-02 15:04:05"), w.stamp())
+		if err == nil {
+			err = tenant.writeReport(file, w.minRateSamples())
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// maintenanceWindow is a planned period without alert notifications, either
+// recurring ("Mon-Fri 02:00-02:30", "Sun 03:00-04:00", "02:00-02:30") or
+// one-off ("2026-10-20T22:00/2026-10-21T01:00")
+type maintenanceWindow struct {
+	text  string       // Window as configured, for messages
+	days  map[int]bool // Weekdays the recurring window starts on (every day when empty)
+	start int          // Start of the recurring window in minutes after midnight
+	end   int          // End of the recurring window in minutes after midnight (may wrap)
+	from  time.Time    // Start of a one-off window
+	until time.Time    // End of a one-off window (zero for recurring windows)
+}
+
+// weekdays maps the day names accepted in MAINTENANCE_WINDOWS to time.Weekday
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// parseMaintenanceWindow parses one MAINTENANCE_WINDOWS entry
+func parseMaintenanceWindow(text string) (maintenanceWindow, error) {
+	window := maintenanceWindow{text: text, days: make(map[int]bool)}
+	if from, until, ok := strings.Cut(text, "/"); ok {
+		var err error
+		if window.from, err = time.ParseInLocation("2006-01-02T15:04", from, time.Local); err != nil {
+			return window, fmt.Errorf("invalid start in %q: expected YYYY-MM-DDTHH:MM", text)
+		}
+		if window.until, err = time.ParseInLocation("2006-01-02T15:04", until, time.Local); err != nil || !window.until.After(window.from) {
+			return window, fmt.Errorf("invalid end in %q: expected YYYY-MM-DDTHH:MM after the start", text)
+		}
+		return window, nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 2 {
+		first, last, _ := strings.Cut(strings.ToLower(fields[0]), "-")
+		if last == "" {
+			last = first
+		}
+		from, ok1 := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok1 || !ok2 {
+			return window, fmt.Errorf("invalid days in %q: expected e.g. Sun or Mon-Fri", text)
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == to {
+				break
+			}
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return window, fmt.Errorf("invalid window %q: expected [DAYS] HH:MM-HH:MM or START/END", text)
+	}
+
+	start, end, _ := strings.Cut(fields[0], "-")
+	startTime, err1 := time.Parse("15:04", start)
+	endTime, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil || start == end {
+		return window, fmt.Errorf("invalid times in %q: expected HH:MM-HH:MM", text)
+	}
+	window.start = startTime.Hour()*60 + startTime.Minute()
+	window.end = endTime.Hour()*60 + endTime.Minute()
+	return window, nil
+}
+
+// maintenanceWindows parses MAINTENANCE_WINDOWS, skipping invalid entries
+func maintenanceWindows(s *config.Settings) []maintenanceWindow {
+	var windows []maintenanceWindow
+	for _, entry := range s.List("MAINTENANCE_WINDOWS") {
+		window, err := parseMaintenanceWindow(entry)
+		if err != nil {
+			fmt.Printf("Error parsing MAINTENANCE_WINDOWS: %v\n", err)
+			continue
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// contains reports whether t falls into the window. Recurring windows
+// ending before they start run past midnight into the next day.
+func (m maintenanceWindow) contains(t time.Time) bool {
+	if !m.until.IsZero() {
+		return !t.Before(m.from) && t.Before(m.until)
+	}
+	day := func(t time.Time) bool { return len(m.days) == 0 || m.days[int(t.Weekday())] }
+	minute := t.Hour()*60 + t.Minute()
+	if m.start < m.end {
+		return day(t) && minute >= m.start && minute < m.end
+	}
+	return (day(t) && minute >= m.start) || (day(t.AddDate(0, 0, -1)) && minute < m.end)
+}
+
+// alertCooldown returns how long a firing alert is not notified again after
+// its last notification: the rule's cooldown for rule_ alerts, otherwise
+// ALERT_COOLDOWN (default 5m)
+func (w *WiFiMonitor) alertCooldown(name string) time.Duration {
+	for _, rule := range w.alertRules {
+		if "rule_"+rule.Name == name && rule.Cooldown != "" {
+			return rule.cooldown
+		}
+	}
+	return w.settings.Duration("ALERT_COOLDOWN", 5*time.Minute)
+}
+
+// suppression returns why an alert is not notified at now, or "" when it
+// is: it resolves without its firing having been notified (so the channel
+// gets a single recovery notice per notified incident), a maintenance window
+// is open, or the alert fired again within its cooldown
+func (w *WiFiMonitor) suppression(alert Alert, now time.Time) string {
+	// A notified firing always gets its recovery notice, even in a window
+	if alert.Resolved && !alert.Event {
+		if !w.notifiedAlerts[alert.Name] {
+			return "firing was not notified"
+		}
+		return ""
+	}
+	for _, window := range w.maintenance {
+		if window.contains(now) {
+			return "maintenance window " + window.text
+		}
+	}
+	if !alert.Event {
+		last, ok := w.lastNotified[alert.Name]
+		if cooldown := w.alertCooldown(alert.Name); ok && now.Sub(last) < cooldown {
+			return fmt.Sprintf("cooldown until %s", last.Add(cooldown).Format("15:04:05"))
+		}
+	}
+	return ""
+}
+
+// deliver sends an alert to the webhooks, chats and email and remembers
+// notified firings for the cooldown and the recovery notice
+func (w *WiFiMonitor) deliver(alert Alert) {
+	if !alert.Event {
+		if alert.Resolved {
+			delete(w.notifiedAlerts, alert.Name)
+		} else {
+			w.notifiedAlerts[alert.Name] = true
+			w.lastNotified[alert.Name] = alert.Timestamp
+		}
+	}
+	if w.notifier != nil {
+		w.notifier.notify(alert)
+	}
+	if w.mailer != nil {
+		w.mailer.notify(alert, w.configHash)
+	}
+}
+
+// releaseHeldAlerts notifies alerts that were held back by a cooldown or a
+// maintenance window and are still firing once nothing suppresses them, so
+// the channel does not keep showing a recovery that did not last
+func (w *WiFiMonitor) releaseHeldAlerts() {
+	now := time.Now()
+	for name, alert := range w.heldAlerts {
+		if !w.activeAlerts[name] {
+			delete(w.heldAlerts, name)
+			continue
+		}
+		if w.suppression(alert, now) != "" {
+			continue
+		}
+		delete(w.heldAlerts, name)
+		alert.Message += fmt.Sprintf(" (firing since %s, held back: %s)", alert.Timestamp.Format("15:04:05"), alert.Suppressed)
+		alert.Suppressed = ""
+		alert.Timestamp = now
+		w.deliver(alert)
+	}
+}
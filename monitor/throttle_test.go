@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2026, 10, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name   string
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{name: "daily", window: "02:00-02:30", at: at(16, "02:15"), want: true},
+		{name: "start is inclusive", window: "02:00-02:30", at: at(16, "02:00"), want: true},
+		{name: "end is exclusive", window: "02:00-02:30", at: at(16, "02:30"), want: false},
+		{name: "weekday range", window: "Mon-Fri 02:00-02:30", at: at(16, "02:15"), want: true},
+		{name: "outside the weekday range", window: "Mon-Fri 02:00-02:30", at: at(17, "02:15"), want: false},
+		{name: "single day", window: "Sun 03:00-04:00", at: at(18, "03:59"), want: true},
+		{name: "other day", window: "Sun 03:00-04:00", at: at(17, "03:30"), want: false},
+		{name: "day range across the week end", window: "Fri-Mon 12:00-13:00", at: at(19, "12:30"), want: true},
+		{name: "outside a day range across the week end", window: "Fri-Mon 12:00-13:00", at: at(20, "12:30"), want: false},
+		{name: "past midnight on the start day", window: "Fri 23:00-01:00", at: at(16, "23:30"), want: true},
+		{name: "past midnight on the next day", window: "Fri 23:00-01:00", at: at(17, "00:30"), want: true},
+		{name: "early hours of the start day", window: "Fri 23:00-01:00", at: at(16, "00:30"), want: false},
+		{name: "one-off", window: "2026-10-20T22:00/2026-10-21T01:00", at: at(21, "00:59"), want: true},
+		{name: "one-off end is exclusive", window: "2026-10-20T22:00/2026-10-21T01:00", at: at(21, "01:00"), want: false},
+		{name: "one-off on another date", window: "2026-10-20T22:00/2026-10-21T01:00", at: at(19, "23:00"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := parseMaintenanceWindow(tt.window)
+			if err != nil {
+				t.Fatalf("parseMaintenanceWindow(%q) error = %v", tt.window, err)
+			}
+			if got := window.contains(tt.at); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMaintenanceWindowErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"02:00",
+		"02:00-02:00",
+		"25:00-26:00",
+		"Someday 02:00-03:00",
+		"Mon-Someday 02:00-03:00",
+		"Mon Fri 02:00-03:00",
+		"2026-10-20/2026-10-21",
+		"2026-10-21T01:00/2026-10-20T22:00",
+	} {
+		if _, err := parseMaintenanceWindow(text); err == nil {
+			t.Errorf("parseMaintenanceWindow(%q) succeeded, want an error", text)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// maxThroughputHistory limits the number of throughput tests kept in memory
+const maxThroughputHistory = 100
+
+// librespeedChunks is the number of 1 MB chunks requested per librespeed download
+const librespeedChunks = 100
+
+// ThroughputTest is one scheduled download and upload measurement
+type ThroughputTest struct {
+	Method       string    `json:"method"`          // iperf3 or librespeed
+	Server       string    `json:"server"`          // iperf3 server or librespeed base URL
+	DownloadMbps float64   `json:"download_mbps"`   // Download rate in Mbit/s
+	UploadMbps   float64   `json:"upload_mbps"`     // Upload rate in Mbit/s
+	Error        string    `json:"error,omitempty"` // Failure reason ("" on success)
+	Timestamp    time.Time `json:"timestamp"`       // Test start
+}
+
+// String formats a throughput test for the log file and the UI
+func (t ThroughputTest) String() string {
+	if t.Error != "" {
+		return fmt.Sprintf("%s %s: FAIL (%s)", t.Method, t.Server, t.Error)
+	}
+	return fmt.Sprintf("%s %s: down %.1f Mbps, up %.1f Mbps", t.Method, t.Server, t.DownloadMbps, t.UploadMbps)
+}
+
+// throughputMethod returns the configured throughput test: iperf3 when
+// THROUGHPUT_IPERF_SERVER is set, librespeed when THROUGHPUT_LIBRESPEED_URL
+// is set, "" when throughput testing is off
+func throughputMethod(s *config.Settings) string {
+	switch {
+	case s.Get("THROUGHPUT_IPERF_SERVER") != "":
+		return "iperf3"
+	case s.Get("THROUGHPUT_LIBRESPEED_URL") != "":
+		return "librespeed"
+	}
+	return ""
+}
+
+// runThroughputTest measures download and upload rates and alerts when
+// either stays below its THROUGHPUT_MIN_*_MBPS threshold. Profiles with
+// throughput=off skip the test, e.g. to keep the AP free during sessions.
+// Each direction takes THROUGHPUT_DURATION, so the test runs off the
+// monitoring loop.
+func (w *WiFiMonitor) runThroughputTest() {
+	if !w.profile.Throughput {
+		return
+	}
+
+	duration := w.settings.Duration("THROUGHPUT_DURATION", 10*time.Second)
+	w.runInBackground("throughput", func() func() {
+		test := ThroughputTest{Method: throughputMethod(w.settings), Timestamp: time.Now()}
+		var err error
+		if test.Method == "iperf3" {
+			test.Server = w.settings.Get("THROUGHPUT_IPERF_SERVER")
+			test.DownloadMbps, test.UploadMbps, err = w.iperfThroughput(test.Server, duration)
+		} else {
+			test.Server = strings.TrimSuffix(w.settings.Get("THROUGHPUT_LIBRESPEED_URL"), "/")
+			test.DownloadMbps, test.UploadMbps, err = w.librespeedThroughput(test.Server, duration)
+		}
+		if err != nil {
+			test.Error = err.Error()
+		}
+		return func() { w.recordThroughputTest(test) }
+	})
+}
+
+// recordThroughputTest keeps a throughput test and alerts on low rates
+func (w *WiFiMonitor) recordThroughputTest(test ThroughputTest) {
+	w.throughputTests = append(w.throughputTests, test)
+	w.writeJSONL("throughput", test)
+	if len(w.throughputTests) > maxThroughputHistory {
+		w.throughputTests = w.throughputTests[len(w.throughputTests)-maxThroughputHistory:]
+	}
+
+	// Failed tests say nothing about the rates, so the alert keeps its state
+	if test.Error != "" {
+		fmt.Printf("Error running throughput test: %v\n", test.Error)
+		return
+	}
+	minDown := float64(w.settings.Int("THROUGHPUT_MIN_DOWN_MBPS", 0))
+	minUp := float64(w.settings.Int("THROUGHPUT_MIN_UP_MBPS", 0))
+	w.setAlert("throughput_low", test.DownloadMbps < minDown || test.UploadMbps < minUp,
+		fmt.Sprintf("Throughput down %.1f Mbps (min %.0f), up %.1f Mbps (min %.0f) via %s",
+			test.DownloadMbps, minDown, test.UploadMbps, minUp, test.Server))
+}
+
+// iperfResult is the part of the iperf3 JSON report used for the rates
+type iperfResult struct {
+	End struct {
+		SumReceived struct {
+			BitsPerSecond float64 `json:"bits_per_second"` // Receiver side rate
+		} `json:"sum_received"` // Totals over all streams
+	} `json:"end"` // Summary after the test
+	Error string `json:"error"` // Set when the test failed
+}
+
+// iperfThroughput runs iperf3 against a server (host or host:port) once in
+// reverse mode for the download and once for the upload, bound to the
+// address of the monitored interface
+func (w *WiFiMonitor) iperfThroughput(server string, duration time.Duration) (float64, float64, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, "5201"
+	}
+	args := []string{"-c", host, "-p", port, "-t", strconv.Itoa(max(int(duration.Seconds()), 1)), "-J"}
+	if ip := probe.InterfaceIPv4(w.wifiInterface); ip != nil {
+		args = append(args, "-B", ip.String())
+	}
+
+	// run measures one direction; the receiver side rate counts
+	run := func(reverse bool) (float64, error) {
+		ctx, cancel := context.WithTimeout(w.probeContext(), duration+30*time.Second)
+		defer cancel()
+		runArgs := args
+		if reverse {
+			runArgs = append(runArgs[:len(runArgs):len(runArgs)], "-R")
+		}
+		output, cmdErr := probe.CaptureCommand(ctx, "iperf3", runArgs...)
+
+		var result iperfResult
+		if err := json.Unmarshal(output, &result); err != nil {
+			if cmdErr != nil {
+				return 0, cmdErr
+			}
+			return 0, fmt.Errorf("parsing iperf3 report: %v", err)
+		}
+		if result.Error != "" {
+			return 0, fmt.Errorf("iperf3: %s", result.Error)
+		}
+		return result.End.SumReceived.BitsPerSecond / 1e6, nil
+	}
+
+	down, err := run(true)
+	if err != nil {
+		return 0, 0, err
+	}
+	up, err := run(false)
+	if err != nil {
+		return down, 0, err
+	}
+	return down, up, nil
+}
+
+// librespeedThroughput measures against a librespeed backend: the download
+// reads garbage.php and the upload posts to empty.php, each for the given
+// duration over the monitored interface
+func (w *WiFiMonitor) librespeedThroughput(base string, duration time.Duration) (float64, float64, error) {
+	client := &http.Client{Transport: &http.Transport{
+		DialContext:       w.interfaceDialer(10 * time.Second).DialContext,
+		DisableKeepAlives: true,
+	}}
+
+	down, err := librespeedTransfer(client, http.MethodGet,
+		fmt.Sprintf("%s/garbage.php?ckSize=%d", base, librespeedChunks), duration)
+	if err != nil {
+		return 0, 0, fmt.Errorf("download: %v", err)
+	}
+	up, err := librespeedTransfer(client, http.MethodPost, base+"/empty.php", duration)
+	if err != nil {
+		return down, 0, fmt.Errorf("upload: %v", err)
+	}
+	return down, up, nil
+}
+
+// countingReader is an endless upload body that counts the bytes read from it
+type countingReader struct {
+	n int64 // Bytes handed out so far
+}
+
+// Read fills p with zeros
+func (r *countingReader) Read(p []byte) (int, error) {
+	clear(p)
+	r.n += int64(len(p))
+	return len(p), nil
+}
+
+// librespeedTransfer downloads (GET) or uploads (POST) until the duration
+// ends and returns the rate in Mbit/s. Running into the deadline is the
+// expected way for a transfer to end.
+func librespeedTransfer(client *http.Client, method, target string, duration time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	upload := &countingReader{}
+	var body io.Reader
+	if method == http.MethodPost {
+		body = upload
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	var transferred int64
+	resp, err := client.Do(req)
+	if err == nil {
+		if resp.StatusCode >= 400 {
+			resp.Body.Close()
+			return 0, fmt.Errorf("%s", resp.Status)
+		}
+		transferred, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if method == http.MethodPost {
+		transferred = upload.n
+	}
+	if err != nil && ctx.Err() == nil {
+		return 0, err
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if transferred == 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("no data transferred")
+	}
+	return float64(transferred) * 8 / elapsed / 1e6, nil
+}
+
+// latestThroughput returns the newest successful throughput test
+func (w *WiFiMonitor) latestThroughput() (ThroughputTest, bool) {
+	for i := len(w.throughputTests) - 1; i >= 0; i-- {
+		if w.throughputTests[i].Error == "" {
+			return w.throughputTests[i], true
+		}
+	}
+	return ThroughputTest{}, false
+}
+
+// throughputSummary averages the successful tests for the stats view
+func (w *WiFiMonitor) throughputSummary() string {
+	var down, up float64
+	var n int
+	for _, test := range w.throughputTests {
+		if test.Error == "" {
+			down += test.DownloadMbps
+			up += test.UploadMbps
+			n++
+		}
+	}
+	latest, ok := w.latestThroughput()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("down %.1f / up %.1f Mbps at %s (avg of %d: down %.1f / up %.1f Mbps)",
+		latest.DownloadMbps, latest.UploadMbps, latest.Timestamp.Format("15:04"), n, down/float64(n), up/float64(n))
+}
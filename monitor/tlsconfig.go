@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// certificatePin returns the base64 SHA-256 of a certificate's public key (SPKI),
+// the same format as HPKP and curl --pinnedpubkey
+func certificatePin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// clientTLSConfig builds a TLS client configuration from <prefix>_CA,
+// <prefix>_CERT, <prefix>_KEY and <prefix>_PINS. It returns nil when none
+// of them is set so the default transport is used.
+func clientTLSConfig(s *config.Settings, prefix string) (*tls.Config, error) {
+	caFile := s.Get(prefix + "_CA")
+	certFile := s.Get(prefix + "_CERT")
+	keyFile := s.Get(prefix + "_KEY")
+	pins := s.List(prefix + "_PINS")
+	if caFile == "" && certFile == "" && keyFile == "" && len(pins) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// Private CA used by the collector instead of the system roots
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Client certificate for mutual TLS
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Pinning: one of the certificates in the verified chain must match a pin
+	if len(pins) > 0 {
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, chain := range state.VerifiedChains {
+				for _, cert := range chain {
+					if contains(pins, certificatePin(cert)) {
+						return nil
+					}
+				}
+			}
+			return errors.New("server certificate does not match any pinned key")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// serverTLSConfig builds a TLS server configuration from <prefix>_TLS_CERT,
+// <prefix>_TLS_KEY and <prefix>_TLS_CLIENT_CA (e.g. files issued by
+// `noc-watch cert issue --server`). With a client CA every client must
+// present a certificate it signed (mutual TLS). It returns nil when none of
+// them is set so the listener serves plain HTTP.
+func serverTLSConfig(s *config.Settings, prefix string) (*tls.Config, error) {
+	certFile := s.Get(prefix + "_TLS_CERT")
+	keyFile := s.Get(prefix + "_TLS_KEY")
+	clientCAFile := s.Get(prefix + "_TLS_CLIENT_CA")
+	if certFile == "" && keyFile == "" && clientCAFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s_TLS_CERT and %s_TLS_KEY are both required", prefix, prefix)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+
+	// Mutual TLS: only clients with a certificate from this CA get through
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// listenAndServe serves an HTTP server over TLS when <prefix>_TLS_* is
+// configured and over plain HTTP otherwise
+func listenAndServe(s *config.Settings, server *http.Server, prefix string) error {
+	tlsConfig, err := serverTLSConfig(s, prefix)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS("", "")
+}
+
+// serveHTTP runs listenAndServe in the background and returns a function
+// shutting the server down, which gives open requests a few seconds to finish
+func serveHTTP(s *config.Settings, server *http.Server, prefix, name string) func() {
+	go func() {
+		if err := listenAndServe(s, server, prefix); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error serving %s: %v\n", name, err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	}
+}
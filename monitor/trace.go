@@ -0,0 +1,344 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// maxTraceHistory limits the number of trace reports kept in memory
+const maxTraceHistory = 20
+
+// traceHopSpacing is the gap between the probes of consecutive TTLs in a round
+const traceHopSpacing = 5 * time.Millisecond
+
+// traceWait is how long replies are awaited after the last round
+const traceWait = 2 * time.Second
+
+// TraceHop is the MTR-style statistics of one TTL
+type TraceHop struct {
+	TTL      int           `json:"ttl"`                // Probe TTL / hop limit
+	Address  string        `json:"address,omitempty"`  // Router that answered ("" if none did)
+	Sent     int           `json:"sent"`               // Probes sent with this TTL
+	Received int           `json:"received"`           // Time Exceeded, unreachable or echo replies
+	Loss     float64       `json:"loss"`               // Unanswered probes in percent
+	Avg      time.Duration `json:"avg_ns,omitempty"`   // Average round trip time
+	Best     time.Duration `json:"best_ns,omitempty"`  // Minimum round trip time
+	Worst    time.Duration `json:"worst_ns,omitempty"` // Maximum round trip time
+}
+
+// TraceReport is a path trace taken automatically when a test failed or
+// was slow, so the path at the time of the problem is on record
+type TraceReport struct {
+	Target    string     `json:"target"`          // Destination address traced
+	Reason    string     `json:"reason"`          // What triggered the trace
+	Reached   bool       `json:"reached"`         // The destination answered
+	Hops      []TraceHop `json:"hops,omitempty"`  // Statistics per TTL, nearest first
+	Error     string     `json:"error,omitempty"` // Why the trace could not run
+	Timestamp time.Time  `json:"timestamp"`       // Trace start
+}
+
+// String formats the hop report for the log file and the UI, one hop per line
+func (r TraceReport) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("to %s (%s): %s", r.Target, r.Reason, r.Error)
+	}
+	text := fmt.Sprintf("to %s (%s), reached=%v", r.Target, r.Reason, r.Reached)
+	for _, hop := range r.Hops {
+		text += fmt.Sprintf("\n  %2d. %-39s loss %5.1f%% sent %d avg %v best %v worst %v", hop.TTL, orDash(hop.Address),
+			hop.Loss, hop.Sent, hop.Avg.Round(10*time.Microsecond), hop.Best.Round(10*time.Microsecond), hop.Worst.Round(10*time.Microsecond))
+	}
+	return text
+}
+
+// listenTraceSocket opens a raw ICMP socket on the interface. Unlike echo
+// replies, Time Exceeded messages only reach raw sockets, so this needs
+// CAP_NET_RAW.
+func listenTraceSocket(iface string, v6 bool) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if v6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, fmt.Errorf("raw ICMP socket (needs CAP_NET_RAW): %v", err)
+	}
+	if err := probe.ConfigureICMPSocket(fd, iface, v6, false, false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "trace")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	return conn, err
+}
+
+// quotedEcho returns the identifier and sequence number of the echo request
+// quoted in a Time Exceeded or Destination Unreachable message
+func quotedEcho(data []byte, v6 bool) (int, int, bool) {
+	header := 40
+	if !v6 {
+		if len(data) < 1 {
+			return 0, 0, false
+		}
+		header = int(data[0]&0x0f) * 4
+	}
+	if len(data) < header+8 {
+		return 0, 0, false
+	}
+	echo := data[header:]
+	return int(echo[4])<<8 | int(echo[5]), int(echo[6])<<8 | int(echo[7]), true
+}
+
+// traceRoute sends rounds of echo requests with TTL 1..maxHops over the
+// interface and collects per-hop loss and round trip times like mtr
+func traceRoute(ctx context.Context, iface, target string, rounds, maxHops int) TraceReport {
+	report := TraceReport{Target: target, Timestamp: time.Now()}
+	addr, err := net.ResolveIPAddr("ip", target)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Target = addr.IP.String()
+	v6 := addr.IP.To4() == nil
+	conn, err := listenTraceSocket(iface, v6)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	defer conn.Close()
+
+	// Message types differ by family; the TTL is set per probe
+	request, reply, exceeded, unreachable, proto := icmp.Type(ipv4.ICMPTypeEcho), icmp.Type(ipv4.ICMPTypeEchoReply),
+		icmp.Type(ipv4.ICMPTypeTimeExceeded), icmp.Type(ipv4.ICMPTypeDestinationUnreachable), 1
+	setTTL := ipv4.NewPacketConn(conn).SetTTL
+	if v6 {
+		request, reply, exceeded, unreachable, proto = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply,
+			ipv6.ICMPTypeTimeExceeded, ipv6.ICMPTypeDestinationUnreachable, 58
+		setTTL = ipv6.NewPacketConn(conn).SetHopLimit
+	}
+	dst := &net.IPAddr{IP: addr.IP, Zone: addr.Zone}
+
+	// Sequence numbers carry the TTL and the round; send times are kept
+	// here because Time Exceeded only quotes the echo header
+	type probeKey struct{ ttl, round int }
+	var mu sync.Mutex
+	sent := make(map[probeKey]time.Time)
+	sentDone := make(chan struct{})
+	id := rand.Intn(1 << 16)
+	go func() {
+		defer close(sentDone)
+		for round := 0; round < rounds; round++ {
+			for ttl := 1; ttl <= maxHops; ttl++ {
+				if ctx.Err() != nil {
+					return
+				}
+				msg := icmp.Message{Type: request, Body: &icmp.Echo{ID: id, Seq: ttl<<8 | round, Data: make([]byte, 32)}}
+				packet, err := msg.Marshal(nil)
+				if err != nil || setTTL(ttl) != nil {
+					return
+				}
+				mu.Lock()
+				sent[probeKey{ttl, round}] = time.Now()
+				mu.Unlock()
+				conn.WriteTo(packet, dst)
+				time.Sleep(traceHopSpacing)
+			}
+			time.Sleep(probe.PingSpacing)
+		}
+	}()
+
+	// Replies are read until the wait after the last round has passed
+	type answer struct {
+		from string
+		rtt  time.Duration
+		dest bool
+	}
+	answers := make(map[probeKey]answer)
+	deadline := time.Now().Add(time.Duration(rounds)*(time.Duration(maxHops)*traceHopSpacing+probe.PingSpacing) + traceWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		received := time.Now()
+		if err != nil {
+			break
+		}
+
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		var echoID, seq int
+		dest := false
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if msg.Type != reply || !probe.AddrIP(from).Equal(addr.IP) {
+				continue
+			}
+			echoID, seq, dest = body.ID, body.Seq, true
+		case *icmp.TimeExceeded:
+			if msg.Type != exceeded {
+				continue
+			}
+			var ok bool
+			if echoID, seq, ok = quotedEcho(body.Data, v6); !ok {
+				continue
+			}
+		case *icmp.DstUnreach:
+			if msg.Type != unreachable {
+				continue
+			}
+			var ok bool
+			if echoID, seq, ok = quotedEcho(body.Data, v6); !ok {
+				continue
+			}
+			dest = probe.AddrIP(from).Equal(addr.IP)
+		default:
+			continue
+		}
+		key := probeKey{seq >> 8, seq & 0xff}
+		mu.Lock()
+		start, ok := sent[key]
+		mu.Unlock()
+		if echoID != id || !ok {
+			continue
+		}
+		if _, seen := answers[key]; !seen {
+			answers[key] = answer{from: probe.AddrIP(from).String(), rtt: received.Sub(start), dest: dest}
+		}
+	}
+	<-sentDone
+
+	// Hops beyond the first TTL that reached the destination only repeat it
+	last := maxHops
+	for key, a := range answers {
+		if a.dest && key.ttl <= last {
+			last = key.ttl
+			report.Reached = true
+		}
+	}
+	if !report.Reached {
+		// Keep one silent hop after the last router that answered
+		last = 0
+		for key := range answers {
+			last = max(last, key.ttl)
+		}
+		last = min(last+1, maxHops)
+	}
+	for ttl := 1; ttl <= last; ttl++ {
+		hop := TraceHop{TTL: ttl, Sent: rounds}
+		var total time.Duration
+		for round := 0; round < rounds; round++ {
+			a, ok := answers[probeKey{ttl, round}]
+			if !ok {
+				continue
+			}
+			if hop.Address == "" {
+				hop.Address = a.from
+			}
+			if hop.Received == 0 || a.rtt < hop.Best {
+				hop.Best = a.rtt
+			}
+			hop.Worst = max(hop.Worst, a.rtt)
+			total += a.rtt
+			hop.Received++
+		}
+		hop.Loss = 100 * float64(hop.Sent-hop.Received) / float64(hop.Sent)
+		if hop.Received > 0 {
+			hop.Avg = total / time.Duration(hop.Received)
+		}
+		report.Hops = append(report.Hops, hop)
+	}
+	return report
+}
+
+// traceTarget picks the address to trace after a test: the first target
+// that failed, else the headline target, else UPSTREAM_TARGET
+func (w *WiFiMonitor) traceTarget(test WiFiTest) string {
+	name := ""
+	for _, result := range test.Targets {
+		if !result.Success {
+			name = result.Name
+			break
+		}
+	}
+	if name == "" && len(test.Targets) > 0 {
+		name = test.Targets[0].Name
+	}
+	for _, target := range w.pingTargets {
+		if target.Name == name {
+			if address, _, err := resolvePingTarget(w.settings, w.wifiInterface, target); err == nil {
+				return address
+			}
+		}
+	}
+	return w.probeTarget("UPSTREAM_TARGET", "8.8.8.8")
+}
+
+// traceOnFailure starts a path trace in the background when a test failed
+// or its latency crossed TRACE_LATENCY_THRESHOLD, at most once per
+// TRACE_COOLDOWN and never while one is still running (TRACE_ON_FAILURE=false
+// turns it off). The report reaches the monitoring loop via traceReports.
+func (w *WiFiMonitor) traceOnFailure(test WiFiTest) {
+	if w.settings.Get("TRACE_ON_FAILURE") == "false" || w.tracing || time.Since(w.lastTrace) < w.settings.Duration("TRACE_COOLDOWN", 5*time.Minute) {
+		return
+	}
+	reason := ""
+	switch threshold := w.settings.Duration("TRACE_LATENCY_THRESHOLD", 0); {
+	case !test.Success:
+		reason = "test failed"
+	case threshold > 0 && test.Latency > threshold:
+		reason = fmt.Sprintf("latency %v above %v", test.Latency.Round(100*time.Microsecond), threshold)
+	default:
+		return
+	}
+	target := w.traceTarget(test)
+	if target == "" {
+		return
+	}
+
+	w.tracing, w.lastTrace = true, time.Now()
+	iface, rounds, maxHops := w.wifiInterface, w.settings.Int("TRACE_COUNT", 5), w.settings.Int("TRACE_MAX_HOPS", 30)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		report := traceRoute(ctx, iface, target, min(max(rounds, 1), 255), min(max(maxHops, 1), 64))
+		report.Reason = reason
+		w.traceReports <- report
+	}()
+}
+
+// noteTrace records a finished trace on the monitoring goroutine and adds
+// the path to the incident timeline
+func (w *WiFiMonitor) noteTrace(report TraceReport) {
+	w.tracing = false
+	w.traces = append(w.traces, report)
+	if len(w.traces) > maxTraceHistory {
+		w.traces = w.traces[len(w.traces)-maxTraceHistory:]
+	}
+	w.pendingTraces = append(w.pendingTraces, report)
+	w.writeJSONL("trace", report)
+	if w.incident != nil {
+		hops := make([]string, len(report.Hops))
+		for i, hop := range report.Hops {
+			hops[i] = fmt.Sprintf("%s %.0f%%", orDash(hop.Address), hop.Loss)
+		}
+		w.incident.add(report.Timestamp, "trace", fmt.Sprintf("trace to %s: %s", report.Target,
+			orDash(strings.Join(hops, " > ")+report.Error)))
+	}
+}
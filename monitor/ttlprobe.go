@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// ttlExceededPattern matches "From 10.0.0.1 icmp_seq=1 Time to live exceeded"
+var ttlExceededPattern = regexp.MustCompile(`(?m)^From (\S+?)(?: \(([\d.]+)\))?:? icmp_seq=\d+ Time to live exceeded`)
+
+// TTLHop is the loss observed for probes expiring at one TTL
+type TTLHop struct {
+	TTL       int     // Probe TTL
+	Responder string  // Router that returned Time Exceeded ("" if none answered)
+	Loss      float64 // Percentage of probes without a Time Exceeded reply
+}
+
+// TTLProbe compares loss at the first TTLs towards a far target. Each hop
+// answers with Time Exceeded even if it ignores pings addressed to itself.
+type TTLProbe struct {
+	Target    string    // Far target the probes are sent towards
+	Hops      []TTLHop  // Loss per TTL, starting at 1
+	Timestamp time.Time // Probe time
+}
+
+// pingTTL sends count probes with the given TTL and counts Time Exceeded replies
+func pingTTL(ctx context.Context, iface, target string, count, ttl int) TTLHop {
+	hop := TTLHop{TTL: ttl, Loss: 100}
+
+	output, _ := probe.CaptureCommand(ctx, "ping", "-I", iface, "-c", strconv.Itoa(count), "-i", "0.2", "-W", "2",
+		"-t", strconv.Itoa(ttl), "-n", target)
+
+	matches := ttlExceededPattern.FindAllStringSubmatch(string(output), -1)
+	if len(matches) > 0 {
+		hop.Responder = matches[0][1]
+		if matches[0][2] != "" {
+			hop.Responder = matches[0][2]
+		}
+	}
+	if count > 0 {
+		hop.Loss = 100 - float64(len(matches))/float64(count)*100
+		if hop.Loss < 0 {
+			hop.Loss = 0
+		}
+	}
+	return hop
+}
+
+// runTTLProbe measures loss at TTL 1..TTL_PROBE_MAX and attributes it to the
+// first hop (air interface and AP/gateway) or to the upstream network
+func (w *WiFiMonitor) runTTLProbe() {
+	probe := TTLProbe{
+		Target:    w.probeTarget("TTL_PROBE_TARGET", w.settings.String("UPSTREAM_TARGET", "8.8.8.8")),
+		Timestamp: time.Now(),
+	}
+	if probe.Target == "" {
+		return
+	}
+	count := w.settings.Int("TTL_PROBE_COUNT", 20)
+	ctx := w.probeContext()
+
+	for ttl := 1; ttl <= w.settings.Int("TTL_PROBE_MAX", 3); ttl++ {
+		probe.Hops = append(probe.Hops, pingTTL(ctx, w.wifiInterface, probe.Target, count, ttl))
+	}
+	w.ttlProbe = &probe
+
+	// Loss already present at TTL 1 is lost on the air or at the first router;
+	// loss that only appears at higher TTLs is upstream
+	threshold := float64(w.settings.Int("TTL_PROBE_LOSS_PERCENT", 10))
+	first := probe.Hops[0]
+	w.setAlert("first_hop_loss", first.Loss >= threshold,
+		fmt.Sprintf("%.0f%% of TTL=1 probes got no reply from the first hop %s (air interface or gateway loss)",
+			first.Loss, orDash(first.Responder)))
+}
+
+// String formats the probe for the log file
+func (p TTLProbe) String() string {
+	var hops []string
+	for _, hop := range p.Hops {
+		hops = append(hops, fmt.Sprintf("ttl%d %s %.0f%%", hop.TTL, orDash(hop.Responder), hop.Loss))
+	}
+	return fmt.Sprintf("towards %s: %s", p.Target, strings.Join(hops, " | "))
+}
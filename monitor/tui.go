@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"github.com/marokiki/noc-watch/ui"
+)
+
+// bindKeys sets up the dashboard keybindings
+func (w *WiFiMonitor) bindKeys() {
+	w.tui.Bind('s', w.showSilenceForm)
+	w.tui.Bind('S', w.showSilences)
+	w.tui.Bind('y', w.copyStatusLine)
+	w.tui.Bind('d', w.showRawOutputs)
+	w.tui.Bind('o', func() { w.cycleStatsSort(false) })
+	w.tui.Bind('O', func() { w.cycleStatsSort(true) })
+	w.tui.Bind('e', w.exportFromTUI)
+	w.tui.Bind('f', w.showFleet)
+}
+
+// showSilenceForm opens a dialog that creates a silence
+func (w *WiFiMonitor) showSilenceForm() {
+	fields := []ui.Field{
+		{Label: "Matchers", Value: "alertname=", Width: 40},
+		{Label: "Duration", Value: "1h", Width: 10},
+		{Label: "Reason", Width: 40},
+		{Label: "Author", Value: os.Getenv("USER"), Width: 20},
+	}
+	w.tui.ShowForm("silence", " Silence alerts (label=value, ...) ", fields, "Silence", func(form *ui.Form) {
+		matchers, err := parseMatchers(config.SplitList(form.Value("Matchers")))
+		duration, durErr := time.ParseDuration(form.Value("Duration"))
+		switch {
+		case err != nil:
+			form.SetError(err.Error())
+			return
+		case durErr != nil || duration <= 0:
+			form.SetError("invalid duration")
+			return
+		case strings.TrimSpace(form.Value("Reason")) == "":
+			form.SetError("a reason is required")
+			return
+		}
+
+		// The monitoring loop adds the silence, so it is sent off the UI goroutine
+		req, _ := json.Marshal(silenceRequest{Matchers: matchers, For: duration.String(), Reason: form.Value("Reason"), Author: form.Value("Author")})
+		go func() {
+			response, ok := w.command("silence add " + string(req))
+			if !ok {
+				return
+			}
+			w.tui.Queue(func() {
+				if message, failed := strings.CutPrefix(response, "error: "); failed {
+					form.SetError(strings.TrimSpace(message))
+					return
+				}
+				w.tui.Close("silence")
+			})
+		}()
+	})
+}
+
+// silenceColumns are the headers of the silence list in the TUI
+var silenceColumns = []string{"ID", "Matchers", "Until", "Author", "Reason"}
+
+// showSilences lists the active silences; Enter expires the selected one.
+// The silences are read and expired by the monitoring loop, so both run off
+// the UI goroutine.
+func (w *WiFiMonitor) showSilences() {
+	go func() {
+		response, ok := w.command("silence list")
+		if !ok {
+			return
+		}
+		var silences []Silence
+		err := json.Unmarshal([]byte(response), &silences)
+
+		w.tui.Queue(func() {
+			if err != nil {
+				w.tui.ShowMessage("silences", fmt.Sprintf("Error reading silences: %s", strings.TrimSpace(response)))
+				return
+			}
+
+			table := ui.Table{Title: " Active silences (Enter to expire, Esc to close) ", Headers: silenceColumns}
+			for _, silence := range silences {
+				var matchers []string
+				for label, value := range silence.Matchers {
+					matchers = append(matchers, label+"="+value)
+				}
+				sort.Strings(matchers)
+				table.Rows = append(table.Rows, []string{silence.ID, strings.Join(matchers, ","), silence.End.Format("2006-01-02 15:04"), silence.Author, silence.Reason})
+			}
+			w.tui.ShowTable("silences", table, func(row int) {
+				id := silences[row].ID
+				go func() {
+					if _, ok := w.command("silence expire " + id); !ok {
+						return
+					}
+					w.tui.Queue(func() { w.tui.Close("silences") })
+					w.showSilences()
+				}()
+			})
+		})
+	}()
+}
+
+// copyStatusLine copies the one-line status to the clipboard (OSC 52, which
+// also works over SSH) and shows it so it can be copied by hand otherwise
+func (w *WiFiMonitor) copyStatusLine() {
+	w.tui.Copy(w.statusText)
+	w.tui.ShowMessage("status", "Copied to clipboard:\n\n"+w.statusText)
+}
+
+// showRawOutputs opens a scrollable view of the recent raw probe outputs
+func (w *WiFiMonitor) showRawOutputs() {
+	w.tui.ShowText("debug", " Raw probe output (newest first, Esc to close) ", formatRawOutputs(w.rawOutputs.Recent("")))
+}
@@ -0,0 +1,36 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// version is the noc-watch release, set at build time with
+// -ldflags "-X github.com/marokiki/noc-watch/monitor.version=..." (see the Makefile)
+var version = "dev"
+
+// stamp identifies the build and configuration that produced exported data,
+// so numbers from different probe boxes can be checked for matching configs
+func (w *WiFiMonitor) stamp() string {
+	return fmt.Sprintf("version=%s config_hash=%s", version, w.configHash)
+}
+
+// runVersionCommand implements `noc-watch version`, printing this binary's
+// version and, when a monitor is running, the version and config hash it runs with
+func runVersionCommand(s *config.Settings, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: noc-watch version")
+		return exitUsage
+	}
+
+	fmt.Printf("noc-watch %s\n", version)
+	response, err := sendControl(s, "version")
+	if err != nil {
+		fmt.Println("running monitor: not reachable")
+		return exitOK
+	}
+	fmt.Printf("running monitor: %s", response)
+	return exitOK
+}
@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/probe"
+)
+
+// vlanIDPattern extracts the VLAN ID from `ip -d link show` output
+var vlanIDPattern = regexp.MustCompile(`vlan protocol \S+ id (\d+)`)
+
+// WiredTest represents a single wired uplink sanity test result
+type WiredTest struct {
+	Interface   string        // Wired interface under test
+	LinkUp      bool          // Carrier detected
+	Speed       int           // Negotiated speed in Mb/s (0 if unknown)
+	Duplex      string        // Negotiated duplex (Full/Half)
+	VLAN        string        // VLAN ID observed on the port ("" if untagged/unknown)
+	VLANOK      bool          // VLAN matches WIRED_VLAN (true when not configured)
+	DHCPTested  bool          // DHCP renewal was part of this test
+	DHCPTime    time.Duration // DHCP renewal time on the wired VLAN
+	DHCPSuccess bool          // DHCP renewal success
+	Success     bool          // Overall wired test success status
+	Timestamp   time.Time     // Test execution timestamp
+}
+
+// readEthtool returns link state, speed (Mb/s) and duplex of an interface
+func readEthtool(iface string) (bool, int, string) {
+	output, err := exec.Command("ethtool", iface).Output()
+	if err != nil {
+		return false, 0, ""
+	}
+
+	var linkUp bool
+	var speed int
+	var duplex string
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Speed":
+			speed, _ = strconv.Atoi(strings.TrimSuffix(value, "Mb/s"))
+		case "Duplex":
+			duplex = value
+		case "Link detected":
+			linkUp = value == "yes"
+		}
+	}
+	return linkUp, speed, duplex
+}
+
+// readVLANID returns the VLAN ID of a VLAN subinterface, falling back to the
+// VLAN advertised by the LLDP neighbor for untagged access ports
+func (w *WiFiMonitor) readVLANID(iface string) string {
+	if output, err := exec.Command("ip", "-d", "link", "show", iface).Output(); err == nil {
+		if m := vlanIDPattern.FindStringSubmatch(string(output)); m != nil {
+			return m[1]
+		}
+	}
+	if w.lldpNeighbor != nil {
+		return w.lldpNeighbor.VLAN
+	}
+	return ""
+}
+
+// runWiredTest checks link, speed/duplex and VLAN of the wired uplink
+func (w *WiFiMonitor) runWiredTest(withDHCP bool) {
+	test := WiredTest{Interface: w.wiredInterface, Timestamp: time.Now()}
+
+	test.LinkUp, test.Speed, test.Duplex = readEthtool(w.wiredInterface)
+
+	test.VLAN = w.readVLANID(w.wiredInterface)
+	expectedVLAN := w.settings.Get("WIRED_VLAN")
+	test.VLANOK = expectedVLAN == "" || test.VLAN == expectedVLAN
+
+	if withDHCP {
+		test.DHCPTested = true
+		dhcp := w.runProbe(probe.NewDHCPProbe(w.settings, w.wiredInterface), coreProbeTimeout)
+		test.DHCPTime, test.DHCPSuccess = dhcp.Latency, dhcp.Success
+	} else if w.wiredTest != nil && w.wiredTest.DHCPTested {
+		// Carry the last DHCP result forward between DHCP runs
+		test.DHCPTested = true
+		test.DHCPTime, test.DHCPSuccess = w.wiredTest.DHCPTime, w.wiredTest.DHCPSuccess
+	}
+
+	test.Success = test.LinkUp && test.Duplex != "Half" && test.VLANOK && (!test.DHCPTested || test.DHCPSuccess)
+	w.wiredTest = &test
+
+	w.setAlert("wired_link_down", !test.LinkUp,
+		fmt.Sprintf("No carrier on wired interface %s", test.Interface))
+	w.setAlert("wired_half_duplex", test.LinkUp && test.Duplex == "Half",
+		fmt.Sprintf("%s negotiated half duplex at %dMb/s", test.Interface, test.Speed))
+	w.setAlert("wired_vlan_mismatch", !test.VLANOK,
+		fmt.Sprintf("%s is on VLAN %q, expected %q", test.Interface, test.VLAN, expectedVLAN))
+	if withDHCP {
+		w.setAlert("wired_dhcp_failed", !test.DHCPSuccess,
+			fmt.Sprintf("DHCP renewal failed on wired interface %s", test.Interface))
+	}
+}
+
+// classifyUpstreamFailure checks a failed WiFi test against the wired
+// reference interface. When the upstream target is unreachable over the wire
+// as well, the failure lies beyond the access network and is not blamed on WiFi.
+func (w *WiFiMonitor) classifyUpstreamFailure(test *WiFiTest) {
+	if w.wiredInterface == "" || test.IPv4Connectivity {
+		return
+	}
+
+	// Same target as the WiFi connectivity test, so both paths are compared like for like
+	if stats := probe.PingSized(w.probeContext(), w.settings, w.wiredInterface, "8.8.8.8", 1, 0, false); stats.Loss >= 100 {
+		test.UpstreamFailure = true
+	}
+}
+
+// accessEstimate is the success rate of the RF/access layer: tests whose
+// failure the wired reference also saw are left out of the denominator
+func (w *WiFiMonitor) accessEstimate() rateEstimate {
+	return rateEstimate{successes: w.successCount, total: w.totalCount - w.upstreamFailures}
+}
+
+// String formats the wired test for logs
+func (t WiredTest) String() string {
+	s := fmt.Sprintf("Success=%v, Interface=%s, Link=%v, Speed=%dMb/s, Duplex=%s, VLAN=%s",
+		t.Success, t.Interface, t.LinkUp, t.Speed, t.Duplex, t.VLAN)
+	if t.DHCPTested {
+		s += fmt.Sprintf(", DHCP=%v (%v)", t.DHCPSuccess, t.DHCPTime)
+	}
+	return s
+}
@@ -0,0 +1,277 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// maxWPAEvents limits the supplicant events kept for the UI
+const maxWPAEvents = 20
+
+// wpaReconnectDelay is the pause before the control socket is opened again
+// after wpa_supplicant went away
+const wpaReconnectDelay = 10 * time.Second
+
+// wpaEventPrefixes maps the start of supplicant messages to event kinds
+var wpaEventPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"CTRL-EVENT-SCAN-STARTED", "scan_started"},
+	{"SME: Trying to authenticate with ", "auth_started"},
+	{"Trying to associate with ", "assoc_started"},
+	{"Associated with ", "associated"},
+	{"CTRL-EVENT-EAP-STARTED", "eap_started"},
+	{"CTRL-EVENT-EAP-SUCCESS", "eap_success"},
+	{"CTRL-EVENT-EAP-FAILURE", "eap_failure"},
+	{"CTRL-EVENT-EAP-TIMEOUT-FAILURE", "eap_timeout"},
+	{"WPA: Key negotiation completed", "handshake_completed"},
+	{"WPA: 4-Way Handshake failed", "handshake_failed"},
+	{"CTRL-EVENT-CONNECTED", "connected"},
+	{"CTRL-EVENT-DISCONNECTED", "disconnected"},
+	{"CTRL-EVENT-ASSOC-REJECT", "assoc_rejected"},
+	{"CTRL-EVENT-AUTH-REJECT", "auth_rejected"},
+	{"CTRL-EVENT-SSID-TEMP-DISABLED", "ssid_disabled"},
+}
+
+// wpaAuthFailures are the event kinds that mean the network refused the client
+var wpaAuthFailures = map[string]bool{
+	"eap_failure":      true,
+	"eap_timeout":      true,
+	"handshake_failed": true,
+	"assoc_rejected":   true,
+	"auth_rejected":    true,
+	"ssid_disabled":    true,
+}
+
+// WPAEvent is an association, handshake or EAP event from wpa_supplicant
+type WPAEvent struct {
+	Kind      string         `json:"event"`            // Event kind (e.g. associated, eap_failure)
+	Text      string         `json:"text"`             // Supplicant message without the priority
+	Timing    *WPAConnection `json:"timing,omitempty"` // Phases of the connection (connected events only)
+	Timestamp time.Time      `json:"timestamp"`        // Time the event was received
+}
+
+// WPAConnection times the phases of one connection from the supplicant's events
+type WPAConnection struct {
+	Association time.Duration `json:"association_ns"`         // Authentication and association with the AP
+	EAP         time.Duration `json:"eap_ns,omitempty"`       // 802.1X/EAP exchange (enterprise networks only)
+	Handshake   time.Duration `json:"handshake_ns,omitempty"` // 4-way handshake until the keys are installed
+	Total       time.Duration `json:"total_ns"`               // First event of the attempt until connected
+}
+
+// String formats the connection phases for the UI and the log
+func (c WPAConnection) String() string {
+	text := fmt.Sprintf("%v (association %v", c.Total.Round(time.Millisecond), c.Association.Round(time.Millisecond))
+	if c.EAP > 0 {
+		text += fmt.Sprintf(", EAP %v", c.EAP.Round(time.Millisecond))
+	}
+	if c.Handshake > 0 {
+		text += fmt.Sprintf(", handshake %v", c.Handshake.Round(time.Millisecond))
+	}
+	return text + ")"
+}
+
+// String formats the event for the UI and the log
+func (e WPAEvent) String() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Timestamp.Format("15:04:05.000"), e.Kind, e.Text)
+}
+
+// parseWPAEvent recognizes an unsolicited supplicant message such as
+// "<3>CTRL-EVENT-EAP-FAILURE EAP authentication failed"
+func parseWPAEvent(message string, now time.Time) (WPAEvent, bool) {
+	if strings.HasPrefix(message, "<") {
+		if _, rest, ok := strings.Cut(message, ">"); ok {
+			message = rest
+		}
+	}
+	message = strings.TrimSpace(message)
+	for _, p := range wpaEventPrefixes {
+		if strings.HasPrefix(message, p.prefix) {
+			return WPAEvent{Kind: p.kind, Text: message, Timestamp: now}, true
+		}
+	}
+	return WPAEvent{}, false
+}
+
+// wpaControlPath returns the control socket of the interface's supplicant
+// from WPA_CTRL_DIR, or "" when event capture is off (WPA_EVENTS=false) or
+// no supplicant runs
+func wpaControlPath(s *config.Settings, iface string) string {
+	if s.Get("WPA_EVENTS") == "false" {
+		return ""
+	}
+	path := filepath.Join(s.String("WPA_CTRL_DIR", "/var/run/wpa_supplicant"), iface)
+	if _, err := os.Stat(path); err != nil {
+		if s.Get("WPA_EVENTS") == "true" {
+			fmt.Printf("Error opening wpa_supplicant control socket: %v\n", err)
+		}
+		return ""
+	}
+	return path
+}
+
+// attachWPA opens a control connection to the supplicant and subscribes to
+// its events. The client socket needs its own path for the replies.
+func attachWPA(path string) (*net.UnixConn, string, error) {
+	local := filepath.Join(os.TempDir(), fmt.Sprintf("noc-watch-wpa-%d-%s", os.Getpid(), filepath.Base(path)))
+	os.Remove(local)
+	conn, err := net.DialUnix("unixgram", &net.UnixAddr{Name: local, Net: "unixgram"}, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := conn.Write([]byte("ATTACH")); err != nil {
+		conn.Close()
+		os.Remove(local)
+		return nil, "", err
+	}
+
+	// Events may arrive before the reply to ATTACH
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			conn.Close()
+			os.Remove(local)
+			return nil, "", err
+		}
+		if reply := strings.TrimSpace(string(buf[:n])); reply == "OK" {
+			break
+		} else if reply == "FAIL" {
+			conn.Close()
+			os.Remove(local)
+			return nil, "", fmt.Errorf("supplicant refused ATTACH")
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, local, nil
+}
+
+// startWPAListener follows the supplicant's events and forwards them to the
+// monitoring loop, reattaching when wpa_supplicant restarts
+func (w *WiFiMonitor) startWPAListener(path string) {
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			conn, local, err := attachWPA(path)
+			if err != nil {
+				fmt.Printf("Error attaching to wpa_supplicant: %v\n", err)
+				time.Sleep(wpaReconnectDelay)
+				continue
+			}
+			for {
+				n, err := conn.Read(buf)
+				if err != nil {
+					break
+				}
+				event, ok := parseWPAEvent(string(buf[:n]), time.Now())
+				if !ok {
+					continue
+				}
+				select {
+				case w.wpaEvents <- event:
+				default: // The loop is busy; the event is lost rather than stalling the socket
+				}
+			}
+			conn.Close()
+			os.Remove(local)
+			time.Sleep(wpaReconnectDelay)
+		}
+	}()
+}
+
+// noteWPAEvent records a supplicant event on the monitoring goroutine. The
+// events of an attempt are timed into phases once it connects; refusals by
+// the network raise wifi_auth_failed and mark failed tests until the next
+// successful connection, so they no longer look like DHCP failures.
+func (w *WiFiMonitor) noteWPAEvent(event WPAEvent) {
+	switch {
+	case event.Kind == "connected":
+		event.Timing = wpaConnectionTiming(w.wpaAttempt, event.Timestamp)
+		if event.Timing != nil {
+			w.wpaConnection = event.Timing
+		}
+		w.wpaAttempt = nil
+		w.authFailure = nil
+		w.setAlert("wifi_auth_failed", false, fmt.Sprintf("%s connected again", w.wifiInterface))
+	case wpaAuthFailures[event.Kind]:
+		w.wpaAttempt = nil
+		w.authFailure = &event
+		w.setAlert("wifi_auth_failed", true, fmt.Sprintf("Authentication with the WiFi network failed on %s: %s",
+			w.wifiInterface, event.Text))
+	case event.Kind != "disconnected":
+		if w.wpaAttempt == nil {
+			w.wpaAttempt = make(map[string]time.Time)
+		}
+		if _, seen := w.wpaAttempt[event.Kind]; !seen {
+			w.wpaAttempt[event.Kind] = event.Timestamp
+		}
+	}
+
+	w.wpaEventLog = append(w.wpaEventLog, event)
+	if len(w.wpaEventLog) > maxWPAEvents {
+		w.wpaEventLog = w.wpaEventLog[len(w.wpaEventLog)-maxWPAEvents:]
+	}
+	w.writeJSONL("wpa", event)
+	if w.incident != nil && (event.Kind == "connected" || event.Kind == "disconnected" || wpaAuthFailures[event.Kind]) {
+		w.incident.add(event.Timestamp, "wpa", event.Kind+": "+event.Text)
+	}
+}
+
+// wpaConnectionTiming splits an attempt into association, EAP and
+// handshake phases from the first time each event was seen
+func wpaConnectionTiming(attempt map[string]time.Time, connected time.Time) *WPAConnection {
+	first := func(kinds ...string) time.Time {
+		for _, kind := range kinds {
+			if t, ok := attempt[kind]; ok {
+				return t
+			}
+		}
+		return time.Time{}
+	}
+	start := first("auth_started", "assoc_started")
+	associated := first("associated")
+	if start.IsZero() || associated.IsZero() {
+		return nil
+	}
+
+	timing := &WPAConnection{Association: associated.Sub(start), Total: connected.Sub(first("scan_started", "auth_started", "assoc_started"))}
+	handshakeStart := associated
+	if eapStart, eapEnd := first("eap_started"), first("eap_success"); !eapStart.IsZero() && !eapEnd.IsZero() {
+		timing.EAP = eapEnd.Sub(eapStart)
+		handshakeStart = eapEnd
+	}
+	if keys := first("handshake_completed"); !keys.IsZero() {
+		timing.Handshake = keys.Sub(handshakeStart)
+	}
+	return timing
+}
+
+// attachAuthFailure marks a failed test with the authentication failure
+// that has not been followed by a successful connection yet
+func (w *WiFiMonitor) attachAuthFailure(test *WiFiTest) {
+	if w.authFailure != nil && !test.Success {
+		test.AuthFailure = w.authFailure.Text
+	}
+}
+
+// wpaSummary describes the supplicant's latest connection or pending
+// authentication failure for the UI and the log
+func (w *WiFiMonitor) wpaSummary() string {
+	switch {
+	case w.authFailure != nil:
+		return fmt.Sprintf("auth failing since %s: %s", w.authFailure.Timestamp.Format("15:04:05"), w.authFailure.Text)
+	case w.wpaConnection != nil:
+		return "connected in " + w.wpaConnection.String()
+	case len(w.wpaEventLog) > 0:
+		return w.wpaEventLog[len(w.wpaEventLog)-1].String()
+	}
+	return ""
+}
@@ -0,0 +1,528 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// D-Bus message types
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+)
+
+// D-Bus header field codes
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+)
+
+// dbusMaxMessage bounds the size of a message read from the bus
+const dbusMaxMessage = 16 << 20
+
+// dbusConn is a connection to the system bus, enough to call methods and
+// read properties of system services
+type dbusConn struct {
+	conn   net.Conn      // Bus socket
+	reader *bufio.Reader // Buffered reads of the socket
+	serial uint32        // Serial of the last message sent
+}
+
+// dbusMessage is a decoded message header and body
+type dbusMessage struct {
+	kind        byte          // Message type
+	replySerial uint32        // Serial of the call this message answers
+	errorName   string        // Error name of error replies
+	body        []interface{} // Decoded body values
+}
+
+// dialSystemBus connects to the system bus from DBUS_SYSTEM_BUS_ADDRESS
+// (unix:path=... only), authenticates as the current user and says Hello
+func dialSystemBus(ctx context.Context) (*dbusConn, error) {
+	path, err := systemBusPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	// SASL EXTERNAL authenticates with the uid the kernel reports for the socket
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		conn.Close()
+		return nil, fmt.Errorf("bus authentication rejected: %s", strings.TrimSpace(line))
+	}
+	if _, err := conn.Write([]byte("BEGIN\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// systemBusPath returns the socket of the system bus
+func systemBusPath() (string, error) {
+	address := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+	if address == "" {
+		return "/run/dbus/system_bus_socket", nil
+	}
+	p, ok := strings.CutPrefix(address, "unix:path=")
+	if !ok {
+		return "", fmt.Errorf("unsupported bus address %s", address)
+	}
+	path, _, _ := strings.Cut(p, ",")
+	return path, nil
+}
+
+// Close closes the bus connection
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+// call invokes a method and waits for its reply. Arguments are basic
+// values (s, o, g, u, b) matching the signature.
+func (c *dbusConn) call(destination, path, iface, member, signature string, args ...interface{}) ([]interface{}, error) {
+	c.serial++
+	serial := c.serial
+
+	body := &dbusEncoder{}
+	types := dbusSplitSignature(signature)
+	if len(types) != len(args) {
+		return nil, fmt.Errorf("%s: %d arguments for signature %q", member, len(args), signature)
+	}
+	for i, t := range types {
+		if err := body.basic(t, args[i]); err != nil {
+			return nil, fmt.Errorf("%s: %v", member, err)
+		}
+	}
+
+	// Fixed header, then the header fields as an array of (code, variant)
+	msg := &dbusEncoder{}
+	msg.buf = append(msg.buf, 'l', dbusMethodCall, 0, 1)
+	msg.uint32(uint32(len(body.buf)))
+	msg.uint32(serial)
+	lengthAt := len(msg.buf)
+	msg.uint32(0)
+	msg.align(8)
+	fieldsStart := len(msg.buf)
+	field := func(code byte, signature string, value interface{}) {
+		msg.align(8)
+		msg.buf = append(msg.buf, code)
+		msg.signature(signature)
+		msg.basic(signature, value)
+	}
+	field(dbusFieldPath, "o", path)
+	field(dbusFieldInterface, "s", iface)
+	field(dbusFieldMember, "s", member)
+	field(dbusFieldDestination, "s", destination)
+	if signature != "" {
+		field(dbusFieldSignature, "g", signature)
+	}
+	binary.LittleEndian.PutUint32(msg.buf[lengthAt:], uint32(len(msg.buf)-fieldsStart))
+	msg.align(8)
+	msg.buf = append(msg.buf, body.buf...)
+	if _, err := c.conn.Write(msg.buf); err != nil {
+		return nil, err
+	}
+
+	// Signals and replies to other calls may arrive first
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if reply.replySerial != serial {
+			continue
+		}
+		switch reply.kind {
+		case dbusMethodReturn:
+			return reply.body, nil
+		case dbusError:
+			if len(reply.body) > 0 {
+				if text, ok := reply.body[0].(string); ok {
+					return nil, fmt.Errorf("%s: %s", reply.errorName, text)
+				}
+			}
+			return nil, errors.New(reply.errorName)
+		}
+	}
+}
+
+// read reads and decodes the next message from the bus
+func (c *dbusConn) read() (dbusMessage, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, head); err != nil {
+		return dbusMessage{}, err
+	}
+	var order binary.ByteOrder
+	switch head[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return dbusMessage{}, fmt.Errorf("invalid bus message endianness %q", head[0])
+	}
+	bodyLength, fieldsLength := order.Uint32(head[4:]), order.Uint32(head[12:])
+	if bodyLength > dbusMaxMessage || fieldsLength > dbusMaxMessage {
+		return dbusMessage{}, errors.New("bus message too large")
+	}
+	headerLength := 16 + int(fieldsLength)
+	headerLength += (8 - headerLength%8) % 8
+	buf := make([]byte, headerLength+int(bodyLength))
+	copy(buf, head)
+	if _, err := io.ReadFull(c.reader, buf[16:]); err != nil {
+		return dbusMessage{}, err
+	}
+
+	// Header fields
+	d := &dbusDecoder{buf: buf[:headerLength], pos: 12, order: order}
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return dbusMessage{}, err
+	}
+	msg := dbusMessage{kind: head[1]}
+	signature := ""
+	for _, f := range fields.([]interface{}) {
+		pair := f.([]interface{})
+		code, _ := pair[0].(byte)
+		switch code {
+		case dbusFieldReplySerial:
+			msg.replySerial, _ = pair[1].(uint32)
+		case dbusFieldErrorName:
+			msg.errorName, _ = pair[1].(string)
+		case dbusFieldSignature:
+			signature, _ = pair[1].(string)
+		}
+	}
+
+	// Body
+	d = &dbusDecoder{buf: buf[headerLength:], order: order}
+	for _, t := range dbusSplitSignature(signature) {
+		value, err := d.value(t)
+		if err != nil {
+			return dbusMessage{}, err
+		}
+		msg.body = append(msg.body, value)
+	}
+	return msg, nil
+}
+
+// dbusSplitSignature splits a signature into its complete types
+func dbusSplitSignature(signature string) []string {
+	var types []string
+	for signature != "" {
+		n := dbusTypeLength(signature)
+		if n == 0 {
+			break
+		}
+		types = append(types, signature[:n])
+		signature = signature[n:]
+	}
+	return types
+}
+
+// dbusTypeLength returns the length of the first complete type of a
+// signature (0 if it is malformed)
+func dbusTypeLength(signature string) int {
+	if signature == "" {
+		return 0
+	}
+	switch signature[0] {
+	case 'a':
+		n := dbusTypeLength(signature[1:])
+		if n == 0 {
+			return 0
+		}
+		return 1 + n
+	case '(', '{':
+		closing := map[byte]byte{'(': ')', '{': '}'}[signature[0]]
+		i, fields := 1, 0
+		for i < len(signature) && signature[i] != closing {
+			n := dbusTypeLength(signature[i:])
+			if n == 0 {
+				return 0
+			}
+			i += n
+			fields++
+		}
+		// Structs have at least one field, dict entries a key and a value
+		if i >= len(signature) || fields == 0 || (closing == '}' && fields != 2) {
+			return 0
+		}
+		return i + 1
+	}
+	if strings.IndexByte("ybnqiuxtdhsogv", signature[0]) < 0 {
+		return 0
+	}
+	return 1
+}
+
+// dbusAlignment returns the alignment of a type by its first character
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// dbusEncoder marshals basic values in little-endian wire format
+type dbusEncoder struct {
+	buf []byte // Encoded message so far
+}
+
+// align pads the buffer to a multiple of n
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// uint32 appends an aligned 32-bit value
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+// signature appends a signature value
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// basic appends a string, object path, signature, uint32 or boolean
+func (e *dbusEncoder) basic(t string, value interface{}) error {
+	switch t {
+	case "s", "o", "g":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%T is not a string", value)
+		}
+		if t == "g" {
+			e.signature(s)
+			return nil
+		}
+		e.uint32(uint32(len(s)))
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, 0)
+	case "u":
+		v, ok := value.(uint32)
+		if !ok {
+			return fmt.Errorf("%T is not a uint32", value)
+		}
+		e.uint32(v)
+	case "b":
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%T is not a bool", value)
+		}
+		if v {
+			e.uint32(1)
+		} else {
+			e.uint32(0)
+		}
+	default:
+		return fmt.Errorf("unsupported argument type %s", t)
+	}
+	return nil
+}
+
+// dbusDecoder unmarshals values of any type. Arrays become []interface{}
+// ([]byte for ay, map[string]interface{} for string-keyed dicts), structs
+// []interface{}, and variants their contained value.
+type dbusDecoder struct {
+	buf   []byte           // Message part being decoded
+	pos   int              // Read position
+	order binary.ByteOrder // Byte order of the message
+}
+
+// align skips padding to a multiple of n
+func (d *dbusDecoder) align(n int) error {
+	d.pos += (n - d.pos%n) % n
+	if d.pos > len(d.buf) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// next returns the next n bytes
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// value decodes one value of a complete type
+func (d *dbusDecoder) value(t string) (interface{}, error) {
+	if err := d.align(dbusAlignment(t[0])); err != nil {
+		return nil, err
+	}
+	switch t[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'n', 'q':
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'b', 'i', 'u', 'h':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		v := d.order.Uint32(b)
+		switch t[0] {
+		case 'b':
+			return v != 0, nil
+		case 'i':
+			return int32(v), nil
+		}
+		return v, nil
+	case 'x', 't', 'd':
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		v := d.order.Uint64(b)
+		switch t[0] {
+		case 'x':
+			return int64(v), nil
+		case 'd':
+			return math.Float64frombits(v), nil
+		}
+		return v, nil
+	case 's', 'o':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		signature, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		inner := signature.(string)
+		if inner == "" || dbusTypeLength(inner) != len(inner) {
+			return nil, fmt.Errorf("invalid variant signature %q", inner)
+		}
+		return d.value(inner)
+	case 'a':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		length := int(d.order.Uint32(b))
+		elem := t[1:]
+		if err := d.align(dbusAlignment(elem[0])); err != nil {
+			return nil, err
+		}
+		end := d.pos + length
+		if end > len(d.buf) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if elem == "y" {
+			return d.next(length)
+		}
+		if strings.HasPrefix(elem, "{s") {
+			dict := make(map[string]interface{})
+			for d.pos < end {
+				entry, err := d.value(elem)
+				if err != nil {
+					return nil, err
+				}
+				pair := entry.([]interface{})
+				dict[pair[0].(string)] = pair[1]
+			}
+			return dict, nil
+		}
+		var items []interface{}
+		for d.pos < end {
+			item, err := d.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case '(', '{':
+		var fields []interface{}
+		for _, ft := range dbusSplitSignature(t[1 : len(t)-1]) {
+			field, err := d.value(ft)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("unsupported bus type %q", t)
+}
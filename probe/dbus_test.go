@@ -0,0 +1,373 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDBusTypeLength(t *testing.T) {
+	tests := []struct {
+		signature string
+		want      int
+	}{
+		{signature: "", want: 0},
+		{signature: "y", want: 1},
+		{signature: "su", want: 1},
+		{signature: "as", want: 2},
+		{signature: "a", want: 0},
+		{signature: "aa{sv}", want: 6},
+		{signature: "a{sv}u", want: 5},
+		{signature: "(yv)", want: 4},
+		{signature: "(a{sv}(ii))x", want: 11},
+		{signature: "(", want: 0},
+		{signature: "(ss", want: 0},
+		{signature: "()", want: 0},
+		{signature: "a()", want: 0},
+		{signature: "{s}", want: 0},
+		{signature: "a{sss}", want: 0},
+		{signature: ")", want: 0},
+		{signature: "z", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			if got := dbusTypeLength(tt.signature); got != tt.want {
+				t.Errorf("dbusTypeLength(%q) = %d, want %d", tt.signature, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBusSplitSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		want      []string
+	}{
+		{signature: "", want: nil},
+		{signature: "s", want: []string{"s"}},
+		{signature: "sa{sv}as", want: []string{"s", "a{sv}", "as"}},
+		{signature: "a(yv)u", want: []string{"a(yv)", "u"}},
+		{signature: "su)", want: []string{"s", "u"}},
+		{signature: "a", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signature, func(t *testing.T) {
+			if got := dbusSplitSignature(tt.signature); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dbusSplitSignature(%q) = %q, want %q", tt.signature, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBusDecoderValue(t *testing.T) {
+	float := binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5))
+	tests := []struct {
+		name    string
+		t       string
+		buf     []byte
+		order   binary.ByteOrder // Little endian when nil
+		want    interface{}
+		wantErr string
+	}{
+		{name: "byte", t: "y", buf: []byte{42}, want: byte(42)},
+		{name: "boolean", t: "b", buf: []byte{1, 0, 0, 0}, want: true},
+		{name: "int16", t: "n", buf: []byte{0xfe, 0xff}, want: int16(-2)},
+		{name: "uint16", t: "q", buf: []byte{0x6c, 0x09}, want: uint16(2412)},
+		{name: "int32", t: "i", buf: []byte{0xc4, 0xff, 0xff, 0xff}, want: int32(-60)},
+		{name: "uint32", t: "u", buf: []byte{5, 0, 0, 0}, want: uint32(5)},
+		{name: "uint32 big endian", t: "u", buf: []byte{0, 0, 0, 5}, order: binary.BigEndian, want: uint32(5)},
+		{name: "int64", t: "x", buf: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: int64(-1)},
+		{name: "uint64", t: "t", buf: []byte{0, 0, 0, 0, 1, 0, 0, 0}, want: uint64(1 << 32)},
+		{name: "double", t: "d", buf: float, want: 1.5},
+		{name: "string", t: "s", buf: []byte{3, 0, 0, 0, 'a', 'b', 'c', 0}, want: "abc"},
+		{name: "object path", t: "o", buf: []byte{1, 0, 0, 0, '/', 0}, want: "/"},
+		{name: "signature", t: "g", buf: []byte{2, 'a', 's', 0}, want: "as"},
+		{name: "variant", t: "v", buf: []byte{1, 'u', 0, 0, 5, 0, 0, 0}, want: uint32(5)},
+		{name: "byte array", t: "ay", buf: []byte{3, 0, 0, 0, 1, 2, 3}, want: []byte{1, 2, 3}},
+		{name: "uint32 array", t: "au", buf: []byte{8, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0}, want: []interface{}{uint32(1), uint32(2)}},
+		{name: "empty struct array", t: "a(yv)", buf: []byte{0, 0, 0, 0, 0, 0, 0, 0}, want: []interface{}(nil)},
+		{
+			name: "string dict",
+			t:    "a{sv}",
+			buf:  []byte{10, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 'k', 0, 1, 'y', 0, 42},
+			want: map[string]interface{}{"k": byte(42)},
+		},
+		{name: "struct", t: "(ys)", buf: []byte{7, 0, 0, 0, 1, 0, 0, 0, 'z', 0}, want: []interface{}{byte(7), "z"}},
+		{name: "empty variant signature", t: "v", buf: []byte{0, 0, 0, 0}, wantErr: "invalid variant signature"},
+		{name: "incomplete variant signature", t: "v", buf: []byte{1, 'a', 0, 0, 0, 0, 0, 0}, wantErr: "invalid variant signature"},
+		{name: "empty struct in variant", t: "v", buf: []byte{2, '(', ')', 0, 0, 0, 0, 0}, wantErr: "invalid variant signature"},
+		{name: "two types in variant", t: "v", buf: []byte{2, 'y', 'y', 0, 1, 2}, wantErr: "invalid variant signature"},
+		{name: "string length beyond buffer", t: "s", buf: []byte{0xff, 0xff, 0xff, 0xff, 'a', 0}, wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "array length beyond buffer", t: "au", buf: []byte{16, 0, 0, 0, 1, 0, 0, 0}, wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "unsupported type", t: "z", buf: []byte{0}, wantErr: "unsupported bus type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			if order == nil {
+				order = binary.LittleEndian
+			}
+			d := &dbusDecoder{buf: tt.buf, order: order}
+			got, err := d.value(tt.t)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("value(%q): %v", tt.t, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value(%q) = %#v, want %#v", tt.t, got, tt.want)
+			}
+			if d.pos != len(tt.buf) {
+				t.Errorf("decoded %d of %d bytes", d.pos, len(tt.buf))
+			}
+
+			// Every shorter buffer is an error, never a panic
+			for n := 0; n < len(tt.buf); n++ {
+				d := &dbusDecoder{buf: tt.buf[:n], order: order}
+				if value, err := d.value(tt.t); err == nil {
+					t.Errorf("value(%q) of %d bytes = %#v, want an error", tt.t, n, value)
+				}
+			}
+		})
+	}
+}
+
+// dbusTestMessage encodes a message the way call does, with the header
+// fields a reply carries
+func dbusTestMessage(kind byte, replySerial uint32, errorName, signature string, body []byte) []byte {
+	msg := &dbusEncoder{}
+	msg.buf = append(msg.buf, 'l', kind, 0, 1)
+	msg.uint32(uint32(len(body)))
+	msg.uint32(1)
+	lengthAt := len(msg.buf)
+	msg.uint32(0)
+	field := func(code byte, signature string, value interface{}) {
+		msg.align(8)
+		msg.buf = append(msg.buf, code)
+		msg.signature(signature)
+		msg.basic(signature, value)
+	}
+	if replySerial != 0 {
+		field(dbusFieldReplySerial, "u", replySerial)
+	}
+	if errorName != "" {
+		field(dbusFieldErrorName, "s", errorName)
+	}
+	if signature != "" {
+		field(dbusFieldSignature, "g", signature)
+	}
+	binary.LittleEndian.PutUint32(msg.buf[lengthAt:], uint32(len(msg.buf)-16))
+	msg.align(8)
+	return append(msg.buf, body...)
+}
+
+// dbusTestBody encodes basic values matching a signature
+func dbusTestBody(signature string, args ...interface{}) []byte {
+	body := &dbusEncoder{}
+	for i, t := range dbusSplitSignature(signature) {
+		body.basic(t, args[i])
+	}
+	return body.buf
+}
+
+func TestDBusRead(t *testing.T) {
+	reply := dbusTestMessage(dbusMethodReturn, 3, "", "su", dbusTestBody("su", "ok", uint32(9)))
+	tooLarge := append([]byte(nil), reply...)
+	binary.LittleEndian.PutUint32(tooLarge[4:], dbusMaxMessage+1)
+	badEndianness := append([]byte(nil), reply...)
+	badEndianness[0] = 'x'
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    dbusMessage
+		wantErr string
+	}{
+		{
+			name: "method return",
+			data: reply,
+			want: dbusMessage{kind: dbusMethodReturn, replySerial: 3, body: []interface{}{"ok", uint32(9)}},
+		},
+		{
+			name: "error reply",
+			data: dbusTestMessage(dbusError, 4, "org.freedesktop.DBus.Error.ServiceUnknown", "s", dbusTestBody("s", "not activatable")),
+			want: dbusMessage{kind: dbusError, replySerial: 4, errorName: "org.freedesktop.DBus.Error.ServiceUnknown", body: []interface{}{"not activatable"}},
+		},
+		{
+			name: "signal without body",
+			data: dbusTestMessage(4, 0, "", "", nil),
+			want: dbusMessage{kind: 4},
+		},
+		{name: "empty stream", data: nil, wantErr: io.EOF.Error()},
+		{name: "short header", data: reply[:10], wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "bad endianness", data: badEndianness, wantErr: "invalid bus message endianness"},
+		{name: "too large", data: tooLarge, wantErr: "too large"},
+		{name: "truncated header fields", data: reply[:20], wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated body", data: reply[:len(reply)-1], wantErr: io.ErrUnexpectedEOF.Error()},
+		{
+			name:    "string beyond the body",
+			data:    dbusTestMessage(dbusMethodReturn, 3, "", "s", []byte{9, 0, 0, 0, 'o', 'k', 0}),
+			wantErr: io.ErrUnexpectedEOF.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &dbusConn{reader: bufio.NewReader(bytes.NewReader(tt.data))}
+			got, err := c.read()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBusCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies [][]byte // Messages the bus sends after reading the call
+		want    []interface{}
+		wantErr string
+	}{
+		{
+			name: "reply after a signal and another reply",
+			replies: [][]byte{
+				dbusTestMessage(4, 0, "", "s", dbusTestBody("s", "signal")),
+				dbusTestMessage(dbusMethodReturn, 99, "", "s", dbusTestBody("s", "other")),
+				dbusTestMessage(dbusMethodReturn, 1, "", "s", dbusTestBody("s", "pong")),
+			},
+			want: []interface{}{"pong"},
+		},
+		{
+			name:    "error reply",
+			replies: [][]byte{dbusTestMessage(dbusError, 1, "org.example.Error.Failed", "s", dbusTestBody("s", "no such thing"))},
+			wantErr: "org.example.Error.Failed: no such thing",
+		},
+		{
+			name:    "error reply without text",
+			replies: [][]byte{dbusTestMessage(dbusError, 1, "org.example.Error.Failed", "", nil)},
+			wantErr: "org.example.Error.Failed",
+		},
+		{
+			name:    "bus closes",
+			replies: nil,
+			wantErr: io.EOF.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			called := make(chan dbusMessage, 1)
+			go func() {
+				defer server.Close()
+				bus := &dbusConn{conn: server, reader: bufio.NewReader(server)}
+				msg, err := bus.read()
+				if err != nil {
+					close(called)
+					return
+				}
+				called <- msg
+				for _, reply := range tt.replies {
+					if _, err := server.Write(reply); err != nil {
+						return
+					}
+				}
+			}()
+
+			c := &dbusConn{conn: client, reader: bufio.NewReader(client)}
+			got, err := c.call("org.example", "/org/example", "org.example.Test", "Ping", "su", "hi", uint32(7))
+			msg, ok := <-called
+			if !ok {
+				t.Fatal("the bus could not decode the call")
+			}
+			if msg.kind != dbusMethodCall || !reflect.DeepEqual(msg.body, []interface{}{"hi", uint32(7)}) {
+				t.Errorf("bus read %+v, want a method call with hi, 7", msg)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("call: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("call() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("arguments not matching the signature", func(t *testing.T) {
+		c := &dbusConn{}
+		if _, err := c.call("org.example", "/", "org.example.Test", "Ping", "su", "hi"); err == nil {
+			t.Error("call with a missing argument succeeded")
+		}
+		if _, err := c.call("org.example", "/", "org.example.Test", "Ping", "u", "hi"); err == nil {
+			t.Error("call with a string for u succeeded")
+		}
+	})
+}
+
+func TestDBusEncoderBasic(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  []byte // Bytes already in the buffer
+		t       string
+		value   interface{}
+		want    []byte
+		wantErr string
+	}{
+		{name: "string", t: "s", value: "ab", want: []byte{2, 0, 0, 0, 'a', 'b', 0}},
+		{name: "string aligned", prefix: []byte{1}, t: "s", value: "", want: []byte{1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "object path", t: "o", value: "/", want: []byte{1, 0, 0, 0, '/', 0}},
+		{name: "signature unaligned", prefix: []byte{1}, t: "g", value: "s", want: []byte{1, 1, 's', 0}},
+		{name: "uint32", t: "u", value: uint32(258), want: []byte{2, 1, 0, 0}},
+		{name: "true", t: "b", value: true, want: []byte{1, 0, 0, 0}},
+		{name: "false", t: "b", value: false, want: []byte{0, 0, 0, 0}},
+		{name: "int for a string", t: "s", value: 1, wantErr: "int is not a string"},
+		{name: "int for a uint32", t: "u", value: 1, wantErr: "int is not a uint32"},
+		{name: "string for a bool", t: "b", value: "true", wantErr: "string is not a bool"},
+		{name: "unsupported type", t: "x", value: int64(1), wantErr: "unsupported argument type x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &dbusEncoder{buf: append([]byte(nil), tt.prefix...)}
+			err := e.basic(tt.t, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("basic: %v", err)
+			}
+			if !bytes.Equal(e.buf, tt.want) {
+				t.Errorf("encoded %v, want %v", e.buf, tt.want)
+			}
+		})
+	}
+}
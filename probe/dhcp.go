@@ -0,0 +1,398 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// DHCP message types (option 53)
+const (
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+)
+
+// DHCP options used by the native client
+const (
+	dhcpOptSubnetMask  = 1
+	dhcpOptRouter      = 3
+	dhcpOptDNS         = 6
+	dhcpOptHostname    = 12
+	dhcpOptRequestedIP = 50
+	dhcpOptLeaseTime   = 51
+	dhcpOptMessageType = 53
+	dhcpOptServerID    = 54
+	dhcpOptParamList   = 55
+	dhcpOptMessage     = 56
+	dhcpOptEnd         = 255
+)
+
+// dhcpMagicCookie starts the options field of every DHCP message
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// dhcpRetransmit is the time to wait for a reply before sending a message again
+const dhcpRetransmit = 2 * time.Second
+
+// dhcpMessage is the part of a BOOTP/DHCP message the client uses
+type dhcpMessage struct {
+	Op      byte             // 1 request, 2 reply
+	XID     uint32           // Transaction ID
+	Secs    uint16           // Seconds since the client started the exchange
+	CIAddr  net.IP           // Client address in RELEASE
+	YIAddr  net.IP           // Address offered or assigned by the server
+	CHAddr  net.HardwareAddr // Client hardware address
+	Options map[byte][]byte  // Options by code
+}
+
+// marshal encodes the message, padded to the 300 byte BOOTP minimum
+func (m dhcpMessage) marshal() []byte {
+	b := make([]byte, 236, 300)
+	b[0], b[1], b[2] = m.Op, 1, 6 // Ethernet hardware address
+	binary.BigEndian.PutUint32(b[4:8], m.XID)
+	binary.BigEndian.PutUint16(b[8:10], m.Secs)
+	copy(b[12:16], m.CIAddr.To4())
+	copy(b[16:20], m.YIAddr.To4())
+	copy(b[28:44], m.CHAddr)
+
+	// Options in code order so the packets are reproducible
+	b = append(b, dhcpMagicCookie...)
+	for code := 1; code < dhcpOptEnd; code++ {
+		if value, ok := m.Options[byte(code)]; ok {
+			b = append(b, byte(code), byte(len(value)))
+			b = append(b, value...)
+		}
+	}
+	b = append(b, dhcpOptEnd)
+	for len(b) < 300 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// parseDHCPMessage decodes a BOOTP/DHCP message and its options
+func parseDHCPMessage(b []byte) (dhcpMessage, error) {
+	if len(b) < 240 || string(b[236:240]) != string(dhcpMagicCookie) {
+		return dhcpMessage{}, errors.New("not a DHCP message")
+	}
+	m := dhcpMessage{
+		Op:      b[0],
+		XID:     binary.BigEndian.Uint32(b[4:8]),
+		Secs:    binary.BigEndian.Uint16(b[8:10]),
+		CIAddr:  net.IP(append([]byte(nil), b[12:16]...)),
+		YIAddr:  net.IP(append([]byte(nil), b[16:20]...)),
+		CHAddr:  net.HardwareAddr(append([]byte(nil), b[28:28+min(int(b[2]), 16)]...)),
+		Options: make(map[byte][]byte),
+	}
+
+	// Options are code/length/value triples; 0 pads and 255 ends the list
+	opts := b[240:]
+	for i := 0; i < len(opts); {
+		code := opts[i]
+		if code == 0 {
+			i++
+			continue
+		}
+		if code == dhcpOptEnd || i+1 >= len(opts) {
+			break
+		}
+		length := int(opts[i+1])
+		if i+2+length > len(opts) {
+			return m, errors.New("truncated DHCP option")
+		}
+		m.Options[code] = opts[i+2 : i+2+length]
+		i += 2 + length
+	}
+	return m, nil
+}
+
+// messageType returns the DHCP message type (0 for plain BOOTP)
+func (m dhcpMessage) messageType() byte {
+	if value := m.Options[dhcpOptMessageType]; len(value) == 1 {
+		return value[0]
+	}
+	return 0
+}
+
+// dhcpLease is a lease obtained by the native client
+type dhcpLease struct {
+	Address   net.IP        // Assigned address
+	Mask      net.IPMask    // Subnet mask
+	Routers   []net.IP      // Default routers
+	DNS       []net.IP      // DNS servers
+	Server    net.IP        // Server identifier
+	LeaseTime time.Duration // Lease duration
+}
+
+// dhcpSocket sends and receives IPv4 packets on one interface below the IP
+// stack (AF_PACKET), so the exchange works without an address and next to
+// the system's own DHCP client. It needs CAP_NET_RAW.
+type dhcpSocket struct {
+	fd      int              // Packet socket
+	ifindex int              // Interface index
+	mac     net.HardwareAddr // Interface hardware address
+}
+
+// Htons converts a 16-bit value to network byte order for socket calls
+func Htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// openDHCPSocket opens a packet socket for IPv4 frames on an interface
+func openDHCPSocket(iface string) (*dhcpSocket, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("%s has no Ethernet address", iface)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, int(Htons(syscall.ETH_P_IP)))
+	if err != nil {
+		return nil, fmt.Errorf("packet socket (needs CAP_NET_RAW or DHCP_CLIENT=dhclient): %v", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: Htons(syscall.ETH_P_IP), Ifindex: ifi.Index}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// Short receive timeouts let the exchange check its deadline and context
+	timeout := syscall.NsecToTimeval(int64(200 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &dhcpSocket{fd: fd, ifindex: ifi.Index, mac: ifi.HardwareAddr}, nil
+}
+
+// close releases the packet socket
+func (s *dhcpSocket) close() {
+	syscall.Close(s.fd)
+}
+
+// send broadcasts a DHCP message from port 68 to port 67 of dst
+func (s *dhcpSocket) send(src, dst net.IP, msg dhcpMessage) error {
+	packet := ipv4UDPPacket(src, dst, 68, 67, msg.marshal())
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: Htons(syscall.ETH_P_IP),
+		Ifindex:  s.ifindex,
+		Halen:    6,
+		Addr:     [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	return syscall.Sendto(s.fd, packet, 0, addr)
+}
+
+// receive waits for a server reply of the transaction until the deadline or
+// the end of ctx
+func (s *dhcpSocket) receive(ctx context.Context, xid uint32, deadline time.Time) (dhcpMessage, error) {
+	buf := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return dhcpMessage{}, err
+		}
+		n, _, err := syscall.Recvfrom(s.fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return dhcpMessage{}, err
+		}
+
+		// Every IPv4 packet of the interface arrives here, so keep replies to us
+		payload, ok := udpPayload(buf[:n], 68)
+		if !ok {
+			continue
+		}
+		msg, err := parseDHCPMessage(payload)
+		if err != nil || msg.Op != 2 || msg.XID != xid || msg.CHAddr.String() != s.mac.String() {
+			continue
+		}
+		return msg, nil
+	}
+	return dhcpMessage{}, errors.New("timeout")
+}
+
+// ipv4UDPPacket builds an IPv4/UDP packet. The UDP checksum is left out,
+// which IPv4 allows.
+func ipv4UDPPacket(src, dst net.IP, srcPort, dstPort uint16, payload []byte) []byte {
+	packet := make([]byte, 28+len(payload))
+	packet[0] = 0x45 // IPv4, 20 byte header
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	packet[8] = 64                  // TTL
+	packet[9] = syscall.IPPROTO_UDP // Protocol
+	copy(packet[12:16], src.To4())
+	copy(packet[16:20], dst.To4())
+	binary.BigEndian.PutUint16(packet[10:12], ipChecksum(packet[:20]))
+
+	binary.BigEndian.PutUint16(packet[20:22], srcPort)
+	binary.BigEndian.PutUint16(packet[22:24], dstPort)
+	binary.BigEndian.PutUint16(packet[24:26], uint16(8+len(payload)))
+	copy(packet[28:], payload)
+	return packet
+}
+
+// ipChecksum computes the Internet checksum of an IPv4 header
+func ipChecksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(header[i])<<8 | uint32(header[i+1])
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// udpPayload returns the payload of an IPv4/UDP packet sent to port
+func udpPayload(packet []byte, port uint16) ([]byte, bool) {
+	if len(packet) < 20 || packet[0]>>4 != 4 || packet[9] != syscall.IPPROTO_UDP {
+		return nil, false
+	}
+	headerLen := int(packet[0]&0x0f) * 4
+	if len(packet) < headerLen+8 || binary.BigEndian.Uint16(packet[headerLen+2:headerLen+4]) != port {
+		return nil, false
+	}
+	end := min(len(packet), headerLen+int(binary.BigEndian.Uint16(packet[headerLen+4:headerLen+6])))
+	return packet[headerLen+8 : end], true
+}
+
+// dhcpTiming splits a native DHCP exchange into its two round trips
+type dhcpTiming struct {
+	Offer time.Duration // DISCOVER until OFFER
+	Ack   time.Duration // REQUEST until ACK
+}
+
+// nativeDHCPExchange runs DISCOVER/OFFER/REQUEST/ACK for the interface,
+// asking for the address it already has. The interface configuration is
+// left to the system's DHCP client. A previous lease is released first
+// when given.
+func nativeDHCPExchange(ctx context.Context, s *config.Settings, iface string, release *dhcpLease) (dhcpLease, dhcpTiming, error) {
+	var timing dhcpTiming
+	sock, err := openDHCPSocket(iface)
+	if err != nil {
+		return dhcpLease{}, timing, err
+	}
+	defer sock.close()
+
+	// Releasing mirrors the old release/renew cycle, so the server assigns from scratch
+	if release != nil {
+		msg := dhcpMessage{Op: 1, XID: rand.Uint32(), CIAddr: release.Address, CHAddr: sock.mac, Options: map[byte][]byte{
+			dhcpOptMessageType: {dhcpRelease},
+			dhcpOptServerID:    release.Server.To4(),
+		}}
+		if err := sock.send(release.Address, release.Server, msg); err != nil {
+			return dhcpLease{}, timing, fmt.Errorf("release: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(s.Duration("DHCP_TIMEOUT", 10*time.Second))
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	// Options shared by DISCOVER and REQUEST
+	options := map[byte][]byte{
+		dhcpOptParamList: {1, 3, 6, 15, dhcpOptLeaseTime, dhcpOptServerID},
+	}
+	if hostname, err := os.Hostname(); err == nil && len(hostname) < 256 {
+		options[dhcpOptHostname] = []byte(hostname)
+	}
+	if current := InterfaceIPv4(iface); current != nil {
+		options[dhcpOptRequestedIP] = current.To4()
+	}
+
+	start := time.Now()
+	xid := rand.Uint32()
+	offer, err := sock.exchange(ctx, xid, start, dhcpDiscover, options, deadline, dhcpOffer)
+	if err != nil {
+		return dhcpLease{}, timing, fmt.Errorf("no offer: %v", err)
+	}
+	timing.Offer = time.Since(start)
+
+	// REQUEST the offered address from the server that offered it
+	requested := time.Now()
+	options[dhcpOptRequestedIP] = offer.YIAddr.To4()
+	options[dhcpOptServerID] = offer.Options[dhcpOptServerID]
+	ack, err := sock.exchange(ctx, xid, start, dhcpRequest, options, deadline, dhcpAck, dhcpNak)
+	if err != nil {
+		return dhcpLease{}, timing, fmt.Errorf("no ack: %v", err)
+	}
+	timing.Ack = time.Since(requested)
+	if ack.messageType() == dhcpNak {
+		return dhcpLease{}, timing, fmt.Errorf("NAK from %s: %s", net.IP(offer.Options[dhcpOptServerID]), ack.Options[dhcpOptMessage])
+	}
+
+	lease := dhcpLease{
+		Address: ack.YIAddr,
+		Routers: dhcpAddressList(ack.Options[dhcpOptRouter]),
+		DNS:     dhcpAddressList(ack.Options[dhcpOptDNS]),
+		Server:  net.IP(ack.Options[dhcpOptServerID]),
+	}
+	if value := ack.Options[dhcpOptSubnetMask]; len(value) == 4 {
+		lease.Mask = net.IPMask(value)
+	}
+	if value := ack.Options[dhcpOptLeaseTime]; len(value) == 4 {
+		lease.LeaseTime = time.Duration(binary.BigEndian.Uint32(value)) * time.Second
+	}
+	return lease, timing, nil
+}
+
+// dhcpAddressList splits an option value into IPv4 addresses
+func dhcpAddressList(value []byte) []net.IP {
+	var addrs []net.IP
+	for i := 0; i+4 <= len(value); i += 4 {
+		addrs = append(addrs, net.IP(value[i:i+4]))
+	}
+	return addrs
+}
+
+// exchange broadcasts a client message, resending it every dhcpRetransmit,
+// until a reply of one of the wanted types arrives
+func (s *dhcpSocket) exchange(ctx context.Context, xid uint32, start time.Time, msgType byte, options map[byte][]byte, deadline time.Time, want ...byte) (dhcpMessage, error) {
+	opts := map[byte][]byte{dhcpOptMessageType: {msgType}}
+	for code, value := range options {
+		opts[code] = value
+	}
+
+	for {
+		msg := dhcpMessage{Op: 1, XID: xid, Secs: uint16(time.Since(start).Seconds()), CHAddr: s.mac, Options: opts}
+		if err := s.send(net.IPv4zero, net.IPv4bcast, msg); err != nil {
+			return dhcpMessage{}, err
+		}
+
+		wait := time.Now().Add(dhcpRetransmit)
+		if deadline.Before(wait) {
+			wait = deadline
+		}
+		for time.Now().Before(wait) {
+			reply, err := s.receive(ctx, xid, wait)
+			if err != nil {
+				break
+			}
+			for _, t := range want {
+				if reply.messageType() == t {
+					return reply, nil
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return dhcpMessage{}, err
+		}
+		if !time.Now().Before(deadline) {
+			return dhcpMessage{}, errors.New("timeout")
+		}
+	}
+}
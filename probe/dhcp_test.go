@@ -0,0 +1,225 @@
+package probe
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// dhcpPacket builds a BOOTP message with the magic cookie and raw option bytes
+func dhcpPacket(options ...byte) []byte {
+	b := make([]byte, 236)
+	b[0], b[1], b[2] = 2, 1, 6
+	b = append(b, dhcpMagicCookie...)
+	return append(b, options...)
+}
+
+func TestDHCPMessageRoundTrip(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x5e, 0x10, 0x20, 0x30}
+	tests := []struct {
+		name string
+		msg  dhcpMessage
+	}{
+		{
+			name: "discover",
+			msg: dhcpMessage{
+				Op: 1, XID: 0xdeadbeef, Secs: 3, CHAddr: mac,
+				Options: map[byte][]byte{
+					dhcpOptMessageType: {dhcpDiscover},
+					dhcpOptParamList:   {dhcpOptSubnetMask, dhcpOptRouter, dhcpOptDNS, dhcpOptLeaseTime},
+					dhcpOptHostname:    []byte("probe01"),
+				},
+			},
+		},
+		{
+			name: "ack",
+			msg: dhcpMessage{
+				Op: 2, XID: 1, YIAddr: net.IPv4(192, 0, 2, 10), CHAddr: mac,
+				Options: map[byte][]byte{
+					dhcpOptMessageType: {dhcpAck},
+					dhcpOptSubnetMask:  {255, 255, 255, 0},
+					dhcpOptRouter:      {192, 0, 2, 1},
+					dhcpOptDNS:         {192, 0, 2, 53, 198, 51, 100, 53},
+					dhcpOptServerID:    {192, 0, 2, 1},
+					dhcpOptLeaseTime:   {0, 0, 0x0e, 0x10},
+				},
+			},
+		},
+		{
+			name: "release",
+			msg: dhcpMessage{
+				Op: 1, XID: 42, CIAddr: net.IPv4(192, 0, 2, 10), CHAddr: mac,
+				Options: map[byte][]byte{dhcpOptMessageType: {dhcpRelease}, dhcpOptServerID: {192, 0, 2, 1}},
+			},
+		},
+		{
+			name: "empty option value",
+			msg: dhcpMessage{
+				Op: 1, XID: 7, CHAddr: mac,
+				Options: map[byte][]byte{dhcpOptMessageType: {dhcpRequest}, dhcpOptHostname: {}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.msg.marshal()
+			if len(b) < 300 {
+				t.Errorf("marshaled %d bytes, want the 300 byte BOOTP minimum", len(b))
+			}
+			got, err := parseDHCPMessage(b)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got.Op != tt.msg.Op || got.XID != tt.msg.XID || got.Secs != tt.msg.Secs {
+				t.Errorf("header op=%d xid=%#x secs=%d, want op=%d xid=%#x secs=%d", got.Op, got.XID, got.Secs, tt.msg.Op, tt.msg.XID, tt.msg.Secs)
+			}
+			for _, ip := range []struct{ got, want net.IP }{{got.CIAddr, tt.msg.CIAddr}, {got.YIAddr, tt.msg.YIAddr}} {
+				if ip.want == nil {
+					ip.want = net.IPv4zero
+				}
+				if !ip.got.Equal(ip.want) {
+					t.Errorf("address %v, want %v", ip.got, ip.want)
+				}
+			}
+			if !bytes.Equal(got.CHAddr, tt.msg.CHAddr) {
+				t.Errorf("chaddr %v, want %v", got.CHAddr, tt.msg.CHAddr)
+			}
+			if !reflect.DeepEqual(got.Options, tt.msg.Options) {
+				t.Errorf("options %v, want %v", got.Options, tt.msg.Options)
+			}
+			if got.messageType() != tt.msg.Options[dhcpOptMessageType][0] {
+				t.Errorf("message type %d, want %d", got.messageType(), tt.msg.Options[dhcpOptMessageType][0])
+			}
+		})
+	}
+}
+
+func TestParseDHCPMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		options map[byte][]byte
+		wantErr bool
+	}{
+		{name: "empty", packet: nil, wantErr: true},
+		{name: "shorter than the header", packet: make([]byte, 100), wantErr: true},
+		{name: "no magic cookie", packet: make([]byte, 300), wantErr: true},
+		{name: "cookie cut short", packet: dhcpPacket()[:238], wantErr: true},
+		{name: "no options", packet: dhcpPacket(), options: map[byte][]byte{}},
+		{
+			name:    "pad and end",
+			packet:  dhcpPacket(0, 0, dhcpOptMessageType, 1, dhcpOffer, dhcpOptEnd, dhcpOptRouter, 4, 1, 2, 3, 4),
+			options: map[byte][]byte{dhcpOptMessageType: {dhcpOffer}},
+		},
+		{
+			name:    "no end option",
+			packet:  dhcpPacket(dhcpOptMessageType, 1, dhcpAck, dhcpOptSubnetMask, 4, 255, 255, 0, 0),
+			options: map[byte][]byte{dhcpOptMessageType: {dhcpAck}, dhcpOptSubnetMask: {255, 255, 0, 0}},
+		},
+		{
+			name:    "option value truncated",
+			packet:  dhcpPacket(dhcpOptMessageType, 1, dhcpAck, dhcpOptDNS, 8, 192, 0, 2, 53),
+			options: map[byte][]byte{dhcpOptMessageType: {dhcpAck}},
+			wantErr: true,
+		},
+		{
+			name:    "option length missing",
+			packet:  dhcpPacket(dhcpOptMessageType, 1, dhcpNak, dhcpOptMessage),
+			options: map[byte][]byte{dhcpOptMessageType: {dhcpNak}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseDHCPMessage(tt.packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.options != nil && !reflect.DeepEqual(m.Options, tt.options) {
+				t.Errorf("options %v, want %v", m.Options, tt.options)
+			}
+		})
+	}
+}
+
+func TestDHCPMessageType(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[byte][]byte
+		want    byte
+	}{
+		{name: "bootp", options: nil, want: 0},
+		{name: "offer", options: map[byte][]byte{dhcpOptMessageType: {dhcpOffer}}, want: dhcpOffer},
+		{name: "empty value", options: map[byte][]byte{dhcpOptMessageType: {}}, want: 0},
+		{name: "oversized value", options: map[byte][]byte{dhcpOptMessageType: {dhcpAck, 0}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (dhcpMessage{Options: tt.options}).messageType(); got != tt.want {
+				t.Errorf("messageType() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDHCPAddressList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  []net.IP
+	}{
+		{name: "empty", value: nil, want: nil},
+		{name: "one", value: []byte{192, 0, 2, 53}, want: []net.IP{net.IPv4(192, 0, 2, 53)}},
+		{name: "two", value: []byte{192, 0, 2, 53, 198, 51, 100, 1}, want: []net.IP{net.IPv4(192, 0, 2, 53), net.IPv4(198, 51, 100, 1)}},
+		{name: "trailing partial address", value: []byte{192, 0, 2, 53, 10, 0}, want: []net.IP{net.IPv4(192, 0, 2, 53)}},
+		{name: "too short", value: []byte{10, 0, 0}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dhcpAddressList(tt.value)
+			if len(got) != len(tt.want) {
+				t.Fatalf("dhcpAddressList() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("address %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUDPPayload(t *testing.T) {
+	payload := []byte("dhcp")
+	packet := ipv4UDPPacket(net.IPv4(192, 0, 2, 1), net.IPv4bcast, 67, 68, payload)
+	if ipChecksum(packet[:20]) != 0 {
+		t.Errorf("IPv4 header checksum does not verify")
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		port   uint16
+		want   []byte
+		ok     bool
+	}{
+		{name: "payload", packet: packet, port: 68, want: payload, ok: true},
+		{name: "other port", packet: packet, port: 67},
+		{name: "empty", packet: nil, port: 68},
+		{name: "IPv4 header only", packet: packet[:20], port: 68},
+		{name: "UDP header cut short", packet: packet[:25], port: 68},
+		{name: "payload cut short", packet: packet[:30], port: 68, want: payload[:2], ok: true},
+		{name: "not UDP", packet: append([]byte{0x45, 0, 0, 0, 0, 0, 0, 0, 64, 6}, packet[10:]...), port: 68},
+		{name: "IPv6", packet: append([]byte{0x60}, packet[1:]...), port: 68},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := udpPayload(tt.packet, tt.port)
+			if ok != tt.ok || !bytes.Equal(got, tt.want) {
+				t.Errorf("udpPayload() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
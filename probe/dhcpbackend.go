@@ -0,0 +1,313 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// DHCPAddressPollInterval is how often the interface is checked for an
+// address after a daemon was told to renew
+const DHCPAddressPollInterval = 100 * time.Millisecond
+
+// dhcpBackend renews the lease of an interface with one DHCP client
+type dhcpBackend interface {
+	Renew(ctx context.Context, iface string) Result // Release and renew, timed until a lease is in place
+}
+
+// dhcpBackends creates the backend for each DHCP_CLIENT value
+var dhcpBackends = map[string]func(s *config.Settings) dhcpBackend{
+	"native":         func(s *config.Settings) dhcpBackend { return &nativeDHCPBackend{settings: s} },
+	"dhclient":       func(s *config.Settings) dhcpBackend { return dhclientBackend{settings: s} },
+	"dhcpcd":         func(s *config.Settings) dhcpBackend { return dhcpcdBackend{} },
+	"udhcpc":         func(s *config.Settings) dhcpBackend { return udhcpcBackend{settings: s} },
+	"nmcli":          func(s *config.Settings) dhcpBackend { return nmcliBackend{} },
+	"networkmanager": func(s *config.Settings) dhcpBackend { return &networkManagerBackend{} },
+}
+
+// DHCPClientTools lists the command each backend runs, for the environment check
+var DHCPClientTools = map[string]string{
+	"dhclient": "dhclient",
+	"dhcpcd":   "dhcpcd",
+	"udhcpc":   "udhcpc",
+	"nmcli":    "nmcli",
+}
+
+// DHCPClient returns the DHCP client driven for an interface from
+// DHCP_CLIENT: native (built-in, default), dhclient, dhcpcd, udhcpc, nmcli,
+// networkmanager or auto (the client that manages the interface)
+func DHCPClient(s *config.Settings, iface string) string {
+	client := s.Get("DHCP_CLIENT")
+	if client == "auto" {
+		return detectDHCPClient(iface)
+	}
+	if _, ok := dhcpBackends[client]; ok {
+		return client
+	}
+	return "native"
+}
+
+// detectDHCPClient finds the client that owns the interface's lease:
+// NetworkManager when it manages the interface, otherwise a running DHCP
+// daemon, and the built-in client when there is none
+func detectDHCPClient(iface string) string {
+	if path, err := systemBusPath(); err == nil {
+		if _, err := os.Stat(path); err == nil && CheckNetworkManager(iface) == nil {
+			return "networkmanager"
+		}
+	}
+	running := runningProcesses()
+	for _, name := range []string{"dhcpcd", "udhcpc", "dhclient"} {
+		if running[name] {
+			return name
+		}
+	}
+	return "native"
+}
+
+// runningProcesses returns the command names of the running processes
+func runningProcesses() map[string]bool {
+	names := make(map[string]bool)
+	comms, _ := filepath.Glob("/proc/[0-9]*/comm")
+	for _, comm := range comms {
+		if data, err := os.ReadFile(comm); err == nil {
+			names[strings.TrimSpace(string(data))] = true
+		}
+	}
+	return names
+}
+
+// Privileged runs a command directly as root and through sudo otherwise
+func Privileged(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if os.Geteuid() == 0 {
+		return CaptureCommand(ctx, name, args...)
+	}
+	return CaptureCommand(ctx, "sudo", append([]string{name}, args...)...)
+}
+
+// interfaceHasIPv4 reports whether an IPv4 address is assigned to the interface
+func interfaceHasIPv4(iface string) bool {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return false
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return false
+	}
+	cidrs := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		cidrs = append(cidrs, addr.String())
+	}
+	return HasIPv4(cidrs)
+}
+
+// waitIPv4 waits until the interface has (present) or no longer has an
+// IPv4 address
+func waitIPv4(ctx context.Context, iface string, present bool) error {
+	for interfaceHasIPv4(iface) != present {
+		select {
+		case <-ctx.Done():
+			if present {
+				return fmt.Errorf("no IPv4 address on %s", iface)
+			}
+			return fmt.Errorf("IPv4 address still on %s after release", iface)
+		case <-time.After(DHCPAddressPollInterval):
+		}
+	}
+	return nil
+}
+
+// waitReleased gives a daemon a few seconds to remove the released address,
+// so the renewal is not timed against the old one
+func waitReleased(ctx context.Context, iface string) error {
+	settle, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return waitIPv4(settle, iface, false)
+}
+
+// nativeDHCPBackend runs the DHCP exchange itself over a packet socket
+type nativeDHCPBackend struct {
+	settings *config.Settings // DHCP_RELEASE and DHCP_TIMEOUT
+	lease    *dhcpLease       // Last lease, released before the next exchange with DHCP_RELEASE
+}
+
+// Renew measures the time until a lease is assigned and reports the OFFER
+// and ACK round trips as metrics
+func (b *nativeDHCPBackend) Renew(ctx context.Context, iface string) Result {
+	var release *dhcpLease
+	if b.settings.Get("DHCP_RELEASE") == "true" {
+		release = b.lease
+	}
+	start := time.Now()
+	lease, timing, err := nativeDHCPExchange(ctx, b.settings, iface, release)
+	if err != nil {
+		b.lease = nil
+		return Result{Error: err.Error()}
+	}
+	b.lease = &lease
+	return Result{Success: true, Latency: time.Since(start), Metrics: map[string]float64{
+		"offer_ms": float64(timing.Offer) / float64(time.Millisecond),
+		"ack_ms":   float64(timing.Ack) / float64(time.Millisecond),
+	}}
+}
+
+// lastLease returns the details of the lease from the last exchange
+func (b *nativeDHCPBackend) lastLease(ctx context.Context, iface string) *DHCPLease {
+	if b.lease == nil {
+		return nil
+	}
+	return b.lease.details()
+}
+
+// dhclientBackend drives ISC dhclient
+type dhclientBackend struct {
+	settings *config.Settings // DHCP_LEASE_FILE
+}
+
+// Renew releases and renews the lease with dhclient and waits for a
+// nameserver to be configured
+func (dhclientBackend) Renew(ctx context.Context, iface string) Result {
+	// Release current DHCP lease for the specific interface
+	Privileged(ctx, "dhclient", "-r", iface)
+
+	// Wait for network to settle
+	time.Sleep(2 * time.Second)
+
+	start := time.Now()
+	// Request new DHCP lease for the specific interface
+	if _, err := Privileged(ctx, "dhclient", iface); err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	// Check if nameserver is configured
+	output, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	if !strings.Contains(string(output), "nameserver") {
+		return Result{Error: "no nameserver in resolv.conf"}
+	}
+
+	return Result{Success: true, Latency: time.Since(start)}
+}
+
+// lastLease reads the lease dhclient wrote to its lease file
+func (b dhclientBackend) lastLease(ctx context.Context, iface string) *DHCPLease {
+	return ReadDHCPLeaseFile(b.settings, iface)
+}
+
+// dhcpcdBackend drives a running dhcpcd daemon
+type dhcpcdBackend struct{}
+
+// Renew has dhcpcd release the lease and rebind the interface, timed until
+// the address is back
+func (dhcpcdBackend) Renew(ctx context.Context, iface string) Result {
+	if _, err := Privileged(ctx, "dhcpcd", "--release", iface); err != nil {
+		return Result{Error: fmt.Sprintf("dhcpcd --release: %v", err)}
+	}
+	if err := waitReleased(ctx, iface); err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	start := time.Now()
+	if _, err := Privileged(ctx, "dhcpcd", "--rebind", iface); err != nil {
+		return Result{Error: fmt.Sprintf("dhcpcd --rebind: %v", err)}
+	}
+	if err := waitIPv4(ctx, iface, true); err != nil {
+		return Result{Error: err.Error()}
+	}
+	return Result{Success: true, Latency: time.Since(start)}
+}
+
+// lastLease asks dhcpcd for the lease it holds
+func (dhcpcdBackend) lastLease(ctx context.Context, iface string) *DHCPLease {
+	return readDhcpcdLease(ctx, iface)
+}
+
+// udhcpcBackend drives busybox udhcpc
+type udhcpcBackend struct {
+	settings *config.Settings // UDHCPC_PIDFILE
+}
+
+// Renew signals a running udhcpc (pid file UDHCPC_PIDFILE, default
+// /var/run/udhcpc-<iface>.pid as on OpenWrt) to release and renew, or runs
+// udhcpc once in the foreground when no daemon runs
+func (b udhcpcBackend) Renew(ctx context.Context, iface string) Result {
+	pidFile := b.settings.String("UDHCPC_PIDFILE", fmt.Sprintf("/var/run/udhcpc-%s.pid", iface))
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		start := time.Now()
+		if _, err := Privileged(ctx, "udhcpc", "-i", iface, "-n", "-q", "-f"); err != nil {
+			return Result{Error: fmt.Sprintf("udhcpc: %v", err)}
+		}
+		return Result{Success: true, Latency: time.Since(start)}
+	}
+
+	// SIGUSR2 releases the lease, SIGUSR1 renews it; udhcpc runs as root, so
+	// the signals go through sudo like the other backends' commands
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return Result{Error: fmt.Sprintf("invalid pid in %s", pidFile)}
+	}
+	if _, err := Privileged(ctx, "kill", "-USR2", strconv.Itoa(pid)); err != nil {
+		return Result{Error: fmt.Sprintf("udhcpc release: %v", err)}
+	}
+	if err := waitReleased(ctx, iface); err != nil {
+		return Result{Error: err.Error()}
+	}
+	start := time.Now()
+	if _, err := Privileged(ctx, "kill", "-USR1", strconv.Itoa(pid)); err != nil {
+		return Result{Error: fmt.Sprintf("udhcpc renew: %v", err)}
+	}
+	if err := waitIPv4(ctx, iface, true); err != nil {
+		return Result{Error: err.Error()}
+	}
+	return Result{Success: true, Latency: time.Since(start)}
+}
+
+// nmcliBackend drives NetworkManager with nmcli
+type nmcliBackend struct{}
+
+// Renew reconnects the device with nmcli, which returns once the
+// connection is activated again
+func (nmcliBackend) Renew(ctx context.Context, iface string) Result {
+	wait := "90"
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = strconv.Itoa(int(time.Until(deadline).Seconds()))
+	}
+	start := time.Now()
+	if _, err := CaptureCommand(ctx, "nmcli", "--wait", wait, "device", "connect", iface); err != nil {
+		return Result{Error: fmt.Sprintf("nmcli device connect: %v", err)}
+	}
+	return Result{Success: true, Latency: time.Since(start)}
+}
+
+// lastLease reads the DHCPv4 options NetworkManager keeps for the device
+func (nmcliBackend) lastLease(ctx context.Context, iface string) *DHCPLease {
+	return readNmcliLease(ctx, iface)
+}
+
+// networkManagerBackend drives NetworkManager over D-Bus
+type networkManagerBackend struct {
+	lease *DHCPLease // Lease read after the last activation
+}
+
+// Renew reactivates the connection through the NetworkManager D-Bus API
+func (b *networkManagerBackend) Renew(ctx context.Context, iface string) Result {
+	var result Result
+	result, b.lease = networkManagerRenew(ctx, iface)
+	return result
+}
+
+// lastLease returns the lease read after the last activation
+func (b *networkManagerBackend) lastLease(ctx context.Context, iface string) *DHCPLease {
+	return b.lease
+}
@@ -0,0 +1,289 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// PingSpacing is the gap between echo requests of one burst, as with ping -i 0.2
+const PingSpacing = 200 * time.Millisecond
+
+// errICMPSocket marks failures to open an ICMP socket, after which the ping
+// command is used instead
+var errICMPSocket = errors.New("cannot open ICMP socket")
+
+// icmpFallbackNotice reports the switch to the ping command once per process
+var icmpFallbackNotice sync.Once
+
+// ICMPMode returns how echo requests are sent: "native" ICMP sockets only,
+// the "exec" ping command only, or "auto" (native, falling back to the ping
+// command when no ICMP socket can be opened)
+func ICMPMode(s *config.Settings) string {
+	switch mode := s.Get("ICMP_MODE"); mode {
+	case "native", "exec":
+		return mode
+	}
+	return "auto"
+}
+
+// listenICMP opens an ICMP socket bound to an interface. An unprivileged
+// datagram socket is used where net.ipv4.ping_group_range allows it, else a
+// raw socket, which needs CAP_NET_RAW. The kernel rewrites the echo
+// identifier on datagram sockets, reported by the second return value.
+func listenICMP(iface string, v6, dontFragment bool) (net.PacketConn, bool, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if v6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+
+	var lastErr error
+	for _, sotype := range []int{syscall.SOCK_DGRAM, syscall.SOCK_RAW} {
+		fd, err := syscall.Socket(family, sotype|syscall.SOCK_CLOEXEC, proto)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := ConfigureICMPSocket(fd, iface, v6, dontFragment, sotype == syscall.SOCK_DGRAM); err != nil {
+			syscall.Close(fd)
+			lastErr = err
+			continue
+		}
+
+		// FilePacketConn duplicates the descriptor, so the file is closed either way
+		f := os.NewFile(uintptr(fd), "icmp")
+		conn, err := net.FilePacketConn(f)
+		f.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return conn, sotype == syscall.SOCK_DGRAM, nil
+	}
+	return nil, false, fmt.Errorf("%w: %v", errICMPSocket, lastErr)
+}
+
+// ConfigureICMPSocket binds a fresh ICMP socket to the interface and sets the
+// Don't Fragment behaviour
+func ConfigureICMPSocket(fd int, iface string, v6, dontFragment, datagram bool) error {
+	if iface != "" {
+		if err := syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface); err != nil {
+			return fmt.Errorf("bind to %s: %v", iface, err)
+		}
+	}
+
+	if dontFragment {
+		var err error
+		if v6 {
+			err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+		} else {
+			err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Datagram sockets need an address before the kernel assigns the echo identifier
+	if datagram {
+		if v6 {
+			return syscall.Bind(fd, &syscall.SockaddrInet6{})
+		}
+		return syscall.Bind(fd, &syscall.SockaddrInet4{})
+	}
+	return nil
+}
+
+// icmpEcho sends count echo requests PingSpacing apart over an interface and
+// waits up to wait after the last one for the replies. Each request carries
+// its send time, so a reply alone gives its round trip time.
+func icmpEcho(ctx context.Context, iface, target string, count, size int, dontFragment bool, wait time.Duration) (PingStats, error) {
+	stats := PingStats{Target: target, Sent: count, Loss: 100}
+
+	addr, err := net.ResolveIPAddr("ip", target)
+	if err != nil {
+		return stats, err
+	}
+	v6 := addr.IP.To4() == nil
+	conn, datagram, err := listenICMP(iface, v6, dontFragment)
+	if err != nil {
+		return stats, err
+	}
+	defer conn.Close()
+
+	// Message types and the destination type differ by family and socket type
+	request, reply, proto := icmp.Type(ipv4.ICMPTypeEcho), icmp.Type(ipv4.ICMPTypeEchoReply), 1
+	if v6 {
+		request, reply, proto = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, 58
+	}
+	var dst net.Addr = &net.IPAddr{IP: addr.IP, Zone: addr.Zone}
+	if datagram {
+		dst = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+	if addr.Zone == "" && v6 && addr.IP.IsLinkLocalUnicast() {
+		dst = zonedAddr(dst, iface)
+	}
+
+	// The payload defaults to ping's 56 bytes and always fits the send time
+	if size == 0 {
+		size = 56
+	}
+	if size < 8 {
+		size = 8
+	}
+
+	// Replies are read until all arrived, the wait has passed or ctx ends
+	deadline := time.Now().Add(time.Duration(count-1)*PingSpacing + wait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	id := rand.Intn(1 << 16)
+	go func() {
+		for seq := 0; seq < count; seq++ {
+			if seq > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(PingSpacing):
+				}
+			}
+			payload := make([]byte, size)
+			binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+			msg := icmp.Message{Type: request, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}
+			packet, err := msg.Marshal(nil)
+			if err != nil {
+				return
+			}
+			// Send errors such as EMSGSIZE with DF set count as lost packets
+			conn.WriteTo(packet, dst)
+		}
+	}()
+
+	buf := make([]byte, size+1500)
+	seen := make(map[int]bool)
+	for len(seen) < count {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		received := time.Now()
+
+		// Raw sockets see every echo reply of the host, so match ours
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || msg.Type != reply {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || (!datagram && echo.ID != id) || echo.Seq >= count || seen[echo.Seq] || len(echo.Data) < 8 || !AddrIP(from).Equal(addr.IP) {
+			continue
+		}
+		seen[echo.Seq] = true
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(echo.Data)))
+		stats.RTTs = append(stats.RTTs, received.Sub(sent))
+	}
+
+	stats.summarize()
+	return stats, nil
+}
+
+// zonedAddr scopes a link-local destination to the interface
+func zonedAddr(dst net.Addr, iface string) net.Addr {
+	switch a := dst.(type) {
+	case *net.IPAddr:
+		a.Zone = iface
+	case *net.UDPAddr:
+		a.Zone = iface
+	}
+	return dst
+}
+
+// AddrIP returns the IP of a reply's source address
+func AddrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// summarize derives loss, min/avg/max and jitter from the per-packet round
+// trip times. The jitter is the RFC 3550 estimate J += (|D| - J) / 16 over
+// the RTT differences of consecutive replies.
+func (s *PingStats) summarize() {
+	if s.Sent == 0 {
+		return
+	}
+	s.Loss = 100 * float64(s.Sent-len(s.RTTs)) / float64(s.Sent)
+	if len(s.RTTs) == 0 {
+		return
+	}
+
+	var total time.Duration
+	var jitter float64
+	s.Min, s.Max = s.RTTs[0], s.RTTs[0]
+	for i, rtt := range s.RTTs {
+		total += rtt
+		s.Min = min(s.Min, rtt)
+		s.Max = max(s.Max, rtt)
+		if i > 0 {
+			d := math.Abs(float64(rtt - s.RTTs[i-1]))
+			jitter += (d - jitter) / 16
+		}
+	}
+	s.Avg = total / time.Duration(len(s.RTTs))
+	s.Jitter = time.Duration(jitter)
+}
+
+// recordICMPOutput keeps a ping-style transcript of a native echo burst in the
+// raw output store, so `noc-watch debug ping` works in either mode
+func recordICMPOutput(ctx context.Context, iface string, count, size int, dontFragment bool, stats PingStats, err error) {
+	command := fmt.Sprintf("icmp echo -I %s -c %d", iface, count)
+	if size > 0 {
+		command += fmt.Sprintf(" -s %d", size)
+	}
+	if dontFragment {
+		command += " -M do"
+	}
+
+	var stdout strings.Builder
+	for i, rtt := range stats.RTTs {
+		fmt.Fprintf(&stdout, "reply %d from %s: time=%.3f ms\n", i+1, stats.Target, float64(rtt)/float64(time.Millisecond))
+	}
+	fmt.Fprintf(&stdout, "%d packets transmitted, %d received, %g%% packet loss\n", stats.Sent, len(stats.RTTs), stats.Loss)
+	if len(stats.RTTs) > 0 {
+		fmt.Fprintf(&stdout, "rtt min/avg/max/jitter = %.3f/%.3f/%.3f/%.3f ms\n",
+			float64(stats.Min)/float64(time.Millisecond), float64(stats.Avg)/float64(time.Millisecond),
+			float64(stats.Max)/float64(time.Millisecond), float64(stats.Jitter)/float64(time.Millisecond))
+	}
+
+	entry := RawOutput{
+		Time:    time.Now(),
+		Source:  "ping",
+		Command: command + " " + stats.Target,
+		Stdout:  stdout.String(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	rawOutputsOf(ctx).Add(entry)
+}
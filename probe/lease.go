@@ -0,0 +1,215 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// DHCPLease is the configuration handed out with a lease, so a renewal
+// into the wrong scope is visible and not just its timing
+type DHCPLease struct {
+	Address   string        `json:"address"`            // Assigned IPv4 address
+	Subnet    string        `json:"subnet,omitempty"`   // Network of the address in CIDR notation
+	Gateway   string        `json:"gateway,omitempty"`  // Default router
+	DNS       []string      `json:"dns,omitempty"`      // DNS servers
+	Server    string        `json:"server,omitempty"`   // DHCP server identifier
+	LeaseTime time.Duration `json:"lease_ns,omitempty"` // Lease duration
+	Source    string        `json:"source"`             // Where the details were read (ack, lease file, dhcpcd, nmcli, networkmanager, interface)
+}
+
+// String formats the lease for the log and the UI
+func (l DHCPLease) String() string {
+	text := l.Address
+	if l.Subnet != "" {
+		text += " in " + l.Subnet
+	}
+	text += fmt.Sprintf(" gw %s dns %s", orDash(l.Gateway), orDash(strings.Join(l.DNS, ",")))
+	if l.LeaseTime > 0 {
+		text += fmt.Sprintf(" lease %v", l.LeaseTime)
+	}
+	if l.Server != "" {
+		text += " from " + l.Server
+	}
+	return text + " (" + l.Source + ")"
+}
+
+// leaseReader is implemented by DHCP backends that know the details of the
+// lease they obtained
+type leaseReader interface {
+	lastLease(ctx context.Context, iface string) *DHCPLease // Details of the current lease (nil if unknown)
+}
+
+// newDHCPLease builds lease details from an address and mask
+func newDHCPLease(address net.IP, mask net.IPMask, source string) *DHCPLease {
+	lease := &DHCPLease{Address: address.String(), Source: source}
+	if mask != nil {
+		ones, _ := mask.Size()
+		lease.Subnet = fmt.Sprintf("%s/%d", address.Mask(mask), ones)
+	}
+	return lease
+}
+
+// details converts a lease of the native client
+func (l dhcpLease) details() *DHCPLease {
+	lease := newDHCPLease(l.Address, l.Mask, "ack")
+	if len(l.Routers) > 0 {
+		lease.Gateway = l.Routers[0].String()
+	}
+	for _, dns := range l.DNS {
+		lease.DNS = append(lease.DNS, dns.String())
+	}
+	if len(l.Server) == 4 {
+		lease.Server = l.Server.String()
+	}
+	lease.LeaseTime = l.LeaseTime
+	return lease
+}
+
+// leaseFromOptions builds lease details from the option names dhcpcd and
+// NetworkManager share (ip_address, subnet_mask, routers, ...)
+func leaseFromOptions(options map[string]string, source string) *DHCPLease {
+	address := net.ParseIP(options["ip_address"]).To4()
+	if address == nil {
+		return nil
+	}
+	var mask net.IPMask
+	if m := net.ParseIP(options["subnet_mask"]).To4(); m != nil {
+		mask = net.IPMask(m)
+	} else if bits, err := strconv.Atoi(options["subnet_cidr"]); err == nil {
+		mask = net.CIDRMask(bits, 32)
+	}
+	lease := newDHCPLease(address, mask, source)
+	if routers := strings.Fields(options["routers"]); len(routers) > 0 {
+		lease.Gateway = routers[0]
+	}
+	lease.DNS = strings.Fields(options["domain_name_servers"])
+	lease.Server = options["dhcp_server_identifier"]
+	if seconds, err := strconv.Atoi(options["dhcp_lease_time"]); err == nil {
+		lease.LeaseTime = time.Duration(seconds) * time.Second
+	}
+	return lease
+}
+
+// dhcpLeaseFiles are the usual dhclient lease locations; %s is the interface
+var dhcpLeaseFiles = []string{
+	"/var/lib/dhcp/dhclient.%s.leases",
+	"/var/lib/dhclient/dhclient-%s.leases",
+	"/var/lib/dhcp/dhclient.leases",
+	"/var/lib/dhclient/dhclient.leases",
+}
+
+// ReadDHCPLeaseFile returns the latest lease of an interface from
+// DHCP_LEASE_FILE or the usual dhclient lease files
+func ReadDHCPLeaseFile(s *config.Settings, iface string) *DHCPLease {
+	paths := []string{s.Get("DHCP_LEASE_FILE")}
+	for _, pattern := range dhcpLeaseFiles {
+		paths = append(paths, strings.ReplaceAll(pattern, "%s", iface))
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		// Leases are appended, so the last block for the interface is current
+		var current map[string]string
+		var blockInterface string
+		block := make(map[string]string)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";"))
+			switch {
+			case len(fields) > 0 && fields[0] == "lease":
+				block, blockInterface = make(map[string]string), ""
+			case len(fields) == 2 && fields[0] == "interface":
+				blockInterface = strings.Trim(fields[1], `"`)
+			case len(fields) == 2 && fields[0] == "fixed-address":
+				block["ip_address"] = fields[1]
+			case len(fields) >= 3 && fields[0] == "option":
+				block[strings.ReplaceAll(fields[1], "-", "_")] = strings.ReplaceAll(strings.Join(fields[2:], " "), ",", " ")
+			case len(fields) > 0 && fields[0] == "}":
+				if block["ip_address"] != "" && (blockInterface == "" || blockInterface == iface) {
+					current = block
+				}
+			}
+		}
+		file.Close()
+
+		if current != nil {
+			return leaseFromOptions(current, "lease file")
+		}
+	}
+	return nil
+}
+
+// readDhcpcdLease asks dhcpcd for the variables of the interface's lease
+func readDhcpcdLease(ctx context.Context, iface string) *DHCPLease {
+	output, err := Privileged(ctx, "dhcpcd", "--dumplease", "-4", iface)
+	if err != nil {
+		return nil
+	}
+	options := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			options[key] = strings.Trim(value, `'"`)
+		}
+	}
+	return leaseFromOptions(options, "dhcpcd")
+}
+
+// readNmcliLease reads the DHCPv4 options NetworkManager keeps for a device
+func readNmcliLease(ctx context.Context, iface string) *DHCPLease {
+	output, err := CaptureCommand(ctx, "nmcli", "-t", "-f", "DHCP4", "device", "show", iface)
+	if err != nil {
+		return nil
+	}
+
+	// Lines look like DHCP4.OPTION[3]:ip_address = 192.0.2.10
+	options := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		_, option, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if key, value, ok := strings.Cut(option, " = "); ok {
+			options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return leaseFromOptions(options, "nmcli")
+}
+
+// interfaceLease describes the lease from what is configured on the host
+// when the client does not tell: address, default route and resolvers
+func interfaceLease(iface string) *DHCPLease {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		lease := newDHCPLease(ipnet.IP.To4(), ipnet.Mask, "interface")
+		lease.Gateway = DefaultGateway(iface)
+		lease.DNS = SystemResolvers()
+		return lease
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// WiFiLink is the association state reported by `iw dev <if> link`
+type WiFiLink struct {
+	SSID    string  // Network name
+	BSSID   string  // Access point radio MAC
+	FreqMHz int     // Operating frequency
+	TxMbps  float64 // Current tx bitrate
+}
+
+// ReadWiFiLink parses `iw dev <if> link`
+func ReadWiFiLink(ctx context.Context, iface string) (*WiFiLink, bool) {
+	output, err := CaptureCommand(ctx, "iw", "dev", iface, "link")
+	if err != nil {
+		return nil, false
+	}
+
+	link := &WiFiLink{}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "Connected to") && len(fields) >= 3:
+			link.BSSID = fields[2]
+		case strings.HasPrefix(line, "SSID:"):
+			link.SSID = strings.TrimSpace(strings.TrimPrefix(line, "SSID:"))
+		case strings.HasPrefix(line, "freq:") && len(fields) >= 2:
+			freq, _ := strconv.ParseFloat(fields[1], 64)
+			link.FreqMHz = int(freq)
+		case strings.HasPrefix(line, "tx bitrate:") && len(fields) >= 3:
+			link.TxMbps, _ = strconv.ParseFloat(fields[2], 64)
+		}
+	}
+
+	if link.BSSID == "" {
+		return nil, false // "Not connected."
+	}
+	return link, true
+}
+
+// Channel converts the frequency into an 802.11 channel number
+func (l *WiFiLink) Channel() int {
+	return frequencyChannel(l.FreqMHz)
+}
+
+// frequencyChannel converts a frequency in MHz into an 802.11 channel number
+func frequencyChannel(freqMHz int) int {
+	switch {
+	case freqMHz == 2484:
+		return 14
+	case freqMHz >= 2412 && freqMHz < 2484:
+		return (freqMHz - 2407) / 5
+	case freqMHz >= 5955:
+		return (freqMHz - 5950) / 5 // 6 GHz
+	case freqMHz >= 5000:
+		return (freqMHz - 5000) / 5
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package probe
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// resolvConfValues returns the values of all lines starting with keyword in /etc/resolv.conf
+func resolvConfValues(keyword string) []string {
+	return ResolvConfFileValues("/etc/resolv.conf", keyword)
+}
+
+// ResolvConfFileValues returns the values of all lines starting with keyword
+// in a resolv.conf style file
+func ResolvConfFileValues(path, keyword string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var values []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == keyword {
+			values = append(values, fields[1:]...)
+		}
+	}
+	return values
+}
+
+// SystemResolvers returns the nameservers configured in /etc/resolv.conf
+func SystemResolvers() []string {
+	return resolvConfValues("nameserver")
+}
+
+// SystemSearchDomains returns the search list (or domain) configured in /etc/resolv.conf
+func SystemSearchDomains() []string {
+	if search := resolvConfValues("search"); len(search) > 0 {
+		return search
+	}
+	return resolvConfValues("domain")
+}
+
+// InterfaceIPv4 returns the first IPv4 address assigned to an interface
+func InterfaceIPv4(iface string) net.IP {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP
+		}
+	}
+	return nil
+}
+
+// DefaultGateway returns the IPv4 default gateway of an interface from the routing table
+func DefaultGateway(iface string) string {
+	return defaultRouteVia("-4", iface)
+}
+
+// DefaultGatewayIPv6 returns the IPv6 default gateway of an interface, normally
+// the link-local address of the advertising router
+func DefaultGatewayIPv6(iface string) string {
+	return defaultRouteVia("-6", iface)
+}
+
+// defaultRouteVia returns the next hop of the default route of an address family
+func defaultRouteVia(family, iface string) string {
+	output, err := exec.Command("ip", family, "route", "show", "default", "dev", iface).Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(output))
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "via" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// HasIPv4 reports whether any CIDR address is IPv4
+func HasIPv4(addrs []string) bool {
+	for _, addr := range addrs {
+		if ip, _, err := net.ParseCIDR(addr); err == nil && ip.To4() != nil {
+			return true
+		}
+	}
+	return false
+}
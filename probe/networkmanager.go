@@ -0,0 +1,218 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NetworkManager D-Bus names
+const (
+	nmService          = "org.freedesktop.NetworkManager"
+	nmPath             = "/org/freedesktop/NetworkManager"
+	nmDeviceInterface  = nmService + ".Device"
+	nmActiveInterface  = nmService + ".Connection.Active"
+	nmDHCP4Interface   = nmService + ".DHCP4Config"
+	dbusPropertiesName = "org.freedesktop.DBus.Properties"
+)
+
+// NetworkManager device states (NMDeviceState)
+const (
+	nmStateUnmanaged = 10
+	nmStateIPConfig  = 70
+	nmStateActivated = 100
+)
+
+// NetworkManager active connection states (NMActiveConnectionState)
+const (
+	nmActiveActivated    = 2
+	nmActiveDeactivating = 3
+)
+
+// nmStatePollInterval is how often the device state is read while a
+// connection is activated
+const nmStatePollInterval = 50 * time.Millisecond
+
+// nmDeviceStates names the NetworkManager device states
+var nmDeviceStates = map[uint32]string{
+	0:   "unknown",
+	10:  "unmanaged",
+	20:  "unavailable",
+	30:  "disconnected",
+	40:  "prepare",
+	50:  "config",
+	60:  "need-auth",
+	70:  "ip-config",
+	80:  "ip-check",
+	90:  "secondaries",
+	100: "activated",
+	110: "deactivating",
+	120: "failed",
+}
+
+// nmStateName names a device state, falling back to its number
+func nmStateName(state uint32) string {
+	if name, ok := nmDeviceStates[state]; ok {
+		return name
+	}
+	return strconv.Itoa(int(state))
+}
+
+// nmProperty reads a property of a NetworkManager object
+func nmProperty(c *dbusConn, path, iface, name string) (interface{}, error) {
+	reply, err := c.call(nmService, path, dbusPropertiesName, "Get", "ss", iface, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 {
+		return nil, fmt.Errorf("no value for %s", name)
+	}
+	return reply[0], nil
+}
+
+// nmDeviceState reads the state of a device and, when it failed, the reason
+func nmDeviceState(c *dbusConn, device string) (uint32, uint32, error) {
+	value, err := nmProperty(c, device, nmDeviceInterface, "StateReason")
+	if err != nil {
+		return 0, 0, err
+	}
+	pair, ok := value.([]interface{})
+	if !ok || len(pair) != 2 {
+		return 0, 0, fmt.Errorf("unexpected StateReason %v", value)
+	}
+	state, _ := pair[0].(uint32)
+	reason, _ := pair[1].(uint32)
+	return state, reason, nil
+}
+
+// nmLease reads the device's DHCPv4 lease (nil if it has none)
+func nmLease(c *dbusConn, device string) *DHCPLease {
+	config, err := nmProperty(c, device, nmDeviceInterface, "Dhcp4Config")
+	path, _ := config.(string)
+	if err != nil || path == "" || path == "/" {
+		return nil
+	}
+	value, err := nmProperty(c, path, nmDHCP4Interface, "Options")
+	if err != nil {
+		return nil
+	}
+	dict, _ := value.(map[string]interface{})
+	options := make(map[string]string, len(dict))
+	for key, option := range dict {
+		options[key], _ = option.(string)
+	}
+	return leaseFromOptions(options, "networkmanager")
+}
+
+// nmDevice finds the device object of an interface
+func nmDevice(c *dbusConn, iface string) (string, error) {
+	reply, err := c.call(nmService, nmPath, nmService, "GetDeviceByIpIface", "s", iface)
+	if err != nil {
+		return "", err
+	}
+	if len(reply) == 0 {
+		return "", fmt.Errorf("no NetworkManager device for %s", iface)
+	}
+	device, _ := reply[0].(string)
+	return device, nil
+}
+
+// networkManagerRenew reactivates the interface's active connection through
+// the NetworkManager D-Bus API instead of running a DHCP client behind its
+// back, and times it until the new activation completes. The time spent
+// configuring IP addresses, where DHCP happens, is reported as a metric
+// and the new lease is returned.
+func networkManagerRenew(ctx context.Context, iface string) (Result, *DHCPLease) {
+	c, err := dialSystemBus(ctx)
+	if err != nil {
+		return Result{Error: fmt.Sprintf("system bus: %v", err)}, nil
+	}
+	defer c.Close()
+
+	// Device and the connection currently active on it
+	device, err := nmDevice(c, iface)
+	if err != nil {
+		return Result{Error: err.Error()}, nil
+	}
+	active, err := nmProperty(c, device, nmDeviceInterface, "ActiveConnection")
+	if err != nil {
+		return Result{Error: err.Error()}, nil
+	}
+	if path, _ := active.(string); path == "" || path == "/" {
+		state, _, _ := nmDeviceState(c, device)
+		return Result{Error: fmt.Sprintf("no active NetworkManager connection on %s (%s)", iface, nmStateName(state))}, nil
+	}
+	connection, err := nmProperty(c, active.(string), nmActiveInterface, "Connection")
+	if err != nil {
+		return Result{Error: err.Error()}, nil
+	}
+
+	// Activate the same connection again and follow the new activation
+	start := time.Now()
+	reply, err := c.call(nmService, nmPath, nmService, "ActivateConnection", "ooo", connection, device, "/")
+	if err != nil {
+		return Result{Error: err.Error()}, nil
+	}
+	if len(reply) == 0 {
+		return Result{Error: "ActivateConnection returned no active connection"}, nil
+	}
+	activation, _ := reply[0].(string)
+	var ipConfig time.Time
+	for {
+		state, reason, err := nmDeviceState(c, device)
+		if err != nil {
+			return Result{Error: err.Error()}, nil
+		}
+		if state >= nmStateIPConfig && state <= nmStateActivated && ipConfig.IsZero() {
+			ipConfig = time.Now()
+		}
+
+		// The activation object disappears when it is torn down
+		value, err := nmProperty(c, activation, nmActiveInterface, "State")
+		activeState, _ := value.(uint32)
+		switch {
+		case err == nil && activeState == nmActiveActivated:
+			latency := time.Since(start)
+			metrics := map[string]float64{"ip_config_ms": float64(time.Since(ipConfig)) / float64(time.Millisecond)}
+			lease := nmLease(c, device)
+			if lease != nil && lease.LeaseTime > 0 {
+				metrics["lease_seconds"] = lease.LeaseTime.Seconds()
+			}
+			return Result{Success: true, Latency: latency, Metrics: metrics}, lease
+		case err != nil || activeState >= nmActiveDeactivating:
+			return Result{Error: fmt.Sprintf("NetworkManager activation failed, device %s (reason %d)", nmStateName(state), reason)}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return Result{Error: fmt.Sprintf("timed out in NetworkManager state %s", nmStateName(state))}, nil
+		case <-time.After(nmStatePollInterval):
+		}
+	}
+}
+
+// CheckNetworkManager verifies that NetworkManager answers on the system
+// bus and manages the interface
+func CheckNetworkManager(iface string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := dialSystemBus(ctx)
+	if err != nil {
+		return fmt.Errorf("system bus: %v", err)
+	}
+	defer c.Close()
+
+	device, err := nmDevice(c, iface)
+	if err != nil {
+		return err
+	}
+	state, _, err := nmDeviceState(c, device)
+	if err != nil {
+		return err
+	}
+	if state <= nmStateUnmanaged {
+		return fmt.Errorf("%s is %s", iface, nmStateName(state))
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Generic netlink and nl80211 protocol numbers (linux/genetlink.h, linux/nl80211.h)
+const (
+	genlIDCtrl           = 0x10
+	ctrlCmdGetFamily     = 3
+	ctrlAttrFamilyID     = 1
+	ctrlAttrFamilyName   = 2
+	nl80211CmdGetIface   = 5
+	nl80211CmdGetStation = 17
+	nl80211CmdGetSurvey  = 50
+	nl80211AttrIfindex   = 3
+	nl80211AttrMAC       = 6
+	nl80211AttrFreq      = 38
+	nl80211AttrSSID      = 52
+	nl80211AttrStaInfo   = 21
+	nl80211AttrSurvey    = 84
+	staInfoSignal        = 7
+	staInfoTxBitrate     = 8
+	staInfoTxPackets     = 10
+	staInfoTxRetries     = 11
+	staInfoTxFailed      = 12
+	staInfoSignalAvg     = 13
+	staInfoRxBitrate     = 14
+	rateInfoBitrate      = 1
+	rateInfoBitrate32    = 5
+	surveyInfoNoise      = 2
+	surveyInfoInUse      = 3
+	nlaTypeMask          = 0x3fff
+)
+
+// StationInfo is the layer 2 view of the association: how well the client
+// hears the access point and how hard the radio works to get frames through
+type StationInfo struct {
+	BSSID        string  `json:"bssid"`                      // Access point radio MAC
+	SSID         string  `json:"ssid,omitempty"`             // Network name
+	FreqMHz      int     `json:"freq_mhz,omitempty"`         // Operating frequency
+	Channel      int     `json:"channel,omitempty"`          // 802.11 channel number
+	RoamedFrom   string  `json:"roamed_from,omitempty"`      // Previous BSSID when the client roamed since the previous sample
+	SignalDBM    int     `json:"signal_dbm"`                 // Signal of the last received frame
+	SignalAvgDBM int     `json:"signal_avg_dbm,omitempty"`   // Averaged signal (0 if not reported)
+	NoiseDBM     int     `json:"noise_dbm,omitempty"`        // Channel noise floor (0 if not reported)
+	TxMbps       float64 `json:"tx_bitrate_mbps,omitempty"`  // Current transmit bitrate
+	RxMbps       float64 `json:"rx_bitrate_mbps,omitempty"`  // Bitrate of the last received frame
+	TxPackets    uint64  `json:"tx_packets,omitempty"`       // Transmitted packets since association
+	TxRetries    uint64  `json:"tx_retries,omitempty"`       // Transmit retries since association
+	TxFailed     uint64  `json:"tx_failed,omitempty"`        // Failed transmissions since association
+	RetryPercent float64 `json:"tx_retry_percent,omitempty"` // Retries per transmitted packet since the previous sample
+	Source       string  `json:"source"`                     // nl80211 or iw
+}
+
+// SNR returns the signal to noise ratio in dB, or 0 when the noise floor is unknown
+func (s StationInfo) SNR() int {
+	if s.NoiseDBM == 0 {
+		return 0
+	}
+	return s.SignalDBM - s.NoiseDBM
+}
+
+// String formats the station info for logs
+func (s StationInfo) String() string {
+	text := fmt.Sprintf("bssid=%s ssid=%q ch=%d signal=%ddBm", s.BSSID, s.SSID, s.Channel, s.SignalDBM)
+	if s.NoiseDBM != 0 {
+		text += fmt.Sprintf(" noise=%ddBm snr=%ddB", s.NoiseDBM, s.SNR())
+	}
+	return text + fmt.Sprintf(" tx=%.1fMbps rx=%.1fMbps retries=%d (%.1f%%) failed=%d via %s",
+		s.TxMbps, s.RxMbps, s.TxRetries, s.RetryPercent, s.TxFailed, s.Source)
+}
+
+// ReadStationInfo reads the station info of the associated access point
+// from nl80211, falling back to iw where netlink is unavailable (e.g. in
+// containers without the host network namespace)
+func ReadStationInfo(ctx context.Context, iface string) (*StationInfo, error) {
+	info, err := readNL80211Station(iface)
+	if err == nil {
+		return info, nil
+	}
+	if info, iwErr := readIwStation(ctx, iface); iwErr == nil {
+		return info, nil
+	}
+	return nil, err
+}
+
+// genlConn is a generic netlink socket
+type genlConn struct {
+	fd  int    // Netlink socket
+	seq uint32 // Sequence number of the last request
+}
+
+// dialGenetlink opens a generic netlink socket
+func dialGenetlink() (*genlConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	timeout := syscall.NsecToTimeval(int64(2 * time.Second))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &genlConn{fd: fd}, nil
+}
+
+// close releases the socket
+func (c *genlConn) close() {
+	syscall.Close(c.fd)
+}
+
+// request sends a generic netlink command and returns the attributes of
+// every reply, collecting all parts of a dump
+func (c *genlConn) request(family uint16, cmd uint8, flags uint16, attrs []byte) ([]map[uint16][]byte, error) {
+	c.seq++
+	msg := make([]byte, syscall.NLMSG_HDRLEN+4, syscall.NLMSG_HDRLEN+4+len(attrs))
+	binary.NativeEndian.PutUint32(msg[0:], uint32(len(msg)+len(attrs)))
+	binary.NativeEndian.PutUint16(msg[4:], family)
+	binary.NativeEndian.PutUint16(msg[6:], syscall.NLM_F_REQUEST|flags)
+	binary.NativeEndian.PutUint32(msg[8:], c.seq)
+	msg[syscall.NLMSG_HDRLEN] = cmd
+	msg[syscall.NLMSG_HDRLEN+1] = 1 // Version
+	msg = append(msg, attrs...)
+	if err := syscall.Sendto(c.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var replies []map[uint16][]byte
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			if m.Header.Seq != c.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return replies, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, errors.New("short netlink error")
+				}
+				if errno := int32(binary.NativeEndian.Uint32(m.Data)); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				return replies, nil
+			}
+			if len(m.Data) >= 4 {
+				replies = append(replies, parseNetlinkAttrs(m.Data[4:]))
+			}
+			if flags&syscall.NLM_F_DUMP == 0 {
+				return replies, nil
+			}
+		}
+	}
+}
+
+// netlinkAttr encodes one attribute, padded to 4 bytes
+func netlinkAttr(typ uint16, payload []byte) []byte {
+	attr := make([]byte, 4, 4+len(payload)+3)
+	binary.NativeEndian.PutUint16(attr[0:], uint16(4+len(payload)))
+	binary.NativeEndian.PutUint16(attr[2:], typ)
+	attr = append(attr, payload...)
+	for len(attr)%4 != 0 {
+		attr = append(attr, 0)
+	}
+	return attr
+}
+
+// parseNetlinkAttrs decodes a sequence of attributes by type
+func parseNetlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= 4 {
+		length := int(binary.NativeEndian.Uint16(b[0:]))
+		if length < 4 || length > len(b) {
+			break
+		}
+		attrs[binary.NativeEndian.Uint16(b[2:])&nlaTypeMask] = b[4:length]
+		b = b[min((length+3)&^3, len(b)):]
+	}
+	return attrs
+}
+
+// attrUint reads an unsigned attribute of 1, 2, 4 or 8 bytes
+func attrUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.NativeEndian.Uint16(b))
+	case 4:
+		return uint64(binary.NativeEndian.Uint32(b))
+	case 8:
+		return binary.NativeEndian.Uint64(b)
+	}
+	return 0
+}
+
+// attrBitrate reads a nested rate info attribute in Mbit/s
+func attrBitrate(b []byte) float64 {
+	rate := parseNetlinkAttrs(b)
+	if v, ok := rate[rateInfoBitrate32]; ok {
+		return float64(attrUint(v)) / 10
+	}
+	return float64(attrUint(rate[rateInfoBitrate])) / 10
+}
+
+// readNL80211Station queries the station and survey dumps of an interface
+func readNL80211Station(iface string) (*StationInfo, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialGenetlink()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	// Resolve the nl80211 family ID
+	replies, err := conn.request(genlIDCtrl, ctrlCmdGetFamily, 0, netlinkAttr(ctrlAttrFamilyName, []byte("nl80211\x00")))
+	if err != nil || len(replies) == 0 || len(replies[0][ctrlAttrFamilyID]) != 2 {
+		return nil, fmt.Errorf("nl80211 not available: %v", err)
+	}
+	family := uint16(attrUint(replies[0][ctrlAttrFamilyID]))
+
+	ifindex := make([]byte, 4)
+	binary.NativeEndian.PutUint32(ifindex, uint32(ifi.Index))
+	stations, err := conn.request(family, nl80211CmdGetStation, syscall.NLM_F_DUMP, netlinkAttr(nl80211AttrIfindex, ifindex))
+	if err != nil {
+		return nil, err
+	}
+	if len(stations) == 0 || stations[0][nl80211AttrStaInfo] == nil {
+		return nil, fmt.Errorf("%s is not associated", iface)
+	}
+
+	// A managed interface has one station: its access point
+	sta := parseNetlinkAttrs(stations[0][nl80211AttrStaInfo])
+	info := &StationInfo{
+		BSSID:        net.HardwareAddr(stations[0][nl80211AttrMAC]).String(),
+		SignalDBM:    int(int8(attrUint(sta[staInfoSignal]))),
+		SignalAvgDBM: int(int8(attrUint(sta[staInfoSignalAvg]))),
+		TxMbps:       attrBitrate(sta[staInfoTxBitrate]),
+		RxMbps:       attrBitrate(sta[staInfoRxBitrate]),
+		TxPackets:    attrUint(sta[staInfoTxPackets]),
+		TxRetries:    attrUint(sta[staInfoTxRetries]),
+		TxFailed:     attrUint(sta[staInfoTxFailed]),
+		Source:       "nl80211",
+	}
+
+	// SSID and frequency are interface attributes
+	if ifaces, err := conn.request(family, nl80211CmdGetIface, 0, netlinkAttr(nl80211AttrIfindex, ifindex)); err == nil && len(ifaces) > 0 {
+		info.SSID = string(ifaces[0][nl80211AttrSSID])
+		info.FreqMHz = int(attrUint(ifaces[0][nl80211AttrFreq]))
+		info.Channel = frequencyChannel(info.FreqMHz)
+	}
+
+	// The noise floor comes from the survey of the channel in use, which not
+	// every driver provides
+	surveys, err := conn.request(family, nl80211CmdGetSurvey, syscall.NLM_F_DUMP, netlinkAttr(nl80211AttrIfindex, ifindex))
+	if err == nil {
+		for _, survey := range surveys {
+			channel := parseNetlinkAttrs(survey[nl80211AttrSurvey])
+			if _, inUse := channel[surveyInfoInUse]; inUse && channel[surveyInfoNoise] != nil {
+				info.NoiseDBM = int(int8(attrUint(channel[surveyInfoNoise])))
+			}
+		}
+	}
+	return info, nil
+}
+
+// readIwStation parses `iw dev <if> station dump` and `iw dev <if> survey dump`
+func readIwStation(ctx context.Context, iface string) (*StationInfo, error) {
+	output, err := CaptureCommand(ctx, "iw", "dev", iface, "station", "dump")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &StationInfo{Source: "iw"}
+	found := false
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		fields := strings.Fields(value)
+		if strings.HasPrefix(line, "Station ") {
+			if found {
+				break // Only the first station is the access point
+			}
+			found = true
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				info.BSSID = fields[1]
+			}
+			continue
+		}
+		if !ok || len(fields) == 0 {
+			continue
+		}
+		number, _ := strconv.ParseFloat(fields[0], 64)
+		switch key {
+		case "signal":
+			info.SignalDBM = int(number)
+		case "signal avg":
+			info.SignalAvgDBM = int(number)
+		case "tx bitrate":
+			info.TxMbps = number
+		case "rx bitrate":
+			info.RxMbps = number
+		case "tx packets":
+			info.TxPackets = uint64(number)
+		case "tx retries":
+			info.TxRetries = uint64(number)
+		case "tx failed":
+			info.TxFailed = uint64(number)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not associated", iface)
+	}
+
+	if link, ok := ReadWiFiLink(ctx, iface); ok {
+		info.SSID, info.FreqMHz, info.Channel = link.SSID, link.FreqMHz, link.Channel()
+	}
+
+	// The noise line follows the frequency marked [in use]
+	if output, err := CaptureCommand(ctx, "iw", "dev", iface, "survey", "dump"); err == nil {
+		inUse := false
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "frequency:"):
+				inUse = strings.Contains(line, "[in use]")
+			case inUse && strings.HasPrefix(line, "noise:"):
+				if fields := strings.Fields(strings.TrimPrefix(line, "noise:")); len(fields) > 0 {
+					info.NoiseDBM, _ = strconv.Atoi(fields[0])
+				}
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,157 @@
+package probe
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// nativeUint encodes v in n bytes of host byte order like the kernel does
+func nativeUint(v uint64, n int) []byte {
+	switch n {
+	case 1:
+		return []byte{byte(v)}
+	case 2:
+		return binary.NativeEndian.AppendUint16(nil, uint16(v))
+	case 4:
+		return binary.NativeEndian.AppendUint32(nil, uint32(v))
+	}
+	return binary.NativeEndian.AppendUint64(nil, v)
+}
+
+// rawNetlinkAttr encodes an attribute header with an arbitrary length field
+func rawNetlinkAttr(length, typ uint16, payload ...byte) []byte {
+	b := binary.NativeEndian.AppendUint16(nil, length)
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	return append(b, payload...)
+}
+
+func TestNetlinkAttr(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		size    int
+	}{
+		{name: "empty", payload: nil, size: 4},
+		{name: "aligned", payload: []byte{1, 2, 3, 4}, size: 8},
+		{name: "padded", payload: []byte("nl80211\x00"[:7]), size: 12},
+		{name: "string", payload: []byte("nl80211\x00"), size: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attr := netlinkAttr(ctrlAttrFamilyName, tt.payload)
+			if len(attr) != tt.size {
+				t.Errorf("netlinkAttr() is %d bytes, want %d", len(attr), tt.size)
+			}
+			if length := int(binary.NativeEndian.Uint16(attr)); length != 4+len(tt.payload) {
+				t.Errorf("length field %d, want %d", length, 4+len(tt.payload))
+			}
+			got := parseNetlinkAttrs(attr)[ctrlAttrFamilyName]
+			if string(got) != string(tt.payload) {
+				t.Errorf("parsed payload %q, want %q", got, tt.payload)
+			}
+		})
+	}
+}
+
+func TestParseNetlinkAttrs(t *testing.T) {
+	signal := netlinkAttr(staInfoSignal, []byte{0xc4})
+	packets := netlinkAttr(staInfoTxPackets, nativeUint(1234, 4))
+
+	tests := []struct {
+		name string
+		b    []byte
+		want map[uint16][]byte
+	}{
+		{name: "empty", b: nil, want: map[uint16][]byte{}},
+		{name: "shorter than a header", b: []byte{8, 0, 7}, want: map[uint16][]byte{}},
+		{
+			name: "several attributes",
+			b:    append(append([]byte(nil), signal...), packets...),
+			want: map[uint16][]byte{staInfoSignal: {0xc4}, staInfoTxPackets: nativeUint(1234, 4)},
+		},
+		{
+			name: "nested flag masked",
+			b:    rawNetlinkAttr(8, 0x8000|nl80211AttrStaInfo, 1, 2, 3, 4),
+			want: map[uint16][]byte{nl80211AttrStaInfo: {1, 2, 3, 4}},
+		},
+		{
+			name: "length beyond the buffer",
+			b:    append(append([]byte(nil), signal...), rawNetlinkAttr(12, staInfoTxPackets, 1, 2)...),
+			want: map[uint16][]byte{staInfoSignal: {0xc4}},
+		},
+		{
+			name: "length below the header",
+			b:    append(rawNetlinkAttr(2, staInfoSignal, 0, 0), packets...),
+			want: map[uint16][]byte{},
+		},
+		{
+			name: "last attribute without padding",
+			b:    append(append([]byte(nil), packets...), rawNetlinkAttr(5, staInfoSignal, 0xc4)...),
+			want: map[uint16][]byte{staInfoTxPackets: nativeUint(1234, 4), staInfoSignal: {0xc4}},
+		},
+		{
+			name: "trailing bytes after the last attribute",
+			b:    append(append([]byte(nil), signal...), 0, 0),
+			want: map[uint16][]byte{staInfoSignal: {0xc4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNetlinkAttrs(tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNetlinkAttrs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttrUint(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want uint64
+	}{
+		{name: "missing", b: nil, want: 0},
+		{name: "u8", b: nativeUint(200, 1), want: 200},
+		{name: "u16", b: nativeUint(2412, 2), want: 2412},
+		{name: "u32", b: nativeUint(5180, 4), want: 5180},
+		{name: "u64", b: nativeUint(1<<40, 8), want: 1 << 40},
+		{name: "odd length", b: []byte{1, 2, 3}, want: 0},
+		{name: "oversized", b: make([]byte, 16), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attrUint(tt.b); got != tt.want {
+				t.Errorf("attrUint() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := int(int8(attrUint([]byte{0xc4}))); got != -60 {
+		t.Errorf("signal 0xc4 = %d dBm, want -60", got)
+	}
+}
+
+func TestAttrBitrate(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want float64
+	}{
+		{name: "missing", b: nil, want: 0},
+		{name: "16-bit rate", b: netlinkAttr(rateInfoBitrate, nativeUint(1300, 2)), want: 130},
+		{
+			name: "32-bit rate preferred",
+			b:    append(netlinkAttr(rateInfoBitrate, nativeUint(0xffff, 2)), netlinkAttr(rateInfoBitrate32, nativeUint(24020, 4))...),
+			want: 2402,
+		},
+		{name: "rate cut short", b: netlinkAttr(rateInfoBitrate32, nativeUint(24020, 4))[:6], want: 0},
+		{name: "header only", b: rawNetlinkAttr(8, rateInfoBitrate32), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attrBitrate(tt.b); got != tt.want {
+				t.Errorf("attrBitrate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+var (
+	// pingLossPattern matches "20% packet loss" in ping summaries
+	pingLossPattern = regexp.MustCompile(`([\d.]+)% packet loss`)
+	// pingRTTPattern matches "rtt min/avg/max/mdev = 1.0/2.0/3.0/0.5 ms"
+	pingRTTPattern = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)/([\d.]+) ms`)
+)
+
+// PingStats summarizes a burst of ICMP echo requests to one target
+type PingStats struct {
+	Target string          // Destination address
+	Sent   int             // Packets sent
+	Loss   float64         // Packet loss in percent
+	Min    time.Duration   // Minimum RTT
+	Avg    time.Duration   // Average RTT
+	Max    time.Duration   // Maximum RTT
+	Jitter time.Duration   // RFC 3550 interarrival jitter (mdev when parsed from ping)
+	RTTs   []time.Duration // Round trip time of each reply, in arrival order (native ICMP only)
+}
+
+// PingFrom sends count echo requests over the given interface and parses the
+// summary, using the payload size configured for the target in PING_SIZES
+func PingFrom(ctx context.Context, s *config.Settings, iface, target string, count int) PingStats {
+	return PingSized(ctx, s, iface, target, count, PingPayloadSize(s, target), false)
+}
+
+// PingPayloadSize returns the ICMP payload size for a target from PING_SIZES
+// entries of the form target=bytes (0 keeps the ping default of 56 bytes)
+func PingPayloadSize(s *config.Settings, target string) int {
+	for _, entry := range s.List("PING_SIZES") {
+		if host, size, ok := strings.Cut(entry, "="); ok && host == target {
+			if n, err := strconv.Atoi(size); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// PingSized sends count echo requests with the given payload size, optionally
+// with the Don't Fragment bit set so oversized packets are dropped instead of fragmented
+func PingSized(ctx context.Context, s *config.Settings, iface, target string, count, size int, dontFragment bool) PingStats {
+	return Ping(ctx, s, iface, target, count, size, dontFragment, 2*time.Second)
+}
+
+// Ping sends the echo requests from an ICMP socket, or runs the ping
+// command depending on ICMP_MODE, waiting up to wait for the last reply
+func Ping(ctx context.Context, s *config.Settings, iface, target string, count, size int, dontFragment bool, wait time.Duration) PingStats {
+	mode := ICMPMode(s)
+	if mode != "exec" {
+		stats, err := icmpEcho(ctx, iface, target, count, size, dontFragment, wait)
+		if mode == "native" || !errors.Is(err, errICMPSocket) {
+			recordICMPOutput(ctx, iface, count, size, dontFragment, stats, err)
+			return stats
+		}
+		icmpFallbackNotice.Do(func() {
+			fmt.Printf("Error opening ICMP socket, using the ping command: %v\n", err)
+		})
+	}
+	return pingCommand(ctx, iface, target, count, size, dontFragment, wait)
+}
+
+// pingCommand runs ping or ping6 and parses its summary
+func pingCommand(ctx context.Context, iface, target string, count, size int, dontFragment bool, wait time.Duration) PingStats {
+	stats := PingStats{Target: target, Sent: count, Loss: 100}
+
+	pingCmd := "ping"
+	if ip := net.ParseIP(target); ip != nil && ip.To4() == nil {
+		pingCmd = "ping6"
+	}
+
+	args := []string{"-I", iface, "-c", strconv.Itoa(count), "-i", "0.2", "-W", strconv.Itoa(int(wait.Seconds()))}
+	if size > 0 {
+		args = append(args, "-s", strconv.Itoa(size))
+	}
+	if dontFragment {
+		args = append(args, "-M", "do")
+	}
+
+	// ping exits non-zero on partial loss, so parse the output regardless
+	output, _ := CaptureCommand(ctx, pingCmd, append(args, target)...)
+
+	if m := pingLossPattern.FindSubmatch(output); m != nil {
+		stats.Loss, _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	if m := pingRTTPattern.FindSubmatch(output); m != nil {
+		stats.Min = parseMillis(string(m[1]))
+		stats.Avg = parseMillis(string(m[2]))
+		stats.Max = parseMillis(string(m[3]))
+		stats.Jitter = parseMillis(string(m[4]))
+	}
+
+	return stats
+}
+
+// parseMillis converts a millisecond string such as "12.345" into a duration
+func parseMillis(s string) time.Duration {
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,155 @@
+// Package probe holds the measurements of noc-watch: the Probe interface
+// the monitoring loop schedules, and the ICMP, DHCP, nl80211, router
+// advertisement and STUN clients behind the built-in checks.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// Probe is a measurement the monitoring loop runs on a schedule. Custom
+// probes registered with monitor.Monitor.AddProbe get scheduling, pausing,
+// alerts, the log, the UI and metrics export without changes to those parts.
+type Probe interface {
+	Name() string                   // Name shown in the UI, log, alerts and metrics
+	Run(ctx context.Context) Result // One measurement; ctx ends when the run times out
+}
+
+// Result is the outcome of one probe run
+type Result struct {
+	Success   bool               `json:"success"`           // Measurement succeeded
+	Latency   time.Duration      `json:"latency_ns"`        // Main timing of the probe (0 if it has none)
+	Metrics   map[string]float64 `json:"metrics,omitempty"` // Further probe-specific values by metric name
+	Error     string             `json:"error,omitempty"`   // Failure reason
+	Timestamp time.Time          `json:"timestamp"`         // Run start, filled in by the monitor when left empty
+}
+
+// String summarizes a probe result for the log and the UI
+func (r Result) String() string {
+	var b strings.Builder
+	if r.Success {
+		b.WriteString("OK")
+	} else {
+		b.WriteString("FAIL")
+	}
+	if r.Latency > 0 {
+		fmt.Fprintf(&b, " %v", r.Latency.Round(time.Millisecond))
+	}
+
+	// Metrics are listed by name so the log lines stay comparable
+	names := make([]string, 0, len(r.Metrics))
+	for name := range r.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s=%g", name, r.Metrics[name])
+	}
+
+	if r.Error != "" {
+		fmt.Fprintf(&b, " (%s)", r.Error)
+	}
+	return b.String()
+}
+
+// DHCPProbe measures a DHCP exchange of an interface with the backend of
+// the configured or detected DHCP client
+type DHCPProbe struct {
+	iface   string      // Interface whose lease is renewed
+	client  string      // DHCP client name (native, dhclient, dhcpcd, udhcpc, nmcli, networkmanager)
+	release bool        // DHCP_RELEASE: the native client releases the lease first
+	backend dhcpBackend // Backend driving the client
+	lease   *DHCPLease  // Details of the lease from the last successful run
+}
+
+// NewDHCPProbe creates a DHCP probe using the client selected by DHCP_CLIENT
+func NewDHCPProbe(s *config.Settings, iface string) *DHCPProbe {
+	client := DHCPClient(s, iface)
+	return &DHCPProbe{iface: iface, client: client, release: s.Get("DHCP_RELEASE") == "true", backend: dhcpBackends[client](s)}
+}
+
+// Name identifies the DHCP probe
+func (p *DHCPProbe) Name() string { return "dhcp" }
+
+// Run measures the time until a lease is assigned and reads its details
+// from the client, or from the interface when the client does not tell
+func (p *DHCPProbe) Run(ctx context.Context) Result {
+	result := p.backend.Renew(ctx, p.iface)
+	p.lease = nil
+	if !result.Success {
+		return result
+	}
+	if reader, ok := p.backend.(leaseReader); ok {
+		p.lease = reader.lastLease(ctx, p.iface)
+	}
+	if p.lease == nil {
+		p.lease = interfaceLease(p.iface)
+	}
+	return result
+}
+
+// Lease returns the details of the lease from the last successful run
+func (p *DHCPProbe) Lease() *DHCPLease {
+	return p.lease
+}
+
+// Disruptive reports whether the DHCP test takes the lease away from the
+// interface: every external client does, the native one only with DHCP_RELEASE
+func (p *DHCPProbe) Disruptive() bool {
+	return p.client != "native" || p.release
+}
+
+// LatencyProbe measures the average round trip time to a target
+type LatencyProbe struct {
+	name     string           // Ping target name
+	iface    string           // Interface the echo requests are sent from
+	target   string           // Address to ping
+	count    int              // Echo requests per burst
+	settings *config.Settings // ICMP_MODE
+}
+
+// NewLatencyProbe creates a probe sending count echo requests per run from
+// iface to target, reported under name
+func NewLatencyProbe(s *config.Settings, name, iface, target string, count int) LatencyProbe {
+	return LatencyProbe{name: name, iface: iface, target: target, count: count, settings: s}
+}
+
+// Name identifies the latency probe by its target
+func (p LatencyProbe) Name() string { return p.name }
+
+// Run sends a burst of echo requests and reports their average round trip
+// time, with loss, the RTT spread and jitter as metrics
+func (p LatencyProbe) Run(ctx context.Context) Result {
+	stats := Ping(ctx, p.settings, p.iface, p.target, p.count, 0, false, 5*time.Second)
+	received := stats.Sent - int(math.Round(float64(stats.Sent)*stats.Loss/100))
+	if stats.Loss >= 100 {
+		return Result{Error: "no reply from " + p.target, Metrics: map[string]float64{
+			"loss_percent": stats.Loss,
+			"sent":         float64(stats.Sent),
+			"received":     0,
+		}}
+	}
+	return Result{Success: true, Latency: stats.Avg, Metrics: map[string]float64{
+		"loss_percent": stats.Loss,
+		"sent":         float64(stats.Sent),
+		"received":     float64(received),
+		"rtt_min_ms":   float64(stats.Min) / float64(time.Millisecond),
+		"rtt_max_ms":   float64(stats.Max) / float64(time.Millisecond),
+		"jitter_ms":    float64(stats.Jitter) / float64(time.Millisecond),
+	}}
+}
+
+// orDash returns "-" for empty values
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
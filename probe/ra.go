@@ -0,0 +1,224 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv6"
+)
+
+// Neighbor Discovery option types used in router advertisements
+const (
+	NDOptSourceLinkAddr = 1
+	NDOptTargetLinkAddr = 2
+	ndOptPrefixInfo     = 3
+	ndOptMTU            = 5
+	ndOptRDNSS          = 25
+	ndOptDNSSL          = 31
+)
+
+// allRouters is the link-local multicast group router solicitations go to
+var allRouters = net.ParseIP("ff02::2")
+
+// RouterAdvertisement is an ICMPv6 router advertisement seen on the interface
+type RouterAdvertisement struct {
+	Router      string        `json:"router"`                 // Link-local source address of the router
+	Managed     bool          `json:"managed,omitempty"`      // M flag: addresses from DHCPv6
+	OtherConfig bool          `json:"other_config,omitempty"` // O flag: other configuration from DHCPv6
+	Lifetime    time.Duration `json:"lifetime_ns"`            // Default router lifetime (0: not a default router)
+	Prefixes    []RAPrefix    `json:"prefixes,omitempty"`     // Prefix information options
+	RDNSS       []string      `json:"rdnss,omitempty"`        // Recursive DNS servers (RFC 8106)
+	DNSSL       []string      `json:"dnssl,omitempty"`        // DNS search list
+	MTU         int           `json:"mtu,omitempty"`          // Advertised link MTU
+	Interval    time.Duration `json:"interval_ns,omitempty"`  // Time since the router's previous advertisement (monitor only)
+	Received    time.Time     `json:"received"`               // Time the advertisement arrived
+}
+
+// RAPrefix is a prefix information option of a router advertisement
+type RAPrefix struct {
+	Prefix     string        `json:"prefix"`               // Prefix in CIDR notation
+	Autonomous bool          `json:"autonomous,omitempty"` // A flag: usable for SLAAC
+	Valid      time.Duration `json:"valid_ns"`             // Valid lifetime
+	Preferred  time.Duration `json:"preferred_ns"`         // Preferred lifetime
+}
+
+// String formats the prefix with its lifetimes
+func (p RAPrefix) String() string {
+	return fmt.Sprintf("%s (valid %v, preferred %v)", p.Prefix, p.Valid, p.Preferred)
+}
+
+// prefixes lists the advertised prefixes in CIDR notation
+func (ra RouterAdvertisement) prefixes() []string {
+	var prefixes []string
+	for _, p := range ra.Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return prefixes
+}
+
+// String summarizes the advertisement for the log and the UI
+func (ra RouterAdvertisement) String() string {
+	var flags []string
+	if ra.Managed {
+		flags = append(flags, "M")
+	}
+	if ra.OtherConfig {
+		flags = append(flags, "O")
+	}
+	return fmt.Sprintf("%s lifetime %v flags [%s] prefixes %s rdnss %s", ra.Router, ra.Lifetime,
+		strings.Join(flags, ""), orDash(strings.Join(ra.prefixes(), ",")), orDash(strings.Join(ra.RDNSS, ",")))
+}
+
+// parseRouterAdvertisement decodes an ICMPv6 router advertisement (type 134)
+func parseRouterAdvertisement(b []byte, router string, received time.Time) (RouterAdvertisement, error) {
+	ra := RouterAdvertisement{Router: router, Received: received}
+	if len(b) < 16 || b[0] != byte(ipv6.ICMPTypeRouterAdvertisement) {
+		return ra, errors.New("not a router advertisement")
+	}
+	ra.Managed = b[5]&0x80 != 0
+	ra.OtherConfig = b[5]&0x40 != 0
+	ra.Lifetime = time.Duration(binary.BigEndian.Uint16(b[6:8])) * time.Second
+
+	// Options are type, length in units of 8 octets, data
+	for opts := b[16:]; len(opts) >= 2; {
+		length := int(opts[1]) * 8
+		if length == 0 || length > len(opts) {
+			return ra, errors.New("malformed router advertisement option")
+		}
+		opt := opts[:length]
+		opts = opts[length:]
+		switch opt[0] {
+		case ndOptPrefixInfo:
+			if len(opt) < 32 {
+				continue
+			}
+			prefix := net.IPNet{IP: net.IP(opt[16:32]), Mask: net.CIDRMask(int(opt[2]), 128)}
+			ra.Prefixes = append(ra.Prefixes, RAPrefix{
+				Prefix:     prefix.String(),
+				Autonomous: opt[3]&0x40 != 0,
+				Valid:      time.Duration(binary.BigEndian.Uint32(opt[4:8])) * time.Second,
+				Preferred:  time.Duration(binary.BigEndian.Uint32(opt[8:12])) * time.Second,
+			})
+		case ndOptMTU:
+			if len(opt) >= 8 {
+				ra.MTU = int(binary.BigEndian.Uint32(opt[4:8]))
+			}
+		case ndOptRDNSS:
+			for addr := opt[8:]; len(addr) >= 16; addr = addr[16:] {
+				ra.RDNSS = append(ra.RDNSS, net.IP(addr[:16]).String())
+			}
+		case ndOptDNSSL:
+			ra.DNSSL = append(ra.DNSSL, ParseDNSLabels(opt[8:])...)
+		}
+	}
+	return ra, nil
+}
+
+// ParseDNSLabels decodes uncompressed domain names in DNS wire format, as
+// carried by the DNSSL option, up to the zero padding at the end
+func ParseDNSLabels(b []byte) []string {
+	var names, labels []string
+	for len(b) > 0 {
+		n := int(b[0])
+		b = b[1:]
+		if n == 0 {
+			if len(labels) > 0 {
+				names = append(names, strings.Join(labels, "."))
+				labels = nil
+			}
+			continue
+		}
+		if n > len(b) {
+			break
+		}
+		labels = append(labels, string(b[:n]))
+		b = b[n:]
+	}
+	return names
+}
+
+// ListenRouterAdvertisements opens a raw ICMPv6 socket on the interface that
+// receives router advertisements only and can send router solicitations.
+// It needs CAP_NET_RAW.
+func ListenRouterAdvertisements(iface string) (*ipv6.PacketConn, error) {
+	return ListenNeighborDiscovery(iface, ipv6.ICMPTypeRouterAdvertisement)
+}
+
+// ListenNeighborDiscovery opens a raw ICMPv6 socket on the interface that
+// receives the given Neighbor Discovery message type. It needs CAP_NET_RAW.
+func ListenNeighborDiscovery(iface string, accept ipv6.ICMPType) (*ipv6.PacketConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.IPPROTO_ICMPV6)
+	if err != nil {
+		return nil, fmt.Errorf("raw ICMPv6 socket (needs CAP_NET_RAW): %v", err)
+	}
+	if err := syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("bind to %s: %v", iface, err)
+	}
+	f := os.NewFile(uintptr(fd), "icmpv6")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Neighbor Discovery messages carry hop limit 255, which proves they are on-link
+	p := ipv6.NewPacketConn(conn)
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(accept)
+	for _, err := range []error{
+		p.SetICMPFilter(&filter),
+		p.SetMulticastHopLimit(255),
+		p.SetHopLimit(255),
+		p.SetControlMessage(ipv6.FlagHopLimit, true),
+	} {
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// SendRouterSolicitation asks the routers on the link to advertise now
+func SendRouterSolicitation(p *ipv6.PacketConn, iface string) error {
+	msg := make([]byte, 8)
+	msg[0] = byte(ipv6.ICMPTypeRouterSolicitation)
+	if ifi, err := net.InterfaceByName(iface); err == nil && len(ifi.HardwareAddr) == 6 {
+		msg = append(msg, NDOptSourceLinkAddr, 1)
+		msg = append(msg, ifi.HardwareAddr...)
+	}
+	_, err := p.WriteTo(msg, nil, &net.IPAddr{IP: allRouters, Zone: iface})
+	return err
+}
+
+// ReadRouterAdvertisement waits for the next valid router advertisement
+func ReadRouterAdvertisement(p *ipv6.PacketConn, deadline time.Time) (RouterAdvertisement, error) {
+	buf := make([]byte, 1500)
+	p.SetReadDeadline(deadline)
+	for {
+		n, cm, src, err := p.ReadFrom(buf)
+		if err != nil {
+			return RouterAdvertisement{}, err
+		}
+		if cm != nil && cm.HopLimit != 255 {
+			continue
+		}
+		router := ""
+		if addr, ok := src.(*net.IPAddr); ok {
+			router = addr.IP.String()
+		}
+		ra, err := parseRouterAdvertisement(buf[:n], router, time.Now())
+		if err != nil {
+			continue
+		}
+		return ra, nil
+	}
+}
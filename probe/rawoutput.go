@@ -0,0 +1,147 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rawOutputMaxBytes caps each stored stream so a runaway command cannot grow the store
+const rawOutputMaxBytes = 8 << 10
+
+// RawOutput is the unparsed output of one probe command or request, kept to
+// diagnose odd parses without re-running commands by hand
+type RawOutput struct {
+	Time    time.Time `json:"time"`             // When the command finished
+	Source  string    `json:"source"`           // Producer (ping, dhclient, traceroute, iw, http, ...)
+	Command string    `json:"command"`          // Command line or request URL
+	Stdout  string    `json:"stdout,omitempty"` // Raw standard output, or the HTTP status line and headers
+	Stderr  string    `json:"stderr,omitempty"` // Raw standard error
+	Error   string    `json:"error,omitempty"`  // Exit status or request error ("" on success)
+}
+
+// RawOutputStore keeps the last outputs per source. Each monitor has its
+// own, shared by its monitoring loop, background measurements and TUI,
+// hence the mutex.
+type RawOutputStore struct {
+	mu      sync.Mutex             // Guards entries
+	limit   int                    // Outputs kept per source (0 disables the store)
+	entries map[string][]RawOutput // Outputs per source, oldest first
+}
+
+// NewRawOutputStore creates a store keeping limit outputs per source
+func NewRawOutputStore(limit int) *RawOutputStore {
+	return &RawOutputStore{limit: limit, entries: make(map[string][]RawOutput)}
+}
+
+// rawOutputsKey is the context key of the store probe commands are kept in
+type rawOutputsKey struct{}
+
+// WithRawOutputs returns a context whose probe commands are kept in store.
+// Probes run commands deep in helpers that do not know their monitor, so
+// the store travels with the context they already take.
+func WithRawOutputs(ctx context.Context, store *RawOutputStore) context.Context {
+	return context.WithValue(ctx, rawOutputsKey{}, store)
+}
+
+// rawOutputsOf returns the store of ctx, or nil when outputs are not kept
+func rawOutputsOf(ctx context.Context) *RawOutputStore {
+	store, _ := ctx.Value(rawOutputsKey{}).(*RawOutputStore)
+	return store
+}
+
+// Add stores an output, dropping the oldest of its source when full. A nil
+// store drops every output.
+func (s *RawOutputStore) Add(entry RawOutput) {
+	if s == nil {
+		return
+	}
+	entry.Stdout = truncateRaw(entry.Stdout)
+	entry.Stderr = truncateRaw(entry.Stderr)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit <= 0 {
+		return
+	}
+	entries := append(s.entries[entry.Source], entry)
+	if len(entries) > s.limit {
+		entries = entries[len(entries)-s.limit:]
+	}
+	s.entries[entry.Source] = entries
+}
+
+// Recent returns the stored outputs of source (all sources when empty), newest first
+func (s *RawOutputStore) Recent(source string) []RawOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []RawOutput
+	for name, list := range s.entries {
+		if source == "" || name == source {
+			entries = append(entries, list...)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	return entries
+}
+
+// truncateRaw cuts a stream to rawOutputMaxBytes
+func truncateRaw(s string) string {
+	if len(s) <= rawOutputMaxBytes {
+		return s
+	}
+	return s[:rawOutputMaxBytes] + "\n[truncated]"
+}
+
+// CaptureCommand runs a command like exec.Cmd.Output, killed once ctx
+// ends, and keeps its raw stdout, stderr and exit status in the raw output
+// store of ctx
+func CaptureCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	entry := RawOutput{
+		Time:    time.Now(),
+		Source:  commandSource(name, args),
+		Command: strings.Join(append([]string{name}, args...), " "),
+		Stdout:  stdout.String(),
+		Stderr:  stderr.String(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	rawOutputsOf(ctx).Add(entry)
+
+	return stdout.Bytes(), err
+}
+
+// commandSource names the store a command belongs to, looking through sudo
+func commandSource(name string, args []string) string {
+	if name == "sudo" && len(args) > 0 {
+		return args[0]
+	}
+	return name
+}
+
+// AddResponse keeps the status line and headers of an HTTP response, or the request error
+func (s *RawOutputStore) AddResponse(target string, resp *http.Response, err error) {
+	entry := RawOutput{Time: time.Now(), Source: "http", Command: "GET " + target}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		var headers bytes.Buffer
+		fmt.Fprintf(&headers, "%s %s\n", resp.Proto, resp.Status)
+		resp.Header.Write(&headers)
+		entry.Stdout = headers.String()
+	}
+	s.Add(entry)
+}
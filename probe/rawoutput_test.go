@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCaptureCommandKeepsOutputPerMonitor(t *testing.T) {
+	first, second := NewRawOutputStore(20), NewRawOutputStore(20)
+	if _, err := CaptureCommand(WithRawOutputs(context.Background(), first), "echo", "first"); err != nil {
+		t.Skipf("echo: %v", err)
+	}
+	CaptureCommand(WithRawOutputs(context.Background(), second), "echo", "second")
+	CaptureCommand(context.Background(), "echo", "unkept")
+
+	for _, tt := range []struct {
+		name  string
+		store *RawOutputStore
+		want  string
+	}{
+		{name: "first", store: first, want: "first\n"},
+		{name: "second", store: second, want: "second\n"},
+	} {
+		outputs := tt.store.Recent("echo")
+		if len(outputs) != 1 || outputs[0].Stdout != tt.want {
+			t.Errorf("%s store kept %+v, want only the %q output", tt.name, outputs, tt.want)
+		}
+	}
+}
+
+func TestRawOutputStoreLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{name: "disabled", limit: 0, want: 0},
+		{name: "below the limit", limit: 5, want: 3},
+		{name: "oldest dropped", limit: 2, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewRawOutputStore(tt.limit)
+			for _, command := range []string{"ping 1", "ping 2", "ping 3"} {
+				store.Add(RawOutput{Source: "ping", Command: command})
+			}
+			if got := len(store.Recent("ping")); got != tt.want {
+				t.Errorf("kept %d outputs, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// STUN message types and attributes (RFC 5389, RFC 5780 and the classic
+// RFC 3489 ones still sent by older servers)
+const (
+	stunBindingRequest     = 0x0001
+	stunBindingResponse    = 0x0101
+	stunMagicCookie        = 0x2112a442
+	stunAttrMapped         = 0x0001
+	stunAttrChangeRequest  = 0x0003
+	stunAttrChangedAddress = 0x0005
+	stunAttrXORMapped      = 0x0020
+	stunAttrOtherAddress   = 0x802c
+)
+
+// CHANGE-REQUEST flags asking the server to answer from its alternate
+// address or port
+const (
+	STUNChangeIP   = 0x04
+	STUNChangePort = 0x02
+)
+
+// stunRetransmit is the time to wait for a response before sending the
+// request again
+const stunRetransmit = 500 * time.Millisecond
+
+// ErrNoSTUNResponse means the server did not answer before the deadline,
+// which the NAT filtering tests expect when the NAT drops the response
+var ErrNoSTUNResponse = errors.New("no STUN response")
+
+// STUNResponse is what the monitor uses from a binding response
+type STUNResponse struct {
+	Mapped *net.UDPAddr // Address the server saw the request from
+	Other  *net.UDPAddr // Alternate address of the server (OTHER-ADDRESS or CHANGED-ADDRESS), nil if it has none
+	Source net.Addr     // Address the response came from
+}
+
+// parseSTUNAddress decodes a (XOR-)MAPPED-ADDRESS attribute value
+func parseSTUNAddress(value []byte, xor bool, txid []byte) *net.UDPAddr {
+	if len(value) < 8 {
+		return nil
+	}
+	port := binary.BigEndian.Uint16(value[2:4])
+	ip := append(net.IP(nil), value[4:]...)
+	switch {
+	case value[1] == 1 && len(ip) == 4:
+	case value[1] == 2 && len(ip) == 16:
+	default:
+		return nil
+	}
+
+	// XOR with the magic cookie, followed by the transaction ID for IPv6
+	if xor {
+		port ^= stunMagicCookie >> 16
+		mask := binary.BigEndian.AppendUint32(nil, stunMagicCookie)
+		mask = append(mask, txid...)
+		for i := range ip {
+			ip[i] ^= mask[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
+
+// parseSTUNAttributes decodes the addresses in the attributes of a binding
+// response. XOR-MAPPED-ADDRESS is preferred, MAPPED-ADDRESS is what old
+// servers send. A truncated attribute ends the list.
+func parseSTUNAttributes(attrs []byte, txid []byte) STUNResponse {
+	var response STUNResponse
+	for len(attrs) >= 4 {
+		kind, length := binary.BigEndian.Uint16(attrs[0:2]), int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+length > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+length]
+		attrs = attrs[min(4+(length+3)/4*4, len(attrs)):]
+		switch kind {
+		case stunAttrXORMapped:
+			if mapped := parseSTUNAddress(value, true, txid); mapped != nil {
+				response.Mapped = mapped
+			}
+		case stunAttrMapped:
+			if response.Mapped == nil {
+				response.Mapped = parseSTUNAddress(value, false, txid)
+			}
+		case stunAttrOtherAddress, stunAttrChangedAddress:
+			response.Other = parseSTUNAddress(value, false, txid)
+		}
+	}
+	return response
+}
+
+// STUNBinding sends a binding request to a STUN server and returns the
+// address the server saw it from, i.e. the public mapping of conn
+func STUNBinding(ctx context.Context, conn net.PacketConn, server net.Addr) (*net.UDPAddr, error) {
+	response, err := STUNRequest(ctx, conn, server, 0)
+	if err != nil {
+		return nil, err
+	}
+	return response.Mapped, nil
+}
+
+// STUNRequest sends a binding request, with a CHANGE-REQUEST attribute
+// when change is not 0, until a response arrives or ctx ends
+func STUNRequest(ctx context.Context, conn net.PacketConn, server net.Addr, change uint32) (STUNResponse, error) {
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	rand.Read(request[8:20])
+	txid := request[8:20]
+	if change != 0 {
+		request = binary.BigEndian.AppendUint16(request, stunAttrChangeRequest)
+		request = binary.BigEndian.AppendUint16(request, 4)
+		request = binary.BigEndian.AppendUint32(request, change)
+		binary.BigEndian.PutUint16(request[2:4], uint16(len(request)-20))
+	}
+
+	buf := make([]byte, 1500)
+	for ctx.Err() == nil {
+		if _, err := conn.WriteTo(request, server); err != nil {
+			return STUNResponse{}, err
+		}
+		deadline := time.Now().Add(stunRetransmit)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				break // Send again
+			}
+			msg := buf[:n]
+			if len(msg) < 20 || binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse || string(msg[8:20]) != string(txid) {
+				continue
+			}
+
+			response := parseSTUNAttributes(msg[20:], txid)
+			if response.Mapped == nil {
+				return STUNResponse{}, errors.New("STUN response without a mapped address")
+			}
+			response.Source = from
+			return response, nil
+		}
+	}
+	return STUNResponse{}, ErrNoSTUNResponse
+}
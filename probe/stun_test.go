@@ -0,0 +1,319 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// rfc5769TxID is the transaction ID of the sample responses of RFC 5769
+var rfc5769TxID = []byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+
+// rfc5769IPv4Response is the attributes of the sample IPv4 response of
+// RFC 5769 section 2.2: SOFTWARE, XOR-MAPPED-ADDRESS 192.0.2.1:32853,
+// MESSAGE-INTEGRITY and FINGERPRINT
+var rfc5769IPv4Response = []byte{
+	0x80, 0x22, 0x00, 0x0b, 0x74, 0x65, 0x73, 0x74, 0x20, 0x76, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x20,
+	0x00, 0x20, 0x00, 0x08, 0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43,
+	0x00, 0x08, 0x00, 0x14, 0x2b, 0x91, 0xf5, 0x99, 0xfd, 0x9e, 0x90, 0xc3, 0x8c, 0x74, 0x89, 0xf9, 0x2a, 0xf9, 0xba, 0x53, 0xf0, 0x6b, 0xe7, 0xd7,
+	0x80, 0x28, 0x00, 0x04, 0xc0, 0x7d, 0x4c, 0x96,
+}
+
+// rfc5769IPv6Mapped is the XOR-MAPPED-ADDRESS value of the sample IPv6
+// response of RFC 5769 section 2.3: [2001:db8:1234:5678:11:2233:4455:6677]:32853
+var rfc5769IPv6Mapped = []byte{
+	0x00, 0x02, 0xa1, 0x47,
+	0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79, 0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+}
+
+// stunAttribute encodes one attribute padded to a multiple of four bytes
+func stunAttribute(kind uint16, value []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, kind)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestParseSTUNAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		xor   bool
+		want  string
+	}{
+		{name: "XOR IPv4 (RFC 5769)", value: rfc5769IPv4Response[20:28], xor: true, want: "192.0.2.1:32853"},
+		{name: "XOR IPv6 (RFC 5769)", value: rfc5769IPv6Mapped, xor: true, want: "[2001:db8:1234:5678:11:2233:4455:6677]:32853"},
+		{name: "plain IPv4", value: []byte{0, 1, 0x0d, 0x96, 203, 0, 113, 7}, want: "203.0.113.7:3478"},
+		{name: "plain IPv6", value: append([]byte{0, 2, 0x0d, 0x96}, net.ParseIP("2001:db8::1")...), want: "[2001:db8::1]:3478"},
+		{name: "empty", value: nil},
+		{name: "header only", value: []byte{0, 1, 0x0d, 0x96}},
+		{name: "IPv4 cut short", value: []byte{0, 1, 0x0d, 0x96, 203, 0, 113}},
+		{name: "IPv6 cut short", value: rfc5769IPv6Mapped[:12], xor: true},
+		{name: "IPv4 family with IPv6 length", value: append([]byte{0, 1, 0x0d, 0x96}, make([]byte, 16)...)},
+		{name: "unknown family", value: []byte{0, 3, 0x0d, 0x96, 203, 0, 113, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := append([]byte(nil), tt.value...)
+			got := parseSTUNAddress(value, tt.xor, rfc5769TxID)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("parseSTUNAddress() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Errorf("parseSTUNAddress() = %v, want %s", got, tt.want)
+			}
+			if string(value) != string(tt.value) {
+				t.Errorf("parseSTUNAddress modified the attribute value")
+			}
+		})
+	}
+}
+
+func TestParseSTUNAttributes(t *testing.T) {
+	plain := []byte{0, 1, 0x0d, 0x96, 198, 51, 100, 9}
+	tests := []struct {
+		name   string
+		attrs  []byte
+		mapped string
+		other  string
+	}{
+		{name: "RFC 5769 IPv4 response", attrs: rfc5769IPv4Response, mapped: "192.0.2.1:32853"},
+		{name: "RFC 5769 IPv6 mapping", attrs: stunAttribute(stunAttrXORMapped, rfc5769IPv6Mapped), mapped: "[2001:db8:1234:5678:11:2233:4455:6677]:32853"},
+		{name: "MAPPED-ADDRESS of old servers", attrs: stunAttribute(stunAttrMapped, plain), mapped: "198.51.100.9:3478"},
+		{
+			name:   "XOR-MAPPED-ADDRESS preferred",
+			attrs:  append(stunAttribute(stunAttrMapped, plain), stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28])...),
+			mapped: "192.0.2.1:32853",
+		},
+		{
+			name:   "invalid XOR-MAPPED-ADDRESS keeps MAPPED-ADDRESS",
+			attrs:  append(stunAttribute(stunAttrMapped, plain), stunAttribute(stunAttrXORMapped, []byte{0, 9, 0, 0, 1, 2, 3, 4})...),
+			mapped: "198.51.100.9:3478",
+		},
+		{
+			name:   "OTHER-ADDRESS",
+			attrs:  append(stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28]), stunAttribute(stunAttrOtherAddress, plain)...),
+			mapped: "192.0.2.1:32853",
+			other:  "198.51.100.9:3478",
+		},
+		{
+			name:  "CHANGED-ADDRESS",
+			attrs: stunAttribute(stunAttrChangedAddress, plain),
+			other: "198.51.100.9:3478",
+		},
+		{name: "empty", attrs: nil},
+		{name: "header cut short", attrs: []byte{0x00, 0x20, 0x00}},
+		{name: "value cut short", attrs: stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28])[:10]},
+		{
+			name:   "attribute after the padding cut short",
+			attrs:  append(stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28]), 0x80, 0x2c, 0x00, 0x08, 198),
+			mapped: "192.0.2.1:32853",
+		},
+		{
+			name:   "padding skipped",
+			attrs:  append(stunAttribute(0x8022, []byte("a")), stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28])...),
+			mapped: "192.0.2.1:32853",
+		},
+		{
+			name:   "unpadded last attribute",
+			attrs:  append(stunAttribute(stunAttrXORMapped, rfc5769IPv4Response[20:28]), 0x80, 0x22, 0x00, 0x01, 'a'),
+			mapped: "192.0.2.1:32853",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := parseSTUNAttributes(tt.attrs, rfc5769TxID)
+			if got := addrString(response.Mapped); got != tt.mapped {
+				t.Errorf("mapped %q, want %q", got, tt.mapped)
+			}
+			if got := addrString(response.Other); got != tt.other {
+				t.Errorf("other %q, want %q", got, tt.other)
+			}
+		})
+	}
+}
+
+// addrString formats an optional address ("" for nil)
+func addrString(addr *net.UDPAddr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestSTUNBinding(t *testing.T) {
+	server, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	defer server.Close()
+
+	// A server answering with the XOR-mapped source address, after ignoring
+	// the first request to exercise the retransmission
+	go func() {
+		buf := make([]byte, 1500)
+		for seen := 0; ; seen++ {
+			n, from, err := server.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if seen == 0 || n < 20 {
+				continue
+			}
+			addr := from.(*net.UDPAddr)
+			value := []byte{0, 1}
+			value = binary.BigEndian.AppendUint16(value, uint16(addr.Port)^stunMagicCookie>>16)
+			value = binary.BigEndian.AppendUint32(value, binary.BigEndian.Uint32(addr.IP.To4())^stunMagicCookie)
+			attrs := stunAttribute(stunAttrXORMapped, value)
+			response := binary.BigEndian.AppendUint16(nil, stunBindingResponse)
+			response = binary.BigEndian.AppendUint16(response, uint16(len(attrs)))
+			response = append(response, buf[4:20]...)
+			server.WriteTo(append(response, attrs...), from)
+		}
+	}()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	mapped, err := STUNBinding(ctx, conn, server.LocalAddr())
+	if err != nil {
+		t.Fatalf("STUNBinding: %v", err)
+	}
+	if mapped.String() != conn.LocalAddr().String() {
+		t.Errorf("mapped %v, want %v", mapped, conn.LocalAddr())
+	}
+}
+
+// stunTestServer is an RFC 5780 server on two loopback ports: it returns
+// the XOR-mapped source and names the second port as OTHER-ADDRESS, and
+// answers a CHANGE-REQUEST for the port from the second port
+type stunTestServer struct {
+	primary, alternate net.PacketConn
+	change             chan uint32 // CHANGE-REQUEST flags of each request (0 without one)
+}
+
+// newSTUNTestServer starts the server, or skips the test without loopback UDP
+func newSTUNTestServer(t *testing.T) *stunTestServer {
+	primary, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	alternate, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		primary.Close()
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	s := &stunTestServer{primary: primary, alternate: alternate, change: make(chan uint32, 16)}
+	t.Cleanup(func() {
+		primary.Close()
+		alternate.Close()
+	})
+	go s.serve()
+	return s
+}
+
+// serve answers binding requests on the primary port
+func (s *stunTestServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.primary.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 20 {
+			continue
+		}
+		request := buf[:n]
+		var change uint32
+		if n >= 28 && binary.BigEndian.Uint16(request[20:22]) == stunAttrChangeRequest && binary.BigEndian.Uint16(request[22:24]) == 4 {
+			change = binary.BigEndian.Uint32(request[24:28])
+		}
+		s.change <- change
+
+		addr := from.(*net.UDPAddr)
+		mapped := []byte{0, 1}
+		mapped = binary.BigEndian.AppendUint16(mapped, uint16(addr.Port)^stunMagicCookie>>16)
+		mapped = binary.BigEndian.AppendUint32(mapped, binary.BigEndian.Uint32(addr.IP.To4())^stunMagicCookie)
+		other := []byte{0, 1}
+		other = binary.BigEndian.AppendUint16(other, uint16(s.alternate.LocalAddr().(*net.UDPAddr).Port))
+		other = append(other, 127, 0, 0, 1)
+		attrs := append(stunAttribute(stunAttrXORMapped, mapped), stunAttribute(stunAttrOtherAddress, other)...)
+
+		response := binary.BigEndian.AppendUint16(nil, stunBindingResponse)
+		response = binary.BigEndian.AppendUint16(response, uint16(len(attrs)))
+		response = append(response, request[4:20]...)
+		response = append(response, attrs...)
+		switch {
+		case change&STUNChangeIP != 0:
+			// Loopback has no alternate IP: like a filtering NAT, drop it
+		case change&STUNChangePort != 0:
+			s.alternate.WriteTo(response, from)
+		default:
+			s.primary.WriteTo(response, from)
+		}
+	}
+}
+
+func TestSTUNRequestChange(t *testing.T) {
+	server := newSTUNTestServer(t)
+	primaryPort := server.primary.LocalAddr().(*net.UDPAddr).Port
+	alternatePort := server.alternate.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name       string
+		change     uint32
+		sourcePort int // Port the response comes from (0 when none arrives)
+	}{
+		{name: "plain binding", change: 0, sourcePort: primaryPort},
+		{name: "change port", change: STUNChangePort, sourcePort: alternatePort},
+		{name: "change IP and port", change: STUNChangeIP | STUNChangePort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			response, err := STUNRequest(ctx, conn, server.primary.LocalAddr(), tt.change)
+			if got := <-server.change; got != tt.change {
+				t.Errorf("server saw CHANGE-REQUEST %#x, want %#x", got, tt.change)
+			}
+			if tt.sourcePort == 0 {
+				if err != ErrNoSTUNResponse {
+					t.Fatalf("err = %v, want ErrNoSTUNResponse", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("STUNRequest: %v", err)
+			}
+			if response.Mapped.String() != conn.LocalAddr().String() {
+				t.Errorf("mapped %v, want %v", response.Mapped, conn.LocalAddr())
+			}
+			if response.Other == nil || response.Other.Port != alternatePort {
+				t.Errorf("other %v, want port %d", response.Other, alternatePort)
+			}
+			if source := response.Source.(*net.UDPAddr); source.Port != tt.sourcePort {
+				t.Errorf("response from port %d, want %d", source.Port, tt.sourcePort)
+			}
+		})
+	}
+}
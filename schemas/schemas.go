@@ -0,0 +1,10 @@
+// Package schemas embeds the published JSON Schemas of the noc-watch
+// configuration, result records and config files.
+package schemas
+
+import "embed"
+
+// Files holds every *.schema.json file of this directory
+//
+//go:embed *.json
+var Files embed.FS
@@ -0,0 +1,114 @@
+// Package storage persists what a monitor measures: the history database,
+// the JSON Lines output, Parquet archives and the signatures of log blocks.
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/marokiki/noc-watch/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+// History persists test results so the history survives restarts. Results
+// are kept as JSON per kind (a database bucket) and ordered by time.
+type History struct {
+	db *bolt.DB // Database keyed by result timestamp per kind
+}
+
+// HistoryPath returns HISTORY_DB, defaulting to a database next to the
+// log file; "off" disables persistence
+func HistoryPath(s *config.Settings, logFile string) string {
+	path := s.String("HISTORY_DB", filepath.Join(filepath.Dir(logFile), "noc-watch.db"))
+	if path == "off" {
+		return ""
+	}
+	return path
+}
+
+// OpenHistory opens or creates the history database with a bucket for each
+// kind. Another instance holding the database makes it fail after a second
+// instead of blocking.
+func OpenHistory(path string, kinds ...string) (*History, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range kinds {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &History{db: db}, nil
+}
+
+// historyKey orders results by time within a bucket
+func historyKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Save stores a result of the given kind taken at the given time
+func (h *History) Save(kind string, at time.Time, result any) error {
+	value, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(kind)).Put(historyKey(at), value)
+	})
+}
+
+// Load decodes the results of a kind taken after the cutoff, in time
+// order, into the slice results points to
+func (h *History) Load(kind string, cutoff time.Time, results any) error {
+	var values [][]byte
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(kind)).Cursor()
+		for k, v := c.Seek(historyKey(cutoff)); k != nil; k, v = c.Next() {
+			values = append(values, bytes.Clone(v))
+		}
+		return nil
+	})
+	if err != nil || len(values) == 0 {
+		return err
+	}
+	list := append([]byte{'['}, bytes.Join(values, []byte{','})...)
+	return json.Unmarshal(append(list, ']'), results)
+}
+
+// Prune deletes the results of every kind taken before the cutoff and
+// returns how many were deleted
+func (h *History) Prune(cutoff time.Time) (int, error) {
+	deleted := 0
+	end := historyKey(cutoff)
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, bucket *bolt.Bucket) error {
+			c := bucket.Cursor()
+			for k, _ := c.First(); k != nil && string(k) < string(end); k, _ = c.Next() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				deleted++
+			}
+			return nil
+		})
+	})
+	return deleted, err
+}
+
+// Close closes the history database
+func (h *History) Close() error {
+	return h.db.Close()
+}
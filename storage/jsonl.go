@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// JSONLStdout selects standard output as the JSON Lines destination
+const JSONLStdout = "-"
+
+// JSONLRecord encodes one result as a JSON object with its fields at the
+// top level next to the given fields (probe type, interface), so every line
+// can be parsed without knowing the probe
+func JSONLRecord(result any, fields map[string]any) ([]byte, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	record := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep nanosecond durations exact
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		record[key] = value
+	}
+	return json.Marshal(record)
+}
+
+// AppendJSONL appends a record as one line to the JSON Lines file at path,
+// or writes it to standard output when path is JSONLStdout
+func AppendJSONL(path string, record []byte) error {
+	line := append(record, '\n')
+	if path == JSONLStdout {
+		_, err := os.Stdout.Write(line)
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(line)
+	return err
+}
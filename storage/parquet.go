@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Parquet physical types, converted types and enums used by the writer
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetRequired      = 0
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+	parquetDataPage      = 0
+	parquetUncompressed  = 0
+)
+
+// ParquetColumn is one required, flat column of a Parquet file
+type ParquetColumn struct {
+	Name    string      // Column name
+	Int64s  []int64     // Values of an INT64 column
+	Doubles []float64   // Values of a DOUBLE column
+	Strings []string    // Values of a UTF8 BYTE_ARRAY column
+	Times   []time.Time // Values of a millisecond timestamp column
+}
+
+// physicalType returns the Parquet type and converted type of the column
+func (c ParquetColumn) physicalType() (int32, int32) {
+	switch {
+	case c.Times != nil:
+		return parquetInt64, parquetConvertedTimestampMillis
+	case c.Doubles != nil:
+		return parquetDouble, -1
+	case c.Strings != nil:
+		return parquetByteArray, parquetConvertedUTF8
+	default:
+		return parquetInt64, -1
+	}
+}
+
+// plainValues encodes the column values with the PLAIN encoding
+func (c ParquetColumn) plainValues() ([]byte, int) {
+	var buf bytes.Buffer
+	switch {
+	case c.Times != nil:
+		for _, t := range c.Times {
+			binary.Write(&buf, binary.LittleEndian, t.UnixMilli())
+		}
+		return buf.Bytes(), len(c.Times)
+	case c.Doubles != nil:
+		for _, v := range c.Doubles {
+			binary.Write(&buf, binary.LittleEndian, math.Float64bits(v))
+		}
+		return buf.Bytes(), len(c.Doubles)
+	case c.Strings != nil:
+		for _, s := range c.Strings {
+			binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		}
+		return buf.Bytes(), len(c.Strings)
+	default:
+		for _, v := range c.Int64s {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+		return buf.Bytes(), len(c.Int64s)
+	}
+}
+
+// EncodeParquet writes the columns as a single row group, one uncompressed
+// PLAIN data page per column. This covers the flat aggregate tables the
+// archiver produces without pulling in a full Parquet implementation.
+func EncodeParquet(columns []ParquetColumn) ([]byte, error) {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	rows := -1
+	var chunks []func(*thriftWriter)
+	var totalSize int64
+	for _, column := range columns {
+		values, count := column.plainValues()
+		if rows >= 0 && count != rows {
+			return nil, fmt.Errorf("column %s has %d values, expected %d", column.Name, count, rows)
+		}
+		rows = count
+
+		// Page header followed by the page data
+		header := newThriftWriter()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.structBegin(5)
+		header.i32(1, int32(count))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.stop()
+
+		offset := int64(file.Len())
+		file.Write(header.bytes())
+		file.Write(values)
+		size := int64(file.Len()) - offset
+		totalSize += size
+
+		kind, _ := column.physicalType()
+		name := column.Name
+		chunks = append(chunks, func(t *thriftWriter) {
+			t.i64(2, offset)
+			t.structBegin(3)
+			t.i32(1, kind)
+			t.listBegin(2, thriftI32, 1)
+			t.varint(zigzag(parquetEncodingPlain))
+			t.listBegin(3, thriftBinary, 1)
+			t.binaryValue(name)
+			t.i32(4, parquetUncompressed)
+			t.i64(5, int64(count))
+			t.i64(6, size)
+			t.i64(7, size)
+			t.i64(9, offset)
+			t.structEnd()
+		})
+	}
+	if rows < 0 {
+		rows = 0
+	}
+
+	// FileMetaData: schema root followed by one element per column
+	meta := newThriftWriter()
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(columns)+1)
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.elementEnd()
+	for _, column := range columns {
+		kind, converted := column.physicalType()
+		meta.i32(1, kind)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, column.Name)
+		if converted >= 0 {
+			meta.i32(6, converted)
+		}
+		meta.elementEnd()
+	}
+	meta.listEnd()
+	meta.i64(3, int64(rows))
+	meta.listBegin(4, thriftStruct, 1)
+	meta.listBegin(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		chunk(meta)
+		meta.elementEnd()
+	}
+	meta.listEnd()
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(rows))
+	meta.elementEnd()
+	meta.listEnd()
+	meta.binary(6, "noc-watch")
+	meta.stop()
+
+	file.Write(meta.bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(len(meta.bytes())))
+	file.WriteString("PAR1")
+	return file.Bytes(), nil
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol used by
+// Parquet metadata. Field IDs are delta encoded per nesting level.
+type thriftWriter struct {
+	buf  bytes.Buffer // Encoded output
+	last []int16      // Last field ID written at each struct nesting level
+}
+
+// newThriftWriter starts encoding a top-level struct
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+// bytes returns the encoded output
+func (t *thriftWriter) bytes() []byte {
+	return t.buf.Bytes()
+}
+
+// varint writes an unsigned LEB128 integer
+func (t *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		t.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	t.buf.WriteByte(byte(v))
+}
+
+// zigzag maps signed integers to unsigned ones for varint encoding
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// field writes a field header for the given ID and type
+func (t *thriftWriter) field(id int16, kind byte) {
+	level := len(t.last) - 1
+	if delta := id - t.last[level]; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.buf.WriteByte(kind)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last[level] = id
+}
+
+// i32 writes an i32 field
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+// i64 writes an i64 field
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+// binary writes a string field
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binaryValue(s)
+}
+
+// binaryValue writes a length-prefixed string without a field header
+func (t *thriftWriter) binaryValue(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// listBegin writes a list field header. Struct elements are then written
+// field by field, each closed with elementEnd, and the list with listEnd.
+func (t *thriftWriter) listBegin(id int16, elem byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.varint(uint64(size))
+	}
+	if elem == thriftStruct {
+		t.last = append(t.last, 0)
+	}
+}
+
+// elementEnd closes one struct element of a list
+func (t *thriftWriter) elementEnd() {
+	t.buf.WriteByte(0)
+	t.last[len(t.last)-1] = 0
+}
+
+// listEnd closes a list of structs
+func (t *thriftWriter) listEnd() {
+	t.last = t.last[:len(t.last)-1]
+}
+
+// structBegin writes a nested struct field
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.last = append(t.last, 0)
+}
+
+// structEnd closes a nested struct field
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// stop closes the top-level struct
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestEncodeParquetRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	columns := []ParquetColumn{
+		{Name: "window_start", Times: []time.Time{at, at.Add(time.Hour), at.Add(2 * time.Hour)}},
+		{Name: "target", Strings: []string{"8.8.8.8", "会議室", ""}},
+		{Name: "tests", Int64s: []int64{60, 0, -1}},
+		{Name: "latency_ms", Doubles: []float64{12.5, 0, 1e9}},
+	}
+	data, err := EncodeParquet(columns)
+	if err != nil {
+		t.Fatalf("EncodeParquet: %v", err)
+	}
+
+	file, err := buffer.NewBufferFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatalf("read footer: %v", err)
+	}
+	defer pr.ReadStop()
+	if rows := pr.GetNumRows(); rows != 3 {
+		t.Errorf("%d rows, want 3", rows)
+	}
+
+	schema := pr.Footer.Schema
+	if len(schema) != len(columns)+1 || schema[0].GetNumChildren() != int32(len(columns)) {
+		t.Fatalf("schema %v, want a root with %d columns", schema, len(columns))
+	}
+	wantTypes := []struct {
+		kind      parquet.Type
+		converted *parquet.ConvertedType
+	}{
+		{kind: parquet.Type_INT64, converted: parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MILLIS)},
+		{kind: parquet.Type_BYTE_ARRAY, converted: parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)},
+		{kind: parquet.Type_INT64},
+		{kind: parquet.Type_DOUBLE},
+	}
+	for i, want := range wantTypes {
+		// The reader keeps the name in the file as the external name
+		element, name := schema[i+1], pr.SchemaHandler.Infos[i+1].ExName
+		if name != columns[i].Name || element.GetType() != want.kind || element.GetRepetitionType() != parquet.FieldRepetitionType_REQUIRED {
+			t.Errorf("column %d is %s %v %v, want required %s %v", i, name, element.GetType(), element.GetRepetitionType(), columns[i].Name, want.kind)
+		}
+		if !reflect.DeepEqual(element.ConvertedType, want.converted) {
+			t.Errorf("column %s converted type %v, want %v", name, element.ConvertedType, want.converted)
+		}
+	}
+
+	wantValues := [][]interface{}{
+		{at.UnixMilli(), at.Add(time.Hour).UnixMilli(), at.Add(2 * time.Hour).UnixMilli()},
+		{"8.8.8.8", "会議室", ""},
+		{int64(60), int64(0), int64(-1)},
+		{12.5, 0.0, 1e9},
+	}
+	for i, want := range wantValues {
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), 3)
+		if err != nil {
+			t.Fatalf("read column %s: %v", columns[i].Name, err)
+		}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("column %s = %v, want %v", columns[i].Name, values, want)
+		}
+	}
+}
+
+func TestEncodeParquetMismatchedColumns(t *testing.T) {
+	_, err := EncodeParquet([]ParquetColumn{
+		{Name: "a", Int64s: []int64{1, 2}},
+		{Name: "b", Doubles: []float64{1}},
+	})
+	if err == nil {
+		t.Error("EncodeParquet accepted columns of different lengths")
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marokiki/noc-watch/config"
+)
+
+// LogFooter terminates every result block in the log file
+const LogFooter = "=========================================="
+
+// ResultSigner signs log result blocks with an Ed25519 key. Each signature
+// covers a hash chain (SHA-256 of the previous chain value and the block),
+// so removing, reordering or editing any block breaks every later signature.
+type ResultSigner struct {
+	key   ed25519.PrivateKey // Agent signing key
+	chain [sha256.Size]byte  // Chain value of the last signed block
+	seq   int                // Number of blocks signed so far
+}
+
+// NewResultSigner loads the key from SIGNING_KEY and resumes the chain from
+// the last signature in the log file. It returns nil when signing is disabled.
+func NewResultSigner(s *config.Settings, logFile string) *ResultSigner {
+	path := s.Get("SIGNING_KEY")
+	if path == "" {
+		return nil
+	}
+
+	key, err := loadSigningKey(path)
+	if err != nil {
+		fmt.Printf("Error loading signing key: %v\n", err)
+		return nil
+	}
+
+	signer := &ResultSigner{key: key}
+	if file, err := os.Open(logFile); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if seq, chain, _, ok := parseSignatureLine(scanner.Text()); ok {
+				signer.seq, signer.chain = seq, chain
+			}
+		}
+	}
+	return signer
+}
+
+// Sign extends the chain with a block and returns its signature line
+func (s *ResultSigner) Sign(block []byte) string {
+	s.chain = sha256.Sum256(append(s.chain[:], block...))
+	s.seq++
+	sig := ed25519.Sign(s.key, s.chain[:])
+	return fmt.Sprintf("Signature: seq=%d chain=%s sig=%s", s.seq, hex.EncodeToString(s.chain[:]),
+		base64.StdEncoding.EncodeToString(sig))
+}
+
+// parseSignatureLine extracts the fields of a "Signature:" log line
+func parseSignatureLine(line string) (seq int, chain [sha256.Size]byte, sig []byte, ok bool) {
+	rest, found := strings.CutPrefix(line, "Signature: ")
+	if !found {
+		return 0, chain, nil, false
+	}
+
+	var chainHex, sigB64 string
+	if _, err := fmt.Sscanf(rest, "seq=%d chain=%s sig=%s", &seq, &chainHex, &sigB64); err != nil {
+		return 0, chain, nil, false
+	}
+	raw, err := hex.DecodeString(chainHex)
+	if err != nil || len(raw) != sha256.Size {
+		return 0, chain, nil, false
+	}
+	copy(chain[:], raw)
+	sig, err = base64.StdEncoding.DecodeString(sigB64)
+	return seq, chain, sig, err == nil
+}
+
+// VerifyLog checks every signed block of a log file and returns the number of
+// verified blocks. Unsigned blocks are only accepted before the first
+// signature, where they were written before signing was enabled. After it,
+// every block must end with its signature and the file with a complete
+// block, so inserted or cut off content fails like edited content.
+func VerifyLog(content []byte, pub ed25519.PublicKey) (int, error) {
+	var prev [sha256.Size]byte
+	verified, blockStart, offset := 0, 0, 0
+	signed := false // The previous line was a verified signature
+
+	for offset < len(content) {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += offset + 1
+		}
+		line := strings.TrimRight(string(content[offset:end]), "\n")
+
+		if seq, chain, sig, ok := parseSignatureLine(line); ok {
+			expected := sha256.Sum256(append(prev[:], content[blockStart:offset]...))
+			if expected != chain {
+				return verified, fmt.Errorf("block seq=%d: content or order does not match the hash chain", seq)
+			}
+			if !ed25519.Verify(pub, chain[:], sig) {
+				return verified, fmt.Errorf("block seq=%d: invalid signature", seq)
+			}
+			prev = chain
+			verified++
+			signed = true
+		} else if line == LogFooter {
+			if verified > 0 && !signed {
+				return verified, fmt.Errorf("unsigned block after %d signed blocks", verified)
+			}
+			blockStart = end
+			signed = false
+		} else {
+			signed = false
+		}
+		offset = end
+	}
+	if verified > 0 && blockStart < len(content) {
+		return verified, fmt.Errorf("unsigned or incomplete content after %d signed blocks", verified)
+	}
+	return verified, nil
+}
+
+// loadSigningKey reads a PKCS#8 PEM Ed25519 private key
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not Ed25519")
+	}
+	return edKey, nil
+}
+
+// LoadVerifyKey reads a PKIX PEM Ed25519 public key
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("verify key is not Ed25519")
+	}
+	return edKey, nil
+}
+
+// GenerateSigningKey writes a new Ed25519 key pair to path and path.pub
+func GenerateSigningKey(path string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+}
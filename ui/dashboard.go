@@ -0,0 +1,19 @@
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardFiles holds the web dashboard served next to the REST API
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// DashboardHandler serves the web dashboard. The page itself holds no data;
+// it loads everything from the API with the #token= it was opened with.
+func DashboardHandler() http.Handler {
+	files, _ := fs.Sub(dashboardFiles, "dashboard")
+	return http.FileServer(http.FS(files))
+}
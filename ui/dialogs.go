@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Table is the content of a table: a header row and the rows below it
+type Table struct {
+	Title      string     // Border title (dialogs only)
+	Headers    []string   // Header cells, in yellow
+	Rows       [][]string // Cells below the header, shown as is
+	Red        []bool     // Rows shown in red, by index into Rows
+	AlignRight bool       // Right-align every column but the first
+}
+
+// fill replaces the cells of a tview table with the content
+func (c Table) fill(table *tview.Table) {
+	table.Clear()
+	for i, header := range c.Headers {
+		table.SetCell(0, i, tview.NewTableCell(header).
+			SetTextColor(tcell.ColorYellow).SetSelectable(false).SetExpansion(1))
+	}
+	for r, row := range c.Rows {
+		for i, text := range row {
+			cell := tview.NewTableCell(tview.Escape(text)).SetExpansion(1)
+			if c.AlignRight && i > 0 {
+				cell.SetAlign(tview.AlignRight)
+			}
+			if r < len(c.Red) && c.Red[r] {
+				cell.SetTextColor(tcell.ColorRed)
+			}
+			table.SetCell(r+1, i, cell)
+		}
+	}
+}
+
+// SetTable replaces the content of the per-target table on the dashboard
+func (t *TUI) SetTable(content Table) {
+	content.fill(t.table)
+}
+
+// Close removes the dialog of the given name
+func (t *TUI) Close(name string) {
+	t.pages.RemovePage(name)
+}
+
+// ShowMessage opens a dialog showing text with an OK button
+func (t *TUI) ShowMessage(name, text string) {
+	modal := tview.NewModal().
+		SetText(tview.Escape(text)).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(int, string) { t.Close(name) })
+	t.pages.AddPage(name, modal, true, true)
+}
+
+// ShowText opens a scrollable view of text; Esc closes it
+func (t *TUI) ShowText(name, title, text string) {
+	view := tview.NewTextView().SetText(text)
+	view.SetBorder(true).SetTitle(title)
+	view.SetDoneFunc(func(tcell.Key) { t.Close(name) })
+	t.pages.AddPage(name, view, true, true)
+}
+
+// ShowTable opens a table; Esc closes it. With selected set the rows can
+// be selected, and Enter calls selected with the index into content.Rows.
+func (t *TUI) ShowTable(name string, content Table, selected func(row int)) {
+	table := tview.NewTable().SetFixed(1, 0).SetSelectable(selected != nil, false)
+	table.SetBorder(true).SetTitle(content.Title)
+	table.SetDoneFunc(func(tcell.Key) { t.Close(name) })
+	content.fill(table)
+	if selected != nil {
+		table.SetSelectedFunc(func(row, _ int) {
+			if row >= 1 && row <= len(content.Rows) {
+				selected(row - 1)
+			}
+		})
+	}
+	t.pages.AddPage(name, table, true, true)
+}
+
+// Field is an input field of a form
+type Field struct {
+	Label string // Label, also the key of its value
+	Value string // Initial text
+	Width int    // Field width in characters
+}
+
+// Form is an open form dialog
+type Form struct {
+	form *tview.Form // Form widget
+}
+
+// Value returns the text of the field with the given label
+func (f *Form) Value(label string) string {
+	return f.form.GetFormItemByLabel(label).(*tview.InputField).GetText()
+}
+
+// SetError shows message in the title of the form
+func (f *Form) SetError(message string) {
+	f.form.SetTitle(" " + message + " ")
+}
+
+// ShowForm opens a form centered over the dashboard. Pressing button calls
+// submit, and the form stays open until submit closes it with Close;
+// Cancel and Esc close it.
+func (t *TUI) ShowForm(name, title string, fields []Field, button string, submit func(f *Form)) {
+	f := &Form{form: tview.NewForm()}
+	for _, field := range fields {
+		f.form.AddInputField(field.Label, field.Value, field.Width, nil, nil)
+	}
+	closeForm := func() { t.Close(name) }
+	f.form.AddButton(button, func() { submit(f) })
+	f.form.AddButton("Cancel", closeForm)
+	f.form.SetCancelFunc(closeForm)
+	f.form.SetBorder(true).SetTitle(title)
+
+	// Center the dialog over the dashboard
+	dialog := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(f.form, 2*len(fields)+5, 0, true).
+			AddItem(nil, 0, 1, false), 60, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	t.pages.AddPage(name, dialog, true, true)
+}
@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+func TestTableFill(t *testing.T) {
+	content := Table{
+		Headers:    []string{"Target", "Loss"},
+		Rows:       [][]string{{"[red]gw", "0.0%"}, {"8.8.8.8", "100.0%"}},
+		Red:        []bool{false, true},
+		AlignRight: true,
+	}
+	table := tview.NewTable()
+	table.SetCell(5, 5, tview.NewTableCell("stale"))
+	content.fill(table)
+
+	if rows, columns := table.GetRowCount(), table.GetColumnCount(); rows != 3 || columns != 2 {
+		t.Fatalf("table is %dx%d, want 3x2 without stale cells", rows, columns)
+	}
+
+	tests := []struct {
+		name      string
+		row, col  int
+		text      string
+		color     tcell.Color
+		align     int
+		selection bool
+	}{
+		{name: "header", row: 0, col: 1, text: "Loss", color: tcell.ColorYellow, align: tview.AlignLeft},
+		{name: "escaped first column", row: 1, col: 0, text: "[red[]gw", color: tview.Styles.PrimaryTextColor, align: tview.AlignLeft, selection: true},
+		{name: "right-aligned value", row: 1, col: 1, text: "0.0%", color: tview.Styles.PrimaryTextColor, align: tview.AlignRight, selection: true},
+		{name: "red row", row: 2, col: 1, text: "100.0%", color: tcell.ColorRed, align: tview.AlignRight, selection: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cell := table.GetCell(tt.row, tt.col)
+			color, _, _ := cell.Style.Decompose()
+			if cell.Text != tt.text || color != tt.color || cell.Align != tt.align || cell.NotSelectable == tt.selection {
+				t.Errorf("cell = %q color %v align %d selectable %v, want %q color %v align %d selectable %v",
+					cell.Text, color, cell.Align, !cell.NotSelectable, tt.text, tt.color, tt.align, tt.selection)
+			}
+		})
+	}
+}
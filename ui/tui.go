@@ -0,0 +1,148 @@
+// Package ui is the terminal dashboard and the web dashboard of noc-watch.
+// The monitor renders the text of each pane (with tview color tags) and
+// decides what the keys do; the TUI owns the widgets, the layout and the
+// dialogs opened over the dashboard.
+package ui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// mainPage names the dashboard page under the dialogs
+const mainPage = "main"
+
+// Panes is the text of the dashboard panes
+type Panes struct {
+	Stats   string // Overall statistics, top right
+	Link    string // Interface and link summary, top left ("" keeps the current text)
+	Chart   string // Test result chart
+	Service string // Internal service checklist beside the chart (shown when enabled in New)
+	Log     string // Latest results and alerts, bottom
+}
+
+// TUI is the terminal dashboard. Its methods other than New, Bind, Run,
+// Stop and Queue must be called on the UI goroutine, i.e. from a key
+// binding or a function passed to Queue.
+type TUI struct {
+	app     *tview.Application // Application running the event loop
+	screen  tcell.Screen       // Terminal screen, used for clipboard access
+	pages   *tview.Pages       // Root container holding the dashboard and dialogs
+	stats   *tview.TextView    // Statistics pane
+	link    *tview.TextView    // Interface/link summary pane
+	table   *tview.Table       // Per-target table
+	chart   *tview.TextView    // Chart pane
+	service *tview.TextView    // Service checklist pane (nil when not shown)
+	log     *tview.TextView    // Log pane
+	keys    map[rune]func()    // Actions of the keybindings
+}
+
+// New creates the dashboard with its initial pane text. tableTitle names
+// the per-target table; withService shows the service checklist beside the
+// chart.
+func New(initial Panes, tableTitle string, withService bool) (*TUI, error) {
+	// Create the screen explicitly so keybindings can use its clipboard
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	t := &TUI{app: tview.NewApplication().SetScreen(screen), screen: screen, keys: make(map[rune]func())}
+
+	t.stats = newPane(tview.AlignCenter)
+	t.link = newPane(tview.AlignLeft)
+	t.chart = newPane(tview.AlignLeft)
+	t.log = newPane(tview.AlignLeft)
+	t.table = tview.NewTable().SetFixed(1, 1)
+	t.table.SetBorder(true).SetTitle(tableTitle)
+
+	// Show the service checklist next to the chart when services are configured
+	var middle tview.Primitive = t.chart
+	if withService {
+		t.service = newPane(tview.AlignLeft)
+		middle = tview.NewFlex().
+			AddItem(t.chart, 0, 2, false).
+			AddItem(t.service, 0, 1, false)
+	}
+	t.SetPanes(initial)
+
+	// Link summary pane beside the statistics
+	top := tview.NewFlex().
+		AddItem(t.link, 0, 1, false).
+		AddItem(t.stats, 0, 1, false)
+
+	flex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(top, 6, 1, false).
+		AddItem(t.table, 0, 1, false).
+		AddItem(middle, 0, 2, false).
+		AddItem(t.log, 15, 1, true)
+
+	// Pages let dialogs (e.g., the silence form) overlay the dashboard
+	t.pages = tview.NewPages().AddPage(mainPage, flex, true, true)
+	t.app.SetRoot(t.pages, true).SetInputCapture(t.handleKey)
+	return t, nil
+}
+
+// newPane creates a text pane with color tags
+func newPane(align int) *tview.TextView {
+	return tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(align)
+}
+
+// Bind runs action on the UI goroutine when key is pressed on the
+// dashboard. Call it before Run.
+func (t *TUI) Bind(key rune, action func()) {
+	t.keys[key] = action
+}
+
+// handleKey runs the keybindings. Keys are only handled while no dialog is
+// open so typing into forms is not intercepted.
+func (t *TUI) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if name, _ := t.pages.GetFrontPage(); name != mainPage {
+		return event
+	}
+	if action, ok := t.keys[event.Rune()]; ok {
+		action()
+		return nil
+	}
+	return event
+}
+
+// Run shows the dashboard until the user quits or Stop is called
+func (t *TUI) Run() error {
+	return t.app.Run()
+}
+
+// Stop closes the dashboard and makes Run return
+func (t *TUI) Stop() {
+	t.app.Stop()
+}
+
+// Queue runs f on the UI goroutine and redraws the screen afterwards
+func (t *TUI) Queue(f func()) {
+	t.app.QueueUpdateDraw(f)
+}
+
+// SetPanes replaces the text of the panes
+func (t *TUI) SetPanes(p Panes) {
+	t.stats.SetText(p.Stats)
+	if p.Link != "" {
+		t.link.SetText(p.Link)
+	}
+	t.chart.SetText(p.Chart)
+	if t.service != nil {
+		t.service.SetText(p.Service)
+	}
+	t.log.SetText(p.Log)
+}
+
+// Copy copies text to the clipboard with OSC 52, which also works over SSH
+func (t *TUI) Copy(text string) {
+	t.screen.SetClipboard([]byte(text))
+}
+
+// Escape escapes text so tview shows it as is inside pane text
+func Escape(text string) string {
+	return tview.Escape(text)
+}